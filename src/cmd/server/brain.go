@@ -0,0 +1,182 @@
+//go:build !test
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"miri-main/src/internal/config"
+	"miri-main/src/internal/engine/memory"
+	"miri-main/src/internal/storage"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// brainCommand is a brain archive command given on the command line.
+type brainCommand struct {
+	export  string
+	imprt   string
+	replace bool
+	diff    []string
+}
+
+// run exports, imports or diffs brain archives of the storage directory of cfg.
+// Archives are read from and written to stdin and stdout for "-".
+func (bc brainCommand) run(cfg *config.Config, stdout io.Writer) error {
+	ctx := context.Background()
+	if len(bc.diff) > 0 {
+		return bc.runDiff(ctx, cfg, stdout)
+	}
+	if bc.imprt != "" {
+		if pid, ok := runningPID(cfg.StorageDir); ok {
+			return fmt.Errorf("miri is running (pid %d), import through POST /api/admin/v1/brain/import instead", pid)
+		}
+	}
+
+	st, err := storage.New(cfg.StorageDir)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	stores, err := memory.OpenStores(cfg, st)
+	if err != nil {
+		return err
+	}
+
+	if bc.export != "" {
+		snap, err := stores.Export(ctx)
+		if err != nil {
+			return err
+		}
+		if err := writeArchive(bc.export, snap); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "exported %d facts, %d summaries and %d steps\n", len(snap.Facts), len(snap.Summaries), len(snap.Steps))
+		return nil
+	}
+
+	snap, err := readArchive(bc.imprt)
+	if err != nil {
+		return err
+	}
+	res, err := stores.Import(ctx, snap, bc.replace)
+	if err != nil {
+		return err
+	}
+	mode := "merged"
+	if res.Replace {
+		mode = fmt.Sprintf("replaced %d documents with", res.Removed)
+	}
+	fmt.Fprintf(stdout, "%s %d facts, %d summaries and %d steps\n", mode, res.Facts, res.Summaries, res.Steps)
+	return nil
+}
+
+// runDiff compares two archives, or the current brain to an archive.
+func (bc brainCommand) runDiff(ctx context.Context, cfg *config.Config, stdout io.Writer) error {
+	var from, to *memory.Snapshot
+	var err error
+	if len(bc.diff) == 2 {
+		if from, err = readArchive(bc.diff[0]); err != nil {
+			return err
+		}
+		if to, err = readArchive(bc.diff[1]); err != nil {
+			return err
+		}
+	} else {
+		st, err := storage.New(cfg.StorageDir)
+		if err != nil {
+			return err
+		}
+		defer st.Close()
+		stores, err := memory.OpenStores(cfg, st)
+		if err != nil {
+			return err
+		}
+		if from, err = stores.Export(ctx); err != nil {
+			return err
+		}
+		if to, err = readArchive(bc.diff[0]); err != nil {
+			return err
+		}
+	}
+
+	diff := memory.DiffSnapshots(from, to)
+	if diff.Empty() {
+		fmt.Fprintln(stdout, "no differences")
+		return nil
+	}
+	for _, c := range []struct {
+		name string
+		d    memory.CollectionDiff
+	}{{"facts", diff.Facts}, {"summaries", diff.Summaries}, {"steps", diff.Steps}} {
+		if c.d.Empty() {
+			continue
+		}
+		fmt.Fprintf(stdout, "%s: %d added, %d removed, %d changed\n", c.name, len(c.d.Added), len(c.d.Removed), len(c.d.Changed))
+		printIDs(stdout, "+", c.d.Added)
+		printIDs(stdout, "-", c.d.Removed)
+		printIDs(stdout, "~", c.d.Changed)
+	}
+	if diff.SoulChanged {
+		fmt.Fprintln(stdout, "soul.md changed")
+	}
+	if diff.HumanChanged {
+		fmt.Fprintln(stdout, "human.md changed")
+	}
+	return nil
+}
+
+func printIDs(w io.Writer, prefix string, ids []string) {
+	for _, id := range ids {
+		fmt.Fprintf(w, "  %s %s\n", prefix, id)
+	}
+}
+
+func readArchive(path string) (*memory.Snapshot, error) {
+	if path == "-" {
+		return memory.ReadSnapshot(os.Stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	snap, err := memory.ReadSnapshot(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return snap, nil
+}
+
+func writeArchive(path string, snap *memory.Snapshot) error {
+	if path == "-" {
+		return memory.WriteSnapshot(os.Stdout, snap)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := memory.WriteSnapshot(f, snap); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// runningPID returns the pid of the Miri running on storageDir, if any.
+func runningPID(storageDir string) (int, bool) {
+	pidBytes, err := os.ReadFile(filepath.Join(storageDir, "miri.pid"))
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(pidBytes)))
+	if err != nil || pid <= 0 {
+		return 0, false
+	}
+	p, _ := os.FindProcess(pid)
+	return pid, p.Signal(syscall.Signal(0)) == nil
+}
@@ -0,0 +1,88 @@
+//go:build !test
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"miri-main/src/internal/config"
+	"miri-main/src/internal/engine"
+	"miri-main/src/internal/storage"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runEval replays every cassette of dir through a fresh engine and reports, per
+// cassette, whether the final answer and the tool sequence match the recording.
+// The engine uses a temporary storage directory, so the templates of the working
+// tree are evaluated without touching the real memory. It returns the number of
+// cassettes that did not match.
+func runEval(cfg *config.Config, dir string, live bool, w io.Writer) (int, error) {
+	paths, err := engine.ListCassettes(dir)
+	if err != nil {
+		return 0, err
+	}
+	if len(paths) == 0 {
+		return 0, fmt.Errorf("no cassettes in %s", dir)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "miri-eval-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	evalCfg := *cfg
+	evalCfg.StorageDir = tmpDir
+	evalCfg.Agents.Cassettes = config.CassetteConfig{}
+	st, err := storage.New(tmpDir)
+	if err != nil {
+		return 0, err
+	}
+	defer st.Close()
+
+	provider, model, ok := strings.Cut(cfg.Agents.Defaults.Model.Primary, "/")
+	if !ok {
+		return 0, fmt.Errorf("invalid primary model %q, expected provider/model", cfg.Agents.Defaults.Model.Primary)
+	}
+	eng, err := engine.NewEinoEngine(&evalCfg, st, provider, model, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	failed := 0
+	for i, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		want, err := engine.LoadCassette(path)
+		if err != nil {
+			fmt.Fprintf(w, "FAIL  %s: %v\n", name, err)
+			failed++
+			continue
+		}
+
+		got := eng.ReplayCassette(context.Background(), fmt.Sprintf("eval-%d", i), want, live)
+		diff := engine.DiffCassettes(want, got)
+		switch {
+		case !diff.OK():
+			failed++
+			fmt.Fprintf(w, "FAIL  %s\n", name)
+			if diff.Error != "" {
+				fmt.Fprintf(w, "      error:  %s\n", diff.Error)
+			}
+			if diff.Answer != diff.WantAnswer {
+				fmt.Fprintf(w, "      answer: %q\n      want:   %q\n", diff.Answer, diff.WantAnswer)
+			}
+			if strings.Join(diff.Tools, ",") != strings.Join(diff.WantTools, ",") {
+				fmt.Fprintf(w, "      tools:  [%s]\n      want:   [%s]\n", strings.Join(diff.Tools, " "), strings.Join(diff.WantTools, " "))
+			}
+		case diff.Drift > 0:
+			fmt.Fprintf(w, "DRIFT %s: %d model requests differ from the recording\n", name, diff.Drift)
+		default:
+			fmt.Fprintf(w, "PASS  %s\n", name)
+		}
+	}
+	fmt.Fprintf(w, "%d/%d cassettes passed\n", len(paths)-failed, len(paths))
+	return failed, nil
+}
@@ -36,6 +36,16 @@ func main() {
 	flag.BoolVar(&setupFlag, "setup", false, "Run interactive setup wizard to configure Miri")
 	var resetFlag bool
 	flag.BoolVar(&resetFlag, "reset-config", false, "Delete config.yaml and run setup wizard")
+	var evalDir string
+	flag.StringVar(&evalDir, "eval", "", "Replay the cassettes of a directory, diff answers and tool sequences, and exit")
+	var evalLive bool
+	flag.BoolVar(&evalLive, "eval-live", false, "With -eval, call the configured models and tools instead of the recorded traffic")
+	var brainCmd brainCommand
+	flag.StringVar(&brainCmd.export, "export-brain", "", "Write a brain archive of the storage directory to a file (- for stdout) and exit")
+	flag.StringVar(&brainCmd.imprt, "import-brain", "", "Load a brain archive (- for stdin) into the storage directory and exit")
+	flag.BoolVar(&brainCmd.replace, "import-replace", false, "With -import-brain, replace the brain instead of merging into it")
+	var diffBrain string
+	flag.StringVar(&diffBrain, "diff-brain", "", "Compare a brain archive to the current brain, or to a second archive given as argument, and exit")
 
 	flag.Parse()
 
@@ -72,11 +82,43 @@ func main() {
 		}
 	}
 
+	if evalDir != "" {
+		failed, err := runEval(cfg, evalDir, evalLive, os.Stdout)
+		if err != nil {
+			slog.Error("eval failed", "error", err)
+			os.Exit(1)
+		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if diffBrain != "" {
+		brainCmd.diff = append([]string{diffBrain}, flag.Args()...)
+	}
+	if brainCmd.export != "" || brainCmd.imprt != "" || len(brainCmd.diff) > 0 {
+		if len(brainCmd.diff) > 2 {
+			slog.Error("-diff-brain takes at most two archives")
+			os.Exit(1)
+		}
+		if err := brainCmd.run(cfg, os.Stdout); err != nil {
+			slog.Error("brain command failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	s, err := storage.New(cfg.StorageDir)
 	if err != nil {
 		slog.Error("failed to initialize storage", "error", err)
 		os.Exit(1)
 	}
+	defer func() {
+		if err := s.Close(); err != nil {
+			slog.Error("failed to close storage", "error", err)
+		}
+	}()
 
 	// PID file management
 	pidPath := filepath.Join(cfg.StorageDir, "miri.pid")
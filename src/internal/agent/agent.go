@@ -9,8 +9,10 @@ import (
 	"math"
 	"miri-main/src/internal/config"
 	"miri-main/src/internal/engine"
+	"miri-main/src/internal/engine/memory"
 	"miri-main/src/internal/engine/skills"
 	"miri-main/src/internal/engine/tools"
+	"miri-main/src/internal/llm"
 	"miri-main/src/internal/session"
 	"miri-main/src/internal/storage"
 	"miri-main/src/internal/system"
@@ -25,6 +27,9 @@ type Agent struct {
 	Storage    *storage.Storage        `json:"-"`
 	Parent     *Agent                  `json:"-"`
 	Eng        engine.Engine           `json:"-"`
+
+	bufferStore memory.BufferStore
+	pool        *engine.EnginePool
 }
 
 func NewAgent(cfg *config.Config, sm *session.SessionManager, st *storage.Storage, gw tools.TaskGateway) *Agent {
@@ -46,10 +51,40 @@ func (a *Agent) InitEngine(gw tools.TaskGateway) {
 		slog.Error("failed to initialize Eino engine", "error", err)
 	} else {
 		a.Eng = react
+		a.pool = engine.NewEnginePool(react, a.Config, 0)
+		if a.bufferStore != nil {
+			if err := a.Eng.AttachBufferStore(a.bufferStore); err != nil {
+				slog.Error("failed to restore conversation buffers", "error", err)
+			}
+		}
 		a.Eng.Startup(context.Background())
 	}
 }
 
+// PersistBuffers makes the agent's conversation buffers durable in bs and restores
+// the stored ones. Engines re-created by InitEngine are attached automatically.
+func (a *Agent) PersistBuffers(bs memory.BufferStore) error {
+	a.bufferStore = bs
+	if a.Eng == nil {
+		return nil
+	}
+	return a.Eng.AttachBufferStore(bs)
+}
+
+// engineFor returns the pooled engine for a per-request model override, falling
+// back to the primary engine when no model is requested or it cannot be built.
+func (a *Agent) engineFor(model string) engine.Engine {
+	if model == "" || a.pool == nil {
+		return a.Eng
+	}
+	eng, err := a.pool.Get(model)
+	if err != nil {
+		slog.Error("failed to get engine for model override, using primary", "model", model, "error", err)
+		return a.Eng
+	}
+	return eng
+}
+
 func (a *Agent) splitModel(modelStr string) (string, string) {
 	parts := strings.SplitN(modelStr, "/", 2)
 	if len(parts) != 2 {
@@ -69,18 +104,29 @@ func (a *Agent) DelegatePrompt(sessionID string, prompt string) (string, error)
 	return a.DelegatePromptWithOptions(context.Background(), sessionID, prompt, engine.Options{})
 }
 
-func (a *Agent) DelegatePromptStream(sessionID string, prompt string) (<-chan string, error) {
+func (a *Agent) DelegatePromptStream(sessionID string, prompt string) (<-chan engine.StreamEvent, error) {
 	return a.DelegatePromptStreamWithOptions(context.Background(), sessionID, prompt, engine.Options{})
 }
 
 func (a *Agent) DelegatePromptWithOptions(ctx context.Context, sessionID string, prompt string, opts engine.Options) (string, error) {
+	resp, _, err := a.DelegatePromptWithUsage(ctx, sessionID, prompt, opts)
+	return resp, err
+}
+
+// DelegatePromptWithUsage is DelegatePromptWithOptions that also returns the usage of the
+// turn, including the model of the failover chain that answered. Usage is nil for
+// commands such as /new that do not reach the model.
+func (a *Agent) DelegatePromptWithUsage(ctx context.Context, sessionID string, prompt string, opts engine.Options) (string, *llm.Usage, error) {
 
 	// Gather system context
 	sysContext := fmt.Sprintf("\nSystem information:\n- %s\n", system.GetInfo())
 
-	if sessionID == "" || sessionID == session.DefaultSessionID {
+	if sessionID == "" {
 		sessionID = session.DefaultSessionID
 	}
+	if !session.ValidID(sessionID) {
+		return "", nil, fmt.Errorf("invalid session id %q", sessionID)
+	}
 	session := a.SessionMgr.GetOrCreate(sessionID)
 
 	// Intercept /new command
@@ -91,28 +137,17 @@ func (a *Agent) DelegatePromptWithOptions(ctx context.Context, sessionID string,
 			a.Eng.ClearHistory(sessionID)
 		}
 		session.Clear()
-		return "Session renewed. Current history cleared.", nil
+		return "Session renewed. Current history cleared.", nil, nil
 	}
 
 	// Wrap context with dynamic options
 	engineCtx := engine.WithOptions(ctx, opts)
 
-	// If a specific model is requested, we might need to re-initialize it or use a temporary one
-	eng := a.Eng
-	if opts.Model != "" {
-		provider, model := a.splitModel(a.PrimaryModel())
-		provider, model = a.splitModel(opts.Model)
-		eino, err := engine.NewEinoEngine(a.Config, a.Storage, provider, model, nil)
-		if err == nil {
-			eng = eino
-		} else {
-			slog.Error("failed to initialize dynamic Eino engine", "error", err)
-		}
-	}
+	eng := a.engineFor(opts.Model)
 
 	resp, usage, err := eng.Respond(engineCtx, session, prompt, sysContext)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	if usage != nil {
 		pt := math.Max(0, float64(usage.PromptTokens))
@@ -120,17 +155,20 @@ func (a *Agent) DelegatePromptWithOptions(ctx context.Context, sessionID string,
 		session.AddTokens(uint64(pt), uint64(ct), usage.TotalCost)
 	}
 
-	return resp, nil
+	return resp, usage, nil
 }
 
-func (a *Agent) DelegatePromptStreamWithOptions(ctx context.Context, sessionID string, prompt string, opts engine.Options) (<-chan string, error) {
+func (a *Agent) DelegatePromptStreamWithOptions(ctx context.Context, sessionID string, prompt string, opts engine.Options) (<-chan engine.StreamEvent, error) {
 
 	// Gather system context
 	sysContext := fmt.Sprintf("\nSystem information:\n- %s\n", system.GetInfo())
 
-	if sessionID == "" || sessionID == session.DefaultSessionID {
+	if sessionID == "" {
 		sessionID = session.DefaultSessionID
 	}
+	if !session.ValidID(sessionID) {
+		return nil, fmt.Errorf("invalid session id %q", sessionID)
+	}
 	session := a.SessionMgr.GetOrCreate(sessionID)
 
 	// Intercept /new command
@@ -142,8 +180,10 @@ func (a *Agent) DelegatePromptStreamWithOptions(ctx context.Context, sessionID s
 		}
 		session.Clear()
 
-		proxy := make(chan string, 1)
-		proxy <- "Session renewed. Current history cleared."
+		const renewed = "Session renewed. Current history cleared."
+		proxy := make(chan engine.StreamEvent, 2)
+		proxy <- engine.StreamEvent{Type: engine.EventContent, Content: renewed}
+		proxy <- engine.StreamEvent{Type: engine.EventDone, Content: renewed}
 		close(proxy)
 		return proxy, nil
 	}
@@ -151,64 +191,85 @@ func (a *Agent) DelegatePromptStreamWithOptions(ctx context.Context, sessionID s
 	// Wrap context with dynamic options
 	engineCtx := engine.WithOptions(ctx, opts)
 
-	eng := a.Eng
-	if opts.Model != "" {
-		provider, model := a.splitModel(a.PrimaryModel())
-		provider, model = a.splitModel(opts.Model)
-		eino, err := engine.NewEinoEngine(a.Config, a.Storage, provider, model, nil)
-		if err == nil {
-			eng = eino
-		} else {
-			slog.Error("failed to initialize dynamic Eino engine (stream)", "error", err)
-		}
-	}
+	eng := a.engineFor(opts.Model)
 
 	stream, err := eng.StreamRespond(engineCtx, session, prompt, sysContext)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create a proxy channel to intercept the final response for persistence
-	proxy := make(chan string, 100)
+	// Proxy the events to account the turn's usage on the session
+	proxy := make(chan engine.StreamEvent, 100)
 	go func() {
 		defer close(proxy)
-		var fullResp strings.Builder
-		for chunk := range stream {
-			// In our current implementation, we send thoughts in brackets [Thought: ...]
-			// Only chunks NOT in brackets are part of the final response to be persisted.
-			// Actually, EinoEngine's Respond returns the final answer.
-			// Our StreamRespond sends thoughts and then the final answer.
-			if strings.HasPrefix(chunk, "[Usage: ") {
-				var p, c, t int
-				var cost float64
-				_, err := fmt.Sscanf(chunk, "[Usage: %d prompt, %d completion, %d total tokens, %f cost]", &p, &c, &t, &cost)
-				if err == nil {
-					pt := math.Max(0, float64(p))
-					ct := math.Max(0, float64(c))
-					session.AddTokens(uint64(pt), uint64(ct), cost)
-				}
-				// Don't pass usage chunk to client if you want it to be hidden
-				continue
+		for ev := range stream {
+			if ev.Type == engine.EventUsage && ev.Usage != nil {
+				pt := math.Max(0, float64(ev.Usage.PromptTokens))
+				ct := math.Max(0, float64(ev.Usage.CompletionTokens))
+				session.AddTokens(uint64(pt), uint64(ct), ev.Usage.TotalCost)
 			}
-
-			// Only exclude specific meta-tags from the persisted history.
-			isMeta := strings.HasPrefix(chunk, "[Thought:") ||
-				strings.HasPrefix(chunk, "[Usage:") ||
-				strings.HasPrefix(chunk, "[Tools:") ||
-				strings.HasPrefix(chunk, "[Error:") ||
-				strings.HasPrefix(chunk, "[Panic:") ||
-				strings.HasPrefix(chunk, "[Stream Error:")
-
-			if !isMeta {
-				fullResp.WriteString(chunk)
-			}
-			proxy <- chunk
+			proxy <- ev
 		}
 	}()
 
 	return proxy, nil
 }
 
+// ListRuns returns the interrupted runs that can be resumed.
+func (a *Agent) ListRuns() ([]engine.RunInfo, error) {
+	if a.Eng == nil {
+		return nil, errors.New("engine not initialized")
+	}
+	return a.Eng.ListRuns()
+}
+
+// ResumeRun continues an interrupted run from its last checkpointed tool step, on the
+// model it was started with, and accounts its usage to the run's session.
+func (a *Agent) ResumeRun(ctx context.Context, runID string) (string, *llm.Usage, error) {
+	return a.continueRun(runID, func(eng engine.Engine, sess *session.Session) (string, *llm.Usage, error) {
+		return eng.ResumeRun(ctx, sess, runID)
+	})
+}
+
+// AnswerRun continues a run suspended on a question to the human with their answer
+// ("" when the question expired unanswered).
+func (a *Agent) AnswerRun(ctx context.Context, runID, answer string) (string, *llm.Usage, error) {
+	return a.continueRun(runID, func(eng engine.Engine, sess *session.Session) (string, *llm.Usage, error) {
+		return eng.AnswerRun(ctx, sess, runID, answer)
+	})
+}
+
+// continueRun runs fn on the engine of the run's model and books its usage on the run's session.
+func (a *Agent) continueRun(runID string, fn func(engine.Engine, *session.Session) (string, *llm.Usage, error)) (string, *llm.Usage, error) {
+	if a.Eng == nil {
+		return "", nil, errors.New("engine not initialized")
+	}
+	info, err := a.Eng.GetRun(runID)
+	if err != nil {
+		return "", nil, err
+	}
+	sess := a.SessionMgr.GetOrCreate(info.SessionID)
+
+	resp, usage, err := fn(a.engineFor(info.Model), sess)
+	if err != nil {
+		return "", nil, err
+	}
+	if usage != nil {
+		pt := math.Max(0, float64(usage.PromptTokens))
+		ct := math.Max(0, float64(usage.CompletionTokens))
+		sess.AddTokens(uint64(pt), uint64(ct), usage.TotalCost)
+	}
+	return resp, usage, nil
+}
+
+// DiscardRun deletes an interrupted run.
+func (a *Agent) DiscardRun(runID string) error {
+	if a.Eng == nil {
+		return errors.New("engine not initialized")
+	}
+	return a.Eng.DiscardRun(runID)
+}
+
 func (a *Agent) ListSkills() []*skills.Skill {
 	return a.Eng.ListSkills()
 }
@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"io"
 	"miri-main/src/internal/config"
+	"miri-main/src/internal/engine"
 	"miri-main/src/internal/gateway"
 	"miri-main/src/internal/session"
 	"miri-main/src/internal/storage"
@@ -14,10 +16,13 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"context"
+	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"net"
 )
@@ -101,6 +106,36 @@ func TestAPI_PromptStream(t *testing.T) {
 	}
 }
 
+func TestAPI_PromptStreamTypedEvents(t *testing.T) {
+	s, tmpDir := setupTestServer(t)
+	defer os.RemoveAll(tmpDir)
+
+	// c.Stream needs a real connection (httptest.ResponseRecorder cannot CloseNotify).
+	ts := httptest.NewServer(s.Engine)
+	defer ts.Close()
+
+	// /new is answered without the model, so the event sequence is deterministic.
+	req, _ := http.NewRequest("GET", ts.URL+"/api/v1/prompt/stream?prompt=%2Fnew", nil)
+	req.Header.Set("X-Server-Key", "test-server-key")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET prompt stream failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET prompt stream: expected 200, got %d", resp.StatusCode)
+	}
+	raw, _ := io.ReadAll(resp.Body)
+	body := string(raw)
+	if !strings.Contains(body, "event:content\ndata:{\"type\":\"content\",\"content\":\"Session renewed.") {
+		t.Errorf("expected a typed content event, got %q", body)
+	}
+	if !strings.Contains(body, "event:done\n") {
+		t.Errorf("expected the stream to end with a done event, got %q", body)
+	}
+}
+
 func TestAPI_BrainEndpoints(t *testing.T) {
 	s, tmpDir := setupTestServer(t)
 	defer os.RemoveAll(tmpDir)
@@ -117,6 +152,14 @@ func TestAPI_BrainEndpoints(t *testing.T) {
 			t.Errorf("expected 200 for %s, got %d. Body: %s", ep, resp.Code, resp.Body.String())
 		}
 	}
+
+	req := httptest.NewRequest("GET", "/api/admin/v1/brain/search?collection=steps", nil)
+	req.Header.Set("Authorization", adminAuth("admin", "admin-password"))
+	resp := httptest.NewRecorder()
+	s.Engine.ServeHTTP(resp, req)
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown collection, got %d. Body: %s", resp.Code, resp.Body.String())
+	}
 }
 
 func TestAPI_AdminConfig(t *testing.T) {
@@ -558,3 +601,432 @@ func TestAPI_TaskDefaultReporting(t *testing.T) {
 		t.Errorf("timeout waiting for websocket message")
 	}
 }
+
+func TestAPI_PromptInvalidSession(t *testing.T) {
+	s, tmpDir := setupTestServer(t)
+	defer os.RemoveAll(tmpDir)
+
+	reqBody := promptRequest{Prompt: "hello", SessionID: "../escape"}
+	body, _ := json.Marshal(reqBody)
+	req := httptest.NewRequest("POST", "/api/v1/prompt", bytes.NewReader(body))
+	req.Header.Set("X-Server-Key", "test-server-key")
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	s.Engine.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("POST prompt with invalid session: expected 400, got %d", resp.Code)
+	}
+}
+
+func TestAPI_V1InteractionNewSession(t *testing.T) {
+	s, tmpDir := setupTestServer(t)
+	defer os.RemoveAll(tmpDir)
+
+	reqBody := interactionRequest{Action: "new_session"}
+	body, _ := json.Marshal(reqBody)
+	req := httptest.NewRequest("POST", "/api/v1/interaction", bytes.NewReader(body))
+	req.Header.Set("X-Server-Key", "test-server-key")
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	s.Engine.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Interaction new_session: expected 200, got %d", resp.Code)
+	}
+	var got map[string]string
+	json.Unmarshal(resp.Body.Bytes(), &got)
+	if got["session_id"] == "" || got["session_id"] == session.DefaultSessionID {
+		t.Errorf("expected a fresh session_id, got %q", got["session_id"])
+	}
+	if s.Gateway.GetSession(got["session_id"]) == nil {
+		t.Errorf("expected session %q to be registered", got["session_id"])
+	}
+}
+
+func TestAPI_Runs(t *testing.T) {
+	s, tmpDir := setupTestServer(t)
+	defer os.RemoveAll(tmpDir)
+
+	req := httptest.NewRequest("GET", "/api/admin/v1/runs", nil)
+	req.Header.Set("Authorization", adminAuth("admin", "admin-password"))
+	resp := httptest.NewRecorder()
+	s.Engine.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("GET runs: expected 200, got %d", resp.Code)
+	}
+	if strings.TrimSpace(resp.Body.String()) != "[]" {
+		t.Errorf("expected no interrupted runs, got %s", resp.Body.String())
+	}
+
+	for _, r := range []struct{ method, path string }{
+		{"POST", "/api/admin/v1/runs/unknown/resume"},
+		{"DELETE", "/api/admin/v1/runs/unknown"},
+	} {
+		req := httptest.NewRequest(r.method, r.path, nil)
+		req.Header.Set("Authorization", adminAuth("admin", "admin-password"))
+		resp := httptest.NewRecorder()
+		s.Engine.ServeHTTP(resp, req)
+		if resp.Code != http.StatusNotFound {
+			t.Errorf("%s %s: expected 404, got %d", r.method, r.path, resp.Code)
+		}
+	}
+}
+
+func TestAPI_HumanQuestions(t *testing.T) {
+	s, tmpDir := setupTestServer(t)
+	defer os.RemoveAll(tmpDir)
+
+	q := &storage.HumanQuestion{
+		ID:        "q1",
+		Status:    storage.HumanQuestionPending,
+		Question:  "Which city?",
+		SessionID: session.DefaultSessionID,
+		Created:   time.Now().UTC(),
+	}
+	if err := s.Gateway.AskHuman(q); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/admin/v1/human/pending?session_id="+url.QueryEscape(session.DefaultSessionID), nil)
+	req.Header.Set("Authorization", adminAuth("admin", "admin-password"))
+	resp := httptest.NewRecorder()
+	s.Engine.ServeHTTP(resp, req)
+	var pending []storage.HumanQuestion
+	if err := json.Unmarshal(resp.Body.Bytes(), &pending); err != nil {
+		t.Fatalf("GET pending: %v (%s)", err, resp.Body.String())
+	}
+	if len(pending) != 1 || pending[0].ID != "q1" || pending[0].Question != "Which city?" {
+		t.Fatalf("unexpected pending questions %+v", pending)
+	}
+
+	answer := func(id string) int {
+		req := httptest.NewRequest("POST", "/api/admin/v1/human/response/"+id, strings.NewReader(`{"response":"Zurich"}`))
+		req.Header.Set("Authorization", adminAuth("admin", "admin-password"))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		s.Engine.ServeHTTP(resp, req)
+		return resp.Code
+	}
+	if code := answer("q1"); code != http.StatusOK {
+		t.Fatalf("POST response: expected 200, got %d", code)
+	}
+	if code := answer("q1"); code != http.StatusBadRequest {
+		t.Errorf("answering twice: expected 400, got %d", code)
+	}
+	if code := answer("unknown"); code != http.StatusNotFound {
+		t.Errorf("unknown question: expected 404, got %d", code)
+	}
+
+	got, err := s.Gateway.Storage.LoadHumanQuestion("q1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != storage.HumanQuestionAnswered || got.Response != "Zurich" {
+		t.Errorf("expected the answer to be recorded, got %+v", got)
+	}
+}
+
+func TestAPI_Approvals(t *testing.T) {
+	s, tmpDir := setupTestServer(t)
+	defer os.RemoveAll(tmpDir)
+
+	decided := make(chan bool, 1)
+	go func() {
+		approved, _, _ := s.Gateway.RequestApproval(context.Background(), &engine.ApprovalRequest{
+			ID:        "a1",
+			SessionID: session.DefaultSessionID,
+			Tool:      "execute_command",
+			Arguments: `{"command":"rm -rf /tmp/x"}`,
+			Created:   time.Now(),
+			ExpiresAt: time.Now().Add(time.Minute),
+		})
+		decided <- approved
+	}()
+
+	var pending []engine.ApprovalRequest
+	for i := 0; i < 50 && len(pending) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		req := httptest.NewRequest("GET", "/api/admin/v1/approvals", nil)
+		req.Header.Set("Authorization", adminAuth("admin", "admin-password"))
+		resp := httptest.NewRecorder()
+		s.Engine.ServeHTTP(resp, req)
+		if err := json.Unmarshal(resp.Body.Bytes(), &pending); err != nil {
+			t.Fatalf("GET approvals: %v (%s)", err, resp.Body.String())
+		}
+	}
+	if len(pending) != 1 || pending[0].ID != "a1" || pending[0].Arguments != `{"command":"rm -rf /tmp/x"}` {
+		t.Fatalf("unexpected pending approvals %+v", pending)
+	}
+
+	req := httptest.NewRequest("POST", "/api/admin/v1/approvals/a1/approve", nil)
+	req.Header.Set("Authorization", adminAuth("admin", "admin-password"))
+	resp := httptest.NewRecorder()
+	s.Engine.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("approve: expected 200, got %d", resp.Code)
+	}
+	select {
+	case approved := <-decided:
+		if !approved {
+			t.Error("expected the call to be approved")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("approval did not unblock the request")
+	}
+
+	req = httptest.NewRequest("POST", "/api/admin/v1/approvals/a1/deny", strings.NewReader(`{"reason":"no"}`))
+	req.Header.Set("Authorization", adminAuth("admin", "admin-password"))
+	req.Header.Set("Content-Type", "application/json")
+	resp = httptest.NewRecorder()
+	s.Engine.ServeHTTP(resp, req)
+	if resp.Code != http.StatusNotFound {
+		t.Errorf("deciding twice: expected 404, got %d", resp.Code)
+	}
+}
+
+func TestAPI_PromptMockProvider(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "miri-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	fixtures := filepath.Join(tmpDir, "mock.yaml")
+	if err := os.WriteFile(fixtures, []byte("responses:\n  - match: ping\n    content: pong\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		StorageDir: tmpDir,
+		Server:     config.ServerConfig{Key: "test-server-key"},
+		Models: config.ModelsConfig{
+			Providers: map[string]config.ProviderConfig{
+				"offline": {API: "mock", Fixtures: fixtures},
+			},
+		},
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Model: config.ModelSelection{Primary: "offline/scripted"},
+			},
+		},
+	}
+	st, err := storage.New(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw := gateway.New(cfg, st)
+	gw.StartEngine(context.Background())
+	s := NewServer(gw)
+
+	body, _ := json.Marshal(promptRequest{Prompt: "ping"})
+	req := httptest.NewRequest("POST", "/api/v1/prompt", bytes.NewReader(body))
+	req.Header.Set("X-Server-Key", "test-server-key")
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	s.Engine.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("POST prompt: expected 200, got %d. Body: %s", resp.Code, resp.Body.String())
+	}
+	var res struct {
+		Response string `json:"response"`
+		Model    string `json:"model"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Response != "pong" || res.Model != "offline/scripted" {
+		t.Errorf("expected scripted pong from offline/scripted, got %+v", res)
+	}
+}
+
+func TestAPI_PromptAttachments(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "miri-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{
+		StorageDir: tmpDir,
+		Server:     config.ServerConfig{Key: "test-server-key"},
+		Models: config.ModelsConfig{
+			Providers: map[string]config.ProviderConfig{
+				"offline": {API: "mock", Models: []config.ModelConfig{{ID: "offline/scripted", Input: []string{"text"}}}},
+			},
+		},
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Model: config.ModelSelection{Primary: "offline/scripted"},
+			},
+		},
+	}
+	st, err := storage.New(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw := gateway.New(cfg, st)
+	gw.StartEngine(context.Background())
+	s := NewServer(gw)
+
+	prompt := func(req promptRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		r := httptest.NewRequest("POST", "/api/v1/prompt", bytes.NewReader(body))
+		r.Header.Set("X-Server-Key", "test-server-key")
+		r.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		s.Engine.ServeHTTP(resp, r)
+		return resp
+	}
+
+	// The mock echoes the prompt, which includes the text of the attached file
+	resp := prompt(promptRequest{Prompt: "summarize", Attachments: []engine.Attachment{
+		{Name: "notes.txt", Data: base64.StdEncoding.EncodeToString([]byte("buy milk"))},
+	}})
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), "buy milk") {
+		t.Fatalf("text attachment: expected 200 with the file text, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	// offline/scripted only accepts text input
+	resp = prompt(promptRequest{Prompt: "what is this?", Attachments: []engine.Attachment{
+		{Name: "photo.png", Data: base64.StdEncoding.EncodeToString([]byte("\x89PNG\r\n\x1a\n"))},
+	}})
+	if resp.Code != http.StatusBadRequest || !strings.Contains(resp.Body.String(), "does not accept images") {
+		t.Errorf("image attachment: expected 400, got %d: %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestAPI_Costs(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "miri-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	fixtures := filepath.Join(tmpDir, "mock.yaml")
+	if err := os.WriteFile(fixtures, []byte("responses:\n  - match: ping\n    content: pong\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		StorageDir: tmpDir,
+		Server:     config.ServerConfig{Key: "test-server-key", AdminUser: "admin", AdminPass: "admin-password"},
+		Models: config.ModelsConfig{
+			Providers: map[string]config.ProviderConfig{
+				"offline": {API: "mock", Fixtures: fixtures, Models: []config.ModelConfig{
+					{ID: "scripted", Cost: config.ModelCost{Input: 1000, Output: 1000}},
+				}},
+			},
+		},
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Model: config.ModelSelection{Primary: "offline/scripted"},
+			},
+		},
+	}
+	st, err := storage.New(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw := gateway.New(cfg, st)
+	gw.StartEngine(context.Background())
+	s := NewServer(gw)
+
+	body, _ := json.Marshal(promptRequest{Prompt: "ping"})
+	req := httptest.NewRequest("POST", "/api/v1/prompt", bytes.NewReader(body))
+	req.Header.Set("X-Server-Key", "test-server-key")
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	s.Engine.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("POST prompt: expected 200, got %d. Body: %s", resp.Code, resp.Body.String())
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", adminAuth("admin", "admin-password"))
+		resp := httptest.NewRecorder()
+		s.Engine.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp = get("/api/admin/v1/costs?group_by=model&source=chat")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("GET costs: expected 200, got %d. Body: %s", resp.Code, resp.Body.String())
+	}
+	var summary struct {
+		GroupBy   string                `json:"group_by"`
+		Groups    []storage.CostSummary `json:"groups"`
+		Calls     int                   `json:"calls"`
+		TotalCost float64               `json:"total_cost"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.GroupBy != "model" || len(summary.Groups) != 1 || summary.Groups[0].Key != "scripted" ||
+		summary.Calls != 1 || summary.TotalCost <= 0 {
+		t.Errorf("expected one priced chat call of scripted, got %+v", summary)
+	}
+
+	resp = get("/api/admin/v1/costs/entries?source=chat&from=2000-01-01")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("GET cost entries: expected 200, got %d. Body: %s", resp.Code, resp.Body.String())
+	}
+	var page struct {
+		Data  []storage.CostEntry `json:"data"`
+		Total int                 `json:"total"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 1 || len(page.Data) != 1 || page.Data[0].Provider != "offline" || page.Data[0].SessionID == "" {
+		t.Errorf("unexpected cost entries: %+v", page)
+	}
+
+	for _, path := range []string{"/api/admin/v1/costs?group_by=color", "/api/admin/v1/costs?from=yesterday"} {
+		if resp := get(path); resp.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: expected 400, got %d", path, resp.Code)
+		}
+	}
+}
+
+func TestAPI_WebSocketConcurrentWrites(t *testing.T) {
+	const writers, perWriter = 4, 200
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		ws := &wsConn{Conn: conn}
+		defer ws.Close()
+		// A streamed run and broadcasts write to the same connection at once.
+		var wg sync.WaitGroup
+		for i := range writers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := range perWriter {
+					if j%50 == 0 {
+						_ = ws.ping(time.Second)
+					}
+					_ = ws.WriteJSON(gin.H{"writer": i, "n": j})
+				}
+			}()
+		}
+		wg.Wait()
+		_, _, _ = ws.ReadMessage()
+	}))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for i := 0; i < writers*perWriter; i++ {
+		var msg map[string]any
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+	}
+}
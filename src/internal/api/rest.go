@@ -1,11 +1,13 @@
 package api
 
 import (
-	"encoding/json"
+	"errors"
 	"log/slog"
+	"miri-main/src/internal/budget"
 	"miri-main/src/internal/config"
 	"miri-main/src/internal/dream"
 	"miri-main/src/internal/engine"
+	"miri-main/src/internal/engine/memory"
 	"miri-main/src/internal/gateway"
 	"miri-main/src/internal/session"
 	"miri-main/src/internal/storage"
@@ -46,10 +48,13 @@ func (s *Server) handleUpdateConfig(c *gin.Context) {
 
 type promptRequest struct {
 	Prompt      string          `json:"prompt"`
+	SessionID   string          `json:"session_id,omitempty"`
 	Model       string          `json:"model,omitempty"`
 	Temperature *float32        `json:"temperature,omitempty"`
 	MaxTokens   *int            `json:"max_tokens,omitempty"`
 	Options     *engine.Options `json:"options,omitempty"`
+	// Attachments are uploaded files (path) or inline base64 images (data).
+	Attachments []engine.Attachment `json:"attachments,omitempty"`
 }
 
 func (s *Server) handlePrompt(c *gin.Context) {
@@ -73,17 +78,34 @@ func (s *Server) handlePrompt(c *gin.Context) {
 	if req.MaxTokens != nil {
 		opts.MaxTokens = req.MaxTokens
 	}
+	if len(req.Attachments) > 0 {
+		opts.Attachments = append(opts.Attachments, req.Attachments...)
+	}
+
+	sessionID := req.SessionID
+	if sessionID == "" {
+		sessionID = session.DefaultSessionID
+	}
+	if !session.ValidID(sessionID) {
+		s.sendError(c, http.StatusBadRequest, "invalid session_id")
+		return
+	}
 
 	promptsTotal.Inc()
 
 	gw := c.MustGet("gateway").(*gateway.Gateway)
-	response, err := gw.PrimaryAgent.DelegatePromptWithOptions(c.Request.Context(), session.DefaultSessionID, req.Prompt, opts)
+	response, usage, err := gw.PrimaryAgent.DelegatePromptWithUsage(c.Request.Context(), sessionID, req.Prompt, opts)
 	if err != nil {
-		s.sendError(c, http.StatusInternalServerError, err.Error())
+		s.sendError(c, promptErrorStatus(err), err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"response": response})
+	res := gin.H{"response": response, "session_id": sessionID}
+	if usage != nil {
+		res["model"] = usage.Model
+		res["usage"] = usage
+	}
+	c.JSON(http.StatusOK, res)
 }
 
 func (s *Server) handleSaveHuman(c *gin.Context) {
@@ -216,8 +238,42 @@ func (s *Server) handleRemoveSkill(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "skill removed"})
 }
 
+func (s *Server) handleListDynamicTools(c *gin.Context) {
+	var pq PaginationQuery
+	if err := c.ShouldBindQuery(&pq); err != nil {
+		s.sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit := pq.Limit
+	if limit == 0 {
+		limit = 50
+	}
+	offset := pq.Offset
+	if offset < 0 {
+		offset = 0
+	}
+	gw := c.MustGet("gateway").(*gateway.Gateway)
+	c.JSON(http.StatusOK, Paginate(gw.ListDynamicTools(), offset, limit))
+}
+
+// handleReloadDynamicTools reloads the dynamic tools; definitions that fail to load
+// are listed in errors while the valid ones are used.
+func (s *Server) handleReloadDynamicTools(c *gin.Context) {
+	gw := c.MustGet("gateway").(*gateway.Gateway)
+	defs, err := gw.ReloadDynamicTools()
+	errs := []string{}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			errs = append(errs, e.Error())
+		}
+	} else if err != nil {
+		errs = append(errs, err.Error())
+	}
+	c.JSON(http.StatusOK, gin.H{"tools": defs, "errors": errs})
+}
+
 type interactionRequest struct {
-	Action string `json:"action" binding:"required,oneof=status"`
+	Action string `json:"action" binding:"required,oneof=status new_session"`
 }
 
 func (s *Server) handleInteraction(c *gin.Context) {
@@ -241,8 +297,10 @@ func (s *Server) handleInteraction(c *gin.Context) {
 			"sessions":      gw.ListSessions(),
 			"channels":      chs,
 		})
+	case "new_session":
+		c.JSON(http.StatusOK, gin.H{"session_id": gw.CreateNewSession()})
 	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid action; must be 'status'"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid action; must be 'status' or 'new_session'"})
 	}
 }
 
@@ -396,7 +454,7 @@ func (s *Server) handleGetSessionSkills(c *gin.Context) {
 	}
 
 	res := []string{}
-	if id == session.DefaultSessionID {
+	if !session.IsSubAgent(id) {
 		res = append(res, "learn", "skill_creator")
 	}
 	// Also check responses for "Skill '...' loaded successfully"
@@ -731,113 +789,239 @@ func (s *Server) handleGetBrainSummaries(c *gin.Context) {
 	c.JSON(http.StatusOK, Paginate(allSummaries, offset, limit))
 }
 
-func (s *Server) handleGetBrainTopology(c *gin.Context) {
-	sessionID := c.Query("session_id")
-	topology, err := s.Gateway.PrimaryAgent.Eng.GetBrainTopology(c.Request.Context(), sessionID)
+// handleSearchBrain GET /api/admin/v1/brain/search
+// Searches the facts and summaries. With q they are ranked by the hybrid score
+// of retrieval and report their distance and score, otherwise newest first.
+func (s *Server) handleSearchBrain(c *gin.Context) {
+	var q BrainSearchQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		s.sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter := memory.MemoryFilter{
+		Query:      q.Q,
+		Collection: q.Collection,
+		Type:       q.Type,
+		Deprecated: q.Deprecated,
+		Pinned:     q.Pinned,
+		SessionID:  q.SessionID,
+	}
+	var err error
+	if filter.From, err = parseCostTime(q.From, false); err != nil {
+		s.sendError(c, http.StatusBadRequest, "invalid from: "+err.Error())
+		return
+	}
+	if filter.To, err = parseCostTime(q.To, true); err != nil {
+		s.sendError(c, http.StatusBadRequest, "invalid to: "+err.Error())
+		return
+	}
+	limit := q.Limit
+	if limit == 0 {
+		limit = 20
+	}
+	hits, err := s.Gateway.PrimaryAgent.Eng.SearchBrainMemories(c.Request.Context(), filter)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		s.sendError(c, brainErrorStatus(err), err.Error())
 		return
 	}
-	c.JSON(http.StatusOK, topology)
+	c.JSON(http.StatusOK, Paginate(hits, q.Offset, limit))
 }
 
-func (s *Server) handleListHumanPending(c *gin.Context) {
-	gw := c.MustGet("gateway").(*gateway.Gateway)
-	pendingDir := filepath.Join(gw.Config.StorageDir, "human_pending")
-	sessionID := c.Query("session_id")
-
-	type HumanPending struct {
-		ID        string    `json:"id"`
-		Question  string    `json:"question"`
-		SessionID string    `json:"session_id"`
-		Created   time.Time `json:"created,omitempty"`
-	}
-
-	var pendings []HumanPending
-
-	entries, err := os.ReadDir(pendingDir)
-	if err != nil {
-		if os.IsNotExist(err) {
-			c.JSON(http.StatusOK, []HumanPending{})
+// handleAddBrainMemory POST /api/admin/v1/brain/{facts,summaries}
+func (s *Server) handleAddBrainMemory(collection string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req BrainMemoryRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			s.sendError(c, http.StatusBadRequest, err.Error())
 			return
 		}
-		s.sendError(c, http.StatusInternalServerError, err.Error())
-		return
+		hit, err := s.Gateway.PrimaryAgent.Eng.AddBrainMemory(c.Request.Context(), collection, req.Content, req.Metadata)
+		if err != nil {
+			s.sendError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.JSON(http.StatusCreated, hit)
 	}
+}
 
-	for _, entry := range entries {
-		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
-			continue
+// handleGetBrainMemory GET /api/admin/v1/brain/{facts,summaries}/:id
+func (s *Server) handleGetBrainMemory(collection string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hit, err := s.Gateway.PrimaryAgent.Eng.GetBrainMemory(c.Request.Context(), collection, c.Param("id"))
+		if err != nil {
+			s.sendError(c, brainErrorStatus(err), err.Error())
+			return
 		}
+		c.JSON(http.StatusOK, hit)
+	}
+}
 
-		id := strings.TrimSuffix(entry.Name(), ".json")
-		filePath := filepath.Join(pendingDir, entry.Name())
-
-		data, err := os.ReadFile(filePath)
+// handleGetBrainMemoryProvenance GET /api/admin/v1/brain/{facts,summaries}/:id/provenance
+// Returns where a memory came from: sessions, messages, tool calls, sub-agent
+// runs and URLs, with the original excerpts, including those of the
+// duplicates merged into it.
+func (s *Server) handleGetBrainMemoryProvenance(collection string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		prov, err := s.Gateway.PrimaryAgent.Eng.GetBrainMemoryProvenance(c.Request.Context(), collection, c.Param("id"))
 		if err != nil {
-			continue
+			s.sendError(c, brainErrorStatus(err), err.Error())
+			return
 		}
+		c.JSON(http.StatusOK, prov)
+	}
+}
 
-		type pendingInfo struct {
-			Status    string    `json:"status"`
-			Question  string    `json:"question"`
-			SessionID string    `json:"session_id"`
-			Created   time.Time `json:"created"`
-		}
-		var h pendingInfo
-		if err := json.Unmarshal(data, &h); err != nil {
-			continue
+// handleUpdateBrainMemory PATCH /api/admin/v1/brain/{facts,summaries}/:id
+// Edits the content or metadata, pins or unpins and deprecates or restores a memory.
+func (s *Server) handleUpdateBrainMemory(collection string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req BrainMemoryPatch
+		if err := c.ShouldBindJSON(&req); err != nil {
+			s.sendError(c, http.StatusBadRequest, err.Error())
+			return
 		}
-
-		if h.Status != "pending" {
-			continue
+		hit, err := s.Gateway.PrimaryAgent.Eng.UpdateBrainMemory(c.Request.Context(), collection, c.Param("id"), memory.MemoryPatch{
+			Content:    req.Content,
+			Metadata:   req.Metadata,
+			Pinned:     req.Pinned,
+			Deprecated: req.Deprecated,
+		})
+		if err != nil {
+			s.sendError(c, brainErrorStatus(err), err.Error())
+			return
 		}
+		c.JSON(http.StatusOK, hit)
+	}
+}
 
-		if sessionID != "" && h.SessionID != sessionID {
-			continue
+// handleDeleteBrainMemory DELETE /api/admin/v1/brain/{facts,summaries}/:id
+func (s *Server) handleDeleteBrainMemory(collection string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := s.Gateway.PrimaryAgent.Eng.DeleteBrainMemory(c.Request.Context(), collection, c.Param("id")); err != nil {
+			s.sendError(c, brainErrorStatus(err), err.Error())
+			return
 		}
+		c.JSON(http.StatusOK, gin.H{"status": "deleted", "id": c.Param("id")})
+	}
+}
 
-		pendings = append(pendings, HumanPending{
-			ID:        id,
-			Question:  h.Question,
-			SessionID: h.SessionID,
-			Created:   h.Created,
-		})
+// handleExportBrain GET /api/admin/v1/brain/export
+// Downloads a brain archive: the facts, summaries, Mole-Syn steps, soul.md and human.md.
+func (s *Server) handleExportBrain(c *gin.Context) {
+	snap, err := s.Gateway.PrimaryAgent.Eng.ExportBrain(c.Request.Context())
+	if err != nil {
+		s.sendError(c, http.StatusInternalServerError, err.Error())
+		return
 	}
+	filename := fmt.Sprintf("miri-brain-%s.json.gz", snap.CreatedAt.Format("20060102-150405"))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Header("Content-Type", "application/gzip")
+	c.Status(http.StatusOK)
+	if err := memory.WriteSnapshot(c.Writer, snap); err != nil {
+		slog.Error("failed to write brain archive", "error", err)
+	}
+}
 
-	c.JSON(http.StatusOK, pendings)
+// handleImportBrain POST /api/admin/v1/brain/import?mode=merge|replace
+// Loads a brain archive sent as the body or as the multipart file "file".
+func (s *Server) handleImportBrain(c *gin.Context) {
+	mode := c.DefaultQuery("mode", "merge")
+	if mode != "merge" && mode != "replace" {
+		s.sendError(c, http.StatusBadRequest, "mode must be merge or replace")
+		return
+	}
+	snap, err := readSnapshotUpload(c)
+	if err != nil {
+		s.sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	res, err := s.Gateway.PrimaryAgent.Eng.ImportBrain(c.Request.Context(), snap, mode == "replace")
+	if err != nil {
+		s.sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, res)
 }
 
-func (s *Server) handleHumanResponse(c *gin.Context) {
-	id := c.Param("id")
-	if id == "" {
-		s.sendError(c, http.StatusBadRequest, "id required")
+// handleDiffBrain POST /api/admin/v1/brain/diff
+// Compares the current brain to an uploaded archive, i.e. what importing it
+// with mode=replace would change.
+func (s *Server) handleDiffBrain(c *gin.Context) {
+	snap, err := readSnapshotUpload(c)
+	if err != nil {
+		s.sendError(c, http.StatusBadRequest, err.Error())
 		return
 	}
-	safeID := filepath.Base(id)
-	if safeID != id {
-		s.sendError(c, http.StatusBadRequest, "invalid id (path traversal not allowed)")
+	current, err := s.Gateway.PrimaryAgent.Eng.ExportBrain(c.Request.Context())
+	if err != nil {
+		s.sendError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
+	c.JSON(http.StatusOK, memory.DiffSnapshots(current, snap))
+}
 
-	gw := c.MustGet("gateway").(*gateway.Gateway)
-	pendingDir := filepath.Join(gw.Config.StorageDir, "human_pending")
-	filePath := filepath.Join(pendingDir, safeID+".json")
+// readSnapshotUpload reads the brain archive of a request.
+func readSnapshotUpload(c *gin.Context) (*memory.Snapshot, error) {
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			return nil, fmt.Errorf("no file uploaded: %w", err)
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return memory.ReadSnapshot(f)
+	}
+	return memory.ReadSnapshot(c.Request.Body)
+}
+
+// brainErrorStatus maps errors of the Brain's memories to HTTP statuses.
+func brainErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, memory.ErrMemoryNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, memory.ErrUnknownCollection):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
 
-	data, err := os.ReadFile(filePath)
+func (s *Server) handleGetBrainTopology(c *gin.Context) {
+	sessionID := c.Query("session_id")
+	topology, err := s.Gateway.PrimaryAgent.Eng.GetBrainTopology(c.Request.Context(), sessionID)
 	if err != nil {
-		s.sendError(c, http.StatusNotFound, "human pending not found")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	c.JSON(http.StatusOK, topology)
+}
 
-	var h map[string]any
-	if err := json.Unmarshal(data, &h); err != nil {
-		s.sendError(c, http.StatusInternalServerError, "invalid pending JSON")
+func (s *Server) handleListHumanPending(c *gin.Context) {
+	gw := c.MustGet("gateway").(*gateway.Gateway)
+	pending, err := gw.PendingHumanQuestions(c.Query("session_id"))
+	if err != nil {
+		s.sendError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if pending == nil {
+		pending = []*storage.HumanQuestion{}
+	}
+	c.JSON(http.StatusOK, pending)
+}
 
-	if h["status"] != "pending" {
-		s.sendError(c, http.StatusBadRequest, "not pending")
+// handleHumanResponse POST /api/admin/v1/human/response/:id
+// Answers a pending question; the run that asked it continues in the background.
+func (s *Server) handleHumanResponse(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		s.sendError(c, http.StatusBadRequest, "id required")
+		return
+	}
+	safeID := filepath.Base(id)
+	if safeID != id {
+		s.sendError(c, http.StatusBadRequest, "invalid id (path traversal not allowed)")
 		return
 	}
 
@@ -850,21 +1034,25 @@ func (s *Server) handleHumanResponse(c *gin.Context) {
 		return
 	}
 
-	h["status"] = "answered"
-	h["response"] = r.Response
-
-	newData, err := json.MarshalIndent(h, "", "  ")
+	gw := c.MustGet("gateway").(*gateway.Gateway)
+	q, err := gw.AnswerHumanQuestion(safeID, r.Response)
 	if err != nil {
-		s.sendError(c, http.StatusInternalServerError, err.Error())
+		switch {
+		case os.IsNotExist(err):
+			s.sendError(c, http.StatusNotFound, "human pending not found")
+		case errors.Is(err, gateway.ErrQuestionNotPending):
+			s.sendError(c, http.StatusBadRequest, "not pending")
+		default:
+			s.sendError(c, http.StatusInternalServerError, err.Error())
+		}
 		return
 	}
 
-	if err := os.WriteFile(filePath, newData, 0644); err != nil {
-		s.sendError(c, http.StatusInternalServerError, err.Error())
-		return
+	res := gin.H{"status": "responded", "id": id}
+	if q.RunID != "" {
+		res["run_id"] = q.RunID
 	}
-
-	c.JSON(http.StatusOK, gin.H{"status": "responded", "id": id})
+	c.JSON(http.StatusOK, res)
 }
 
 // handleSpawnSubAgent POST /api/v1/subagents
@@ -942,6 +1130,221 @@ func (s *Server) handleCancelSubAgentRun(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "canceled"})
 }
 
+// handleListRuns GET /api/admin/v1/runs
+// Lists interrupted agent runs with the step and last tool they stopped at.
+func (s *Server) handleListRuns(c *gin.Context) {
+	gw := c.MustGet("gateway").(*gateway.Gateway)
+	runs, err := gw.ListRuns()
+	if err != nil {
+		s.sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if runs == nil {
+		runs = []engine.RunInfo{}
+	}
+	c.JSON(http.StatusOK, runs)
+}
+
+// handleResumeRun POST /api/admin/v1/runs/:id/resume
+// Continues an interrupted run from its last checkpointed tool step and returns the answer.
+func (s *Server) handleResumeRun(c *gin.Context) {
+	gw := c.MustGet("gateway").(*gateway.Gateway)
+	response, usage, err := gw.ResumeRun(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		s.sendError(c, runErrorStatus(err), err.Error())
+		return
+	}
+	res := gin.H{"response": response, "run_id": c.Param("id")}
+	if usage != nil {
+		res["model"] = usage.Model
+		res["usage"] = usage
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// handleDiscardRun DELETE /api/admin/v1/runs/:id
+func (s *Server) handleDiscardRun(c *gin.Context) {
+	gw := c.MustGet("gateway").(*gateway.Gateway)
+	if err := gw.DiscardRun(c.Param("id")); err != nil {
+		s.sendError(c, runErrorStatus(err), err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "discarded"})
+}
+
+// handleListApprovals GET /api/admin/v1/approvals
+// Lists the tool calls waiting for approval, optionally of one session.
+func (s *Server) handleListApprovals(c *gin.Context) {
+	gw := c.MustGet("gateway").(*gateway.Gateway)
+	c.JSON(http.StatusOK, gw.PendingApprovals(c.Query("session_id")))
+}
+
+// handleApproveToolCall POST /api/admin/v1/approvals/:id/approve
+func (s *Server) handleApproveToolCall(c *gin.Context) {
+	s.decideApproval(c, true)
+}
+
+// handleDenyToolCall POST /api/admin/v1/approvals/:id/deny
+// An optional {"reason": "..."} is passed to the agent.
+func (s *Server) handleDenyToolCall(c *gin.Context) {
+	s.decideApproval(c, false)
+}
+
+func (s *Server) decideApproval(c *gin.Context, approved bool) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			s.sendError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	gw := c.MustGet("gateway").(*gateway.Gateway)
+	if err := gw.DecideApproval(c.Param("id"), approved, req.Reason); err != nil {
+		if errors.Is(err, gateway.ErrApprovalNotFound) {
+			s.sendError(c, http.StatusNotFound, err.Error())
+			return
+		}
+		s.sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	status := "denied"
+	if approved {
+		status = "approved"
+	}
+	c.JSON(http.StatusOK, gin.H{"status": status, "id": c.Param("id")})
+}
+
+// handleGetCosts GET /api/admin/v1/costs
+// Totals the cost ledger by day (default), model, provider, source or session.
+func (s *Server) handleGetCosts(c *gin.Context) {
+	var q CostQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		s.sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter, err := q.filter()
+	if err != nil {
+		s.sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if q.GroupBy == "" {
+		q.GroupBy = "day"
+	}
+	gw := c.MustGet("gateway").(*gateway.Gateway)
+	ss, err := gw.Storage.SessionStore()
+	if err != nil {
+		s.sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	groups, err := ss.CostSummary(filter, q.GroupBy)
+	if err != nil {
+		if errors.Is(err, storage.ErrUnknownCostGroup) {
+			s.sendError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var calls int
+	var total float64
+	for _, g := range groups {
+		calls += g.Calls
+		total += g.Cost
+	}
+	c.JSON(http.StatusOK, gin.H{"group_by": q.GroupBy, "groups": groups, "calls": calls, "total_cost": total})
+}
+
+// handleListCostEntries GET /api/admin/v1/costs/entries
+// Lists the cost ledger entries, newest first.
+func (s *Server) handleListCostEntries(c *gin.Context) {
+	var q CostQuery
+	var pq PaginationQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		s.sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := c.ShouldBindQuery(&pq); err != nil {
+		s.sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter, err := q.filter()
+	if err != nil {
+		s.sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit := pq.Limit
+	if limit == 0 {
+		limit = 50
+	}
+	gw := c.MustGet("gateway").(*gateway.Gateway)
+	ss, err := gw.Storage.SessionStore()
+	if err != nil {
+		s.sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	entries, total, err := ss.CostEntries(filter, limit, pq.Offset)
+	if err != nil {
+		s.sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, PaginatedResponse{Data: entries, Total: total, Limit: limit, Offset: pq.Offset})
+}
+
+// filter converts the query into a ledger filter.
+func (q CostQuery) filter() (storage.CostFilter, error) {
+	f := storage.CostFilter{Source: q.Source, Model: q.Model, Provider: q.Provider, SessionID: q.SessionID, TaskID: q.TaskID}
+	var err error
+	if f.From, err = parseCostTime(q.From, false); err != nil {
+		return f, fmt.Errorf("invalid from: %w", err)
+	}
+	if f.To, err = parseCostTime(q.To, true); err != nil {
+		return f, fmt.Errorf("invalid to: %w", err)
+	}
+	return f, nil
+}
+
+// parseCostTime parses a date or an RFC 3339 time. A date used as the end of a
+// range includes the whole day.
+func parseCostTime(v string, end bool) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.Parse(time.DateOnly, v); err == nil {
+		if end {
+			d = d.AddDate(0, 0, 1)
+		}
+		return d, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// promptErrorStatus maps errors of a prompt: bad attachments are the client's fault.
+func promptErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, engine.ErrAttachment):
+		return http.StatusBadRequest
+	case errors.Is(err, budget.ErrExceeded):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func runErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, engine.ErrRunNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, engine.ErrRunActive), errors.Is(err, engine.ErrRunWaiting):
+		return http.StatusConflict
+	case errors.Is(err, budget.ErrExceeded):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 // handleDream POST /api/v1/dream
 // Runs n offline chain-of-thought simulations for the given goal,
 // scores each path, persists the best plan to memory, and returns a report.
@@ -959,10 +1362,11 @@ func (s *Server) handleDream(c *gin.Context) {
 		req.Paths = 10
 	}
 	sim := dream.New(gw.PrimaryAgent.Config, gw.PrimaryAgent.Storage)
+	sim.SetBudget(gw.Budget())
 	report, err := sim.Run(c.Request.Context(), req.Goal, req.Paths)
 	if err != nil {
 		slog.Error("dream simulation failed", "goal", req.Goal, "error", err)
-		s.sendError(c, http.StatusInternalServerError, err.Error())
+		s.sendError(c, promptErrorStatus(err), err.Error())
 		return
 	}
 	c.JSON(http.StatusOK, report)
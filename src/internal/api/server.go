@@ -3,6 +3,8 @@ package api
 import (
 	"context"
 	"log/slog"
+	"miri-main/src/internal/engine"
+	"miri-main/src/internal/engine/memory"
 	"miri-main/src/internal/gateway"
 	"miri-main/src/internal/session"
 	"net/http"
@@ -14,7 +16,6 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"github.com/gorilla/websocket"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
@@ -28,7 +29,7 @@ type Server struct {
 
 	// WebSocket session tracking
 	wsMu       sync.RWMutex
-	wsSessions map[string][]*websocket.Conn
+	wsSessions map[string][]*wsConn
 }
 
 var (
@@ -67,7 +68,7 @@ func NewServer(gw *gateway.Gateway) *Server {
 	s := &Server{
 		Gateway:    gw,
 		Engine:     e,
-		wsSessions: make(map[string][]*websocket.Conn),
+		wsSessions: make(map[string][]*wsConn),
 	}
 	s.Engine.Use(s.corsMiddleware())
 	s.Engine.Use(s.recoveryMiddleware())
@@ -78,6 +79,8 @@ func NewServer(gw *gateway.Gateway) *Server {
 	s.setupRoutesStatic()
 	s.Engine.GET("/metrics", gin.WrapH(promhttp.Handler()))
 	s.Gateway.SetTaskReportHandler(s.handleTaskReport)
+	s.Gateway.SetHumanQuestionHandler(s.handleHumanQuestion)
+	s.Gateway.SetApprovalHandler(s.handleApprovalRequest)
 	return s
 }
 
@@ -107,7 +110,38 @@ func (s *Server) handleTaskReport(sessionID, taskName, taskID, message string) {
 	if sessionID == "" {
 		sessionID = session.DefaultSessionID
 	}
+	s.broadcast(sessionID, gin.H{
+		"response":   message,
+		"source":     "task",
+		"task_id":    taskID,
+		"task_name":  taskName,
+		"session_id": sessionID,
+	})
+}
+
+// handleHumanQuestion pushes a question of the agent (kind "question") or the result
+// of the run its answer continued (kind "answer") to the session's WebSocket clients.
+func (s *Server) handleHumanQuestion(sessionID, questionID, kind, message string) {
+	s.broadcast(sessionID, gin.H{
+		"response":    message,
+		"source":      "ask_human",
+		"kind":        kind,
+		"question_id": questionID,
+		"session_id":  sessionID,
+	})
+}
+
+// handleApprovalRequest pushes a tool call waiting for approval to the session's WebSocket clients.
+func (s *Server) handleApprovalRequest(sessionID string, req *engine.ApprovalRequest) {
+	s.broadcast(sessionID, gin.H{
+		"source":     "approval",
+		"approval":   req,
+		"session_id": sessionID,
+	})
+}
 
+// broadcast sends a JSON message to every WebSocket client of a session.
+func (s *Server) broadcast(sessionID string, msg gin.H) {
 	s.wsMu.RLock()
 	conns, ok := s.wsSessions[sessionID]
 	s.wsMu.RUnlock()
@@ -116,18 +150,11 @@ func (s *Server) handleTaskReport(sessionID, taskName, taskID, message string) {
 		return
 	}
 
-	slog.Info("Broadcasting task report to session", "session_id", sessionID, "task_id", taskID, "conns", len(conns))
+	slog.Info("Broadcasting to session", "session_id", sessionID, "source", msg["source"], "conns", len(conns))
 
 	for _, conn := range conns {
-		err := conn.WriteJSON(gin.H{
-			"response":   message,
-			"source":     "task",
-			"task_id":    taskID,
-			"task_name":  taskName,
-			"session_id": sessionID,
-		})
-		if err != nil {
-			slog.Warn("Failed to send task report to websocket", "session_id", sessionID, "error", err)
+		if err := conn.WriteJSON(msg); err != nil {
+			slog.Warn("Failed to send to websocket", "session_id", sessionID, "source", msg["source"], "error", err)
 		}
 	}
 }
@@ -183,6 +210,10 @@ func (s *Server) setupRoutesAdmin() {
 		admin.GET("/skills/:name", s.handleGetSkill)
 		admin.DELETE("/skills/:name", s.handleRemoveSkill)
 
+		// Dynamic tools
+		admin.GET("/tools", s.handleListDynamicTools)
+		admin.POST("/tools/reload", s.handleReloadDynamicTools)
+
 		// Task management
 		admin.GET("/tasks", s.handleListTasks)
 		admin.GET("/tasks/:id", s.handleGetTask)
@@ -191,6 +222,17 @@ func (s *Server) setupRoutesAdmin() {
 		admin.GET("/brain/facts", s.handleGetBrainFacts)
 		admin.GET("/brain/summaries", s.handleGetBrainSummaries)
 		admin.GET("/brain/topology", s.handleGetBrainTopology)
+		admin.GET("/brain/search", s.handleSearchBrain)
+		admin.GET("/brain/export", s.handleExportBrain)
+		admin.POST("/brain/import", s.handleImportBrain)
+		admin.POST("/brain/diff", s.handleDiffBrain)
+		for _, collection := range []string{memory.CollectionFacts, memory.CollectionSummaries} {
+			admin.POST("/brain/"+collection, s.handleAddBrainMemory(collection))
+			admin.GET("/brain/"+collection+"/:id", s.handleGetBrainMemory(collection))
+			admin.GET("/brain/"+collection+"/:id/provenance", s.handleGetBrainMemoryProvenance(collection))
+			admin.PATCH("/brain/"+collection+"/:id", s.handleUpdateBrainMemory(collection))
+			admin.DELETE("/brain/"+collection+"/:id", s.handleDeleteBrainMemory(collection))
+		}
 
 		// human
 		admin.GET("/human", s.handleGetHuman)
@@ -203,6 +245,20 @@ func (s *Server) setupRoutesAdmin() {
 		admin.GET("/subagents/:id", s.handleGetSubAgentRun)
 		admin.GET("/subagents/:id/transcript", s.handleGetSubAgentTranscript)
 		admin.DELETE("/subagents/:id", s.handleCancelSubAgentRun)
+
+		// Interrupted agent runs
+		admin.GET("/runs", s.handleListRuns)
+		admin.POST("/runs/:id/resume", s.handleResumeRun)
+		admin.DELETE("/runs/:id", s.handleDiscardRun)
+
+		// Tool calls waiting for approval
+		admin.GET("/approvals", s.handleListApprovals)
+		admin.POST("/approvals/:id/approve", s.handleApproveToolCall)
+		admin.POST("/approvals/:id/deny", s.handleDenyToolCall)
+
+		// Cost ledger
+		admin.GET("/costs", s.handleGetCosts)
+		admin.GET("/costs/entries", s.handleListCostEntries)
 	}
 }
 
@@ -340,7 +396,7 @@ func (s *Server) sendError(c *gin.Context, code int, msg string) {
 	c.Abort()
 }
 
-func (s *Server) sendWSError(ws *websocket.Conn, code int, msg string) error {
+func (s *Server) sendWSError(ws *wsConn, code int, msg string) error {
 	return ws.WriteJSON(APIError{
 		Code:    code,
 		Message: msg,
@@ -390,6 +446,7 @@ func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
 		slog.Info("triggering engine shutdown...")
 		s.Gateway.PrimaryAgent.Shutdown(ctxShut)
 	}
+	engine.CloseMCPServers()
 
 	slog.Info("server stopped")
 
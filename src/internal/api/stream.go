@@ -8,6 +8,7 @@ import (
 	"miri-main/src/internal/session"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"slices"
@@ -27,23 +28,64 @@ func (s *Server) handlePromptStream(c *gin.Context) {
 		Model: q.Model,
 	}
 
+	sessionID := q.SessionID
+	if sessionID == "" {
+		sessionID = session.DefaultSessionID
+	}
+	if !session.ValidID(sessionID) {
+		s.sendError(c, http.StatusBadRequest, "invalid session_id")
+		return
+	}
+
 	promptsTotal.Inc()
 
 	gw := c.MustGet("gateway").(*gateway.Gateway)
-	stream, err := gw.PrimaryAgent.DelegatePromptStreamWithOptions(c.Request.Context(), session.DefaultSessionID, q.Prompt, opts)
+	stream, err := gw.PrimaryAgent.DelegatePromptStreamWithOptions(c.Request.Context(), sessionID, q.Prompt, opts)
 	if err != nil {
 		s.sendError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	// Each event is sent as an SSE event named after its type with the JSON event as data.
 	c.Stream(func(w io.Writer) bool {
-		chunk, ok := <-stream
+		ev, ok := <-stream
 		if !ok {
 			return false
 		}
-		c.SSEvent("message", chunk)
+		c.SSEvent(string(ev.Type), ev)
 		return true
 	})
+	// The client may have gone away mid-answer; let the run finish without blocking.
+	go drain(stream)
+}
+
+// drain discards the rest of a prompt stream so its producer is never blocked.
+func drain(stream <-chan engine.StreamEvent) {
+	for range stream {
+	}
+}
+
+// wsConn is a WebSocket connection that serializes its writes. The handler of a
+// session connection streams events while broadcasts of approvals, questions and
+// task reports write to it from other goroutines, and gorilla/websocket allows
+// only one concurrent writer.
+type wsConn struct {
+	*websocket.Conn
+	writeMu sync.Mutex
+}
+
+func (w *wsConn) WriteJSON(v any) error {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+	return w.Conn.WriteJSON(v)
+}
+
+// ping sends a ping message, giving up after wait.
+func (w *wsConn) ping(wait time.Duration) error {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+	w.Conn.SetWriteDeadline(time.Now().Add(wait))
+	return w.Conn.WriteMessage(websocket.PingMessage, nil)
 }
 
 func (s *Server) handleWebsocket(c *gin.Context) {
@@ -51,7 +93,7 @@ func (s *Server) handleWebsocket(c *gin.Context) {
 		writeWait      = 10 * time.Second
 		pongWait       = 60 * time.Second
 		pingPeriod     = (pongWait * 9) / 10
-		maxMessageSize = 524288
+		maxMessageSize = 32 << 20 // room for inline base64 images
 	)
 
 	gw := c.MustGet("gateway").(*gateway.Gateway)
@@ -81,11 +123,12 @@ func (s *Server) handleWebsocket(c *gin.Context) {
 				upgrader.Subprotocols = parts
 			}
 		}
-		ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 		if err != nil {
 			slog.Error("ws upgrade failed", "error", err)
 			return
 		}
+		ws := &wsConn{Conn: conn}
 		defer ws.Close()
 
 		ws.SetReadLimit(int64(maxMessageSize))
@@ -110,13 +153,14 @@ func (s *Server) handleWebsocket(c *gin.Context) {
 			}
 
 			if streamReq {
-				stream, err := gw.PrimaryAgent.DelegatePromptStream(device, msg.Prompt)
+				stream, err := gw.PrimaryAgent.DelegatePromptStream(session.ChannelSessionID(channel, device), msg.Prompt)
 				if err != nil {
 					s.sendWSError(ws, http.StatusInternalServerError, err.Error())
 					continue
 				}
-				for chunk := range stream {
-					if err := ws.WriteJSON(gin.H{"response": chunk, "stream": true}); err != nil {
+				for ev := range stream {
+					if err := ws.WriteJSON(gin.H{"event": ev, "stream": true}); err != nil {
+						go drain(stream)
 						break
 					}
 				}
@@ -136,8 +180,7 @@ func (s *Server) handleWebsocket(c *gin.Context) {
 			// Send ping if ticker fired during processing
 			select {
 			case <-pingTicker.C:
-				ws.SetWriteDeadline(time.Now().Add(writeWait))
-				if err := ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+				if err := ws.ping(writeWait); err != nil {
 					slog.Error("channel WS ping failed", "err", err)
 					return
 				}
@@ -147,7 +190,14 @@ func (s *Server) handleWebsocket(c *gin.Context) {
 		return
 	}
 
-	sessionID := session.DefaultSessionID
+	sessionID := c.Query("session_id")
+	if sessionID == "" {
+		sessionID = session.DefaultSessionID
+	}
+	if !session.ValidID(sessionID) {
+		s.sendError(c, http.StatusBadRequest, "invalid session_id")
+		return
+	}
 
 	upgrader := websocket.Upgrader{
 		CheckOrigin: func(r *http.Request) bool {
@@ -169,11 +219,12 @@ func (s *Server) handleWebsocket(c *gin.Context) {
 			upgrader.Subprotocols = parts
 		}
 	}
-	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		slog.Error("ws upgrade failed", "error", err)
 		return
 	}
+	ws := &wsConn{Conn: conn}
 	defer ws.Close()
 
 	ws.SetReadLimit(int64(maxMessageSize))
@@ -193,7 +244,7 @@ func (s *Server) handleWebsocket(c *gin.Context) {
 		s.wsMu.Lock()
 		defer s.wsMu.Unlock()
 		conns := s.wsSessions[sessionID]
-		s.wsSessions[sessionID] = slices.DeleteFunc(conns, func(c *websocket.Conn) bool {
+		s.wsSessions[sessionID] = slices.DeleteFunc(conns, func(c *wsConn) bool {
 			return c == ws
 		})
 		if len(s.wsSessions[sessionID]) == 0 {
@@ -204,13 +255,14 @@ func (s *Server) handleWebsocket(c *gin.Context) {
 	for {
 		ws.SetReadDeadline(time.Now().Add(pongWait))
 		var msg struct {
-			Prompt  string          `json:"prompt"`
-			Options *engine.Options `json:"options,omitempty"`
-			Stream  *bool           `json:"stream,omitempty"`
+			Prompt      string              `json:"prompt"`
+			Options     *engine.Options     `json:"options,omitempty"`
+			Stream      *bool               `json:"stream,omitempty"`
+			Attachments []engine.Attachment `json:"attachments,omitempty"`
 		}
 		if err := ws.ReadJSON(&msg); err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
-				slog.Warn("default session WS unexpected close", "session", sessionID, "err", err)
+				slog.Warn("session WS unexpected close", "session", sessionID, "err", err)
 			}
 			break
 		}
@@ -224,15 +276,19 @@ func (s *Server) handleWebsocket(c *gin.Context) {
 		if msg.Options != nil {
 			opts = *msg.Options
 		}
+		if len(msg.Attachments) > 0 {
+			opts.Attachments = append(opts.Attachments, msg.Attachments...)
+		}
 
 		if isStreaming {
 			stream, err := gw.PrimaryAgent.DelegatePromptStreamWithOptions(c.Request.Context(), sessionID, msg.Prompt, opts)
 			if err != nil {
-				s.sendWSError(ws, http.StatusInternalServerError, err.Error())
+				s.sendWSError(ws, promptErrorStatus(err), err.Error())
 				continue
 			}
-			for chunk := range stream {
-				if err := ws.WriteJSON(gin.H{"response": chunk, "stream": true}); err != nil {
+			for ev := range stream {
+				if err := ws.WriteJSON(gin.H{"event": ev, "stream": true}); err != nil {
+					go drain(stream)
 					break
 				}
 			}
@@ -240,7 +296,7 @@ func (s *Server) handleWebsocket(c *gin.Context) {
 		} else {
 			response, err := gw.PrimaryAgent.DelegatePromptWithOptions(c.Request.Context(), sessionID, msg.Prompt, opts)
 			if err != nil {
-				s.sendWSError(ws, http.StatusInternalServerError, err.Error())
+				s.sendWSError(ws, promptErrorStatus(err), err.Error())
 				continue
 			}
 
@@ -252,9 +308,8 @@ func (s *Server) handleWebsocket(c *gin.Context) {
 		// Send ping if ticker fired during processing
 		select {
 		case <-pingTicker.C:
-			ws.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := ws.WriteMessage(websocket.PingMessage, nil); err != nil {
-				slog.Error("default session WS ping failed", "session", sessionID, "err", err)
+			if err := ws.ping(writeWait); err != nil {
+				slog.Error("session WS ping failed", "session", sessionID, "err", err)
 				return
 			}
 		default:
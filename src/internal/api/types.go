@@ -18,6 +18,49 @@ type PaginationQuery struct {
 	Offset int `form:"offset" binding:"omitempty,min=0"`
 }
 
+// CostQuery filters the cost ledger. From and To are dates (2006-01-02, To
+// inclusive) or RFC 3339 times (To exclusive).
+type CostQuery struct {
+	From      string `form:"from"`
+	To        string `form:"to"`
+	Source    string `form:"source"`
+	Model     string `form:"model"`
+	Provider  string `form:"provider"`
+	SessionID string `form:"session_id"`
+	TaskID    string `form:"task_id"`
+	GroupBy   string `form:"group_by"`
+}
+
+// BrainSearchQuery filters the memories of the Brain. Q ranks them like
+// retrieval does; From and To bound created_at like CostQuery.
+type BrainSearchQuery struct {
+	Q          string `form:"q"`
+	Collection string `form:"collection" binding:"omitempty,oneof=facts summaries"`
+	Type       string `form:"type"`
+	Deprecated *bool  `form:"deprecated"`
+	Pinned     *bool  `form:"pinned"`
+	SessionID  string `form:"session_id"`
+	From       string `form:"from"`
+	To         string `form:"to"`
+	Limit      int    `form:"limit" binding:"omitempty,min=1,max=1000"`
+	Offset     int    `form:"offset" binding:"omitempty,min=0"`
+}
+
+// BrainMemoryRequest creates a fact or summary of the Brain.
+type BrainMemoryRequest struct {
+	Content  string            `json:"content" binding:"required"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// BrainMemoryPatch edits a fact or summary of the Brain. Omitted fields are
+// left unchanged; an empty metadata value removes the key.
+type BrainMemoryPatch struct {
+	Content    string            `json:"content,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	Pinned     *bool             `json:"pinned,omitempty"`
+	Deprecated *bool             `json:"deprecated,omitempty"`
+}
+
 type SessionQuery struct {
 	SessionID string `form:"session_id" binding:"required"`
 }
@@ -29,8 +72,9 @@ type SessionPaginationQuery struct {
 }
 
 type PromptQuery struct {
-	Prompt string `form:"prompt" binding:"required"`
-	Model  string `form:"model"`
+	Prompt    string `form:"prompt" binding:"required"`
+	Model     string `form:"model"`
+	SessionID string `form:"session_id"`
 }
 
 type InteractionRequest struct {
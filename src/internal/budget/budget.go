@@ -0,0 +1,194 @@
+// Package budget enforces the spending limits of agents.budgets against the cost
+// ledger: before a model call, the tracker decides whether it may use the
+// configured model, must degrade to the cheaper fallback model or is refused.
+package budget
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"miri-main/src/internal/config"
+	"miri-main/src/internal/session"
+	"miri-main/src/internal/storage"
+)
+
+// ErrExceeded is returned for model calls refused because a budget is used up.
+var ErrExceeded = errors.New("spending budget exceeded")
+
+// defaultFallbackAt is the share of a limit from which calls degrade to the fallback model.
+const defaultFallbackAt = 0.8
+
+// defaultAlertAt are the shares of a limit at which alerts are sent.
+var defaultAlertAt = []float64{0.8, 1}
+
+// Spending reports what the ledger entries matching a filter cost; *storage.Storage
+// implements it.
+type Spending interface {
+	SpentCost(f storage.CostFilter) (float64, error)
+}
+
+// Call describes a model call about to be made.
+type Call struct {
+	// Provider is the provider of the model the call goes to.
+	Provider  string
+	SessionID string
+	// TaskID is the cron task the call is made for, if any.
+	TaskID string
+}
+
+// Tracker checks model calls against the configured budgets and sends an alert
+// the first time a budget reaches each of its alert thresholds.
+type Tracker struct {
+	ledger Spending
+	alert  func(message string)
+	now    func() time.Time
+
+	mu  sync.Mutex
+	cfg *config.Config
+	// alerted holds the thresholds already alerted, by limit, period and threshold.
+	alerted map[string]bool
+}
+
+// New creates a tracker of the budgets of cfg. alert, if set, receives the alert
+// messages.
+func New(cfg *config.Config, ledger Spending, alert func(message string)) *Tracker {
+	return &Tracker{cfg: cfg, ledger: ledger, alert: alert, now: time.Now, alerted: make(map[string]bool)}
+}
+
+// limit is a budget that applies to a call.
+type limit struct {
+	name string
+	// period identifies the day, month or run the limit is counted over.
+	period   string
+	amount   float64
+	filter   storage.CostFilter
+	provider bool
+}
+
+// SetConfig makes the tracker enforce the budgets of cfg, e.g. after the config
+// is updated.
+func (t *Tracker) SetConfig(cfg *config.Config) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cfg = cfg
+}
+
+func (t *Tracker) budgets() config.BudgetConfig {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.cfg.Agents.Budgets
+}
+
+func (t *Tracker) limits(b config.BudgetConfig, c Call) []limit {
+	now := t.now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	today := day.Format(time.DateOnly)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	var out []limit
+	if b.Daily > 0 {
+		out = append(out, limit{name: "daily budget", period: today, amount: b.Daily, filter: storage.CostFilter{From: day}})
+	}
+	if b.Monthly > 0 {
+		out = append(out, limit{name: "monthly budget", period: month.Format("2006-01"), amount: b.Monthly, filter: storage.CostFilter{From: month}})
+	}
+	if amount := b.Providers[c.Provider]; amount > 0 {
+		out = append(out, limit{name: "daily budget of provider " + c.Provider, period: today, amount: amount,
+			filter: storage.CostFilter{From: day, Provider: c.Provider}, provider: true})
+	}
+	switch {
+	case session.IsSubAgent(c.SessionID):
+		if b.SubAgent > 0 {
+			out = append(out, limit{name: "budget of sub-agent run " + c.SessionID, period: c.SessionID, amount: b.SubAgent,
+				filter: storage.CostFilter{SessionID: c.SessionID}})
+		}
+	case c.SessionID != "" && b.Session > 0:
+		out = append(out, limit{name: "daily budget of session " + c.SessionID, period: today, amount: b.Session,
+			filter: storage.CostFilter{From: day, SessionID: c.SessionID}})
+	}
+	if c.TaskID != "" && b.Task > 0 {
+		out = append(out, limit{name: "daily budget of task " + c.TaskID, period: today, amount: b.Task,
+			filter: storage.CostFilter{From: day, TaskID: c.TaskID}})
+	}
+	return out
+}
+
+// Check decides on a call: fallback is true when it should go to the fallback model
+// (see FallbackModel) instead, and the error wraps ErrExceeded when it is refused.
+// A fallback call is to be checked again with the fallback's provider.
+func (t *Tracker) Check(c Call) (fallback bool, err error) {
+	if t == nil {
+		return false, nil
+	}
+	b := t.budgets()
+	fallbackProvider, _, _ := strings.Cut(b.FallbackModel, "/")
+	fallbackAt := b.FallbackAt
+	if fallbackAt <= 0 {
+		fallbackAt = defaultFallbackAt
+	}
+	for _, l := range t.limits(b, c) {
+		spent, err := t.ledger.SpentCost(l.filter)
+		if err != nil {
+			// Budgets must not take the agent down with the ledger.
+			slog.Warn("budget: failed to read spending", "budget", l.name, "error", err)
+			continue
+		}
+		t.alertAt(b, l, spent)
+		switch {
+		case spent >= l.amount:
+			if l.provider && b.FallbackModel != "" && fallbackProvider != c.Provider {
+				fallback = true
+				continue
+			}
+			return false, fmt.Errorf("%w: %s of %.2f is used up (%.2f spent)", ErrExceeded, l.name, l.amount, spent)
+		case b.FallbackModel != "" && spent >= fallbackAt*l.amount:
+			fallback = true
+		}
+	}
+	return fallback, nil
+}
+
+// FallbackModel returns the "provider/model" calls degrade to, or "" for none.
+func (t *Tracker) FallbackModel() string {
+	if t == nil {
+		return ""
+	}
+	return t.budgets().FallbackModel
+}
+
+// alertAt sends an alert for each threshold of l that spent reached for the first
+// time in the limit's period.
+func (t *Tracker) alertAt(b config.BudgetConfig, l limit, spent float64) {
+	thresholds := b.AlertAt
+	if len(thresholds) == 0 {
+		thresholds = defaultAlertAt
+	}
+	for _, th := range thresholds {
+		if th <= 0 || spent < th*l.amount {
+			continue
+		}
+		key := fmt.Sprintf("%s|%s|%g", l.name, l.period, th)
+		t.mu.Lock()
+		seen := t.alerted[key]
+		t.alerted[key] = true
+		t.mu.Unlock()
+		if seen {
+			continue
+		}
+		msg := fmt.Sprintf("Budget alert: %.0f%% of the %s used (%.2f of %.2f).", th*100, l.name, spent, l.amount)
+		if th >= 1 {
+			msg = fmt.Sprintf("Budget alert: the %s is used up (%.2f of %.2f); calls are now refused or use the fallback model.", l.name, spent, l.amount)
+		}
+		slog.Warn(msg, "budget", l.name, "period", l.period, "spent", spent, "limit", l.amount)
+		if t.alert != nil {
+			t.alert(msg)
+		}
+	}
+}
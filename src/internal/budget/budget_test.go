@@ -0,0 +1,142 @@
+package budget
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"miri-main/src/internal/config"
+	"miri-main/src/internal/session"
+	"miri-main/src/internal/storage"
+)
+
+// memSpending sums the entries matching a filter like the ledger does.
+type memSpending []storage.CostEntry
+
+func (m memSpending) SpentCost(f storage.CostFilter) (float64, error) {
+	var total float64
+	for _, e := range m {
+		if (!f.From.IsZero() && e.Time.Before(f.From)) || (!f.To.IsZero() && !e.Time.Before(f.To)) ||
+			(f.Provider != "" && e.Provider != f.Provider) || (f.SessionID != "" && e.SessionID != f.SessionID) ||
+			(f.TaskID != "" && e.TaskID != f.TaskID) {
+			continue
+		}
+		total += e.Cost
+	}
+	return total, nil
+}
+
+func newTestTracker(b config.BudgetConfig, spent memSpending) (*Tracker, *[]string) {
+	cfg := &config.Config{}
+	cfg.Agents.Budgets = b
+	var alerts []string
+	tr := New(cfg, spent, func(msg string) { alerts = append(alerts, msg) })
+	tr.now = func() time.Time { return time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC) }
+	return tr, &alerts
+}
+
+func TestTracker_Check(t *testing.T) {
+	today := time.Date(2026, 3, 15, 9, 0, 0, 0, time.UTC)
+	earlier := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	spent := memSpending{
+		{Time: earlier, Provider: "anthropic", Cost: 40},
+		{Time: today, Provider: "anthropic", SessionID: "miri:main:session", Cost: 6},
+		{Time: today, Provider: "xai", SessionID: session.SubAgentSessionPrefix + "abc", Cost: 1},
+		{Time: today, Provider: "xai", TaskID: "task-1", Cost: 2},
+	}
+
+	cases := []struct {
+		name         string
+		budgets      config.BudgetConfig
+		call         Call
+		wantFallback bool
+		wantErr      string
+	}{
+		{name: "no budgets", call: Call{Provider: "anthropic"}},
+		{name: "under daily budget", budgets: config.BudgetConfig{Daily: 100}, call: Call{Provider: "xai"}},
+		{name: "daily budget used up", budgets: config.BudgetConfig{Daily: 9}, call: Call{Provider: "xai"}, wantErr: "daily budget"},
+		{name: "monthly budget used up", budgets: config.BudgetConfig{Monthly: 45}, call: Call{Provider: "xai"}, wantErr: "monthly budget"},
+		{name: "near daily budget degrades", budgets: config.BudgetConfig{Daily: 10, FallbackModel: "xai/grok-3-mini"},
+			call: Call{Provider: "anthropic"}, wantFallback: true},
+		{name: "near daily budget without fallback", budgets: config.BudgetConfig{Daily: 10}, call: Call{Provider: "anthropic"}},
+		{name: "provider budget degrades to other provider",
+			budgets: config.BudgetConfig{Providers: map[string]float64{"anthropic": 5}, FallbackModel: "xai/grok-3-mini"},
+			call:    Call{Provider: "anthropic"}, wantFallback: true},
+		{name: "provider budget without fallback", budgets: config.BudgetConfig{Providers: map[string]float64{"anthropic": 5}},
+			call: Call{Provider: "anthropic"}, wantErr: "provider anthropic"},
+		{name: "session budget", budgets: config.BudgetConfig{Session: 5},
+			call: Call{Provider: "xai", SessionID: "miri:main:session"}, wantErr: "session miri:main:session"},
+		{name: "sub-agent run budget", budgets: config.BudgetConfig{SubAgent: 1, Session: 100},
+			call: Call{Provider: "xai", SessionID: session.SubAgentSessionPrefix + "abc"}, wantErr: "sub-agent run"},
+		{name: "task budget", budgets: config.BudgetConfig{Task: 2, FallbackModel: "xai/grok-3-mini"},
+			call: Call{Provider: "xai", TaskID: "task-1"}, wantErr: "task task-1"},
+		{name: "other task", budgets: config.BudgetConfig{Task: 2}, call: Call{Provider: "xai", TaskID: "task-2"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tr, _ := newTestTracker(tc.budgets, spent)
+			fallback, err := tr.Check(tc.call)
+			if tc.wantErr != "" {
+				if !errors.Is(err, ErrExceeded) || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected ErrExceeded mentioning %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if fallback != tc.wantFallback {
+				t.Errorf("expected fallback %v, got %v", tc.wantFallback, fallback)
+			}
+		})
+	}
+
+	var nilTracker *Tracker
+	if fallback, err := nilTracker.Check(Call{Provider: "xai"}); fallback || err != nil {
+		t.Errorf("expected a nil tracker to allow calls, got %v, %v", fallback, err)
+	}
+}
+
+func TestTracker_Alerts(t *testing.T) {
+	today := time.Date(2026, 3, 15, 9, 0, 0, 0, time.UTC)
+	spent := memSpending{{Time: today, Provider: "xai", Cost: 8.5}}
+	tr, alerts := newTestTracker(config.BudgetConfig{Daily: 10}, spent)
+
+	for range 3 {
+		if _, err := tr.Check(Call{Provider: "xai"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(*alerts) != 1 || !strings.Contains((*alerts)[0], "80% of the daily budget") {
+		t.Fatalf("expected one 80%% alert, got %q", *alerts)
+	}
+
+	tr.ledger = append(spent, storage.CostEntry{Time: today, Provider: "xai", Cost: 2})
+	if _, err := tr.Check(Call{Provider: "xai"}); !errors.Is(err, ErrExceeded) {
+		t.Fatalf("expected ErrExceeded, got %v", err)
+	}
+	if len(*alerts) != 2 || !strings.Contains((*alerts)[1], "used up") {
+		t.Errorf("expected a used-up alert, got %q", *alerts)
+	}
+}
+
+func TestTracker_SetConfig(t *testing.T) {
+	spent := memSpending{{Time: time.Date(2026, 3, 15, 9, 0, 0, 0, time.UTC), Provider: "xai", TaskID: "task-1", Cost: 2}}
+	tr, _ := newTestTracker(config.BudgetConfig{Task: 10}, spent)
+	call := Call{Provider: "xai", TaskID: "task-1"}
+	if _, err := tr.Check(call); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A lowered limit applies to the next call.
+	cfg := &config.Config{}
+	cfg.Agents.Budgets = config.BudgetConfig{Task: 1, FallbackModel: "xai/grok-3-mini"}
+	tr.SetConfig(cfg)
+	if _, err := tr.Check(call); !errors.Is(err, ErrExceeded) {
+		t.Errorf("expected the lowered task budget enforced, got %v", err)
+	}
+	if m := tr.FallbackModel(); m != "xai/grok-3-mini" {
+		t.Errorf("expected the new fallback model, got %q", m)
+	}
+}
@@ -49,10 +49,12 @@ type ModelsConfig struct {
 }
 
 type ProviderConfig struct {
-	BaseURL string        `mapstructure:"baseUrl" json:"baseUrl"`
-	APIKey  string        `mapstructure:"apiKey" json:"apiKey,omitempty"`
-	API     string        `mapstructure:"api" json:"api"`
-	Models  []ModelConfig `mapstructure:"models" json:"models"`
+	BaseURL string `mapstructure:"baseUrl" json:"baseUrl"`
+	APIKey  string `mapstructure:"apiKey" json:"apiKey,omitempty"`
+	API     string `mapstructure:"api" json:"api"`
+	// Fixtures is the scripted responses file of the "mock" API.
+	Fixtures string        `mapstructure:"fixtures" json:"fixtures,omitempty"`
+	Models   []ModelConfig `mapstructure:"models" json:"models"`
 }
 
 type ModelConfig struct {
@@ -73,18 +75,116 @@ type ModelCost struct {
 }
 
 type AgentsConfig struct {
-	Defaults  AgentDefaults `mapstructure:"defaults" json:"defaults"`
-	SubAgents int           `mapstructure:"subagents" json:"subagents"`
-	Debug     bool          `mapstructure:"debug" json:"debug"`
+	Defaults  AgentDefaults  `mapstructure:"defaults" json:"defaults"`
+	SubAgents int            `mapstructure:"subagents" json:"subagents"`
+	Debug     bool           `mapstructure:"debug" json:"debug"`
+	Cassettes CassetteConfig `mapstructure:"cassettes" json:"cassettes,omitempty"`
+	Budgets   BudgetConfig   `mapstructure:"budgets" json:"budgets,omitempty"`
+	Vault     VaultConfig    `mapstructure:"vault" json:"vault,omitempty"`
+	MCP       MCPConfig      `mapstructure:"mcp" json:"mcp,omitempty"`
+}
+
+// MCPConfig mounts the tools of external MCP (Model Context Protocol) servers.
+type MCPConfig struct {
+	// Servers by name; their tools are named "<server>__<tool>".
+	Servers map[string]MCPServerConfig `mapstructure:"servers" json:"servers,omitempty"`
+}
+
+// MCPServerConfig is an MCP server started as a subprocess speaking over stdio
+// (Command) or reached over streamable HTTP (URL).
+type MCPServerConfig struct {
+	Command string   `mapstructure:"command" json:"command,omitempty"`
+	Args    []string `mapstructure:"args" json:"args,omitempty"`
+	// Env is added to the environment of Command; values may reference $VAR.
+	Env map[string]string `mapstructure:"env" json:"env,omitempty"`
+	URL string            `mapstructure:"url" json:"url,omitempty"`
+	// Headers are sent to URL; values may reference $VAR.
+	Headers map[string]string `mapstructure:"headers" json:"headers,omitempty"`
+	// Tools limits the mounted tools to these names of the server; all by default.
+	Tools []string `mapstructure:"tools" json:"tools,omitempty"`
+	// SubAgents are the sub-agent roles (researcher, coder, reviewer) that get the
+	// tools too; all by default.
+	SubAgents []string `mapstructure:"subagents" json:"subagents,omitempty"`
+	// TimeoutSeconds bounds a tool call (default 60).
+	TimeoutSeconds int  `mapstructure:"timeout_seconds" json:"timeout_seconds,omitempty"`
+	Disabled       bool `mapstructure:"disabled" json:"disabled,omitempty"`
+}
+
+// VaultConfig extends the vault that swaps sensitive values (emails, IDs, keys) for
+// placeholders before text goes to a model and restores them in tool calls and answers.
+type VaultConfig struct {
+	// Patterns are regular expressions of further sensitive values by placeholder kind
+	// (letters and digits, e.g. "iban"); the first group of a pattern, if any, is the value.
+	Patterns map[string]string `mapstructure:"patterns" json:"patterns,omitempty"`
+}
+
+// BudgetConfig limits what model calls may cost, in the units of the models' cost
+// config. Limits are checked against the cost ledger before every model call; a
+// limit of 0 is unlimited. Days and months are UTC.
+type BudgetConfig struct {
+	Daily   float64 `mapstructure:"daily" json:"daily,omitempty"`
+	Monthly float64 `mapstructure:"monthly" json:"monthly,omitempty"`
+	// Providers limits the daily spending per provider name.
+	Providers map[string]float64 `mapstructure:"providers" json:"providers,omitempty"`
+	// Session limits the daily spending of each session.
+	Session float64 `mapstructure:"session" json:"session,omitempty"`
+	// Task limits the daily spending of each cron task.
+	Task float64 `mapstructure:"task" json:"task,omitempty"`
+	// SubAgent limits the spending of each sub-agent run.
+	SubAgent float64 `mapstructure:"subagent" json:"subagent,omitempty"`
+	// FallbackModel ("provider/model") answers instead of the configured models once
+	// a limit reaches FallbackAt of its amount (default 0.8), and when the limit of
+	// the called model's provider is used up. Without it, calls are only refused.
+	FallbackModel string  `mapstructure:"fallback_model" json:"fallback_model,omitempty"`
+	FallbackAt    float64 `mapstructure:"fallback_at" json:"fallback_at,omitempty"`
+	// AlertAt are the fractions of a limit at which an alert is sent (default 0.8 and 1).
+	AlertAt []float64 `mapstructure:"alert_at" json:"alert_at,omitempty"`
+	// AlertTarget is the "channel:device" alerts are sent to (e.g. "whatsapp:<jid>").
+	// Alerts are logged either way.
+	AlertTarget string `mapstructure:"alert_target" json:"alert_target,omitempty"`
+}
+
+// CassetteConfig records agent runs into cassette files or replays them.
+type CassetteConfig struct {
+	// Mode is "record" to write a cassette per run, "replay" to answer each prompt
+	// from the newest cassette recorded for it, or empty to do neither.
+	Mode string `mapstructure:"mode" json:"mode,omitempty"`
+	// Dir holds the cassettes (default <storage_dir>/cassettes).
+	Dir string `mapstructure:"dir" json:"dir,omitempty"`
 }
 
 type AgentDefaults struct {
-	Model ModelSelection `mapstructure:"model" json:"model"`
+	Model     ModelSelection `mapstructure:"model" json:"model"`
+	AskHuman  AskHumanConfig `mapstructure:"ask_human" json:"ask_human"`
+	Approvals ApprovalConfig `mapstructure:"approvals" json:"approvals"`
+	// ImageModel is the model of the generate_image tool (e.g. "xai/grok-2-image-1212").
+	// When empty, the first model of the primary's provider with "image" in its name is used.
+	ImageModel string `mapstructure:"image_model" json:"image_model,omitempty"`
+}
+
+// ApprovalConfig is the approval policy for the agent's tool calls.
+type ApprovalConfig struct {
+	// Tools maps a tool name, or "tool:action" for tools with an action argument
+	// (e.g. "file_manager:share"), to "allow", "ask" or "deny". It overrides the
+	// built-in policy, which asks before execute_command, store_password,
+	// skill_install, skill_local_install and file_manager:share.
+	Tools map[string]string `mapstructure:"tools" json:"tools,omitempty"`
+	// TimeoutSeconds is how long a call waits for a decision before it is denied (default 600).
+	TimeoutSeconds int `mapstructure:"timeout_seconds" json:"timeout_seconds,omitempty"`
+}
+
+// AskHumanConfig controls questions the agent asks the human with the ask_human tool.
+type AskHumanConfig struct {
+	// TimeoutSeconds is how long a run waits for an answer before it continues on its
+	// own best judgement (default 86400).
+	TimeoutSeconds int `mapstructure:"timeout_seconds" json:"timeout_seconds,omitempty"`
 }
 
 type ModelSelection struct {
 	Primary   string   `mapstructure:"primary" json:"primary"`
 	Fallbacks []string `mapstructure:"fallbacks" json:"fallbacks"`
+	// CooldownSeconds is how long a failed model is skipped before it is retried (default 300).
+	CooldownSeconds int `mapstructure:"cooldown_seconds" json:"cooldown_seconds,omitempty"`
 }
 
 type XAIConfig struct {
@@ -285,6 +385,9 @@ func Save(cfg *Config) error {
 		viper.Set(prefix+".baseUrl", prov.BaseURL)
 		viper.Set(prefix+".apiKey", prov.APIKey)
 		viper.Set(prefix+".api", prov.API)
+		if prov.Fixtures != "" {
+			viper.Set(prefix+".fixtures", prov.Fixtures)
+		}
 		for i, m := range prov.Models {
 			mPrefix := prefix + ".models." + strconv.Itoa(i)
 			viper.Set(mPrefix+".id", m.ID)
@@ -305,8 +408,38 @@ func Save(cfg *Config) error {
 	for i, fb := range cfg.Agents.Defaults.Model.Fallbacks {
 		viper.Set("agents.defaults.model.fallbacks."+strconv.Itoa(i), fb)
 	}
+	viper.Set("agents.defaults.model.cooldown_seconds", cfg.Agents.Defaults.Model.CooldownSeconds)
+	viper.Set("agents.defaults.ask_human.timeout_seconds", cfg.Agents.Defaults.AskHuman.TimeoutSeconds)
+	viper.Set("agents.defaults.approvals.tools", cfg.Agents.Defaults.Approvals.Tools)
+	viper.Set("agents.defaults.approvals.timeout_seconds", cfg.Agents.Defaults.Approvals.TimeoutSeconds)
+	viper.Set("agents.defaults.image_model", cfg.Agents.Defaults.ImageModel)
 	viper.Set("agents.subagents", cfg.Agents.SubAgents)
 	viper.Set("agents.debug", cfg.Agents.Debug)
+	viper.Set("agents.cassettes.mode", cfg.Agents.Cassettes.Mode)
+	viper.Set("agents.cassettes.dir", cfg.Agents.Cassettes.Dir)
+	viper.Set("agents.budgets.daily", cfg.Agents.Budgets.Daily)
+	viper.Set("agents.budgets.monthly", cfg.Agents.Budgets.Monthly)
+	viper.Set("agents.budgets.providers", cfg.Agents.Budgets.Providers)
+	viper.Set("agents.budgets.session", cfg.Agents.Budgets.Session)
+	viper.Set("agents.budgets.task", cfg.Agents.Budgets.Task)
+	viper.Set("agents.budgets.subagent", cfg.Agents.Budgets.SubAgent)
+	viper.Set("agents.budgets.fallback_model", cfg.Agents.Budgets.FallbackModel)
+	viper.Set("agents.budgets.fallback_at", cfg.Agents.Budgets.FallbackAt)
+	viper.Set("agents.budgets.alert_at", cfg.Agents.Budgets.AlertAt)
+	viper.Set("agents.budgets.alert_target", cfg.Agents.Budgets.AlertTarget)
+	viper.Set("agents.vault.patterns", cfg.Agents.Vault.Patterns)
+	for name, srv := range cfg.Agents.MCP.Servers {
+		prefix := "agents.mcp.servers." + name
+		viper.Set(prefix+".command", srv.Command)
+		viper.Set(prefix+".args", srv.Args)
+		viper.Set(prefix+".env", srv.Env)
+		viper.Set(prefix+".url", srv.URL)
+		viper.Set(prefix+".headers", srv.Headers)
+		viper.Set(prefix+".tools", srv.Tools)
+		viper.Set(prefix+".subagents", srv.SubAgents)
+		viper.Set(prefix+".timeout_seconds", srv.TimeoutSeconds)
+		viper.Set(prefix+".disabled", srv.Disabled)
+	}
 
 	// Server
 	viper.Set("server.addr", cfg.Server.Addr)
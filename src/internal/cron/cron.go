@@ -129,7 +129,7 @@ func (m *CronManager) runTask(t *tasks.Task) {
 	// For now, EinoEngine loads skills from the skills directory automatically.
 	// If the task needs specific skills, they should be installed.
 
-	resp, err := m.promptFn(context.Background(), sessionID, t.Prompt, engine.Options{})
+	resp, err := m.promptFn(engine.WithCronTask(context.Background(), t.ID), sessionID, t.Prompt, engine.Options{})
 	if err != nil {
 		slog.Error("task prompt failed", "task_id", t.ID, "error", err)
 		return
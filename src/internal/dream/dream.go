@@ -2,10 +2,13 @@ package dream
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"miri-main/src/internal/budget"
 	"miri-main/src/internal/config"
 	"miri-main/src/internal/llm"
+	"miri-main/src/internal/storage"
 	"sort"
 	"strings"
 	"sync"
@@ -17,6 +20,12 @@ type MemoryWriter interface {
 	AppendToMemory(text string) error
 }
 
+// CostRecorder is implemented by memory writers that keep the cost ledger
+// (storage.Storage); the model calls of a simulation are recorded in it.
+type CostRecorder interface {
+	AddCost(entry storage.CostEntry) error
+}
+
 // Result holds the outcome of a single simulated CoT path.
 type Result struct {
 	Path  int     `json:"path"`
@@ -38,6 +47,7 @@ type Report struct {
 type Simulator struct {
 	cfg     *config.Config
 	storage MemoryWriter
+	budget  *budget.Tracker
 }
 
 // New creates a new Simulator with the given config and optional memory writer.
@@ -45,6 +55,12 @@ func New(cfg *config.Config, storage MemoryWriter) *Simulator {
 	return &Simulator{cfg: cfg, storage: storage}
 }
 
+// SetBudget sets the tracker each simulated path is checked against: paths degrade
+// to the fallback model or are skipped once the budgets are used up.
+func (s *Simulator) SetBudget(t *budget.Tracker) {
+	s.budget = t
+}
+
 // Run executes n parallel CoT simulations, scores each path, persists the best
 // plan to memory, and returns a full report.
 func (s *Simulator) Run(ctx context.Context, goal string, n int) (*Report, error) {
@@ -61,6 +77,8 @@ func (s *Simulator) Run(ctx context.Context, goal string, n int) (*Report, error
 	slog.Info("dream simulation started", "goal", goal, "paths", n)
 
 	results := make([]Result, n)
+	var budgetErr error
+	var budgetMu sync.Mutex
 	var wg sync.WaitGroup
 	sem := make(chan struct{}, 8) // max 8 concurrent LLM calls
 
@@ -73,6 +91,11 @@ func (s *Simulator) Run(ctx context.Context, goal string, n int) (*Report, error
 
 			plan, score, err := s.simulatePath(ctx, modelStr, goal, idx)
 			if err != nil {
+				if errors.Is(err, budget.ErrExceeded) {
+					budgetMu.Lock()
+					budgetErr = err
+					budgetMu.Unlock()
+				}
 				slog.Warn("dream path failed", "path", idx, "error", err)
 				results[idx] = Result{Path: idx, Plan: "", Score: -1}
 				return
@@ -88,6 +111,10 @@ func (s *Simulator) Run(ctx context.Context, goal string, n int) (*Report, error
 	})
 
 	best := results[0]
+	if best.Score < 0 && budgetErr != nil {
+		// Every path failed and the budgets stopped at least some of them.
+		return nil, budgetErr
+	}
 	duration := time.Since(start)
 
 	slog.Info("dream simulation complete",
@@ -143,15 +170,59 @@ Begin your reasoning now:`, idx+1, goal),
 		},
 	}
 
-	resp, _, err := llm.ChatCompletion(s.cfg, modelStr, messages)
+	modelStr, err := s.checkBudget(modelStr)
 	if err != nil {
 		return "", 0, err
 	}
+	resp, usage, err := llm.ChatCompletion(s.cfg, modelStr, messages)
+	if err != nil {
+		return "", 0, err
+	}
+	s.recordCost(usage)
 
 	score := scorePlan(resp)
 	return resp, score, nil
 }
 
+// checkBudget checks a call of modelStr against the budgets and returns the model
+// to use for it: modelStr itself or the budgets' fallback model.
+func (s *Simulator) checkBudget(modelStr string) (string, error) {
+	provider, _, _ := strings.Cut(modelStr, "/")
+	fallback, err := s.budget.Check(budget.Call{Provider: provider})
+	if err != nil || !fallback {
+		return modelStr, err
+	}
+	fallbackModel := s.budget.FallbackModel()
+	provider, _, _ = strings.Cut(fallbackModel, "/")
+	if _, err := s.budget.Check(budget.Call{Provider: provider}); err != nil {
+		return "", err
+	}
+	return fallbackModel, nil
+}
+
+// recordCost adds the usage of a simulated path to the cost ledger, if the memory
+// writer keeps one.
+func (s *Simulator) recordCost(usage *llm.Usage) {
+	rec, ok := s.storage.(CostRecorder)
+	if !ok || usage == nil {
+		return
+	}
+	provider, model, _ := strings.Cut(usage.Model, "/")
+	entry := storage.CostEntry{
+		Model:            model,
+		Provider:         provider,
+		PromptTokens:     usage.PromptTokens,
+		CachedTokens:     usage.CachedTokens,
+		CacheWriteTokens: usage.CacheWriteTokens,
+		CompletionTokens: usage.CompletionTokens,
+		Cost:             usage.TotalCost,
+		Source:           storage.CostSourceDream,
+	}
+	if err := rec.AddCost(entry); err != nil {
+		slog.Warn("dream: failed to record cost", "error", err)
+	}
+}
+
 // scorePlan heuristically scores a plan based on structural richness and reasoning depth.
 func scorePlan(plan string) float64 {
 	if plan == "" {
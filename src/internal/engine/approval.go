@@ -0,0 +1,246 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"miri-main/src/internal/config"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	"github.com/google/uuid"
+)
+
+// Approval policies of a tool call.
+const (
+	ApprovalAllow = "allow"
+	ApprovalAsk   = "ask"
+	ApprovalDeny  = "deny"
+)
+
+// defaultApprovalTimeout is how long a tool call waits for a decision before it is denied.
+const defaultApprovalTimeout = 10 * time.Minute
+
+// defaultApprovalPolicy asks before calls that change the machine or hand out data.
+// Keys are tool names or "tool:action" for tools with an action argument.
+var defaultApprovalPolicy = map[string]string{
+	"execute_command":     ApprovalAsk,
+	"store_password":      ApprovalAsk,
+	"skill_install":       ApprovalAsk,
+	"skill_local_install": ApprovalAsk,
+	"file_manager:share":  ApprovalAsk,
+}
+
+// ApprovalRequest is a tool call waiting for the human to approve it.
+type ApprovalRequest struct {
+	ID         string    `json:"id"`
+	SessionID  string    `json:"session_id"`
+	RunID      string    `json:"run_id,omitempty"`
+	ToolCallID string    `json:"tool_call_id,omitempty"`
+	Tool       string    `json:"tool"`
+	Arguments  string    `json:"arguments"`
+	Created    time.Time `json:"created"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Approver asks the human to approve a tool call. It blocks until they decide, the
+// request expires (denied) or ctx is done; reason explains a denial.
+type Approver interface {
+	RequestApproval(ctx context.Context, req *ApprovalRequest) (approved bool, reason string, err error)
+}
+
+// SetApprover sets who approves the tool calls the policy asks about. Engines created
+// with a task gateway that is an Approver use it by default.
+func (e *EinoEngine) SetApprover(a Approver) {
+	e.approver = a
+}
+
+// newApprovalPolicy merges the configured policy over the defaults. Unknown values
+// are treated as "ask". Keys are lower-cased, as the config loader does.
+func newApprovalPolicy(cfg config.ApprovalConfig) map[string]string {
+	policy := make(map[string]string, len(defaultApprovalPolicy)+len(cfg.Tools))
+	for k, v := range defaultApprovalPolicy {
+		policy[k] = v
+	}
+	for k, v := range cfg.Tools {
+		v = strings.ToLower(strings.TrimSpace(v))
+		switch v {
+		case ApprovalAllow, ApprovalAsk, ApprovalDeny:
+		default:
+			slog.Warn("unknown approval policy, asking instead", "tool", k, "policy", v)
+			v = ApprovalAsk
+		}
+		policy[strings.ToLower(k)] = v
+	}
+	return policy
+}
+
+// approvalPolicyFor returns the policy of a call: "tool:action" wins over "tool",
+// and calls without a policy are allowed.
+func (e *EinoEngine) approvalPolicyFor(name, arguments string) string {
+	name = strings.ToLower(name)
+	var args struct {
+		Action string `json:"action"`
+	}
+	if json.Unmarshal([]byte(arguments), &args) == nil && args.Action != "" {
+		if p, ok := e.approvalPolicy[name+":"+args.Action]; ok {
+			return p
+		}
+	}
+	if p, ok := e.approvalPolicy[name]; ok {
+		return p
+	}
+	return ApprovalAllow
+}
+
+// approvalMiddleware holds tool calls back according to the approval policy. Denied
+// calls are not run; the model gets the denial as the tool result.
+func (e *EinoEngine) approvalMiddleware(next compose.InvokableToolEndpoint) compose.InvokableToolEndpoint {
+	return func(ctx context.Context, in *compose.ToolInput) (*compose.ToolOutput, error) {
+		switch e.approvalPolicyFor(in.Name, in.Arguments) {
+		case ApprovalDeny:
+			slog.Warn("Tool call denied by policy", "tool", in.Name)
+			return &compose.ToolOutput{Result: fmt.Sprintf("Tool call denied: the approval policy does not allow %s.", in.Name)}, nil
+		case ApprovalAsk:
+			if approved, reason := e.requestApproval(ctx, in); !approved {
+				return &compose.ToolOutput{Result: "Tool call denied: " + reason}, nil
+			}
+		}
+		return next(ctx, in)
+	}
+}
+
+// subAgentTool runs a tool of a sub-agent through the vault and approval
+// middleware of the agent's own tools.
+type subAgentTool struct {
+	tool.InvokableTool
+	endpoint compose.InvokableToolEndpoint
+}
+
+// wrapSubAgentTool makes the calls of a sub-agent to t obey the approval policy
+// and get the vault placeholders restored, like the calls of the agent. Sub-agents
+// run detached from the run that spun them off, so the calls are scoped to the
+// parent session the sub-agent was started from.
+func (e *EinoEngine) wrapSubAgentTool(t tool.BaseTool) tool.BaseTool {
+	inv, ok := t.(tool.InvokableTool)
+	if !ok {
+		return t
+	}
+	return &subAgentTool{
+		InvokableTool: inv,
+		endpoint: e.vaultMiddleware(e.approvalMiddleware(func(ctx context.Context, in *compose.ToolInput) (*compose.ToolOutput, error) {
+			res, err := inv.InvokableRun(ctx, in.Arguments)
+			if err != nil {
+				return nil, err
+			}
+			return &compose.ToolOutput{Result: res}, nil
+		})),
+	}
+}
+
+func (t *subAgentTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	info, err := t.Info(ctx)
+	if err != nil {
+		return "", err
+	}
+	out, err := t.endpoint(parentSessionScope(ctx), &compose.ToolInput{Name: info.Name, Arguments: argumentsInJSON})
+	if err != nil {
+		return "", err
+	}
+	return out.Result, nil
+}
+
+// requestApproval asks the approver about a call and waits for the decision.
+func (e *EinoEngine) requestApproval(ctx context.Context, in *compose.ToolInput) (bool, string) {
+	if e.approver == nil {
+		slog.Warn("Tool call needs approval but there is no approver", "tool", in.Name)
+		return false, fmt.Sprintf("%s needs approval and nobody can be asked from this run.", in.Name)
+	}
+	sessionID, runID := runScope(ctx)
+	timeout := e.approvalTimeout
+	if timeout <= 0 {
+		timeout = defaultApprovalTimeout
+	}
+	now := time.Now().UTC()
+	req := &ApprovalRequest{
+		ID:         uuid.NewString(),
+		SessionID:  sessionID,
+		RunID:      runID,
+		ToolCallID: in.CallID,
+		Tool:       in.Name,
+		Arguments:  redactSecrets(in.Arguments),
+		Created:    now,
+		ExpiresAt:  now.Add(timeout),
+	}
+	slog.Info("Tool call waiting for approval", "approval_id", req.ID, "tool", in.Name, "session_id", sessionID)
+	emitEvent(ctx, StreamEvent{Type: EventApproval, ApprovalID: req.ID, ToolCallID: in.CallID, Tool: in.Name, Arguments: req.Arguments})
+
+	approved, reason, err := e.approver.RequestApproval(ctx, req)
+	if err != nil {
+		return false, fmt.Sprintf("approval failed: %v", err)
+	}
+	slog.Info("Tool call approval decided", "approval_id", req.ID, "tool", in.Name, "approved", approved, "reason", reason)
+	if !approved && reason == "" {
+		reason = "the human did not approve it."
+	}
+	return approved, reason
+}
+
+// redactSecrets masks password and secret fields of JSON tool arguments, which are
+// shown to the human on other channels.
+func redactSecrets(arguments string) string {
+	var args map[string]any
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return arguments
+	}
+	redacted := false
+	for k := range args {
+		lk := strings.ToLower(k)
+		if strings.Contains(lk, "password") || strings.Contains(lk, "secret") {
+			args[k] = "[REDACTED]"
+			redacted = true
+		}
+	}
+	if !redacted {
+		return arguments
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return arguments
+	}
+	return string(data)
+}
+
+type runScopeKey struct{}
+
+type runScopeValue struct {
+	sessionID string
+	runID     string
+}
+
+// withRunScope makes the session and run of the agent loop known to tool middleware.
+func withRunScope(ctx context.Context, input *graphInput) context.Context {
+	return context.WithValue(ctx, runScopeKey{}, runScopeValue{sessionID: input.SessionID, runID: input.RunID})
+}
+
+func runScope(ctx context.Context) (sessionID, runID string) {
+	v, _ := ctx.Value(runScopeKey{}).(runScopeValue)
+	return v.sessionID, v.runID
+}
+
+// parentSessionScope scopes ctx to the session a sub-agent was started from, for
+// the calls of sub-agents, which run detached from the agent loop.
+func parentSessionScope(ctx context.Context) context.Context {
+	const parentSessionKey = "parent_subagent_session"
+	if sessionID, _ := runScope(ctx); sessionID != "" {
+		return ctx
+	}
+	ps, _ := ctx.Value(parentSessionKey).(string)
+	if ps == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, runScopeKey{}, runScopeValue{sessionID: ps})
+}
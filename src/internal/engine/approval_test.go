@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"context"
+	"miri-main/src/internal/config"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+)
+
+// stubApprover records the requests it gets and answers with approved.
+type stubApprover struct {
+	approved bool
+	reqs     []*ApprovalRequest
+}
+
+func (a *stubApprover) RequestApproval(ctx context.Context, req *ApprovalRequest) (bool, string, error) {
+	a.reqs = append(a.reqs, req)
+	return a.approved, "", nil
+}
+
+func TestApprovalPolicyFor(t *testing.T) {
+	e := &EinoEngine{approvalPolicy: newApprovalPolicy(config.ApprovalConfig{Tools: map[string]string{
+		"store_password": "deny",
+		"web_fetch":      "ASK",
+		"skill_install":  "sometimes",
+		"Coder":          "deny",
+	}})}
+
+	cases := []struct{ name, args, want string }{
+		{"execute_command", `{"command":"ls"}`, ApprovalAsk},
+		{"store_password", `{}`, ApprovalDeny},
+		{"web_fetch", `{}`, ApprovalAsk},
+		{"skill_install", `{}`, ApprovalAsk},
+		{"file_manager", `{"action":"share"}`, ApprovalAsk},
+		{"file_manager", `{"action":"list"}`, ApprovalAllow},
+		{"web_search", `{}`, ApprovalAllow},
+		{"Coder", `{"query":"x"}`, ApprovalDeny},
+	}
+	for _, c := range cases {
+		if got := e.approvalPolicyFor(c.name, c.args); got != c.want {
+			t.Errorf("approvalPolicyFor(%s, %s) = %s, want %s", c.name, c.args, got, c.want)
+		}
+	}
+}
+
+func TestApprovalMiddleware(t *testing.T) {
+	ran := 0
+	next := func(ctx context.Context, in *compose.ToolInput) (*compose.ToolOutput, error) {
+		ran++
+		return &compose.ToolOutput{Result: "ran"}, nil
+	}
+	ctx := withRunScope(context.Background(), &graphInput{SessionID: "miri:session:test", RunID: "r1"})
+	call := &compose.ToolInput{Name: "store_password", Arguments: `{"title":"mail","password":"hunter2"}`, CallID: "c1"}
+
+	approver := &stubApprover{approved: true}
+	e := &EinoEngine{approvalPolicy: newApprovalPolicy(config.ApprovalConfig{}), approver: approver}
+	out, err := e.approvalMiddleware(next)(ctx, call)
+	if err != nil || out.Result != "ran" || ran != 1 {
+		t.Fatalf("approved call: got %+v, %v (ran %d)", out, err, ran)
+	}
+	req := approver.reqs[0]
+	if req.SessionID != "miri:session:test" || req.RunID != "r1" || req.Tool != "store_password" {
+		t.Errorf("unexpected request %+v", req)
+	}
+	if strings.Contains(req.Arguments, "hunter2") || !strings.Contains(req.Arguments, "mail") {
+		t.Errorf("expected the password to be redacted, got %s", req.Arguments)
+	}
+
+	approver.approved = false
+	out, _ = e.approvalMiddleware(next)(ctx, call)
+	if ran != 1 || !strings.HasPrefix(out.Result, "Tool call denied") {
+		t.Errorf("denied call must not run, got %q (ran %d)", out.Result, ran)
+	}
+
+	// Without an approver, calls that need approval are denied
+	e.approver = nil
+	out, _ = e.approvalMiddleware(next)(ctx, call)
+	if ran != 1 || !strings.HasPrefix(out.Result, "Tool call denied") {
+		t.Errorf("call without approver must not run, got %q (ran %d)", out.Result, ran)
+	}
+
+	// Allowed calls are not held back
+	if _, err := e.approvalMiddleware(next)(ctx, &compose.ToolInput{Name: "web_search", Arguments: `{}`}); err != nil || ran != 2 {
+		t.Errorf("allowed call must run, ran %d, err %v", ran, err)
+	}
+}
+
+func TestSubAgentToolApproval(t *testing.T) {
+	cmd := &countingTool{name: "execute_command"}
+	approver := &stubApprover{}
+	e := &EinoEngine{approvalPolicy: newApprovalPolicy(config.ApprovalConfig{}), approver: approver}
+	wrapped := e.wrapSubAgentTool(cmd).(tool.InvokableTool)
+
+	// Sub-agents run detached from the agent loop, with only the parent session.
+	ctx := context.WithValue(context.Background(), "parent_subagent_session", "miri:session:test")
+	out, err := wrapped.InvokableRun(ctx, `{"command":"rm -rf /"}`)
+	if err != nil || cmd.calls != 0 || !strings.HasPrefix(out, "Tool call denied") {
+		t.Fatalf("denied call must not run, got %q, %v (ran %d)", out, err, cmd.calls)
+	}
+	if len(approver.reqs) != 1 || approver.reqs[0].SessionID != "miri:session:test" || approver.reqs[0].Tool != "execute_command" {
+		t.Errorf("unexpected requests %+v", approver.reqs)
+	}
+
+	approver.approved = true
+	if out, err := wrapped.InvokableRun(ctx, `{"command":"ls"}`); err != nil || out != "execute_command ok" || cmd.calls != 1 {
+		t.Errorf("approved call must run, got %q, %v (ran %d)", out, err, cmd.calls)
+	}
+}
@@ -0,0 +1,209 @@
+package engine
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// ErrAttachment is returned for prompt attachments that cannot be read or that the
+// model cannot take, such as images for a text-only model.
+var ErrAttachment = errors.New("invalid attachment")
+
+// Size limits of a single attachment.
+const (
+	maxImageAttachment = 20 << 20
+	maxTextAttachment  = 1 << 20
+)
+
+// imageTypes are the image formats every multimodal provider accepts.
+var imageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// Attachment is a file sent along with a prompt (see Options): a file stored with
+// /api/v1/files/upload or generated by a tool, referenced by the path relative to
+// the storage directory that the upload returned (under uploads/ or generated/),
+// or inline base64 Data (a data: URL is accepted too).
+// Images are passed to models whose input includes "image"; text files are added
+// to the prompt.
+type Attachment struct {
+	Path     string `json:"path,omitempty"`
+	Data     string `json:"data,omitempty"`
+	MIMEType string `json:"mime_type,omitempty"`
+	Name     string `json:"name,omitempty"`
+}
+
+// attachmentParts resolves the attachments of ctx (see WithOptions) into message
+// parts for the user prompt of sessionID.
+func (e *EinoEngine) attachmentParts(ctx context.Context, sessionID string) ([]schema.MessageInputPart, error) {
+	opts, _ := FromContext(ctx)
+	var parts []schema.MessageInputPart
+	for i, a := range opts.Attachments {
+		name, mimeType, data, err := e.readAttachment(a)
+		if err != nil {
+			return nil, fmt.Errorf("%w %d: %v", ErrAttachment, i+1, err)
+		}
+		switch {
+		case imageTypes[mimeType]:
+			if !e.imageInput {
+				return nil, fmt.Errorf("%w %s: model %s does not accept images", ErrAttachment, name, e.primary)
+			}
+			if len(data) > maxImageAttachment {
+				return nil, fmt.Errorf("%w %s: image larger than %d MB", ErrAttachment, name, maxImageAttachment>>20)
+			}
+			encoded := base64.StdEncoding.EncodeToString(data)
+			parts = append(parts, schema.MessageInputPart{
+				Type: schema.ChatMessagePartTypeImageURL,
+				Image: &schema.MessageInputImage{
+					MessagePartCommon: schema.MessagePartCommon{Base64Data: &encoded, MIMEType: mimeType},
+				},
+			})
+		case isTextType(mimeType, data):
+			if len(data) > maxTextAttachment {
+				return nil, fmt.Errorf("%w %s: text file larger than %d MB", ErrAttachment, name, maxTextAttachment>>20)
+			}
+			parts = append(parts, schema.MessageInputPart{
+				Type: schema.ChatMessagePartTypeText,
+				Text: fmt.Sprintf("Attached file %s:\n```\n%s\n```", name, e.sanitizeString(sessionID, string(data))),
+			})
+		default:
+			return nil, fmt.Errorf("%w %s: unsupported file type %s", ErrAttachment, name, mimeType)
+		}
+	}
+	return parts, nil
+}
+
+// readAttachment returns the name, MIME type and content of a.
+func (e *EinoEngine) readAttachment(a Attachment) (name, mimeType string, data []byte, err error) {
+	mimeType = a.MIMEType
+	switch {
+	case a.Path != "" && a.Data != "":
+		return "", "", nil, errors.New("set either path or data")
+	case a.Path != "":
+		path, err := e.attachmentPath(a.Path)
+		if err != nil {
+			return "", "", nil, err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", "", nil, fmt.Errorf("file %s not found", a.Path)
+		}
+		if info.IsDir() || info.Size() > maxImageAttachment {
+			return "", "", nil, fmt.Errorf("file %s is a directory or too large", a.Path)
+		}
+		if data, err = os.ReadFile(path); err != nil {
+			return "", "", nil, err
+		}
+		name = filepath.Base(path)
+	case a.Data != "":
+		encoded := a.Data
+		// data:[<mediatype>][;base64],<data>
+		if rest, ok := strings.CutPrefix(encoded, "data:"); ok {
+			header, payload, found := strings.Cut(rest, ",")
+			if !found || !strings.HasSuffix(header, ";base64") {
+				return "", "", nil, errors.New("data URL is not base64 encoded")
+			}
+			if mimeType == "" {
+				mimeType = strings.TrimSuffix(header, ";base64")
+			}
+			encoded = payload
+		}
+		if data, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+			return "", "", nil, fmt.Errorf("decode base64 data: %w", err)
+		}
+		name = "attachment"
+	default:
+		return "", "", nil, errors.New("path or data is required")
+	}
+	if a.Name != "" {
+		name = a.Name
+	}
+
+	if mimeType == "" {
+		mimeType = mime.TypeByExtension(filepath.Ext(name))
+	}
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	if mt, _, err := mime.ParseMediaType(mimeType); err == nil {
+		mimeType = mt
+	}
+	return name, mimeType, data, nil
+}
+
+// attachmentDirs are the directories of the storage directory attachments can
+// be read from: uploaded files and files generated by tools. Anything else, like
+// config.yaml and its secrets, is refused.
+var attachmentDirs = []string{"uploads", "generated"}
+
+// attachmentPath resolves the path of an attachment relative to the storage
+// directory, refusing paths outside attachmentDirs, also through symlinks.
+func (e *EinoEngine) attachmentPath(rel string) (string, error) {
+	base := e.storageBaseDir
+	if strings.HasPrefix(base, "~") {
+		home, _ := os.UserHomeDir()
+		base = filepath.Join(home, base[1:])
+	}
+	clean := strings.TrimPrefix(filepath.Clean("/"+rel), "/")
+	dir, _, _ := strings.Cut(clean, "/")
+	if !slices.Contains(attachmentDirs, dir) || clean == dir {
+		return "", fmt.Errorf("path %s is not an uploaded or generated file", rel)
+	}
+	path := filepath.Join(base, clean)
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("file %s not found", rel)
+	}
+	realDir, err := filepath.EvalSymlinks(filepath.Join(base, dir))
+	if err != nil {
+		return "", fmt.Errorf("file %s not found", rel)
+	}
+	if r, err := filepath.Rel(realDir, real); err != nil || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %s is not an uploaded or generated file", rel)
+	}
+	return real, nil
+}
+
+// isTextType reports whether a file of mimeType can be added to the prompt as text.
+func isTextType(mimeType string, data []byte) bool {
+	switch {
+	case strings.HasPrefix(mimeType, "text/"),
+		mimeType == "application/json",
+		mimeType == "application/xml",
+		mimeType == "application/yaml",
+		mimeType == "application/x-yaml",
+		mimeType == "application/javascript",
+		mimeType == "image/svg+xml":
+		return utf8.Valid(data)
+	case mimeType == "application/octet-stream":
+		// Unknown extension: accept it when the content is plain UTF-8 text.
+		return utf8.Valid(data) && !strings.ContainsRune(string(data), 0)
+	}
+	return false
+}
+
+// userMessage returns the user message of a prompt with its attachment parts.
+func userMessage(prompt string, parts []schema.MessageInputPart) *schema.Message {
+	if len(parts) == 0 {
+		return schema.UserMessage(prompt)
+	}
+	var multi []schema.MessageInputPart
+	if prompt != "" {
+		multi = append(multi, schema.MessageInputPart{Type: schema.ChatMessagePartTypeText, Text: prompt})
+	}
+	return &schema.Message{Role: schema.User, UserInputMultiContent: append(multi, parts...)}
+}
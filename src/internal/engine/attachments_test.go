@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// pngHeader is enough of a PNG file for content sniffing.
+const pngHeader = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+
+func TestAttachmentParts(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "uploads"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "uploads", "shot.png"), []byte(pngHeader), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "uploads", "notes.md"), []byte("# Notes\nbuy milk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := &EinoEngine{storageBaseDir: dir, imageInput: true, primary: modelRef{Provider: "xai", Model: "grok-2-vision"}}
+
+	ctx := WithOptions(context.Background(), Options{Attachments: []Attachment{
+		{Path: "uploads/shot.png"},
+		{Data: "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString([]byte("jpeg")), Name: "photo"},
+		{Path: "uploads/notes.md"},
+	}})
+	parts, err := e.attachmentParts(ctx, "miri:main:session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 3 {
+		t.Fatalf("expected 3 parts, got %d", len(parts))
+	}
+	if p := parts[0]; p.Type != schema.ChatMessagePartTypeImageURL || p.Image.MIMEType != "image/png" ||
+		*p.Image.Base64Data != base64.StdEncoding.EncodeToString([]byte(pngHeader)) {
+		t.Errorf("unexpected image part from upload: %+v", p)
+	}
+	if p := parts[1]; p.Type != schema.ChatMessagePartTypeImageURL || p.Image.MIMEType != "image/jpeg" {
+		t.Errorf("unexpected image part from data URL: %+v", p)
+	}
+	if p := parts[2]; p.Type != schema.ChatMessagePartTypeText || !strings.Contains(p.Text, "notes.md") || !strings.Contains(p.Text, "buy milk") {
+		t.Errorf("expected the text file inlined, got %+v", p)
+	}
+
+	msg := userMessage("what is this?", parts)
+	if msg.Role != schema.User || msg.Content != "" || len(msg.UserInputMultiContent) != 4 ||
+		msg.UserInputMultiContent[0].Text != "what is this?" {
+		t.Errorf("unexpected user message: %+v", msg)
+	}
+	if msg := userMessage("hi", nil); msg.Content != "hi" || msg.UserInputMultiContent != nil {
+		t.Errorf("expected a plain user message, got %+v", msg)
+	}
+}
+
+func TestAttachmentPartsRejected(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "uploads"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("api_key: secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "config.yaml"), filepath.Join(dir, "uploads", "link.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	e := &EinoEngine{storageBaseDir: dir, primary: modelRef{Provider: "xai", Model: "grok-3"}}
+
+	cases := map[string]Attachment{
+		"image for text model": {Data: base64.StdEncoding.EncodeToString([]byte(pngHeader))},
+		"binary file":          {Data: base64.StdEncoding.EncodeToString([]byte("%PDF-1.7\x00\x01")), Name: "doc.pdf"},
+		"outside storage":      {Path: "../../etc/passwd"},
+		"missing file":         {Path: "uploads/none.png"},
+		"config file":          {Path: "config.yaml"},
+		"config via uploads":   {Path: "uploads/../config.yaml"},
+		"symlink out":          {Path: "uploads/link.yaml"},
+		"uploads directory":    {Path: "uploads"},
+		"bad base64":           {Data: "not base64!"},
+		"empty":                {},
+	}
+	for name, a := range cases {
+		_, err := e.attachmentParts(WithOptions(context.Background(), Options{Attachments: []Attachment{a}}), "miri:main:session")
+		if !errors.Is(err, ErrAttachment) {
+			t.Errorf("%s: expected ErrAttachment, got %v", name, err)
+		}
+	}
+}
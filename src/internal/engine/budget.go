@@ -0,0 +1,172 @@
+package engine
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+
+	"miri-main/src/internal/budget"
+	"miri-main/src/internal/config"
+	"miri-main/src/internal/storage"
+)
+
+type cronTaskKey struct{}
+
+// WithCronTask attributes the model calls made with ctx to a cron task, in the cost
+// ledger and for the task budget (agents.budgets.task).
+func WithCronTask(ctx context.Context, taskID string) context.Context {
+	return context.WithValue(ctx, cronTaskKey{}, taskID)
+}
+
+func cronTask(ctx context.Context) string {
+	id, _ := ctx.Value(cronTaskKey{}).(string)
+	return id
+}
+
+// budgetGuard holds the budget tracker of an engine and the model that calls degrade
+// to (agents.budgets.fallback_model). Engines derived with forModel share it.
+type budgetGuard struct {
+	tracker *budget.Tracker
+	ref     modelRef
+	model   chainModel
+	// chat is the fallback bound to the engine's tools, brain the unbound one.
+	chat  *failoverChatModel
+	brain *failoverChatModel
+}
+
+// newBudgetGuard creates the fallback model of the budgets, if one is configured.
+// Its tools are bound later with bind.
+func newBudgetGuard(cfg *config.Config, defaultProvider string) *budgetGuard {
+	g := &budgetGuard{}
+	ref := cfg.Agents.Budgets.FallbackModel
+	if ref == "" {
+		return g
+	}
+	g.ref = resolveModelRef(cfg, ref, defaultProvider)
+	chain, _, err := newModelChain(cfg, g.ref)
+	if err != nil {
+		slog.Warn("failed to initialize budget fallback model, over-budget calls will be refused", "model", ref, "error", err)
+		return g
+	}
+	g.model = chain[0]
+	cooldown := time.Duration(cfg.Agents.Defaults.Model.CooldownSeconds) * time.Second
+	g.brain = newFailoverChatModel(cooldown, &failoverCandidate{name: g.model.name, chat: g.model.cm, cost: g.model.cost})
+	return g
+}
+
+// bind binds the engine's tools to the fallback model.
+func (g *budgetGuard) bind(cfg *config.Config, toolInfos []*schema.ToolInfo) {
+	if g.brain == nil {
+		return
+	}
+	fo, err := bindModelChain(cfg, []chainModel{g.model}, toolInfos)
+	if err != nil {
+		slog.Warn("failed to bind tools to budget fallback model", "model", g.ref.String(), "error", err)
+		return
+	}
+	g.chat = fo
+}
+
+// BudgetProvider is implemented by task gateways that keep the spending budgets.
+type BudgetProvider interface {
+	Budget() *budget.Tracker
+}
+
+// SetBudget sets the tracker whose budgets the engine's model calls are checked
+// against. Engines created with a task gateway that provides one use it already.
+func (e *EinoEngine) SetBudget(t *budget.Tracker) {
+	if e.budget == nil {
+		e.budget = &budgetGuard{}
+	}
+	e.budget.tracker = t
+}
+
+// budgetChatModel checks every model call against the budgets first. Calls over a
+// limit are refused with budget.ErrExceeded or go to the fallback model.
+type budgetChatModel struct {
+	inner    model.BaseChatModel
+	fallback model.BaseChatModel
+	guard    *budgetGuard
+	// provider is the provider of the inner model's primary.
+	provider string
+}
+
+func (b *budgetChatModel) pick(ctx context.Context) (model.BaseChatModel, error) {
+	t := b.guard.tracker
+	if t == nil {
+		return b.inner, nil
+	}
+	sessionID, _ := runScope(ctx)
+	call := budget.Call{Provider: b.provider, SessionID: sessionID, TaskID: cronTask(ctx)}
+	fallback, err := t.Check(call)
+	if err != nil {
+		return nil, err
+	}
+	if !fallback || b.fallback == nil {
+		return b.inner, nil
+	}
+	call.Provider = b.guard.ref.Provider
+	if _, err := t.Check(call); err != nil {
+		return nil, err
+	}
+	slog.Info("budget: degrading to the fallback model", "model", b.guard.ref.String(), "session_id", sessionID)
+	return b.fallback, nil
+}
+
+func (b *budgetChatModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	m, err := b.pick(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return m.Generate(ctx, input, opts...)
+}
+
+func (b *budgetChatModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	m, err := b.pick(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return m.Stream(ctx, input, opts...)
+}
+
+// wrap checks the calls of inner, a model of provider recorded in the ledger for
+// source, against the budgets. The Brain's calls degrade to the unbound fallback.
+func (g *budgetGuard) wrap(inner model.BaseChatModel, provider string, ledger costLedger, source string) model.BaseChatModel {
+	if g == nil {
+		return inner
+	}
+	fallback := g.chat
+	if source == storage.CostSourceBrain {
+		fallback = g.brain
+	}
+	b := &budgetChatModel{inner: inner, guard: g, provider: provider}
+	if fallback != nil {
+		b.fallback = newLedgerChatModel(fallback, ledger, source, g.ref.String(), fallback.costOf)
+	}
+	return b
+}
+
+// newChatModel wraps a failover chain of the engine for source: its calls are
+// checked against the budgets and recorded in the cost ledger and in cassettes.
+func (e *EinoEngine) newChatModel(fo *failoverChatModel, ref modelRef, source string) model.BaseChatModel {
+	inner := newLedgerChatModel(fo, e.ledger, source, ref.String(), fo.costOf)
+	return newCassetteChatModel(e.budget.wrap(inner, ref.Provider, e.ledger, source), cassetteChat)
+}
+
+// subAgentChatModel is the model of the sub-agents. It forwards to chat, which is
+// set once the model chain is bound to the tool infos of the sub-agent tools, and
+// scopes the calls to the parent session, so its budget applies to them.
+type subAgentChatModel struct {
+	chat model.BaseChatModel
+}
+
+func (s *subAgentChatModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	return s.chat.Generate(parentSessionScope(ctx), input, opts...)
+}
+
+func (s *subAgentChatModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	return s.chat.Stream(parentSessionScope(ctx), input, opts...)
+}
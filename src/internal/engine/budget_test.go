@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+
+	"miri-main/src/internal/budget"
+	"miri-main/src/internal/config"
+	"miri-main/src/internal/engine/subagents"
+	"miri-main/src/internal/storage"
+)
+
+// fixedSpending reports the same spending for every filter.
+type fixedSpending float64
+
+func (f fixedSpending) SpentCost(storage.CostFilter) (float64, error) { return float64(f), nil }
+
+func TestBudgetChatModel(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agents.Budgets = config.BudgetConfig{Daily: 10, FallbackModel: "xai/grok-3-mini"}
+
+	ledger := &memLedger{}
+	primary := newFailoverChatModel(time.Minute, &failoverCandidate{name: "anthropic/claude-sonnet", chat: usageChat{}})
+	guard := &budgetGuard{ref: modelRef{Provider: "xai", Model: "grok-3-mini"}}
+	guard.chat = newFailoverChatModel(time.Minute, &failoverCandidate{name: "xai/grok-3-mini", chat: usageChat{}})
+	chat := guard.wrap(newLedgerChatModel(primary, ledger, storage.CostSourceChat, "anthropic/claude-sonnet", primary.costOf),
+		"anthropic", ledger, storage.CostSourceChat)
+
+	ctx := withRunScope(context.Background(), &graphInput{SessionID: "miri:main:session"})
+	calls := []struct {
+		spent    float64
+		provider string
+	}{
+		{spent: 0, provider: "anthropic"}, // without a tracker
+		{spent: 5, provider: "anthropic"},
+		{spent: 9, provider: "xai"},
+	}
+	for i, c := range calls {
+		if i > 0 {
+			guard.tracker = budget.New(cfg, fixedSpending(c.spent), nil)
+		}
+		if _, err := chat.Generate(ctx, []*schema.Message{schema.UserMessage("hi")}); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+		if e := ledger.snapshot()[i]; e.Provider != c.provider {
+			t.Errorf("call %d at %v spent: expected provider %s, got %+v", i, c.spent, c.provider, e)
+		}
+	}
+
+	guard.tracker = budget.New(cfg, fixedSpending(10), nil)
+	if _, err := chat.Generate(ctx, nil); !errors.Is(err, budget.ErrExceeded) {
+		t.Fatalf("expected the call refused with ErrExceeded, got %v", err)
+	}
+	if _, err := chat.Stream(ctx, nil); !errors.Is(err, budget.ErrExceeded) {
+		t.Fatalf("expected the stream refused with ErrExceeded, got %v", err)
+	}
+	if n := len(ledger.snapshot()); n != len(calls) {
+		t.Errorf("expected no ledger entries for refused calls, got %d entries", n)
+	}
+}
+
+// sessionSpending reports the spending of the session of the filter.
+type sessionSpending map[string]float64
+
+func (s sessionSpending) SpentCost(f storage.CostFilter) (float64, error) { return s[f.SessionID], nil }
+
+func TestSubAgentBudget(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Agents.Budgets = config.BudgetConfig{Session: 1}
+
+	ledger := &memLedger{}
+	e := &EinoEngine{ledger: ledger, budget: &budgetGuard{tracker: budget.New(cfg, sessionSpending{"miri:main:spent": 1}, nil)}}
+	primary := newFailoverChatModel(time.Minute, &failoverCandidate{name: "xai/grok-3", chat: usageChat{}})
+	chat := &subAgentChatModel{chat: e.newChatModel(primary, modelRef{Provider: "xai", Model: "grok-3"}, storage.CostSourceSubAgent)}
+
+	st, err := storage.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	researcher := subagents.BuildSubAgentTools(context.Background(), chat, t.TempDir(), st, nil, nil)[0].(tool.InvokableTool)
+	run := func(parentSession string) *storage.SubAgentRun {
+		ctx := context.WithValue(context.Background(), "parent_subagent_session", parentSession)
+		out, err := researcher.InvokableRun(ctx, `{"query":"find the ticket"}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := regexp.MustCompile(`ID: (\S+)\)`).FindStringSubmatch(out)[1]
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if r, err := st.LoadSubAgentRun(id); err == nil && r.Status != "pending" {
+				return r
+			}
+		}
+		t.Fatalf("run %s did not finish", id)
+		return nil
+	}
+
+	if r := run("miri:main:spent"); r.Status != "failed" || !strings.Contains(r.Error, "budget of session miri:main:spent") {
+		t.Errorf("expected the run refused by the session budget, got %+v", r)
+	}
+	if n := len(ledger.snapshot()); n != 0 {
+		t.Errorf("expected no ledger entries for refused calls, got %d entries", n)
+	}
+
+	if r := run("miri:main:other"); r.Status != "done" {
+		t.Errorf("expected the run of another session to finish, got %+v", r)
+	}
+	if entries := ledger.snapshot(); len(entries) != 1 || entries[0].Source != storage.CostSourceSubAgent || entries[0].SessionID != "miri:main:other" {
+		t.Errorf("expected the sub-agent call in the ledger, got %+v", entries)
+	}
+}
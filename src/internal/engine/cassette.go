@@ -0,0 +1,493 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+// Cassette modes (config agents.cassettes.mode).
+const (
+	CassetteRecord = "record"
+	CassetteReplay = "replay"
+)
+
+// cassetteVersion is the format version written to new cassettes.
+const cassetteVersion = 1
+
+// Interaction kinds of a cassette.
+const (
+	// cassetteChat is a model call of the agent loop.
+	cassetteChat = "chat"
+	// cassetteBrain is a model call of the Brain made during the run (e.g. topology analysis).
+	cassetteBrain = "brain"
+	// cassetteTool is a tool call and its result.
+	cassetteTool = "tool"
+)
+
+// Cassette is the recording of one agent run: every model request and response and
+// every tool result, in order, together with the prompt and the final answer.
+// Replaying a cassette serves the recorded traffic instead of calling the models and
+// tools, so a run can be reproduced without network.
+type Cassette struct {
+	Version      int                   `json:"version"`
+	RecordedAt   time.Time             `json:"recorded_at"`
+	Model        string                `json:"model,omitempty"`
+	Prompt       string                `json:"prompt"`
+	History      []*schema.Message     `json:"history,omitempty"`
+	Interactions []CassetteInteraction `json:"interactions"`
+	Answer       string                `json:"answer"`
+	Error        string                `json:"error,omitempty"`
+}
+
+// CassetteInteraction is a model call (Request, Response) or a tool call (Tool,
+// Arguments, Result or Error).
+type CassetteInteraction struct {
+	Kind      string            `json:"kind"`
+	Request   []*schema.Message `json:"request,omitempty"`
+	Response  *schema.Message   `json:"response,omitempty"`
+	Tool      string            `json:"tool,omitempty"`
+	Arguments string            `json:"arguments,omitempty"`
+	Result    string            `json:"result,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// ToolSequence returns the tools the model called, in the order it called them.
+func (c *Cassette) ToolSequence() []string {
+	var seq []string
+	for _, in := range c.Interactions {
+		if in.Kind == cassetteChat && in.Response != nil {
+			for _, tc := range in.Response.ToolCalls {
+				seq = append(seq, tc.Function.Name)
+			}
+		}
+	}
+	return seq
+}
+
+// LoadCassette reads a cassette file.
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("parse cassette %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// ListCassettes returns the cassette files of dir, sorted by name.
+func ListCassettes(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Save writes the cassette to path, readable by the owner only: recordings hold
+// conversations and tool results.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of a cassette recorded again.
+	return os.Chmod(path, 0600)
+}
+
+// CassetteDiff compares the outcome of a run with a recorded cassette.
+type CassetteDiff struct {
+	Answer     string   `json:"answer"`
+	WantAnswer string   `json:"want_answer"`
+	Tools      []string `json:"tools"`
+	WantTools  []string `json:"want_tools"`
+	// Drift counts the model requests that differ from the recorded ones, e.g. after
+	// a change to a prompt template.
+	Drift int    `json:"drift"`
+	Error string `json:"error,omitempty"`
+}
+
+// OK reports whether the run reproduced the recorded answer and tool sequence.
+func (d *CassetteDiff) OK() bool {
+	return d.Error == "" && d.Answer == d.WantAnswer && reflect.DeepEqual(d.Tools, d.WantTools)
+}
+
+// DiffCassettes compares the run recorded in got with the one in want.
+func DiffCassettes(want, got *Cassette) *CassetteDiff {
+	d := &CassetteDiff{
+		Answer:     got.Answer,
+		WantAnswer: want.Answer,
+		Tools:      got.ToolSequence(),
+		WantTools:  want.ToolSequence(),
+		Error:      got.Error,
+	}
+	recorded := map[string][][]*schema.Message{}
+	for _, in := range want.Interactions {
+		if in.Kind != cassetteTool {
+			recorded[in.Kind] = append(recorded[in.Kind], in.Request)
+		}
+	}
+	seen := map[string]int{}
+	for _, in := range got.Interactions {
+		if in.Kind == cassetteTool {
+			continue
+		}
+		i := seen[in.Kind]
+		seen[in.Kind]++
+		if i >= len(recorded[in.Kind]) || !sameMessages(recorded[in.Kind][i], in.Request) {
+			d.Drift++
+		}
+	}
+	return d
+}
+
+// sameMessages compares the roles, content and tool calls of two requests.
+func sameMessages(a, b []*schema.Message) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Role != b[i].Role || a[i].Content != b[i].Content || a[i].ToolCallID != b[i].ToolCallID || len(a[i].ToolCalls) != len(b[i].ToolCalls) {
+			return false
+		}
+		for j := range a[i].ToolCalls {
+			if a[i].ToolCalls[j].Function != b[i].ToolCalls[j].Function {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// cassetteRecorder records the traffic of one run into got. When replaying it serves
+// model responses and tool results from want instead of calling them.
+type cassetteRecorder struct {
+	mu     sync.Mutex
+	want   *Cassette
+	got    *Cassette
+	cursor map[string]int
+	used   []bool
+}
+
+func newCassetteRecorder(input *graphInput, want *Cassette) *cassetteRecorder {
+	r := &cassetteRecorder{
+		want: want,
+		got: &Cassette{
+			Version:    cassetteVersion,
+			RecordedAt: time.Now().UTC(),
+			Prompt:     input.Prompt,
+			History:    input.Messages,
+		},
+		cursor: map[string]int{},
+	}
+	if want != nil {
+		r.used = make([]bool, len(want.Interactions))
+	}
+	return r
+}
+
+func (r *cassetteRecorder) replaying() bool {
+	return r.want != nil
+}
+
+func (r *cassetteRecorder) add(in CassetteInteraction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.got.Interactions = append(r.got.Interactions, in)
+}
+
+// finish records the outcome of the run.
+func (r *cassetteRecorder) finish(out *graphOutput, err error) *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.got.Error = err.Error()
+	} else if out != nil {
+		r.got.Answer = out.Answer
+		r.got.Model = out.Model
+	}
+	return r.got
+}
+
+// replayChat returns the next recorded response of a model call of the given kind.
+func (r *cassetteRecorder) replayChat(kind string, input []*schema.Message) (*schema.Message, error) {
+	r.mu.Lock()
+	var resp *schema.Message
+	for i := r.cursor[kind]; i < len(r.want.Interactions); i++ {
+		if in := r.want.Interactions[i]; in.Kind == kind && !r.used[i] {
+			r.used[i] = true
+			r.cursor[kind] = i + 1
+			resp = in.Response
+			break
+		}
+	}
+	r.mu.Unlock()
+	if resp == nil {
+		return nil, fmt.Errorf("cassette has no more recorded %s responses", kind)
+	}
+	msg := *resp
+	r.add(CassetteInteraction{Kind: kind, Request: input, Response: &msg})
+	return &msg, nil
+}
+
+// replayTool returns the recorded result of a tool call, preferring a call with the
+// same arguments: the tools node runs the calls of a step concurrently, so their
+// order in the cassette is not fixed.
+func (r *cassetteRecorder) replayTool(name, args string) (CassetteInteraction, error) {
+	r.mu.Lock()
+	match := -1
+	for i, in := range r.want.Interactions {
+		if in.Kind != cassetteTool || in.Tool != name || r.used[i] {
+			continue
+		}
+		if in.Arguments == args {
+			match = i
+			break
+		}
+		if match < 0 {
+			match = i
+		}
+	}
+	if match >= 0 {
+		r.used[match] = true
+	}
+	r.mu.Unlock()
+	if match < 0 {
+		return CassetteInteraction{}, fmt.Errorf("cassette has no recorded result for tool %s", name)
+	}
+	in := r.want.Interactions[match]
+	r.add(CassetteInteraction{Kind: cassetteTool, Tool: name, Arguments: args, Result: in.Result, Error: in.Error})
+	return in, nil
+}
+
+type cassetteKey struct{}
+
+// withCassette makes the recorder of a run reachable from the chat models and tool
+// middleware; a nil recorder hides the run's recorder (e.g. from sub-agents).
+func withCassette(ctx context.Context, r *cassetteRecorder) context.Context {
+	return context.WithValue(ctx, cassetteKey{}, r)
+}
+
+func cassetteFrom(ctx context.Context) *cassetteRecorder {
+	r, _ := ctx.Value(cassetteKey{}).(*cassetteRecorder)
+	return r
+}
+
+// cassetteChatModel records or replays the model calls made under a cassette.
+type cassetteChatModel struct {
+	inner model.BaseChatModel
+	kind  string
+}
+
+func newCassetteChatModel(inner model.BaseChatModel, kind string) *cassetteChatModel {
+	return &cassetteChatModel{inner: inner, kind: kind}
+}
+
+func (c *cassetteChatModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	r := cassetteFrom(ctx)
+	if r == nil {
+		return c.inner.Generate(ctx, input, opts...)
+	}
+	if r.replaying() {
+		return r.replayChat(c.kind, input)
+	}
+	msg, err := c.inner.Generate(ctx, input, opts...)
+	if err == nil {
+		r.add(CassetteInteraction{Kind: c.kind, Request: input, Response: msg})
+	}
+	return msg, err
+}
+
+// Stream passes the chunks through and records their concatenation once the
+// stream is complete. Replayed responses arrive as a single chunk.
+func (c *cassetteChatModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	r := cassetteFrom(ctx)
+	if r == nil {
+		return c.inner.Stream(ctx, input, opts...)
+	}
+	if r.replaying() {
+		msg, err := r.replayChat(c.kind, input)
+		if err != nil {
+			return nil, err
+		}
+		return schema.StreamReaderFromArray([]*schema.Message{msg}), nil
+	}
+
+	sr, err := c.inner.Stream(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	out, sw := schema.Pipe[*schema.Message](1)
+	go func() {
+		defer sr.Close()
+		defer sw.Close()
+		var chunks []*schema.Message
+		for {
+			chunk, err := sr.Recv()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				sw.Send(nil, err)
+				return
+			}
+			if chunk != nil {
+				chunks = append(chunks, chunk)
+			}
+			if sw.Send(chunk, nil) {
+				return
+			}
+		}
+		if len(chunks) == 0 {
+			return
+		}
+		msg, err := schema.ConcatMessages(chunks)
+		if err != nil {
+			slog.Warn("cassette: failed to concat stream chunks", "error", err)
+			return
+		}
+		stampAnsweredBy(msg, answeredBy(chunks[0]))
+		r.add(CassetteInteraction{Kind: c.kind, Request: input, Response: msg})
+	}()
+	return out, nil
+}
+
+// cassetteMiddleware records tool results under a cassette, or serves them from the
+// cassette when replaying. Tools run without the cassette so the model calls of
+// sub-agents are not mixed into the run's recording. The vault has restored the
+// arguments by now, so arguments and results are recorded with the placeholders
+// of their sensitive values, as the model sees them.
+func (e *EinoEngine) cassetteMiddleware(next compose.InvokableToolEndpoint) compose.InvokableToolEndpoint {
+	return func(ctx context.Context, in *compose.ToolInput) (*compose.ToolOutput, error) {
+		r := cassetteFrom(ctx)
+		if r == nil {
+			return next(ctx, in)
+		}
+		sessionID, _ := runScope(ctx)
+		args := e.sanitizeString(sessionID, in.Arguments)
+		if r.replaying() {
+			rec, err := r.replayTool(in.Name, args)
+			if err != nil {
+				return nil, err
+			}
+			if rec.Error != "" {
+				return nil, errors.New(rec.Error)
+			}
+			return &compose.ToolOutput{Result: rec.Result}, nil
+		}
+		out, err := next(withCassette(ctx, nil), in)
+		rec := CassetteInteraction{Kind: cassetteTool, Tool: in.Name, Arguments: args}
+		if err != nil {
+			rec.Error = e.sanitizeString(sessionID, err.Error())
+		} else if out != nil {
+			rec.Result = e.sanitizeString(sessionID, out.Result)
+		}
+		r.add(rec)
+		return out, err
+	}
+}
+
+// startCassette attaches a recorder to the context of a new run according to the
+// configured cassette mode. In replay mode the run is answered from the recorded
+// cassette with the same prompt.
+func (e *EinoEngine) startCassette(ctx context.Context, input *graphInput) (context.Context, *cassetteRecorder, error) {
+	switch e.cassetteMode {
+	case CassetteRecord:
+		r := newCassetteRecorder(input, nil)
+		return withCassette(ctx, r), r, nil
+	case CassetteReplay:
+		want, err := findCassette(e.cassetteDir, input.Prompt)
+		if err != nil {
+			return ctx, nil, err
+		}
+		r := newCassetteRecorder(input, want)
+		return withCassette(ctx, r), r, nil
+	default:
+		return ctx, nil, nil
+	}
+}
+
+// finishCassette saves the recording of a run in record mode.
+func (e *EinoEngine) finishCassette(r *cassetteRecorder, input *graphInput, out *graphOutput, err error) {
+	if r == nil {
+		return
+	}
+	c := r.finish(out, err)
+	if e.cassetteMode != CassetteRecord {
+		return
+	}
+	id := input.RunID
+	if id == "" {
+		id = input.SessionID
+	}
+	path := filepath.Join(e.cassetteDir, c.RecordedAt.Format("20060102-150405")+"-"+id+".json")
+	if err := c.Save(path); err != nil {
+		slog.Warn("failed to save cassette", "path", path, "error", err)
+		return
+	}
+	slog.Info("Cassette recorded", "path", path, "interactions", len(c.Interactions))
+}
+
+// findCassette returns the newest cassette of dir recorded for prompt.
+func findCassette(dir, prompt string) (*Cassette, error) {
+	paths, err := ListCassettes(dir)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(paths) - 1; i >= 0; i-- {
+		c, err := LoadCassette(paths[i])
+		if err != nil {
+			slog.Warn("skipping unreadable cassette", "path", paths[i], "error", err)
+			continue
+		}
+		if strings.TrimSpace(c.Prompt) == strings.TrimSpace(prompt) {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("no cassette recorded for this prompt in %s", dir)
+}
+
+// ReplayCassette runs the prompt of want through the full graph (prompt injection,
+// retrieval, agent loop and Brain) and returns the recording of the run. Unless
+// live is set, model responses and tool results are served from want, so the run
+// needs no network; a live run calls the configured models and tools again. A
+// failed run is reported in the Error of the returned cassette.
+func (e *EinoEngine) ReplayCassette(ctx context.Context, sessionID string, want *Cassette, live bool) *Cassette {
+	input := &graphInput{
+		SessionID: sessionID,
+		Messages:  append([]*schema.Message(nil), want.History...),
+		Prompt:    want.Prompt,
+	}
+	var r *cassetteRecorder
+	if live {
+		r = newCassetteRecorder(input, nil)
+	} else {
+		r = newCassetteRecorder(input, want)
+	}
+	out, err := e.compiledGraph.Invoke(withCassette(ctx, r), input)
+	return r.finish(out, err)
+}
@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+
+	"miri-main/src/internal/engine/skills"
+	"miri-main/src/internal/engine/vault"
+)
+
+func newCassetteTestEngine(t *testing.T, chat *scriptedChat, tools ...tool.BaseTool) *EinoEngine {
+	t.Helper()
+	e := &EinoEngine{
+		chat:        newCassetteChatModel(chat, cassetteChat),
+		maxSteps:    5,
+		skillLoader: skills.NewSkillLoader(t.TempDir(), t.TempDir()),
+	}
+	toolsNode, err := compose.NewToolNode(context.Background(), &compose.ToolsNodeConfig{
+		Tools:               tools,
+		ToolCallMiddlewares: []compose.ToolMiddleware{{Invokable: e.cassetteMiddleware}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.tools = toolsNode
+	return e
+}
+
+func recordTestRun(t *testing.T, ctx context.Context) *Cassette {
+	t.Helper()
+	search := &countingTool{name: "search"}
+	chat := &scriptedChat{replies: []*schema.Message{
+		toolCallMsg("c1", "search"),
+		schema.AssistantMessage("found it", nil),
+	}}
+	e := newCassetteTestEngine(t, chat, search)
+
+	input := &graphInput{SessionID: "miri:session:test", Prompt: "look it up"}
+	r := newCassetteRecorder(input, nil)
+	out, err := e.agentInvoke(withCassette(ctx, r), input)
+	c := r.finish(out, err)
+	if err != nil {
+		t.Fatalf("recorded run failed: %v", err)
+	}
+	if search.calls != 1 {
+		t.Fatalf("search ran %d times while recording, want 1", search.calls)
+	}
+	return c
+}
+
+func TestCassette_RecordAndReplay(t *testing.T) {
+	want := recordTestRun(t, context.Background())
+	if len(want.Interactions) != 3 || want.Answer != "found it" {
+		t.Fatalf("unexpected recording: %+v", want)
+	}
+	if seq := want.ToolSequence(); len(seq) != 1 || seq[0] != "search" {
+		t.Fatalf("tool sequence = %v, want [search]", seq)
+	}
+
+	path := filepath.Join(t.TempDir(), "run.json")
+	if err := want.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither the model nor the tool may be called while replaying.
+	search := &countingTool{name: "search", fail: true}
+	e := newCassetteTestEngine(t, &scriptedChat{}, search)
+	input := &graphInput{SessionID: "miri:session:test", Prompt: loaded.Prompt}
+	r := newCassetteRecorder(input, loaded)
+	out, err := e.agentInvoke(withCassette(context.Background(), r), input)
+	got := r.finish(out, err)
+	if err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	if search.calls != 0 {
+		t.Errorf("search ran %d times during replay", search.calls)
+	}
+
+	diff := DiffCassettes(loaded, got)
+	if !diff.OK() || diff.Drift != 0 {
+		t.Errorf("replay differs from recording: %+v", diff)
+	}
+}
+
+func TestCassette_StreamedRunIsRecorded(t *testing.T) {
+	events := make(chan StreamEvent, 64)
+	want := recordTestRun(t, withEventSink(context.Background(), events))
+	if len(want.Interactions) != 3 || want.Interactions[2].Response.Content != "found it" {
+		t.Errorf("streamed run not recorded: %+v", want.Interactions)
+	}
+}
+
+func TestCassette_DriftAndMismatch(t *testing.T) {
+	want := recordTestRun(t, context.Background())
+
+	// A changed prompt is still answered from the cassette but counts as drift.
+	e := newCassetteTestEngine(t, &scriptedChat{}, &countingTool{name: "search"})
+	input := &graphInput{SessionID: "miri:session:test", Prompt: "look it up, please"}
+	r := newCassetteRecorder(input, want)
+	out, err := e.agentInvoke(withCassette(context.Background(), r), input)
+	diff := DiffCassettes(want, r.finish(out, err))
+	if !diff.OK() || diff.Drift != 2 {
+		t.Errorf("expected a passing replay with 2 drifted requests, got %+v", diff)
+	}
+
+	// A different answer fails the comparison.
+	got := *want
+	got.Answer = "lost it"
+	if diff := DiffCassettes(want, &got); diff.OK() {
+		t.Error("expected a changed answer to fail")
+	}
+}
+
+func TestCassette_RecordsPlaceholders(t *testing.T) {
+	e := &EinoEngine{vault: vault.New(nil, vault.DefaultDetectors()...)}
+	ran := 0
+	endpoint := e.vaultMiddleware(e.cassetteMiddleware(func(ctx context.Context, in *compose.ToolInput) (*compose.ToolOutput, error) {
+		ran++
+		return &compose.ToolOutput{Result: "mail sent to bob@example.com"}, nil
+	}))
+	input := &graphInput{SessionID: "miri:session:test", Prompt: "mail bob"}
+	ctx := withRunScope(context.Background(), input)
+	args := e.sanitizeString(input.SessionID, `{"to":"bob@example.com"}`)
+
+	r := newCassetteRecorder(input, nil)
+	if _, err := endpoint(withCassette(ctx, r), &compose.ToolInput{Name: "send", Arguments: args}); err != nil {
+		t.Fatal(err)
+	}
+	c := r.finish(nil, nil)
+	path := filepath.Join(t.TempDir(), "run.json")
+	if err := c.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "bob@example.com") || c.Interactions[0].Arguments != args {
+		t.Errorf("expected the email recorded as a placeholder, got %s", data)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected the cassette readable by the owner only, got %v, %v", info.Mode(), err)
+	}
+
+	// The placeholders of the replayed call match the recording.
+	r = newCassetteRecorder(input, c)
+	out, err := endpoint(withCassette(ctx, r), &compose.ToolInput{Name: "send", Arguments: args})
+	if err != nil || ran != 1 || out.Result != c.Interactions[0].Result {
+		t.Errorf("expected the recorded result, got %+v, %v (ran %d)", out, err, ran)
+	}
+}
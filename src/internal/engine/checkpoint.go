@@ -2,27 +2,36 @@ package engine
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/cloudwego/eino/schema"
 	"io/fs"
 	"log/slog"
+	"miri-main/src/internal/llm"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
 // FileCheckPointStore implements compose.CheckPointStore by saving data to the filesystem.
+// It also keeps the run checkpoints of the agent loop under checkpoints/runs.
 type FileCheckPointStore struct {
 	baseDir string
+	runsDir string
 	mu      sync.RWMutex
 }
 
 func NewFileCheckPointStore(baseDir string) (*FileCheckPointStore, error) {
 	dir := filepath.Join(baseDir, "checkpoints")
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	runsDir := filepath.Join(dir, "runs")
+	if err := os.MkdirAll(runsDir, 0755); err != nil {
 		return nil, err
 	}
-	return &FileCheckPointStore{baseDir: dir}, nil
+	return &FileCheckPointStore{baseDir: dir, runsDir: runsDir}, nil
 }
 
 func (s *FileCheckPointStore) Get(ctx context.Context, checkPointID string) ([]byte, bool, error) {
@@ -66,7 +75,113 @@ func (s *FileCheckPointStore) Delete(ctx context.Context, checkPointID string) e
 }
 
 // engineState represents the resumable state of the EinoEngine ReAct loop.
+// It is saved after every tool step; Step is the next step to run.
 type engineState struct {
-	Messages []*schema.Message `json:"messages"`
-	Step     int               `json:"step"`
+	RunID     string            `json:"run_id"`
+	SessionID string            `json:"session_id"`
+	Prompt    string            `json:"prompt"`
+	Model     string            `json:"model,omitempty"`
+	Messages  []*schema.Message `json:"messages"`
+	Step      int               `json:"step"`
+	LastTool  string            `json:"last_tool,omitempty"`
+	Usage     llm.Usage         `json:"usage"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	// WaitingFor is the ID of the human question the run is suspended on, and
+	// WaitingCallID the ask_human tool call whose result the answer becomes.
+	WaitingFor    string `json:"waiting_for,omitempty"`
+	WaitingCallID string `json:"waiting_call_id,omitempty"`
+}
+
+func (s *FileCheckPointStore) runPath(runID string) (string, error) {
+	if runID == "" || strings.ContainsAny(runID, `/\`) || strings.Contains(runID, "..") {
+		return "", fmt.Errorf("invalid run id %q", runID)
+	}
+	return filepath.Join(s.runsDir, runID+".json"), nil
+}
+
+// SaveRun writes the checkpoint of a run. The file is replaced atomically so a
+// crash mid-write leaves the previous checkpoint intact.
+func (s *FileCheckPointStore) SaveRun(st *engineState) error {
+	path, err := s.runPath(st.RunID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(st)
+	if err != nil {
+		return fmt.Errorf("marshal run %s: %w", st.RunID, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadRun reads the checkpoint of a run.
+func (s *FileCheckPointStore) LoadRun(runID string) (*engineState, error) {
+	path, err := s.runPath(runID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("run %s: %w", runID, ErrRunNotFound)
+		}
+		return nil, err
+	}
+	var st engineState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("decode run %s: %w", runID, err)
+	}
+	return &st, nil
+}
+
+// DeleteRun removes the checkpoint of a run; a missing checkpoint is not an error.
+func (s *FileCheckPointStore) DeleteRun(runID string) error {
+	path, err := s.runPath(runID)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// ListRuns returns every run checkpoint, most recently updated first.
+func (s *FileCheckPointStore) ListRuns() ([]*engineState, error) {
+	s.mu.RLock()
+	entries, err := os.ReadDir(s.runsDir)
+	s.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []*engineState
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		st, err := s.LoadRun(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			slog.Warn("skipping unreadable run checkpoint", "file", name, "error", err)
+			continue
+		}
+		runs = append(runs, st)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].UpdatedAt.After(runs[j].UpdatedAt)
+	})
+	return runs, nil
 }
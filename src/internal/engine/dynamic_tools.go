@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+
+	"miri-main/src/internal/engine/tools"
+)
+
+// dynamicToolDirs holds the storage directories whose dynamic tools were loaded, so
+// the engines of a pool load them once; later loads are explicit reloads.
+var dynamicToolDirs sync.Map // string -> struct{}
+
+// loadDynamicTools loads the dynamic tools of dir unless they already were.
+func loadDynamicTools(dir string) {
+	if _, loaded := dynamicToolDirs.LoadOrStore(dir, struct{}{}); loaded {
+		return
+	}
+	if err := tools.LoadDynamicTools(dir); err != nil {
+		slog.Warn("failed to load some dynamic tools", "dir", dir, "error", err)
+	}
+}
+
+// dynamicTools returns the registered dynamic tools, except those named like a
+// built-in tool, which keeps its place.
+func (e *EinoEngine) dynamicTools() []*tools.DynamicTool {
+	registered := tools.DynamicTools()
+	if len(registered) == 0 {
+		return nil
+	}
+	builtin := make(map[string]bool, len(e.toolInfos))
+	for _, info := range e.toolInfos {
+		builtin[info.Name] = true
+	}
+	out := registered[:0]
+	for _, t := range registered {
+		if name := t.GetInfo().Name; builtin[name] {
+			slog.Debug("dynamic tool shadowed by a built-in tool", "tool", name)
+			continue
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// modelToolOptions binds the dynamic tools next to the built-in ones for a model
+// call. The models are bound to the built-in tools only, so reloaded dynamic tools
+// are offered from the next call on.
+func (e *EinoEngine) modelToolOptions() []model.Option {
+	dynamic := e.dynamicTools()
+	if len(dynamic) == 0 {
+		return nil
+	}
+	infos := make([]*schema.ToolInfo, 0, len(e.toolInfos)+len(dynamic))
+	infos = append(infos, e.toolInfos...)
+	for _, t := range dynamic {
+		infos = append(infos, t.GetInfo())
+	}
+	return []model.Option{model.WithTools(infos)}
+}
+
+// invokeTools runs the tool calls of msg with the tools node, adding the dynamic
+// tools to its list so they pass the same middlewares as the built-in ones.
+func (e *EinoEngine) invokeTools(ctx context.Context, msg *schema.Message) ([]*schema.Message, error) {
+	dynamic := e.dynamicTools()
+	if len(dynamic) == 0 {
+		return e.tools.Invoke(ctx, msg)
+	}
+	list := make([]tool.BaseTool, 0, len(e.staticTools)+len(dynamic))
+	list = append(list, e.staticTools...)
+	for _, t := range dynamic {
+		list = append(list, t)
+	}
+	return e.tools.Invoke(ctx, msg, compose.WithToolList(list...))
+}
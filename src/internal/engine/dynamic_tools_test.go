@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+
+	"miri-main/src/internal/config"
+	"miri-main/src/internal/engine/tools"
+)
+
+func TestDynamicTools(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "tools"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, def := range map[string]string{
+		"echo.json":   `{"name":"echo_text","parameters":{"type":"object","properties":{"text":{"type":"string"}}},"command":"printf %s {{.text}}"}`,
+		"shadow.json": `{"name":"execute_command","command":"true"}`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, "tools", name), []byte(def), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tools.LoadDynamicTools(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = tools.LoadDynamicTools(t.TempDir()) })
+
+	cmdTool := tools.NewCmdTool(filepath.Join(dir, "uploads"))
+	e := &EinoEngine{
+		toolInfos:      []*schema.ToolInfo{cmdTool.GetInfo()},
+		staticTools:    []tool.BaseTool{cmdTool},
+		approvalPolicy: newApprovalPolicy(config.ApprovalConfig{Tools: map[string]string{"echo_text": "deny"}}),
+	}
+
+	// The model is offered the built-in tools and the dynamic one that does not shadow them.
+	opts := model.GetCommonOptions(nil, e.modelToolOptions()...)
+	var names []string
+	for _, info := range opts.Tools {
+		names = append(names, info.Name)
+	}
+	if strings.Join(names, ",") != "execute_command,echo_text" {
+		t.Errorf("unexpected model tools %v", names)
+	}
+
+	node, err := compose.NewToolNode(context.Background(), &compose.ToolsNodeConfig{
+		Tools:               e.staticTools,
+		ToolCallMiddlewares: []compose.ToolMiddleware{{Invokable: e.approvalMiddleware}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.tools = node
+	call := &schema.Message{Role: schema.Assistant, ToolCalls: []schema.ToolCall{{
+		ID: "c1", Type: "function", Function: schema.FunctionCall{Name: "echo_text", Arguments: `{"text":"hi"}`},
+	}}}
+	ctx := withRunScope(context.Background(), &graphInput{SessionID: "miri:session:test"})
+
+	// Dynamic tools pass the middlewares of the built-in ones.
+	msgs, err := e.invokeTools(ctx, call)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(msgs[0].Content, "Tool call denied") {
+		t.Errorf("expected the approval policy applied, got %q", msgs[0].Content)
+	}
+
+	e.approvalPolicy = newApprovalPolicy(config.ApprovalConfig{})
+	msgs, err = e.invokeTools(ctx, call)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(msgs[0].Content, `"stdout":"hi"`) {
+		t.Errorf("unexpected result %q", msgs[0].Content)
+	}
+}
@@ -3,29 +3,111 @@ package engine
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"strings"
+	"time"
 
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
 	"github.com/cloudwego/eino/schema"
 
 	"miri-main/src/internal/engine/tools"
 	"miri-main/src/internal/llm"
-	"miri-main/src/internal/resilience"
 	"miri-main/src/internal/session"
+	"miri-main/src/internal/storage"
 )
 
-// emitVerbose sends a tagged verbose event to the input's VerboseCh non-blocking.
-func emitVerbose(input *graphInput, msg string) {
-	if input.VerboseCh == nil {
-		return
+// generate runs one model call of the agent loop. When ctx carries an event sink it uses
+// the model's Stream API, emitting content and reasoning deltas as they arrive, and
+// concatenates the chunks so tool calls are assembled exactly as Generate returns them.
+// The deltas are emitted with the session's placeholders restored.
+func (e *EinoEngine) generate(ctx context.Context, input *graphInput, msgs []*schema.Message) (*schema.Message, error) {
+	opts := append(e.modelToolOptions(), input.CallOpts...)
+	if !hasEventSink(ctx) {
+		return e.chat.Generate(ctx, msgs, opts...)
 	}
-	select {
-	case input.VerboseCh <- msg:
-	default:
+
+	sr, err := e.chat.Stream(ctx, msgs, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer sr.Close()
+
+	reasoning, content := e.vault.Restorer(input.SessionID), e.vault.Restorer(input.SessionID)
+	emit := func(t EventType, delta string) {
+		if delta != "" {
+			emitEvent(ctx, StreamEvent{Type: t, Content: delta})
+		}
+	}
+	var chunks []*schema.Message
+	for {
+		chunk, err := sr.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if chunk == nil {
+			continue
+		}
+		emit(EventReasoning, reasoning.Write(chunk.ReasoningContent))
+		emit(EventContent, content.Write(chunk.Content))
+		chunks = append(chunks, chunk)
+	}
+	emit(EventReasoning, reasoning.Flush())
+	emit(EventContent, content.Flush())
+	if len(chunks) == 0 {
+		return nil, errors.New("model returned an empty stream")
+	}
+
+	msg, err := schema.ConcatMessages(chunks)
+	if err != nil {
+		return nil, fmt.Errorf("concat stream chunks: %w", err)
+	}
+	// Every chunk carries the answering model; concatenation would join the values.
+	stampAnsweredBy(msg, answeredBy(chunks[0]))
+	return msg, nil
+}
+
+// toolEventMiddleware reports tool_start and tool_end events, including the call's
+// duration, to the event sink of the call's context.
+func (e *EinoEngine) toolEventMiddleware(next compose.InvokableToolEndpoint) compose.InvokableToolEndpoint {
+	return func(ctx context.Context, in *compose.ToolInput) (*compose.ToolOutput, error) {
+		emitEvent(ctx, StreamEvent{Type: EventToolStart, ToolCallID: in.CallID, Tool: in.Name, Arguments: in.Arguments})
+		start := time.Now()
+		out, err := next(ctx, in)
+		ev := StreamEvent{Type: EventToolEnd, ToolCallID: in.CallID, Tool: in.Name, DurationMs: time.Since(start).Milliseconds()}
+		if err != nil {
+			ev.Error = err.Error()
+		} else if out != nil {
+			ev.Result = e.redactKeys(out.Result)
+		}
+		emitEvent(ctx, ev)
+		return out, err
 	}
 }
 
+// runInlineTool runs a tool the loop executes itself (task_manager, file_manager)
+// through the same event, cassette and approval middleware as the tools node.
+func (e *EinoEngine) runInlineTool(ctx context.Context, tc schema.ToolCall, t tool.InvokableTool) (string, error) {
+	endpoint := e.vaultMiddleware(e.toolEventMiddleware(e.cassetteMiddleware(e.approvalMiddleware(func(ctx context.Context, in *compose.ToolInput) (*compose.ToolOutput, error) {
+		res, err := t.InvokableRun(ctx, in.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		return &compose.ToolOutput{Result: res}, nil
+	}))))
+	out, err := endpoint(ctx, &compose.ToolInput{Name: tc.Function.Name, Arguments: tc.Function.Arguments, CallID: tc.ID})
+	if err != nil {
+		return "", err
+	}
+	return out.Result, nil
+}
+
 func (e *EinoEngine) agentInvoke(ctx context.Context, input *graphInput) (out *graphOutput, err error) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -34,11 +116,22 @@ func (e *EinoEngine) agentInvoke(ctx context.Context, input *graphInput) (out *g
 		}
 	}()
 
-	slog.Info("Agent loop start", "session_id", input.SessionID, "max_steps", e.maxSteps)
+	slog.Info("Agent loop start", "session_id", input.SessionID, "run_id", input.RunID, "max_steps", e.maxSteps)
+	ctx = withRunScope(ctx, input)
+	// Paid tools (generate_image) add their cost to the run's usage
+	meter := &tools.CostMeter{}
+	ctx = tools.WithCostMeter(ctx, meter)
 	msgs := input.Messages
+	start := 0
+	var totalUsage llm.Usage
 
-	// Activate skills learn and skill_creator for default session
-	if input.SessionID == session.DefaultSessionID {
+	if input.Resume != nil {
+		// The checkpoint already holds the prepared conversation up to the last tool step
+		msgs = input.Resume.Messages
+		start = input.Resume.Step
+		totalUsage = input.Resume.Usage
+	} else if !session.IsSubAgent(input.SessionID) {
+		// Activate skills learn and skill_creator for conversation sessions (not sub-agent runs)
 		activatedSkills := []string{"learn", "skill_creator"}
 		for _, sn := range activatedSkills {
 			// Check if already in messages to avoid duplicates
@@ -52,28 +145,32 @@ func (e *EinoEngine) agentInvoke(ctx context.Context, input *graphInput) (out *g
 			}
 			if !alreadyLoaded {
 				if skill, ok := e.skillLoader.GetSkill(sn); ok {
-					slog.Info("Auto-activating skill for default session", "skill", sn)
+					slog.Info("Auto-activating skill for session", "skill", sn, "session_id", input.SessionID)
 					msgs = append(msgs, schema.SystemMessage(fmt.Sprintf("SKILL LOADED: %s\n\n%s", skill.Name, skill.FullContent)))
 				}
 			}
 		}
 	}
 
-	// Add user prompt if not already there (it might be restored from checkpoint)
-	if len(msgs) == 0 || msgs[len(msgs)-1].Role != schema.User || msgs[len(msgs)-1].Content != input.Prompt {
-		msgs = append(msgs, schema.UserMessage(input.Prompt))
+	// Add user prompt if not already there (it might be restored from checkpoint).
+	// The history only holds its text, so a prompt with attachments replaces it.
+	if input.Resume == nil {
+		user := userMessage(input.Prompt, input.Attachments)
+		if len(msgs) == 0 || msgs[len(msgs)-1].Role != schema.User || msgs[len(msgs)-1].Content != input.Prompt {
+			msgs = append(msgs, user)
+		} else if len(input.Attachments) > 0 {
+			msgs = append(msgs[:len(msgs)-1:len(msgs)-1], user)
+		}
 	}
 
-	var totalUsage llm.Usage
-
-	for i := range e.maxSteps {
+	for i := start; i < e.maxSteps; i++ {
 		slog.Debug("Agent loop iteration", "step", i, "messages_count", len(msgs))
 
 		// Sanitize messages before sending to LLM to avoid safety triggers (e.g. Grok data leakage check)
-		sanitizedMsgs := e.sanitizeMessages(msgs)
-		assistant, err := resilience.Retry(ctx, func(rctx context.Context) (*schema.Message, error) {
-			return e.chat.Generate(rctx, sanitizedMsgs, input.CallOpts...)
-		}, resilience.RetryOpts{})
+		// and trim them to the context window of the model chain
+		sanitizedMsgs := e.fitContext(e.sanitizeMessages(input.SessionID, msgs))
+		// e.chat retries transient errors and fails over along the configured model chain
+		assistant, err := e.generate(ctx, input, sanitizedMsgs)
 		if err != nil {
 			var sb strings.Builder
 			for _, m := range sanitizedMsgs {
@@ -86,13 +183,20 @@ func (e *EinoEngine) agentInvoke(ctx context.Context, input *graphInput) (out *g
 		// Ensure assistant message has non-empty content
 		if strings.TrimSpace(assistant.Content) == "" {
 			assistant.Content = "..."
+			if len(assistant.ToolCalls) == 0 {
+				emitEvent(ctx, StreamEvent{Type: EventContent, Content: assistant.Content})
+			}
 		}
 
+		if m := answeredBy(assistant); m != "" {
+			totalUsage.Model = m
+		}
 		if assistant.ResponseMeta != nil && assistant.ResponseMeta.Usage != nil {
 			totalUsage.PromptTokens += assistant.ResponseMeta.Usage.PromptTokens
+			totalUsage.CachedTokens += assistant.ResponseMeta.Usage.PromptTokenDetails.CachedTokens
 			totalUsage.CompletionTokens += assistant.ResponseMeta.Usage.CompletionTokens
 			totalUsage.TotalTokens += assistant.ResponseMeta.Usage.TotalTokens
-			totalUsage.TotalCost += e.CalculateCost(assistant.ResponseMeta.Usage.PromptTokens, assistant.ResponseMeta.Usage.CompletionTokens)
+			totalUsage.TotalCost += e.CalculateCost(assistant)
 
 			slog.Debug("Usage update", "step", i, "total_tokens", totalUsage.TotalTokens, "cost", totalUsage.TotalCost)
 
@@ -112,12 +216,10 @@ func (e *EinoEngine) agentInvoke(ctx context.Context, input *graphInput) (out *g
 
 		if len(assistant.ToolCalls) == 0 {
 			slog.Info("Agent loop finished (no tool calls)", "steps", i+1, "total_tokens", totalUsage.TotalTokens)
-			if strings.TrimSpace(assistant.Content) != "" {
-				emitVerbose(input, fmt.Sprintf("[Thought: %s]", strings.TrimSpace(assistant.Content)))
-			}
 			return &graphOutput{
 				SessionID:   input.SessionID,
 				Answer:      assistant.Content,
+				Model:       totalUsage.Model,
 				Messages:    msgs,
 				Usage:       totalUsage,
 				LastMessage: assistant,
@@ -125,12 +227,6 @@ func (e *EinoEngine) agentInvoke(ctx context.Context, input *graphInput) (out *g
 		}
 
 		slog.Info("Agent tool calls triggered", "step", i, "calls", len(assistant.ToolCalls))
-		if strings.TrimSpace(assistant.Content) != "" {
-			emitVerbose(input, fmt.Sprintf("[Thought: %s]", strings.TrimSpace(assistant.Content)))
-		}
-		for _, tc := range assistant.ToolCalls {
-			emitVerbose(input, fmt.Sprintf("[Tool: %s(%s)]", tc.Function.Name, tc.Function.Arguments))
-		}
 		msgs = append(msgs, assistant)
 		if e.brain != nil {
 			e.brain.AddToBuffer(input.SessionID, assistant)
@@ -147,13 +243,17 @@ func (e *EinoEngine) agentInvoke(ctx context.Context, input *graphInput) (out *g
 						slog.Info("Injecting skill into context", "skill", skill.Name)
 						// Inject skill content as a system message to guide future steps
 						// Sanitize skill content as well
-						cleanSkillContent := e.sanitizeString(skill.FullContent)
+						cleanSkillContent := e.sanitizeString(input.SessionID, skill.FullContent)
 						msgs = append(msgs, schema.SystemMessage(fmt.Sprintf("SKILL LOADED: %s\n\n%s", skill.Name, cleanSkillContent)))
 					}
 				}
 			}
 		}
 
+		// A question to the human suspends the run after this step
+		var asked *storage.HumanQuestion
+		var askedCallID string
+
 		// Inject Task Manager Tool with current session ID
 		if e.taskGateway != nil {
 			taskMgrTool := tools.NewTaskManagerTool(e.taskGateway, input.SessionID)
@@ -164,7 +264,7 @@ func (e *EinoEngine) agentInvoke(ctx context.Context, input *graphInput) (out *g
 			for _, tc := range assistant.ToolCalls {
 				if tc.Function.Name == "task_manager" {
 					slog.Info("Executing task_manager tool", "session_id", input.SessionID)
-					res, err := taskMgrTool.InvokableRun(ctx, tc.Function.Arguments)
+					res, err := e.runInlineTool(ctx, tc, taskMgrTool)
 					if err != nil {
 						res = fmt.Sprintf("Error: %v", err)
 					} else {
@@ -173,13 +273,12 @@ func (e *EinoEngine) agentInvoke(ctx context.Context, input *graphInput) (out *g
 						}
 					}
 					// Sanitize tool output before adding to messages and buffer
-					res = e.sanitizeString(res)
-					emitVerbose(input, fmt.Sprintf("[ToolResult: task_manager → %s]", res))
+					res = e.sanitizeString(input.SessionID, res)
 					toolMsgs = append(toolMsgs, schema.ToolMessage(res, tc.ID))
 				} else if tc.Function.Name == "file_manager" {
 					slog.Info("Executing file_manager tool")
 					fileMgrTool := tools.NewFileManagerTool(e.storageBaseDir, e.taskGateway)
-					res, err := fileMgrTool.InvokableRun(ctx, tc.Function.Arguments)
+					res, err := e.runInlineTool(ctx, tc, fileMgrTool)
 					if err != nil {
 						res = fmt.Sprintf("Error: %v", err)
 					} else {
@@ -188,8 +287,25 @@ func (e *EinoEngine) agentInvoke(ctx context.Context, input *graphInput) (out *g
 						}
 					}
 					// Sanitize tool output before adding to messages and buffer
-					res = e.sanitizeString(res)
-					emitVerbose(input, fmt.Sprintf("[ToolResult: file_manager → %s]", res))
+					res = e.sanitizeString(input.SessionID, res)
+					toolMsgs = append(toolMsgs, schema.ToolMessage(res, tc.ID))
+				} else if tc.Function.Name == "ask_human" {
+					var res string
+					if asked != nil {
+						res = "Only one question can be asked at a time. Ask again after the human has answered."
+					} else {
+						hg, _ := e.taskGateway.(tools.HumanGateway)
+						askTool := tools.NewAskHumanTool(hg, input.SessionID, input.RunID, e.askHumanTimeout)
+						var err error
+						res, err = e.runInlineTool(ctx, tc, askTool)
+						if err != nil {
+							res = fmt.Sprintf("Error: %v", err)
+						} else if q := askTool.Asked(); q != nil {
+							slog.Info("Agent asked the human", "session_id", input.SessionID, "run_id", input.RunID, "question_id", q.ID)
+							asked, askedCallID = q, tc.ID
+						}
+					}
+					res = e.sanitizeString(input.SessionID, res)
 					toolMsgs = append(toolMsgs, schema.ToolMessage(res, tc.ID))
 				} else {
 					remainingToolCalls = append(remainingToolCalls, tc)
@@ -212,18 +328,17 @@ func (e *EinoEngine) agentInvoke(ctx context.Context, input *graphInput) (out *g
 					Content:   "",
 					ToolCalls: remainingToolCalls,
 				}
-				moreToolMsgs, err := e.tools.Invoke(ctx, tempAssistant)
+				moreToolMsgs, err := e.invokeTools(ctx, tempAssistant)
 				if err != nil {
 					slog.Error("Tool invoke failed (remaining)", "step", i, "error", err)
 					return nil, err
 				}
-				// Sanitize tool outputs from e.tools.Invoke
-				moreToolMsgs = e.sanitizeMessages(moreToolMsgs)
+				// Sanitize tool outputs from e.invokeTools
+				moreToolMsgs = e.sanitizeMessages(input.SessionID, moreToolMsgs)
 				for _, m := range moreToolMsgs {
 					if strings.TrimSpace(m.Content) == "" {
 						m.Content = "Tool execution completed (no output)"
 					}
-					emitVerbose(input, fmt.Sprintf("[ToolResult: %s]", m.Content))
 				}
 				msgs = append(msgs, moreToolMsgs...)
 				if e.brain != nil {
@@ -233,18 +348,17 @@ func (e *EinoEngine) agentInvoke(ctx context.Context, input *graphInput) (out *g
 				}
 			}
 		} else {
-			toolMsgs, err := e.tools.Invoke(ctx, assistant)
+			toolMsgs, err := e.invokeTools(ctx, assistant)
 			if err != nil {
 				slog.Error("Tool invoke failed", "step", i, "error", err)
 				return nil, err
 			}
-			// Sanitize tool outputs from e.tools.Invoke
-			toolMsgs = e.sanitizeMessages(toolMsgs)
+			// Sanitize tool outputs from e.invokeTools
+			toolMsgs = e.sanitizeMessages(input.SessionID, toolMsgs)
 			for _, m := range toolMsgs {
 				if strings.TrimSpace(m.Content) == "" {
 					m.Content = "Tool execution completed (no output)"
 				}
-				emitVerbose(input, fmt.Sprintf("[ToolResult: %s]", m.Content))
 			}
 			msgs = append(msgs, toolMsgs...)
 			if e.brain != nil {
@@ -253,27 +367,56 @@ func (e *EinoEngine) agentInvoke(ctx context.Context, input *graphInput) (out *g
 				}
 			}
 		}
+
+		totalUsage.TotalCost += meter.Take()
+
+		if asked != nil {
+			// The question ends this turn; AnswerRun continues with the next step
+			e.suspendRun(input, msgs, i+1, asked, askedCallID, totalUsage)
+			emitEvent(ctx, StreamEvent{Type: EventQuestion, QuestionID: asked.ID, Content: asked.Question})
+			emitEvent(ctx, StreamEvent{Type: EventContent, Content: asked.Question})
+			slog.Info("Agent run suspended, waiting for the human", "steps", i+1, "run_id", input.RunID, "question_id", asked.ID)
+			return &graphOutput{
+				SessionID:   input.SessionID,
+				Answer:      asked.Question,
+				Model:       totalUsage.Model,
+				Messages:    msgs,
+				Usage:       totalUsage,
+				LastMessage: schema.AssistantMessage(asked.Question, nil),
+				WaitingFor:  asked.ID,
+			}, nil
+		}
+
+		// A crash from here on resumes at the next step instead of starting over
+		lastTool := assistant.ToolCalls[len(assistant.ToolCalls)-1].Function.Name
+		e.checkpointRun(input, msgs, i+1, lastTool, totalUsage)
 	}
 
 	// Final generation if loop exhausted
 	slog.Info("Agent loop exhausted, final generation", "max_steps", e.maxSteps)
-	final, err := e.chat.Generate(ctx, msgs, input.CallOpts...)
+	final, err := e.generate(ctx, input, e.fitContext(e.sanitizeMessages(input.SessionID, msgs)))
 	if err != nil {
 		return nil, err
 	}
 	if strings.TrimSpace(final.Content) == "" {
 		final.Content = "..."
+		emitEvent(ctx, StreamEvent{Type: EventContent, Content: final.Content})
+	}
+	if m := answeredBy(final); m != "" {
+		totalUsage.Model = m
 	}
 	if final.ResponseMeta != nil && final.ResponseMeta.Usage != nil {
 		totalUsage.PromptTokens += final.ResponseMeta.Usage.PromptTokens
+		totalUsage.CachedTokens += final.ResponseMeta.Usage.PromptTokenDetails.CachedTokens
 		totalUsage.CompletionTokens += final.ResponseMeta.Usage.CompletionTokens
 		totalUsage.TotalTokens += final.ResponseMeta.Usage.TotalTokens
-		totalUsage.TotalCost += e.CalculateCost(final.ResponseMeta.Usage.PromptTokens, final.ResponseMeta.Usage.CompletionTokens)
+		totalUsage.TotalCost += e.CalculateCost(final)
 	}
 
 	return &graphOutput{
 		SessionID:   input.SessionID,
 		Answer:      final.Content,
+		Model:       totalUsage.Model,
 		Messages:    msgs,
 		Usage:       totalUsage,
 		LastMessage: final,
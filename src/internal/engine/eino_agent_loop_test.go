@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+// chunkChat streams a fixed sequence of chunks.
+type chunkChat struct {
+	chunks []*schema.Message
+}
+
+func (c *chunkChat) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	return schema.ConcatMessages(c.chunks)
+}
+
+func (c *chunkChat) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	return schema.StreamReaderFromArray(c.chunks), nil
+}
+
+func TestGenerate_StreamsDeltasAndAssemblesToolCalls(t *testing.T) {
+	idx := 0
+	chunks := []*schema.Message{
+		{Role: schema.Assistant, ReasoningContent: "thinking"},
+		{Role: schema.Assistant, Content: "Let me "},
+		{Role: schema.Assistant, Content: "check."},
+		{Role: schema.Assistant, ToolCalls: []schema.ToolCall{{Index: &idx, ID: "call_1", Function: schema.FunctionCall{Name: "web_search", Arguments: `{"query":`}}}},
+		{Role: schema.Assistant, ToolCalls: []schema.ToolCall{{Index: &idx, Function: schema.FunctionCall{Arguments: `"go"}`}}}},
+	}
+	f := newTestFailover(0)
+	f.candidates = []*failoverCandidate{{name: "xai/test", chat: &chunkChat{chunks: chunks}}}
+	e := &EinoEngine{chat: f, failover: f}
+
+	events := make(chan StreamEvent, 16)
+	ctx := withEventSink(context.Background(), events)
+	msg, err := e.generate(ctx, &graphInput{}, nil)
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	close(events)
+
+	var got []StreamEvent
+	for ev := range events {
+		got = append(got, ev)
+	}
+	want := []StreamEvent{
+		{Type: EventReasoning, Content: "thinking"},
+		{Type: EventContent, Content: "Let me "},
+		{Type: EventContent, Content: "check."},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("events = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].Type != want[i].Type || got[i].Content != want[i].Content {
+			t.Errorf("event %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if msg.Content != "Let me check." {
+		t.Errorf("content = %q", msg.Content)
+	}
+	if len(msg.ToolCalls) != 1 || msg.ToolCalls[0].Function.Arguments != `{"query":"go"}` {
+		t.Fatalf("tool calls not assembled: %+v", msg.ToolCalls)
+	}
+	if answeredBy(msg) != "xai/test" {
+		t.Errorf("answeredBy = %q, want xai/test", answeredBy(msg))
+	}
+}
+
+func TestGenerate_WithoutSinkUsesGenerate(t *testing.T) {
+	f := newTestFailover(0, &stubChat{name: "xai/test"})
+	e := &EinoEngine{chat: f, failover: f}
+
+	msg, err := e.generate(context.Background(), &graphInput{}, nil)
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	if msg.Content != "from xai/test" {
+		t.Errorf("content = %q", msg.Content)
+	}
+}
+
+func TestToolEventMiddleware(t *testing.T) {
+	e := &EinoEngine{}
+	events := make(chan StreamEvent, 4)
+	ctx := withEventSink(context.Background(), events)
+
+	ok := e.toolEventMiddleware(func(ctx context.Context, in *compose.ToolInput) (*compose.ToolOutput, error) {
+		return &compose.ToolOutput{Result: "42"}, nil
+	})
+	if _, err := ok(ctx, &compose.ToolInput{Name: "calc", Arguments: `{"x":1}`, CallID: "c1"}); err != nil {
+		t.Fatalf("tool failed: %v", err)
+	}
+	failing := e.toolEventMiddleware(func(ctx context.Context, in *compose.ToolInput) (*compose.ToolOutput, error) {
+		return nil, errors.New("boom")
+	})
+	if _, err := failing(ctx, &compose.ToolInput{Name: "calc", CallID: "c2"}); err == nil {
+		t.Fatal("expected tool error to propagate")
+	}
+	close(events)
+
+	var got []StreamEvent
+	for ev := range events {
+		got = append(got, ev)
+	}
+	if len(got) != 4 {
+		t.Fatalf("expected 4 events, got %+v", got)
+	}
+	if got[0].Type != EventToolStart || got[0].Tool != "calc" || got[0].Arguments != `{"x":1}` || got[0].ToolCallID != "c1" {
+		t.Errorf("unexpected start event %+v", got[0])
+	}
+	if got[1].Type != EventToolEnd || got[1].Result != "42" || got[1].Error != "" {
+		t.Errorf("unexpected end event %+v", got[1])
+	}
+	if got[3].Type != EventToolEnd || got[3].Error != "boom" {
+		t.Errorf("unexpected error end event %+v", got[3])
+	}
+}
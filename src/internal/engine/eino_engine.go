@@ -10,6 +10,7 @@ import (
 	"miri-main/src/internal/engine/skills"
 	"miri-main/src/internal/engine/subagents"
 	"miri-main/src/internal/engine/tools"
+	"miri-main/src/internal/engine/vault"
 	"miri-main/src/internal/llm"
 	"miri-main/src/internal/storage"
 	"path/filepath"
@@ -17,9 +18,7 @@ import (
 	"strings"
 	"time"
 
-	"github.com/cloudwego/eino-ext/components/model/openai"
 	"github.com/cloudwego/eino/callbacks"
-	"github.com/cloudwego/eino/components"
 	"github.com/cloudwego/eino/components/model"
 	"github.com/cloudwego/eino/components/tool"
 	"github.com/cloudwego/eino/compose"
@@ -27,7 +26,7 @@ import (
 )
 
 // newSlogHandler creates a callback handler that logs component execution to slog.
-func newSlogHandler(out chan<- string) callbacks.Handler {
+func newSlogHandler() callbacks.Handler {
 	return callbacks.NewHandlerBuilder().
 		OnStartFn(func(ctx context.Context, info *callbacks.RunInfo, input callbacks.CallbackInput) context.Context {
 			slog.Info("Eino Component Start",
@@ -35,10 +34,6 @@ func newSlogHandler(out chan<- string) callbacks.Handler {
 				"type", info.Type,
 				"component", info.Component,
 				"input_type", fmt.Sprintf("%T", input))
-
-			if out != nil && info.Component == components.ComponentOfChatModel {
-				out <- fmt.Sprintf("[Thought: %s started]\n", info.Name)
-			}
 			return ctx
 		}).
 		OnEndFn(func(ctx context.Context, info *callbacks.RunInfo, output callbacks.CallbackOutput) context.Context {
@@ -47,10 +42,6 @@ func newSlogHandler(out chan<- string) callbacks.Handler {
 				"type", info.Type,
 				"component", info.Component,
 				"output_type", fmt.Sprintf("%T", output))
-
-			if out != nil && info.Component == compose.ComponentOfToolsNode {
-				out <- fmt.Sprintf("[Tools: %s finished]\n", info.Name)
-			}
 			return ctx
 		}).
 		OnErrorFn(func(ctx context.Context, info *callbacks.RunInfo, err error) context.Context {
@@ -59,9 +50,6 @@ func newSlogHandler(out chan<- string) callbacks.Handler {
 				"type", info.Type,
 				"component", info.Component,
 				"error", err)
-			if out != nil {
-				out <- fmt.Sprintf("[Error in %s: %v]\n", info.Name, err)
-			}
 			return ctx
 		}).
 		Build()
@@ -71,44 +59,62 @@ func newSlogHandler(out chan<- string) callbacks.Handler {
 type EinoEngine struct {
 	chat            model.BaseChatModel
 	tools           *compose.ToolsNode
+	staticTools     []tool.BaseTool
 	maxSteps        int
 	debug           bool
 	checkPointStore *FileCheckPointStore
 	contextWindow   int
+	imageInput      bool
+	promptBudget    int
+	tokens          tokenEstimator
 	storageBaseDir  string
 	storage         *storage.Storage
+	ledger          costLedger
+	budget          *budgetGuard
 	compiledGraph   compose.Runnable[*graphInput, *graphOutput]
 	skillLoader     *skills.SkillLoader
 	taskGateway     tools.TaskGateway
 	memorySystem    memory.MemorySystem
 	brain           *memory.Brain
 	subAgentTools   map[string]tool.InvokableTool
-	modelCost       config.ModelCost
-
+	failover        *failoverChatModel
+	primary         modelRef
+	toolInfos       []*schema.ToolInfo
+	askHumanTimeout time.Duration
+	approver        Approver
+	approvalPolicy  map[string]string
+	approvalTimeout time.Duration
+	cassetteMode    string
+	cassetteDir     string
+
+	// sensitiveStrings (the providers' API keys) are redacted for good; other
+	// sensitive values are swapped for placeholders by the vault.
 	sensitiveStrings []string
-	xaiIDRegex       *regexp.Regexp
-	uuidRegex        *regexp.Regexp
-	emailRegex       *regexp.Regexp
-	hexKeyRegex      *regexp.Regexp
+	vault            *vault.Vault
 }
 
 type graphInput struct {
 	SessionID string
 	Messages  []*schema.Message
 	Prompt    string
-	CallOpts  []model.Option
-	// VerboseCh receives tagged verbose events during the agent loop:
-	// [Thought: ...], [Tool: name(args)], [ToolResult: name → result]
-	// It is optional; nil means no verbose output.
-	VerboseCh chan<- string
+	// Attachments are the parts of the prompt besides its text (see Options).
+	Attachments []schema.MessageInputPart
+	CallOpts    []model.Option
+	// RunID identifies the run for checkpointing after each tool step; empty disables it.
+	RunID string
+	// Resume continues an interrupted run from its checkpoint instead of Messages.
+	Resume *engineState
 }
 
 type graphOutput struct {
 	SessionID   string
 	Answer      string
+	Model       string
 	Messages    []*schema.Message
 	Usage       llm.Usage
 	LastMessage *schema.Message
+	// WaitingFor is the ID of the question the run is suspended on (ask_human).
+	WaitingFor string
 }
 
 func NewEinoEngine(cfg *config.Config, st *storage.Storage, providerName, modelName string, taskGateway tools.TaskGateway) (*EinoEngine, error) {
@@ -117,49 +123,40 @@ func NewEinoEngine(cfg *config.Config, st *storage.Storage, providerName, modelN
 		return nil, fmt.Errorf("provider %q not found", providerName)
 	}
 
-	cm, err := openai.NewChatModel(context.Background(), &openai.ChatModelConfig{
-		BaseURL: prov.BaseURL,
-		APIKey:  prov.APIKey,
-		Model:   modelName,
-		Timeout: 30 * time.Minute,
-	})
+	// Primary model followed by the fallback chain (agents.defaults.model.fallbacks)
+	chain, ctxWindow, err := newModelChain(cfg, modelRef{Provider: providerName, Model: modelName})
 	if err != nil {
 		return nil, err
 	}
+	var chatModel model.BaseChatModel = chain[0].cm
 
-	var chatModel model.BaseChatModel = cm
-
-	// determine context window and cost for selected model
-	ctxWindow := 0
-	var modelCost config.ModelCost
-	fullName := providerName + "/" + modelName
-	for _, m := range prov.Models {
-		if m.ID == fullName || m.Name == fullName || m.Name == modelName {
-			if m.ContextWindow > 0 {
-				ctxWindow = m.ContextWindow
-			}
-			modelCost = m.Cost
-			break
-		}
+	// Every model call is recorded in the cost ledger of the session database.
+	var ledger costLedger
+	if st != nil {
+		ledger = st
 	}
+	brainModel := newLedgerChatModel(chatModel, ledger, storage.CostSourceBrain, chain[0].name,
+		func(string) config.ModelCost { return chain[0].cost })
+	guard := newBudgetGuard(cfg, providerName)
+	brainModel = guard.wrap(brainModel, providerName, ledger, storage.CostSourceBrain)
 
 	// Initialize Vector Memory
 	var factsVM memory.MemorySystem
-	if vm, err := memory.NewVectorMemory(cfg, "miri_facts"); err == nil {
+	if vm, err := memory.NewVectorMemory(cfg, memory.FactsCollectionName); err == nil {
 		factsVM = vm
 	} else {
 		slog.Warn("failed to initialize facts vector memory", "error", err)
 	}
 
 	var summariesVM memory.MemorySystem
-	if vm, err := memory.NewVectorMemory(cfg, "miri_summaries"); err == nil {
+	if vm, err := memory.NewVectorMemory(cfg, memory.SummariesCollectionName); err == nil {
 		summariesVM = vm
 	} else {
 		slog.Warn("failed to initialize summaries vector memory", "error", err)
 	}
 
 	var stepsVM memory.MemorySystem
-	if vm, err := memory.NewVectorMemory(cfg, "miri_steps"); err == nil {
+	if vm, err := memory.NewVectorMemory(cfg, memory.StepsCollectionName); err == nil {
 		stepsVM = vm
 	} else {
 		slog.Warn("failed to initialize steps vector memory", "error", err)
@@ -174,6 +171,7 @@ func NewEinoEngine(cfg *config.Config, st *storage.Storage, providerName, modelN
 	fileManagerTool := tools.NewFileManagerTool(cfg.StorageDir, nil) // Will be properly set if gateway is available
 	retrievePasswordTool := tools.NewRetrievePasswordTool(cfg.Miri.KeePass.DBPath, cfg.Miri.KeePass.Password)
 	storePasswordTool := tools.NewStorePasswordTool(cfg.Miri.KeePass.DBPath, cfg.Miri.KeePass.Password)
+	askHumanTool := tools.NewAskHumanTool(nil, "", "", 0) // Executed by the agent loop when a gateway is available
 
 	cpStore, err := NewFileCheckPointStore(cfg.StorageDir)
 	if err != nil {
@@ -186,21 +184,42 @@ func NewEinoEngine(cfg *config.Config, st *storage.Storage, providerName, modelN
 		debug:            cfg.Agents.Debug,
 		checkPointStore:  cpStore,
 		contextWindow:    ctxWindow,
+		imageInput:       chain[0].images,
 		storageBaseDir:   cfg.StorageDir,
 		storage:          st,
+		ledger:           ledger,
+		budget:           guard,
 		memorySystem:     factsVM,
-		brain:            memory.NewBrain(chatModel, factsVM, summariesVM, stepsVM, ctxWindow, st, cfg.Miri.Brain.Retrieval, cfg.Miri.Brain.MaxNodesPerSession),
-		modelCost:        modelCost,
+		brain:            memory.NewBrain(newCassetteChatModel(brainModel, cassetteBrain), factsVM, summariesVM, stepsVM, ctxWindow, st, cfg.Miri.Brain.Retrieval, cfg.Miri.Brain.MaxNodesPerSession),
 		taskGateway:      taskGateway,
+		askHumanTimeout:  defaultAskHumanTimeout,
+		approvalPolicy:   newApprovalPolicy(cfg.Agents.Defaults.Approvals),
+		approvalTimeout:  time.Duration(cfg.Agents.Defaults.Approvals.TimeoutSeconds) * time.Second,
+		cassetteMode:     cfg.Agents.Cassettes.Mode,
+		cassetteDir:      cfg.Agents.Cassettes.Dir,
 		sensitiveStrings: []string{prov.APIKey},
-		xaiIDRegex:       regexp.MustCompile(`(?i)(Team|API key ID):? [0-9a-f-]{36}`),
-		uuidRegex:        regexp.MustCompile(`(?i)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`),
-		emailRegex:       regexp.MustCompile(`(?i)[a-z0-9._%+-]+@[a-z0-9.-]+\.[a-z]{2,}`),
-		hexKeyRegex:      regexp.MustCompile(`(?i)\b[0-9a-f]{32,}\b`),
+		vault:            sharedVault(cfg, st),
+	}
+
+	if a, ok := taskGateway.(Approver); ok {
+		ee.approver = a
+	}
+	if b, ok := taskGateway.(BudgetProvider); ok {
+		ee.SetBudget(b.Budget())
+	}
+	if ee.cassetteDir == "" {
+		ee.cassetteDir = filepath.Join(cfg.StorageDir, "cassettes")
+	}
+	if secs := cfg.Agents.Defaults.AskHuman.TimeoutSeconds; secs > 0 {
+		ee.askHumanTimeout = time.Duration(secs) * time.Second
 	}
 
 	if ee.brain != nil {
-		ee.brain.SetSanitizeFunc(ee.sanitizeMessages)
+		// The Brain's placeholders belong to no session; retrieval adopts them.
+		ee.brain.SetSanitizeFunc(func(msgs []*schema.Message) []*schema.Message {
+			return ee.sanitizeMessages("", msgs)
+		})
+		ee.brain.SetVault(ee.vault)
 	}
 
 	// Also add other provider API keys to sensitive strings
@@ -229,6 +248,9 @@ func NewEinoEngine(cfg *config.Config, st *storage.Storage, providerName, modelN
 		}
 	})
 
+	// Dynamic tools are added per call (see dynamic_tools.go), so they can be reloaded.
+	loadDynamicTools(cfg.StorageDir)
+
 	// Add skill tools
 	skillsDir := filepath.Join(cfg.StorageDir, "skills")
 	scriptsDir := "scripts" // default scripts directory
@@ -240,30 +262,31 @@ func NewEinoEngine(cfg *config.Config, st *storage.Storage, providerName, modelN
 	skillUseTool := skills.NewUseTool(ee.skillLoader)
 
 	// Update tools node with all tools
-	allTools := []tool.BaseTool{searchTool, fetchTool /* pruned: grokipediaTool (redundant with search/fetch) */, cmdTool, skillRemoveTool, skillListTool, skillInstallTool, skillUseTool, fileManagerTool, retrievePasswordTool, storePasswordTool, chromeMCPTool, cotGraphTool, localInstallTool, topologyTool}
+	allTools := []tool.BaseTool{searchTool, fetchTool /* pruned: grokipediaTool (redundant with search/fetch) */, cmdTool, skillRemoveTool, skillListTool, skillInstallTool, skillUseTool, fileManagerTool, retrievePasswordTool, storePasswordTool, askHumanTool, chromeMCPTool, cotGraphTool, localInstallTool, topologyTool}
+	if imageTool := newImageGenTool(cfg, providerName, ledger, guard); imageTool != nil {
+		allTools = append(allTools, imageTool)
+	}
 	allTools = append(allTools, ee.skillLoader.GetExtraTools()...)
 
-	// Add Eino ADK sub-agent tools (Researcher, Coder, Reviewer)
-	adkTools := subagents.BuildSubAgentTools(context.Background(), chatModel, filepath.Join(ee.storageBaseDir, "uploads"), ee.storage)
-	allTools = append(allTools, adkTools...)
+	// Tools of the configured MCP servers, for the agent and the sub-agents
+	mcpTools, mcpRoleTools := mountMCPTools(context.Background(), cfg)
+	allTools = append(allTools, mcpTools...)
 
-	// Extract sub-agent invokers for /agent slash command
-	ee.subAgentTools = make(map[string]tool.InvokableTool)
-	for _, t := range adkTools {
-		if info, err := t.Info(context.Background()); err == nil {
-			if invoker, ok := t.(tool.InvokableTool); ok {
-				ee.subAgentTools[info.Name] = invoker
-			}
-		}
-	}
+	// Add Eino ADK sub-agent tools (Researcher, Coder, Reviewer). Their model is
+	// set once the model chain is bound to the tool infos, theirs included.
+	subAgentChat := &subAgentChatModel{}
+	adkTools := subagents.BuildSubAgentTools(context.Background(), subAgentChat, filepath.Join(ee.storageBaseDir, "uploads"), ee.storage, mcpRoleTools, ee.wrapSubAgentTool)
+	allTools = append(allTools, adkTools...)
 
 	toolsNode, err := compose.NewToolNode(context.Background(), &compose.ToolsNodeConfig{
-		Tools: allTools,
+		Tools:               allTools,
+		ToolCallMiddlewares: []compose.ToolMiddleware{{Invokable: ee.vaultMiddleware}, {Invokable: ee.toolEventMiddleware}, {Invokable: ee.cassetteMiddleware}, {Invokable: ee.approvalMiddleware}},
 	})
 	if err != nil {
 		return nil, err
 	}
 	ee.tools = toolsNode
+	ee.staticTools = allTools
 
 	// Bind tools to model
 	toolInfos := []*schema.ToolInfo{
@@ -308,26 +331,28 @@ func NewEinoEngine(cfg *config.Config, st *storage.Storage, providerName, modelN
 		toolInfos = append(toolInfos, info)
 	}
 
-	// Prefer the safer ToolCalling API
-	if tc, err2 := cm.WithTools(toolInfos); err2 == nil {
-		ee.chat = tc
-	} else if err := cm.BindTools(toolInfos); err != nil {
+	ee.primary = modelRef{Provider: providerName, Model: modelName}
+	ee.toolInfos = toolInfos
+	ee.tokens = newTokenEstimator(modelName)
+	ee.promptBudget = contextBudget(chain, ee.tokens.tools(toolInfos))
+	ee.failover, err = bindModelChain(cfg, chain, toolInfos)
+	if err != nil {
 		return nil, err
 	}
+	guard.bind(cfg, toolInfos)
+	ee.chat = ee.newChatModel(ee.failover, ee.primary, storage.CostSourceChat)
 
-	// Initialize sub-agent tools
-	ctx := context.Background()
-	agentTools := subagents.BuildSubAgentTools(ctx, ee.chat, filepath.Join(ee.storageBaseDir, "uploads"), ee.storage)
-	ee.subAgentTools = make(map[string]tool.InvokableTool, 3)
-	for _, baseTool := range agentTools {
-		info, err := baseTool.Info(ctx)
+	// Sub-agents are billed, budgeted and failed over like the agent
+	subAgentChat.chat = ee.newChatModel(ee.failover, ee.primary, storage.CostSourceSubAgent)
+	ee.subAgentTools = make(map[string]tool.InvokableTool, len(adkTools))
+	for _, baseTool := range adkTools {
+		info, err := baseTool.Info(context.Background())
 		if err != nil {
 			slog.Warn("failed to get subagent tool info", "error", err)
 			continue
 		}
-		toolRole := strings.ToLower(info.Name)
-		if toolRole == "researcher" || toolRole == "coder" || toolRole == "reviewer" {
-			ee.subAgentTools[toolRole] = baseTool.(tool.InvokableTool)
+		if invoker, ok := baseTool.(tool.InvokableTool); ok {
+			ee.subAgentTools[strings.ToLower(info.Name)] = invoker
 		}
 	}
 
@@ -338,42 +363,66 @@ func NewEinoEngine(cfg *config.Config, st *storage.Storage, providerName, modelN
 	return ee, nil
 }
 
-func (e *EinoEngine) CalculateCost(promptTokens, outputTokens int) float64 {
-	// Cost is typically per 1M tokens.
-	return (float64(promptTokens) * e.modelCost.Input / 1000000.0) + (float64(outputTokens) * e.modelCost.Output / 1000000.0)
-}
-
-func (e *EinoEngine) sanitizeString(s string) string {
-	if s == "" {
-		return ""
+// forModel derives an engine that answers with ref (and the configured fallbacks)
+// but shares everything else with e: Brain, tools, skills, task gateway and checkpoints.
+func (e *EinoEngine) forModel(cfg *config.Config, ref modelRef) (*EinoEngine, error) {
+	chain, ctxWindow, err := newModelChain(cfg, ref)
+	if err != nil {
+		return nil, err
+	}
+	fo, err := bindModelChain(cfg, chain, e.toolInfos)
+	if err != nil {
+		return nil, err
 	}
 
-	// Redact XAI specific IDs (Team, API key ID)
-	if e.xaiIDRegex != nil {
-		s = e.xaiIDRegex.ReplaceAllString(s, "$1: [REDACTED]")
+	derived := *e
+	derived.primary = ref
+	derived.failover = fo
+	derived.chat = derived.newChatModel(fo, ref, storage.CostSourceChat)
+	derived.tokens = newTokenEstimator(ref.Model)
+	derived.imageInput = chain[0].images
+	if ctxWindow > 0 {
+		derived.contextWindow = ctxWindow
+	}
+	if budget := contextBudget(chain, derived.tokens.tools(e.toolInfos)); budget > 0 {
+		derived.promptBudget = budget
 	}
+	if err := derived.buildGraph(); err != nil {
+		return nil, err
+	}
+	return &derived, nil
+}
 
-	// Redact Emails
-	if e.emailRegex != nil {
-		s = e.emailRegex.ReplaceAllString(s, "[REDACTED_EMAIL]")
+// CalculateCost returns the cost of the model call that produced msg, pricing
+// cached prompt tokens at the model's cache rates.
+func (e *EinoEngine) CalculateCost(msg *schema.Message) float64 {
+	var cost config.ModelCost
+	if e.failover != nil {
+		cost = e.failover.costOf(answeredBy(msg))
 	}
+	return llm.MessageCost(cost, msg)
+}
 
-	// Redact long hex strings (common for keys/tokens)
-	if e.hexKeyRegex != nil {
-		s = e.hexKeyRegex.ReplaceAllString(s, "[REDACTED_KEY]")
+// sanitizeString prepares s for a model: API keys are redacted and the other
+// sensitive values swapped for placeholders that sessionID can restore.
+func (e *EinoEngine) sanitizeString(sessionID, s string) string {
+	if s == "" {
+		return ""
 	}
+	return e.vault.Tokenize(sessionID, e.redactKeys(s))
+}
 
-	// Redact sensitive strings (API keys)
+// redactKeys redacts the providers' API keys, which never go back to a tool or the user.
+func (e *EinoEngine) redactKeys(s string) string {
 	for _, ss := range e.sensitiveStrings {
 		if ss != "" && len(ss) > 8 { // Only redact if long enough to be a key
 			s = strings.ReplaceAll(s, ss, "[REDACTED_SENSITIVE]")
 		}
 	}
-
 	return s
 }
 
-func (e *EinoEngine) sanitizeMessages(msgs []*schema.Message) []*schema.Message {
+func (e *EinoEngine) sanitizeMessages(sessionID string, msgs []*schema.Message) []*schema.Message {
 	if msgs == nil {
 		return nil
 	}
@@ -381,7 +430,7 @@ func (e *EinoEngine) sanitizeMessages(msgs []*schema.Message) []*schema.Message
 	for i, m := range msgs {
 		res[i] = &schema.Message{
 			Role:                     m.Role,
-			Content:                  e.sanitizeString(m.Content),
+			Content:                  e.sanitizeString(sessionID, m.Content),
 			MultiContent:             m.MultiContent,
 			UserInputMultiContent:    m.UserInputMultiContent,
 			AssistantGenMultiContent: m.AssistantGenMultiContent,
@@ -390,7 +439,7 @@ func (e *EinoEngine) sanitizeMessages(msgs []*schema.Message) []*schema.Message
 			ToolCallID:               m.ToolCallID,
 			ToolName:                 m.ToolName,
 			ResponseMeta:             m.ResponseMeta,
-			ReasoningContent:         e.sanitizeString(m.ReasoningContent),
+			ReasoningContent:         e.sanitizeString(sessionID, m.ReasoningContent),
 			Extra:                    m.Extra,
 		}
 		// Sanitize tool call arguments if present
@@ -398,7 +447,7 @@ func (e *EinoEngine) sanitizeMessages(msgs []*schema.Message) []*schema.Message
 			newTCs := make([]schema.ToolCall, len(m.ToolCalls))
 			for j, tc := range m.ToolCalls {
 				newTCs[j] = tc
-				newTCs[j].Function.Arguments = e.sanitizeString(tc.Function.Arguments)
+				newTCs[j].Function.Arguments = e.sanitizeString(sessionID, tc.Function.Arguments)
 			}
 			res[i].ToolCalls = newTCs
 		}
@@ -13,12 +13,15 @@ import (
 
 // buildGraph compiles the Eino chain (retriever → agent → brain) and stores it in e.compiledGraph.
 func (e *EinoEngine) buildGraph() error {
-	sanitizer := memory.NewMemorySanitizer(e.sanitizeString)
-
 	chain := compose.NewChain[*graphInput, *graphOutput]()
 
 	// 1. Retriever node
 	chain.AppendLambda(compose.InvokableLambda(func(ctx context.Context, input *graphInput) (*graphInput, error) {
+		// A resumed run continues from its checkpointed conversation, which already
+		// contains the prompts and memories injected here.
+		if input.Resume != nil {
+			return input, nil
+		}
 
 		// Inject agent prompt + topology injection guidance
 		if e.brain != nil {
@@ -38,7 +41,11 @@ func (e *EinoEngine) buildGraph() error {
 		if e.brain != nil && input.Prompt != "" {
 			docs, err := e.brain.RetrieveDocuments(ctx, input.SessionID, input.Prompt)
 			if err == nil && len(docs) > 0 {
-				// Post-retrieval sanitization
+				// Post-retrieval sanitization; memories may hold placeholders of other
+				// sessions, which become restorable in this one.
+				sanitizer := memory.NewMemorySanitizer(func(s string) string {
+					return e.vault.Adopt(input.SessionID, e.redactKeys(s))
+				})
 				sanitizedDocs, err := sanitizer.Transform(ctx, docs)
 				if err == nil {
 					docs = sanitizedDocs
@@ -55,6 +62,7 @@ func (e *EinoEngine) buildGraph() error {
 				memories := sb.String()
 				if memories != "" {
 					input.Messages = append(input.Messages, schema.SystemMessage(memories))
+					emitEvent(ctx, StreamEvent{Type: EventRetrieval, Documents: len(docs)})
 					if e.debug {
 						slog.Info("EinoEngine Debug: Brain memory injected (sanitized)")
 					}
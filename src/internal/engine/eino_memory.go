@@ -7,7 +7,6 @@ import (
 	"io"
 	"log/slog"
 	"strings"
-	"sync"
 
 	"time"
 
@@ -26,24 +25,42 @@ import (
 func (e *EinoEngine) Respond(ctx context.Context, sess *session.Session, promptStr string, humanContext string) (string, *llm.Usage, error) {
 	slog.Info("EinoEngine Respond", "session_id", sess.ID, "prompt_len", len(promptStr))
 
-	const parentSessionKey = "parent_subagent_session"
-	ctx = context.WithValue(ctx, parentSessionKey, sess.ID)
-
 	// Sanitize prompt to remove potentially sensitive data before adding to buffer
-	promptStr = e.sanitizeString(promptStr)
+	promptStr = e.sanitizeString(sess.ID, promptStr)
+
+	attachments, err := e.attachmentParts(ctx, sess.ID)
+	if err != nil {
+		return "", nil, err
+	}
 
 	// Add user prompt to brain buffer as it arrives
 	if e.brain != nil {
 		e.brain.AddToBuffer(sess.ID, schema.UserMessage(promptStr))
 	}
 
+	input := &graphInput{
+		SessionID:   sess.ID,
+		Messages:    e.cleanHistory(sess.ID),
+		Prompt:      promptStr,
+		Attachments: attachments,
+		CallOpts:    callOptionsFrom(ctx),
+		RunID:       e.startRun(sess.ID),
+	}
+	return e.runGraph(ctx, sess, input)
+}
+
+// runGraph invokes the compiled graph for a new or resumed run and finishes the run.
+func (e *EinoEngine) runGraph(ctx context.Context, sess *session.Session, input *graphInput) (string, *llm.Usage, error) {
+	const parentSessionKey = "parent_subagent_session"
+	ctx = context.WithValue(ctx, parentSessionKey, sess.ID)
+
 	// Initialize callbacks with slog handler
 	ctx = callbacks.InitCallbacks(ctx, &callbacks.RunInfo{
 		Name: "EinoEngine",
-	}, newSlogHandler(nil))
+	}, newSlogHandler())
 
 	// Trigger start callback for the engine itself
-	ctx = callbacks.OnStart(ctx, promptStr)
+	ctx = callbacks.OnStart(ctx, input.Prompt)
 	var finalResp string
 	var finalErr error
 	defer func() {
@@ -54,45 +71,24 @@ func (e *EinoEngine) Respond(ctx context.Context, sess *session.Session, promptS
 		}
 	}()
 
-	// Load history from brain
-	var history []*schema.Message
-	if e.brain != nil {
-		history = e.brain.GetBuffer(sess.ID)
-	}
-
-	// Filter out empty messages just in case, though brain buffer should be clean
-	var cleanHistory []*schema.Message
-	for _, m := range history {
-		if strings.TrimSpace(m.Content) != "" {
-			cleanHistory = append(cleanHistory, m)
-		}
-	}
+	subctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
 
-	// Collect dynamic options from context
-	var callOpts []model.Option
-	if opts, ok := FromContext(ctx); ok {
-		if opts.Model != "" {
-			callOpts = append(callOpts, model.WithModel(opts.Model))
-		}
-		if opts.Temperature != nil {
-			callOpts = append(callOpts, model.WithTemperature(*opts.Temperature))
-		}
-		if opts.MaxTokens != nil {
-			callOpts = append(callOpts, model.WithMaxTokens(*opts.MaxTokens))
+	// Resumed runs continue a recording-free checkpoint; only new runs get a cassette.
+	var rec *cassetteRecorder
+	if input.Resume == nil {
+		var err error
+		if subctx, rec, err = e.startCassette(subctx, input); err != nil {
+			e.finishRun(input.RunID, false)
+			finalErr = err
+			return "", nil, err
 		}
 	}
 
-	input := &graphInput{
-		SessionID: sess.ID,
-		Messages:  cleanHistory,
-		Prompt:    promptStr,
-		CallOpts:  callOpts,
-	}
-
-	subctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
-	defer cancel()
-
 	output, err := e.compiledGraph.Invoke(subctx, input, compose.WithCheckPointID(sess.ID))
+	e.finishCassette(rec, input, output, err)
+	// A run waiting for the human keeps its checkpoint until the answer arrives
+	e.finishRun(input.RunID, err == nil && output.WaitingFor == "")
 	if err != nil {
 		// Check for persistent 503 error
 		if strings.Contains(err.Error(), "503") || strings.Contains(err.Error(), "Service Unavailable") {
@@ -101,7 +97,7 @@ func (e *EinoEngine) Respond(ctx context.Context, sess *session.Session, promptS
 
 		// Eino wraps node errors in an internal error type that isn't exported.
 		// We can't type-assert it, so log the error and its immediate cause if any.
-		slog.Error("Graph error", "error", err, "session_id", sess.ID)
+		slog.Error("Graph error", "error", err, "session_id", sess.ID, "run_id", input.RunID)
 		if cause := errors.Unwrap(err); cause != nil {
 			slog.Error("Cause", "cause", cause)
 		}
@@ -109,7 +105,7 @@ func (e *EinoEngine) Respond(ctx context.Context, sess *session.Session, promptS
 		return "", nil, err
 	}
 
-	slog.Info("EinoEngine Respond complete", "session_id", sess.ID, "total_tokens", output.Usage.TotalTokens)
+	slog.Info("EinoEngine Respond complete", "session_id", sess.ID, "model", output.Model, "total_tokens", output.Usage.TotalTokens)
 
 	// Update brain with context usage to trigger maintenance if needed
 	if e.brain != nil {
@@ -121,27 +117,66 @@ func (e *EinoEngine) Respond(ctx context.Context, sess *session.Session, promptS
 		_ = e.checkPointStore.Delete(ctx, sess.ID)
 	}
 
-	finalResp = output.Answer
-	return output.Answer, &output.Usage, nil
+	// The answer leaves the engine with the session's placeholders restored
+	finalResp = e.vault.Restore(sess.ID, output.Answer)
+	return finalResp, &output.Usage, nil
+}
+
+// cleanHistory returns the brain buffer of a session without empty messages.
+func (e *EinoEngine) cleanHistory(sessionID string) []*schema.Message {
+	if e.brain == nil {
+		return nil
+	}
+	var clean []*schema.Message
+	for _, m := range e.brain.GetBuffer(sessionID) {
+		if strings.TrimSpace(m.Content) != "" {
+			clean = append(clean, m)
+		}
+	}
+	return clean
+}
+
+// callOptionsFrom collects the dynamic model options of ctx (see WithOptions).
+// opts.Model selects the engine (see Agent), so it is not passed as a call option
+// where it would also override the fallback models.
+func callOptionsFrom(ctx context.Context) []model.Option {
+	var callOpts []model.Option
+	if opts, ok := FromContext(ctx); ok {
+		if opts.Temperature != nil {
+			callOpts = append(callOpts, model.WithTemperature(*opts.Temperature))
+		}
+		if opts.MaxTokens != nil {
+			callOpts = append(callOpts, model.WithMaxTokens(*opts.MaxTokens))
+		}
+	}
+	return callOpts
 }
 
-func (e *EinoEngine) StreamRespond(ctx context.Context, sess *session.Session, promptStr string, humanContext string) (<-chan string, error) {
+// StreamRespond is Respond as a stream of typed events: content and reasoning deltas
+// as the model produces them, tool calls, retrieval and usage, ending with EventDone
+// (whose Content is the full answer) or EventError.
+func (e *EinoEngine) StreamRespond(ctx context.Context, sess *session.Session, promptStr string, humanContext string) (<-chan StreamEvent, error) {
 	slog.Info("EinoEngine StreamRespond", "session_id", sess.ID, "prompt_len", len(promptStr))
 
 	// Sanitize prompt to remove potentially sensitive data before adding to buffer
-	promptStr = e.sanitizeString(promptStr)
+	promptStr = e.sanitizeString(sess.ID, promptStr)
+
+	attachments, err := e.attachmentParts(ctx, sess.ID)
+	if err != nil {
+		return nil, err
+	}
 
 	// Add user prompt to brain buffer as it arrives
 	if e.brain != nil {
 		e.brain.AddToBuffer(sess.ID, schema.UserMessage(promptStr))
 	}
 
-	out := make(chan string, 100)
+	out := make(chan StreamEvent, 100)
 
-	// Initialize callbacks with our streaming handler
+	// Initialize callbacks with slog handler
 	ctx = callbacks.InitCallbacks(ctx, &callbacks.RunInfo{
 		Name: "EinoEngine",
-	}, newSlogHandler(out))
+	}, newSlogHandler())
 
 	// Trigger start callback for the engine itself
 	ctx = callbacks.OnStart(ctx, promptStr)
@@ -150,72 +185,42 @@ func (e *EinoEngine) StreamRespond(ctx context.Context, sess *session.Session, p
 		defer close(out)
 		defer func() {
 			if r := recover(); r != nil {
-				out <- fmt.Sprintf("[Panic: %v]\n", r)
+				out <- StreamEvent{Type: EventError, Error: fmt.Sprintf("panic: %v", r)}
 			}
 		}()
 
-		// Load history from brain
-		var history []*schema.Message
-		if e.brain != nil {
-			history = e.brain.GetBuffer(sess.ID)
-		}
-
-		// Filter out empty messages
-		var cleanHistory []*schema.Message
-		for _, m := range history {
-			if strings.TrimSpace(m.Content) != "" {
-				cleanHistory = append(cleanHistory, m)
-			}
-		}
-
-		// Collect dynamic options from context
-		var callOpts []model.Option
-		if opts, ok := FromContext(ctx); ok {
-			if opts.Model != "" {
-				callOpts = append(callOpts, model.WithModel(opts.Model))
-			}
-			if opts.Temperature != nil {
-				callOpts = append(callOpts, model.WithTemperature(*opts.Temperature))
-			}
-			if opts.MaxTokens != nil {
-				callOpts = append(callOpts, model.WithMaxTokens(*opts.MaxTokens))
-			}
-		}
-
-		verboseCh := make(chan string, 64)
-		var wg sync.WaitGroup
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for ev := range verboseCh {
-				select {
-				case out <- ev:
-				default:
-					return
-				}
-			}
-		}()
 		input := &graphInput{
-			SessionID: sess.ID,
-			Messages:  cleanHistory,
-			Prompt:    promptStr,
-			CallOpts:  callOpts,
-			VerboseCh: verboseCh,
+			SessionID:   sess.ID,
+			Messages:    e.cleanHistory(sess.ID),
+			Prompt:      promptStr,
+			Attachments: attachments,
+			CallOpts:    callOptionsFrom(ctx),
+			RunID:       e.startRun(sess.ID),
 		}
 
 		subctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
 		defer cancel()
+		// The graph nodes and tool middleware emit their events straight to out.
+		subctx = withEventSink(subctx, out)
+
+		subctx, rec, err := e.startCassette(subctx, input)
+		if err != nil {
+			e.finishRun(input.RunID, false)
+			callbacks.OnError(ctx, err)
+			out <- StreamEvent{Type: EventError, Error: err.Error()}
+			return
+		}
 
 		stream, err := e.compiledGraph.Stream(subctx, input, compose.WithCheckPointID(sess.ID))
 		if err != nil {
-			close(verboseCh)
-			wg.Wait()
+			e.finishCassette(rec, input, nil, err)
+			e.finishRun(input.RunID, false)
 			callbacks.OnError(ctx, err)
 			// Check for persistent 503 error
 			if strings.Contains(err.Error(), "503") || strings.Contains(err.Error(), "Service Unavailable") {
-				out <- "I'm sorry, but the language model is currently overloaded (503 Service Unavailable). Please try again in a moment."
+				out <- StreamEvent{Type: EventError, Error: "I'm sorry, but the language model is currently overloaded (503 Service Unavailable). Please try again in a moment."}
 			} else {
-				out <- fmt.Sprintf("[Error: %v]\n", err)
+				out <- StreamEvent{Type: EventError, Error: err.Error()}
 			}
 			return
 		}
@@ -227,30 +232,30 @@ func (e *EinoEngine) StreamRespond(ctx context.Context, sess *session.Session, p
 				if err == io.EOF {
 					break
 				}
-				close(verboseCh)
-				wg.Wait()
+				e.finishCassette(rec, input, nil, err)
+				e.finishRun(input.RunID, false)
 				callbacks.OnError(ctx, err)
-				out <- fmt.Sprintf("[Stream Error: %v]\n", err)
+				out <- StreamEvent{Type: EventError, Error: err.Error()}
 				return
 			}
 			lastOutput = chunk
 		}
-		close(verboseCh)
-		wg.Wait()
-		if lastOutput != nil {
-			out <- lastOutput.Answer
-			callbacks.OnEnd(ctx, lastOutput.Answer)
-			// Clear checkpoint on success
-			if e.checkPointStore != nil {
-				_ = e.checkPointStore.Delete(ctx, sess.ID)
-			}
-			// Send usage as a special metadata chunk
-			out <- fmt.Sprintf("[Usage: %d prompt, %d completion, %d total tokens, %.6f cost]",
-				lastOutput.Usage.PromptTokens,
-				lastOutput.Usage.CompletionTokens,
-				lastOutput.Usage.TotalTokens,
-				lastOutput.Usage.TotalCost)
+		e.finishCassette(rec, input, lastOutput, nil)
+		e.finishRun(input.RunID, lastOutput != nil && lastOutput.WaitingFor == "")
+		if lastOutput == nil {
+			out <- StreamEvent{Type: EventError, Error: "agent produced no output"}
+			return
+		}
+
+		answer := e.vault.Restore(sess.ID, lastOutput.Answer)
+		callbacks.OnEnd(ctx, answer)
+		// Clear checkpoint on success
+		if e.checkPointStore != nil {
+			_ = e.checkPointStore.Delete(ctx, sess.ID)
 		}
+		usage := lastOutput.Usage
+		out <- StreamEvent{Type: EventUsage, Usage: &usage}
+		out <- StreamEvent{Type: EventDone, Content: answer}
 	}()
 
 	return out, nil
@@ -262,6 +267,15 @@ func (e *EinoEngine) ClearHistory(sessionID string) {
 	}
 }
 
+// AttachBufferStore makes the Brain's short-term buffers durable, restoring
+// previously persisted conversations.
+func (e *EinoEngine) AttachBufferStore(bs memory.BufferStore) error {
+	if e.brain == nil {
+		return nil
+	}
+	return e.brain.AttachBufferStore(bs)
+}
+
 func (e *EinoEngine) GetHistory(sessionID string) []session.Message {
 	if e.brain == nil {
 		return nil
@@ -270,14 +284,14 @@ func (e *EinoEngine) GetHistory(sessionID string) []session.Message {
 	res := make([]session.Message, 0, len(msgs)/2)
 	for i := 0; i < len(msgs); i++ {
 		if msgs[i].Role == schema.User {
-			m := session.Message{Prompt: msgs[i].Content}
+			m := session.Message{Prompt: e.vault.Restore(sessionID, msgs[i].Content)}
 			if i+1 < len(msgs) && msgs[i+1].Role == schema.Assistant {
-				m.Response = msgs[i+1].Content
+				m.Response = e.vault.Restore(sessionID, msgs[i+1].Content)
 				i++
 			}
 			res = append(res, m)
 		} else if msgs[i].Role == schema.Assistant {
-			res = append(res, session.Message{Response: msgs[i].Content})
+			res = append(res, session.Message{Response: e.vault.Restore(sessionID, msgs[i].Content)})
 		}
 	}
 	return res
@@ -304,6 +318,62 @@ func (e *EinoEngine) InjectFact(ctx context.Context, content string, metadata ma
 	return e.brain.StoreFact(ctx, content, metadata)
 }
 
+func (e *EinoEngine) SearchBrainMemories(ctx context.Context, filter memory.MemoryFilter) ([]memory.MemoryHit, error) {
+	if e.brain == nil {
+		return nil, nil
+	}
+	return e.brain.SearchMemories(ctx, filter)
+}
+
+func (e *EinoEngine) GetBrainMemory(ctx context.Context, collection, id string) (*memory.MemoryHit, error) {
+	if e.brain == nil {
+		return nil, memory.ErrMemoryNotFound
+	}
+	return e.brain.GetMemory(ctx, collection, id)
+}
+
+func (e *EinoEngine) AddBrainMemory(ctx context.Context, collection, content string, metadata map[string]string) (*memory.MemoryHit, error) {
+	if e.brain == nil {
+		return nil, errors.New("brain is not enabled")
+	}
+	return e.brain.AddMemory(ctx, collection, content, metadata)
+}
+
+func (e *EinoEngine) UpdateBrainMemory(ctx context.Context, collection, id string, patch memory.MemoryPatch) (*memory.MemoryHit, error) {
+	if e.brain == nil {
+		return nil, memory.ErrMemoryNotFound
+	}
+	return e.brain.UpdateMemory(ctx, collection, id, patch)
+}
+
+func (e *EinoEngine) DeleteBrainMemory(ctx context.Context, collection, id string) error {
+	if e.brain == nil {
+		return memory.ErrMemoryNotFound
+	}
+	return e.brain.DeleteMemory(ctx, collection, id)
+}
+
+func (e *EinoEngine) GetBrainMemoryProvenance(ctx context.Context, collection, id string) (*memory.Provenance, error) {
+	if e.brain == nil {
+		return nil, memory.ErrMemoryNotFound
+	}
+	return e.brain.GetProvenance(ctx, collection, id)
+}
+
+func (e *EinoEngine) ExportBrain(ctx context.Context) (*memory.Snapshot, error) {
+	if e.brain == nil {
+		return nil, errors.New("brain is not enabled")
+	}
+	return e.brain.ExportSnapshot(ctx)
+}
+
+func (e *EinoEngine) ImportBrain(ctx context.Context, snap *memory.Snapshot, replace bool) (*memory.ImportResult, error) {
+	if e.brain == nil {
+		return nil, errors.New("brain is not enabled")
+	}
+	return e.brain.ImportSnapshot(ctx, snap, replace)
+}
+
 func (e *EinoEngine) GetBrainTopology(ctx context.Context, sessionID string) (*mole_syn.TopologyData, error) {
 	if e.brain == nil {
 		return nil, nil
@@ -13,6 +13,8 @@ type Options struct {
 	Model       string   `json:"model,omitempty"`
 	Temperature *float32 `json:"temperature,omitempty"`
 	MaxTokens   *int     `json:"max_tokens,omitempty"`
+	// Attachments are images and files sent along with the prompt.
+	Attachments []Attachment `json:"attachments,omitempty"`
 }
 
 type optionsKey struct{}
@@ -29,7 +31,7 @@ func FromContext(ctx context.Context) (Options, bool) {
 // Responder handles prompt execution — the core of what the agent loop needs.
 type Responder interface {
 	Respond(ctx context.Context, sess *session.Session, prompt string, humanContext string) (string, *llm.Usage, error)
-	StreamRespond(ctx context.Context, sess *session.Session, prompt string, humanContext string) (<-chan string, error)
+	StreamRespond(ctx context.Context, sess *session.Session, prompt string, humanContext string) (<-chan StreamEvent, error)
 }
 
 // SkillManager handles skill lifecycle operations.
@@ -54,6 +56,25 @@ type MemoryManager interface {
 	GetBrainSummaries(ctx context.Context) ([]memory.SearchResult, error)
 	GetBrainTopology(ctx context.Context, sessionID string) (*mole_syn.TopologyData, error)
 	InjectFact(ctx context.Context, content string, metadata map[string]string) error
+	SearchBrainMemories(ctx context.Context, filter memory.MemoryFilter) ([]memory.MemoryHit, error)
+	GetBrainMemory(ctx context.Context, collection, id string) (*memory.MemoryHit, error)
+	AddBrainMemory(ctx context.Context, collection, content string, metadata map[string]string) (*memory.MemoryHit, error)
+	UpdateBrainMemory(ctx context.Context, collection, id string, patch memory.MemoryPatch) (*memory.MemoryHit, error)
+	DeleteBrainMemory(ctx context.Context, collection, id string) error
+	GetBrainMemoryProvenance(ctx context.Context, collection, id string) (*memory.Provenance, error)
+	ExportBrain(ctx context.Context) (*memory.Snapshot, error)
+	ImportBrain(ctx context.Context, snap *memory.Snapshot, replace bool) (*memory.ImportResult, error)
+	AttachBufferStore(bs memory.BufferStore) error
+}
+
+// RunManager exposes interrupted agent runs, which are checkpointed after every tool step,
+// and runs suspended on a question to the human.
+type RunManager interface {
+	ListRuns() ([]RunInfo, error)
+	GetRun(id string) (*RunInfo, error)
+	ResumeRun(ctx context.Context, sess *session.Session, id string) (string, *llm.Usage, error)
+	AnswerRun(ctx context.Context, sess *session.Session, id, answer string) (string, *llm.Usage, error)
+	DiscardRun(id string) error
 }
 
 // Lifecycle manages engine startup and shutdown.
@@ -69,6 +90,7 @@ type Engine interface {
 	Responder
 	SkillManager
 	MemoryManager
+	RunManager
 	Lifecycle
 	SpawnSubAgent(ctx context.Context, role, query string) (string, error)
 }
@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"context"
+
+	"miri-main/src/internal/llm"
+)
+
+// EventType identifies the kind of a StreamEvent.
+type EventType string
+
+const (
+	// EventContent carries a delta of the answer text in Content.
+	EventContent EventType = "content"
+	// EventReasoning carries a delta of the model's reasoning in Content.
+	EventReasoning EventType = "reasoning"
+	// EventToolStart is sent when a tool call begins (ToolCallID, Tool, Arguments).
+	EventToolStart EventType = "tool_start"
+	// EventToolEnd is sent when a tool call returns (Result or Error, DurationMs).
+	EventToolEnd EventType = "tool_end"
+	// EventRetrieval reports how many memory documents were injected (Documents).
+	EventRetrieval EventType = "retrieval"
+	// EventQuestion reports that the agent asked the human a question (QuestionID,
+	// Content) and the run is suspended until it is answered. The question is also
+	// the content of the turn.
+	EventQuestion EventType = "question"
+	// EventApproval reports that a tool call (ToolCallID, Tool, Arguments) waits for
+	// the human to approve it (ApprovalID). The call's tool_end carries the outcome.
+	EventApproval EventType = "approval"
+	// EventUsage carries the token usage and cost of the turn in Usage.
+	EventUsage EventType = "usage"
+	// EventError terminates the stream with a message in Error.
+	EventError EventType = "error"
+	// EventDone terminates a successful stream.
+	EventDone EventType = "done"
+)
+
+// StreamEvent is one event of a streamed agent turn. A stream ends with exactly one
+// EventDone or EventError.
+type StreamEvent struct {
+	Type       EventType  `json:"type"`
+	Content    string     `json:"content,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+	Tool       string     `json:"tool,omitempty"`
+	Arguments  string     `json:"arguments,omitempty"`
+	Result     string     `json:"result,omitempty"`
+	DurationMs int64      `json:"duration_ms,omitempty"`
+	Documents  int        `json:"documents,omitempty"`
+	QuestionID string     `json:"question_id,omitempty"`
+	ApprovalID string     `json:"approval_id,omitempty"`
+	Usage      *llm.Usage `json:"usage,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+type eventSinkKey struct{}
+
+// withEventSink makes ch reachable from code that only sees ctx, such as tool middleware.
+func withEventSink(ctx context.Context, ch chan<- StreamEvent) context.Context {
+	if ch == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, eventSinkKey{}, ch)
+}
+
+func hasEventSink(ctx context.Context) bool {
+	ch, _ := ctx.Value(eventSinkKey{}).(chan<- StreamEvent)
+	return ch != nil
+}
+
+// emitEvent sends ev to the event sink of ctx, if any. Events are never dropped;
+// the send only gives up when ctx is done.
+func emitEvent(ctx context.Context, ev StreamEvent) {
+	ch, _ := ctx.Value(eventSinkKey{}).(chan<- StreamEvent)
+	if ch == nil {
+		return
+	}
+	select {
+	case ch <- ev:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,295 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"miri-main/src/internal/config"
+	"miri-main/src/internal/llm"
+	"miri-main/src/internal/resilience"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// defaultFailoverCooldown is how long a failed model is skipped before it is tried again.
+const defaultFailoverCooldown = 5 * time.Minute
+
+// answeredByKey is the schema.Message Extra key under which the failover chat model
+// records the "provider/model" that produced a message.
+const answeredByKey = "miri_model"
+
+// modelRef identifies a model on a configured provider.
+type modelRef struct {
+	Provider string
+	Model    string
+}
+
+func (r modelRef) String() string {
+	return r.Provider + "/" + r.Model
+}
+
+// resolveModelRef maps a model reference from the config ("provider/model" or a bare
+// model ID such as "kimi-k2.5") to a provider and model name. Bare IDs are looked up
+// in the provider model lists and default to defaultProvider when not found.
+func resolveModelRef(cfg *config.Config, ref, defaultProvider string) modelRef {
+	if provider, name, ok := strings.Cut(ref, "/"); ok {
+		if _, exists := cfg.Models.Providers[provider]; exists {
+			return modelRef{Provider: provider, Model: name}
+		}
+	}
+	// Deterministic order so the same config always resolves the same way.
+	names := make([]string, 0, len(cfg.Models.Providers))
+	for name := range cfg.Models.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, provider := range names {
+		for _, m := range cfg.Models.Providers[provider].Models {
+			if m.ID == ref {
+				return modelRef{Provider: provider, Model: ref}
+			}
+		}
+	}
+	return modelRef{Provider: defaultProvider, Model: ref}
+}
+
+// lookupModelConfig returns the configured model entry for ref, if any.
+func lookupModelConfig(cfg *config.Config, ref modelRef) (config.ModelConfig, bool) {
+	prov, ok := cfg.Models.Providers[ref.Provider]
+	if !ok {
+		return config.ModelConfig{}, false
+	}
+	fullName := ref.String()
+	for _, m := range prov.Models {
+		if m.ID == fullName || m.ID == ref.Model || m.Name == fullName || m.Name == ref.Model {
+			return m, true
+		}
+	}
+	return config.ModelConfig{}, false
+}
+
+// chainModel is an unbound model of a failover chain.
+type chainModel struct {
+	name          string
+	cm            model.ToolCallingChatModel
+	cost          config.ModelCost
+	contextWindow int
+	maxTokens     int
+	images        bool
+}
+
+// newModelChain creates the chat models for primary followed by the configured
+// fallbacks, skipping duplicates and fallbacks that cannot be created. It also
+// returns the primary's context window (0 when unknown).
+func newModelChain(cfg *config.Config, primary modelRef) ([]chainModel, int, error) {
+	prov, ok := cfg.Models.Providers[primary.Provider]
+	if !ok {
+		return nil, 0, fmt.Errorf("provider %q not found", primary.Provider)
+	}
+	cm, err := llm.NewChatModel(prov, primary.Model)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	first := chainModel{name: primary.String(), cm: cm}
+	if m, ok := lookupModelConfig(cfg, primary); ok {
+		first.cost, first.contextWindow, first.maxTokens = m.Cost, m.ContextWindow, m.MaxTokens
+		first.images = slices.Contains(m.Input, "image")
+	}
+
+	chain := []chainModel{first}
+	seen := map[string]bool{primary.String(): true}
+	for _, fb := range cfg.Agents.Defaults.Model.Fallbacks {
+		ref := resolveModelRef(cfg, fb, primary.Provider)
+		if seen[ref.String()] {
+			continue
+		}
+		seen[ref.String()] = true
+		fbProv, ok := cfg.Models.Providers[ref.Provider]
+		if !ok {
+			slog.Warn("fallback model provider not found, skipping", "fallback", fb, "provider", ref.Provider)
+			continue
+		}
+		fbCM, err := llm.NewChatModel(fbProv, ref.Model)
+		if err != nil {
+			slog.Warn("failed to initialize fallback model, skipping", "fallback", fb, "error", err)
+			continue
+		}
+		fbModel := chainModel{name: ref.String(), cm: fbCM}
+		if m, ok := lookupModelConfig(cfg, ref); ok {
+			fbModel.cost, fbModel.contextWindow, fbModel.maxTokens = m.Cost, m.ContextWindow, m.MaxTokens
+			fbModel.images = slices.Contains(m.Input, "image")
+		}
+		chain = append(chain, fbModel)
+	}
+	return chain, first.contextWindow, nil
+}
+
+// bindModelChain binds tools to every model of the chain and wraps the result in a
+// failover chat model.
+func bindModelChain(cfg *config.Config, chain []chainModel, toolInfos []*schema.ToolInfo) (*failoverChatModel, error) {
+	candidates := make([]*failoverCandidate, 0, len(chain))
+	for _, c := range chain {
+		bound, err := c.cm.WithTools(toolInfos)
+		if err != nil {
+			return nil, fmt.Errorf("bind tools to %s: %w", c.name, err)
+		}
+		candidates = append(candidates, &failoverCandidate{name: c.name, chat: bound, cost: c.cost})
+	}
+	cooldown := time.Duration(cfg.Agents.Defaults.Model.CooldownSeconds) * time.Second
+	return newFailoverChatModel(cooldown, candidates...), nil
+}
+
+// failoverCandidate is one model of the failover chain.
+type failoverCandidate struct {
+	name      string
+	chat      model.BaseChatModel
+	cost      config.ModelCost
+	downUntil time.Time
+}
+
+// failoverChatModel implements model.BaseChatModel over an ordered chain of models.
+// Each call starts at the primary; a model whose retries are exhausted is skipped for
+// the cool-down period, after which it is tried first again. When every model is
+// cooling down they are still tried, soonest-recovering first.
+type failoverChatModel struct {
+	candidates []*failoverCandidate
+	cooldown   time.Duration
+	retry      resilience.RetryOpts
+	mu         sync.Mutex
+}
+
+func newFailoverChatModel(cooldown time.Duration, candidates ...*failoverCandidate) *failoverChatModel {
+	if cooldown <= 0 {
+		cooldown = defaultFailoverCooldown
+	}
+	return &failoverChatModel{candidates: candidates, cooldown: cooldown}
+}
+
+// order returns the candidates to try, available ones first in chain order.
+func (f *failoverChatModel) order() []*failoverCandidate {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	var ready, cooling []*failoverCandidate
+	for _, c := range f.candidates {
+		if now.Before(c.downUntil) {
+			cooling = append(cooling, c)
+		} else {
+			ready = append(ready, c)
+		}
+	}
+	sort.SliceStable(cooling, func(i, j int) bool {
+		return cooling[i].downUntil.Before(cooling[j].downUntil)
+	})
+	return append(ready, cooling...)
+}
+
+func (f *failoverChatModel) markDown(c *failoverCandidate) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c.downUntil = time.Now().Add(f.cooldown)
+}
+
+func (f *failoverChatModel) markUp(c *failoverCandidate) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c.downUntil = time.Time{}
+}
+
+func (f *failoverChatModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	var lastErr error
+	for i, c := range f.order() {
+		msg, err := resilience.Retry(ctx, func(rctx context.Context) (*schema.Message, error) {
+			return c.chat.Generate(rctx, input, opts...)
+		}, f.retry)
+		if err == nil {
+			f.markUp(c)
+			if i > 0 {
+				slog.Warn("Model failover: answered by fallback", "model", c.name, "position", i)
+			}
+			stampAnsweredBy(msg, c.name)
+			return msg, nil
+		}
+		if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		slog.Error("Model failed, failing over", "model", c.name, "cooldown", f.cooldown, "error", err)
+		f.markDown(c)
+		lastErr = err
+	}
+	if len(f.candidates) == 1 {
+		return nil, lastErr
+	}
+	return nil, fmt.Errorf("all %d models in the failover chain failed: %w", len(f.candidates), lastErr)
+}
+
+func (f *failoverChatModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	var lastErr error
+	for i, c := range f.order() {
+		sr, err := resilience.Retry(ctx, func(rctx context.Context) (*schema.StreamReader[*schema.Message], error) {
+			return c.chat.Stream(rctx, input, opts...)
+		}, f.retry)
+		if err == nil {
+			f.markUp(c)
+			if i > 0 {
+				slog.Warn("Model failover: streaming from fallback", "model", c.name, "position", i)
+			}
+			name := c.name
+			return schema.StreamReaderWithConvert(sr, func(m *schema.Message) (*schema.Message, error) {
+				stampAnsweredBy(m, name)
+				return m, nil
+			}), nil
+		}
+		if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		slog.Error("Model stream failed, failing over", "model", c.name, "cooldown", f.cooldown, "error", err)
+		f.markDown(c)
+		lastErr = err
+	}
+	if len(f.candidates) == 1 {
+		return nil, lastErr
+	}
+	return nil, fmt.Errorf("all %d models in the failover chain failed: %w", len(f.candidates), lastErr)
+}
+
+// costOf returns the configured cost of the named model, or the primary's cost when unknown.
+func (f *failoverChatModel) costOf(name string) config.ModelCost {
+	for _, c := range f.candidates {
+		if c.name == name {
+			return c.cost
+		}
+	}
+	if len(f.candidates) > 0 {
+		return f.candidates[0].cost
+	}
+	return config.ModelCost{}
+}
+
+func stampAnsweredBy(msg *schema.Message, name string) {
+	if msg == nil {
+		return
+	}
+	if msg.Extra == nil {
+		msg.Extra = make(map[string]any)
+	}
+	msg.Extra[answeredByKey] = name
+}
+
+// answeredBy returns the model recorded on msg by the failover chat model.
+func answeredBy(msg *schema.Message) string {
+	if msg == nil || msg.Extra == nil {
+		return ""
+	}
+	name, _ := msg.Extra[answeredByKey].(string)
+	return name
+}
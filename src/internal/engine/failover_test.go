@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"miri-main/src/internal/config"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+type stubChat struct {
+	name  string
+	err   error
+	calls int
+}
+
+func (s *stubChat) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return schema.AssistantMessage("from "+s.name, nil), nil
+}
+
+func (s *stubChat) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return schema.StreamReaderFromArray([]*schema.Message{schema.AssistantMessage("from "+s.name, nil)}), nil
+}
+
+func newTestFailover(cooldown time.Duration, chats ...*stubChat) *failoverChatModel {
+	var cands []*failoverCandidate
+	for _, c := range chats {
+		cands = append(cands, &failoverCandidate{name: c.name, chat: c})
+	}
+	f := newFailoverChatModel(cooldown, cands...)
+	f.retry.MaxAttempts = 1
+	return f
+}
+
+func TestFailover_FallsBackInOrder(t *testing.T) {
+	primary := &stubChat{name: "xai/primary", err: errors.New("503 Service Unavailable")}
+	second := &stubChat{name: "xai/second", err: errors.New("502 Bad Gateway")}
+	third := &stubChat{name: "nvidia/third"}
+	f := newTestFailover(time.Minute, primary, second, third)
+
+	msg, err := f.Generate(context.Background(), []*schema.Message{schema.UserMessage("hi")})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if msg.Content != "from nvidia/third" {
+		t.Errorf("expected answer from third model, got %q", msg.Content)
+	}
+	if got := answeredBy(msg); got != "nvidia/third" {
+		t.Errorf("expected answeredBy nvidia/third, got %q", got)
+	}
+}
+
+func TestFailover_CooldownAndRecovery(t *testing.T) {
+	primary := &stubChat{name: "xai/primary", err: errors.New("503 Service Unavailable")}
+	fallback := &stubChat{name: "xai/fallback"}
+	f := newTestFailover(50*time.Millisecond, primary, fallback)
+
+	if _, err := f.Generate(context.Background(), nil); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	// Primary is cooling down: the next call must go straight to the fallback.
+	if _, err := f.Generate(context.Background(), nil); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if primary.calls != 1 {
+		t.Errorf("expected primary to be skipped during cool-down, got %d calls", primary.calls)
+	}
+
+	// After the cool-down the primary is tried first again.
+	primary.err = nil
+	time.Sleep(60 * time.Millisecond)
+	msg, err := f.Generate(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if answeredBy(msg) != "xai/primary" {
+		t.Errorf("expected primary after cool-down, got %q", answeredBy(msg))
+	}
+}
+
+func TestFailover_AllFail(t *testing.T) {
+	a := &stubChat{name: "a/a", err: errors.New("500 boom")}
+	b := &stubChat{name: "b/b", err: errors.New("500 boom")}
+	f := newTestFailover(time.Minute, a, b)
+
+	if _, err := f.Generate(context.Background(), nil); err == nil {
+		t.Fatal("expected error when every model fails")
+	}
+	// Everything is cooling down, but models are still tried as a last resort.
+	if _, err := f.Generate(context.Background(), nil); err == nil {
+		t.Fatal("expected error when every model fails")
+	}
+	if a.calls != 2 || b.calls != 2 {
+		t.Errorf("expected both models to be tried twice, got %d and %d", a.calls, b.calls)
+	}
+}
+
+func TestFailover_Stream(t *testing.T) {
+	primary := &stubChat{name: "xai/primary", err: errors.New("503 Service Unavailable")}
+	fallback := &stubChat{name: "xai/fallback"}
+	f := newTestFailover(time.Minute, primary, fallback)
+
+	sr, err := f.Stream(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	defer sr.Close()
+	msg, err := sr.Recv()
+	if err != nil {
+		t.Fatalf("Recv failed: %v", err)
+	}
+	if answeredBy(msg) != "xai/fallback" {
+		t.Errorf("expected stream from fallback, got %q", answeredBy(msg))
+	}
+}
+
+func TestResolveModelRef(t *testing.T) {
+	cfg := &config.Config{Models: config.ModelsConfig{Providers: map[string]config.ProviderConfig{
+		"xai":    {Models: []config.ModelConfig{{ID: "xai/grok-4", Name: "grok-4"}}},
+		"nvidia": {Models: []config.ModelConfig{{ID: "kimi-k2.5", Name: "Kimi K2.5"}}},
+	}}}
+
+	cases := map[string]modelRef{
+		"xai/grok-4-fast": {Provider: "xai", Model: "grok-4-fast"},
+		"kimi-k2.5":       {Provider: "nvidia", Model: "kimi-k2.5"},
+		"unknown-model":   {Provider: "xai", Model: "unknown-model"},
+	}
+	for ref, want := range cases {
+		if got := resolveModelRef(cfg, ref, "xai"); got != want {
+			t.Errorf("resolveModelRef(%q) = %+v, want %+v", ref, got, want)
+		}
+	}
+}
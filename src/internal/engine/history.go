@@ -0,0 +1,262 @@
+package engine
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+const (
+	// defaultOutputReserve is kept free for the answer of models without maxTokens.
+	defaultOutputReserve = 4096
+	// contextMarginPercent of the window is left unused to absorb estimation errors.
+	contextMarginPercent = 5
+	// minToolResultTokens is the size below which tool results are not truncated.
+	minToolResultTokens = 64
+	// digestLineChars is the length a prompt or answer is cut to in the digest.
+	digestLineChars = 200
+)
+
+// contextBudget returns the tokens the messages of a prompt may use with every model
+// of the chain: the smallest context window minus the model's output reserve, a
+// safety margin and the tool definitions. 0 means no model has a known window.
+func contextBudget(chain []chainModel, toolTokens int) int {
+	budget := 0
+	for _, c := range chain {
+		if c.contextWindow <= 0 {
+			continue
+		}
+		reserve := c.maxTokens
+		if reserve <= 0 {
+			reserve = min(defaultOutputReserve, c.contextWindow/4)
+		}
+		b := c.contextWindow - reserve - c.contextWindow*contextMarginPercent/100 - toolTokens
+		if budget == 0 || b < budget {
+			budget = b
+		}
+	}
+	if budget == 0 {
+		return 0
+	}
+	return max(budget, minToolResultTokens)
+}
+
+// fitContext returns msgs cut down to the prompt budget of the engine, leaving msgs
+// itself untouched. Until the prompt fits, it
+//  1. truncates tool results of earlier turns longer than a tenth of the budget,
+//  2. replaces the oldest turns by a digest of what was asked and answered,
+//  3. truncates the tool results of the current turn to ever smaller sizes.
+//
+// System messages and the current turn, from the last user message on, are kept, and
+// a turn is only dropped as a whole so tool calls never lose their results. The
+// result depends on the messages alone, so repeated calls trim the same way.
+func (e *EinoEngine) fitContext(msgs []*schema.Message) []*schema.Message {
+	budget := e.promptBudget
+	if budget <= 0 {
+		return msgs
+	}
+	t := e.tokens
+	total := t.messages(msgs)
+	if total <= budget {
+		return msgs
+	}
+	before := total
+
+	current := len(msgs)
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == schema.User {
+			current = i
+			break
+		}
+	}
+	out := make([]*schema.Message, len(msgs))
+	copy(out, msgs)
+
+	// 1. Oversized tool results of earlier turns
+	historyCap := max(budget/10, minToolResultTokens)
+	for i := 0; i < current && total > budget; i++ {
+		if m, saved := truncateToolResult(t, out[i], historyCap); saved > 0 {
+			out[i] = m
+			total -= saved
+		}
+	}
+
+	// 2. Oldest turns, collapsed into a digest
+	dropped := 0
+	if total > budget {
+		turns := historyTurns(out[:current])
+		for k := 1; k <= len(turns); k++ {
+			digest := digestTurns(t, out, turns[:k], budget/10)
+			size := total - spanTokens(t, out, turns[:k]) + t.message(digest)
+			if size <= budget || k == len(turns) {
+				current -= spanLen(out, turns[:k]) - 1
+				out = replaceTurns(out, turns[:k], digest)
+				total = size
+				dropped = k
+				break
+			}
+		}
+	}
+
+	// 3. Tool results of the current turn
+	for limit := budget / 4; total > budget && limit >= minToolResultTokens; limit /= 2 {
+		for i := current; i < len(out) && total > budget; i++ {
+			if m, saved := truncateToolResult(t, out[i], limit); saved > 0 {
+				out[i] = m
+				total -= saved
+			}
+		}
+	}
+
+	if total > budget {
+		slog.Warn("Prompt exceeds the context window even after trimming", "budget", budget, "tokens", total)
+	}
+	slog.Info("Prompt trimmed to fit the context window", "budget", budget, "tokens_before", before, "tokens_after", total, "dropped_turns", dropped)
+	return out
+}
+
+// turnSpan is the half-open range of messages of a conversation turn.
+type turnSpan struct{ start, end int }
+
+// historyTurns splits the messages before the current turn into turns, each starting
+// at a user message. System messages belong to no turn and are never dropped.
+func historyTurns(msgs []*schema.Message) []turnSpan {
+	var turns []turnSpan
+	for i, m := range msgs {
+		if m.Role == schema.System {
+			continue
+		}
+		if m.Role == schema.User || len(turns) == 0 {
+			turns = append(turns, turnSpan{start: i, end: i + 1})
+			continue
+		}
+		turns[len(turns)-1].end = i + 1
+	}
+	return turns
+}
+
+// spanTokens returns the estimated tokens of the non-system messages of turns.
+func spanTokens(t tokenEstimator, msgs []*schema.Message, turns []turnSpan) int {
+	n := 0
+	for _, s := range turns {
+		for _, m := range msgs[s.start:s.end] {
+			if m.Role != schema.System {
+				n += t.message(m)
+			}
+		}
+	}
+	return n
+}
+
+// spanLen returns the number of non-system messages of turns.
+func spanLen(msgs []*schema.Message, turns []turnSpan) int {
+	n := 0
+	for _, s := range turns {
+		for _, m := range msgs[s.start:s.end] {
+			if m.Role != schema.System {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// replaceTurns returns msgs with the non-system messages of turns replaced by digest,
+// which takes the place of the first of them.
+func replaceTurns(msgs []*schema.Message, turns []turnSpan, digest *schema.Message) []*schema.Message {
+	drop := make(map[int]bool)
+	for _, s := range turns {
+		for i := s.start; i < s.end; i++ {
+			if msgs[i].Role != schema.System {
+				drop[i] = true
+			}
+		}
+	}
+	res := make([]*schema.Message, 0, len(msgs)-len(drop)+1)
+	placed := false
+	for i, m := range msgs {
+		if !drop[i] {
+			res = append(res, m)
+			continue
+		}
+		if !placed {
+			res = append(res, digest)
+			placed = true
+		}
+	}
+	return res
+}
+
+// digestTurns condenses dropped turns into a system message listing each request and
+// its final answer. When the digest would exceed maxTokens, the oldest entries go.
+func digestTurns(t tokenEstimator, msgs []*schema.Message, turns []turnSpan, maxTokens int) *schema.Message {
+	var entries []string
+	for _, s := range turns {
+		var prompt, answer string
+		for _, m := range msgs[s.start:s.end] {
+			switch {
+			case m.Role == schema.User && prompt == "":
+				prompt = m.Content
+			case m.Role == schema.Assistant && len(m.ToolCalls) == 0 && strings.TrimSpace(m.Content) != "":
+				answer = m.Content
+			}
+		}
+		if prompt == "" && answer == "" {
+			continue
+		}
+		entry := "- User: " + clipLine(prompt)
+		if answer != "" {
+			entry += "\n  Assistant: " + clipLine(answer)
+		}
+		entries = append(entries, entry)
+	}
+
+	omitted := 0
+	for len(entries) > 0 && t.text(strings.Join(entries, "\n")) > maxTokens {
+		entries = entries[1:]
+		omitted++
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "EARLIER CONVERSATION (%d turns condensed to fit the context window)", len(turns))
+	if omitted > 0 {
+		fmt.Fprintf(&sb, ", the oldest %d left out", omitted)
+	}
+	sb.WriteString(":")
+	for _, entry := range entries {
+		sb.WriteString("\n")
+		sb.WriteString(entry)
+	}
+	return schema.SystemMessage(sb.String())
+}
+
+// clipLine returns s on one line, cut to digestLineChars runes.
+func clipLine(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > digestLineChars {
+		return string(r[:digestLineChars]) + "…"
+	}
+	return s
+}
+
+// truncateToolResult returns a copy of a tool message cut to about limit tokens,
+// keeping its beginning and end, and the tokens saved. Other messages and results
+// within the limit are returned as they are.
+func truncateToolResult(t tokenEstimator, m *schema.Message, limit int) (*schema.Message, int) {
+	if m.Role != schema.Tool {
+		return m, 0
+	}
+	size := t.text(m.Content)
+	if size <= limit {
+		return m, 0
+	}
+	runes := []rune(m.Content)
+	keep := len(runes) * limit / size
+	head := keep * 2 / 3
+	tail := keep - head
+	c := *m
+	c.Content = fmt.Sprintf("%s\n[... about %d tokens of tool output omitted to fit the context window ...]\n%s",
+		string(runes[:head]), size-t.text(string(runes[:head]))-t.text(string(runes[len(runes)-tail:])), string(runes[len(runes)-tail:]))
+	return &c, t.message(m) - t.message(&c)
+}
@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+func TestTokenEstimator(t *testing.T) {
+	grok := newTokenEstimator("grok-3-mini")
+	if grok.charsPerToken != 3.6 {
+		t.Errorf("expected the grok ratio, got %v", grok.charsPerToken)
+	}
+	if unknown := newTokenEstimator("some-local-model"); unknown.charsPerToken != defaultCharsPerToken {
+		t.Errorf("expected the default ratio, got %v", unknown.charsPerToken)
+	}
+
+	if n := grok.text(strings.Repeat("a", 36)); n != 10 {
+		t.Errorf("expected 10 tokens for 36 ASCII chars, got %d", n)
+	}
+	if n := grok.text("日本語"); n != 3 {
+		t.Errorf("expected a token per non-ASCII rune, got %d", n)
+	}
+
+	plain := grok.message(schema.AssistantMessage("hello", nil))
+	withCall := grok.message(schema.AssistantMessage("hello", []schema.ToolCall{{ID: "c1", Function: schema.FunctionCall{Name: "web_search", Arguments: `{"query":"weather"}`}}}))
+	if withCall <= plain {
+		t.Errorf("tool calls must add tokens: %d <= %d", withCall, plain)
+	}
+}
+
+func TestContextBudget(t *testing.T) {
+	chain := []chainModel{
+		{name: "xai/grok-4", contextWindow: 200000, maxTokens: 8192},
+		{name: "xai/grok-3-mini", contextWindow: 20000, maxTokens: 2000},
+		{name: "local/unknown"},
+	}
+	if got, want := contextBudget(chain, 1000), 20000-2000-1000-1000; got != want {
+		t.Errorf("expected the smallest window to win: got %d, want %d", got, want)
+	}
+	if got := contextBudget([]chainModel{{name: "local/unknown"}}, 1000); got != 0 {
+		t.Errorf("expected no budget without a known window, got %d", got)
+	}
+}
+
+// longConversation returns a system prompt, n earlier turns with a tool call each and
+// the current user prompt.
+func longConversation(n int) []*schema.Message {
+	msgs := []*schema.Message{schema.SystemMessage("You are Miri.")}
+	for i := range n {
+		id := fmt.Sprintf("call-%d", i)
+		msgs = append(msgs,
+			schema.UserMessage(fmt.Sprintf("question %d", i)),
+			schema.AssistantMessage("", []schema.ToolCall{{ID: id, Function: schema.FunctionCall{Name: "web_fetch", Arguments: `{"url":"https://example.com"}`}}}),
+			schema.ToolMessage(strings.Repeat("page content ", 100), id),
+			schema.AssistantMessage(fmt.Sprintf("answer %d", i), nil),
+		)
+	}
+	return append(msgs, schema.UserMessage("the current question"))
+}
+
+func TestFitContext(t *testing.T) {
+	e := &EinoEngine{tokens: newTokenEstimator("grok-3-mini")}
+	msgs := longConversation(20)
+
+	if got := e.fitContext(msgs); len(got) != len(msgs) {
+		t.Fatal("without a budget the messages must be kept")
+	}
+	e.promptBudget = e.tokens.messages(msgs)
+	if got := e.fitContext(msgs); len(got) != len(msgs) {
+		t.Fatal("a prompt within the budget must be kept")
+	}
+
+	e.promptBudget = 2000
+	original := msgs[3].Content
+	got := e.fitContext(msgs)
+	if n := e.tokens.messages(got); n > e.promptBudget {
+		t.Errorf("expected at most %d tokens, got %d", e.promptBudget, n)
+	}
+	if msgs[3].Content != original {
+		t.Error("fitContext must not modify its input")
+	}
+	if got[0].Content != "You are Miri." || got[len(got)-1].Content != "the current question" {
+		t.Error("expected the system prompt and the current question to be kept")
+	}
+	if got[1].Role != schema.System || !strings.Contains(got[1].Content, "EARLIER CONVERSATION") || !strings.Contains(got[1].Content, "question 0") {
+		t.Errorf("expected a digest of the dropped turns, got %q", got[1].Content)
+	}
+
+	// Every kept tool result still has its tool call
+	calls := map[string]bool{}
+	for _, m := range got {
+		for _, tc := range m.ToolCalls {
+			calls[tc.ID] = true
+		}
+		if m.Role == schema.Tool && !calls[m.ToolCallID] {
+			t.Errorf("tool result %s lost its call", m.ToolCallID)
+		}
+	}
+
+	again := e.fitContext(msgs)
+	if len(again) != len(got) || again[1].Content != got[1].Content {
+		t.Error("expected the same messages from the same input")
+	}
+}
+
+func TestFitContext_TruncatesCurrentToolResults(t *testing.T) {
+	e := &EinoEngine{tokens: newTokenEstimator("grok-3-mini"), promptBudget: 500}
+	msgs := []*schema.Message{
+		schema.SystemMessage("You are Miri."),
+		schema.UserMessage("summarize the page"),
+		schema.AssistantMessage("", []schema.ToolCall{{ID: "c1", Function: schema.FunctionCall{Name: "web_fetch", Arguments: `{}`}}}),
+		schema.ToolMessage("BEGIN "+strings.Repeat("lorem ipsum ", 1000)+" END", "c1"),
+	}
+	got := e.fitContext(msgs)
+	if n := e.tokens.messages(got); n > e.promptBudget {
+		t.Errorf("expected at most %d tokens, got %d", e.promptBudget, n)
+	}
+	result := got[3].Content
+	if !strings.HasPrefix(result, "BEGIN") || !strings.HasSuffix(result, "END") || !strings.Contains(result, "omitted") {
+		t.Errorf("expected the head and tail of the result around a marker, got %q", result)
+	}
+}
@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"miri-main/src/internal/budget"
+	"miri-main/src/internal/config"
+	"miri-main/src/internal/engine/tools"
+	"miri-main/src/internal/llm"
+	"miri-main/src/internal/storage"
+)
+
+// imageModel returns the model of the generate_image tool: agents.defaults.image_model,
+// or else the first model of the default provider with "image" in its name.
+func imageModel(cfg *config.Config, defaultProvider string) (modelRef, bool) {
+	if ref := cfg.Agents.Defaults.ImageModel; ref != "" {
+		return resolveModelRef(cfg, ref, defaultProvider), true
+	}
+	for _, m := range cfg.Models.Providers[defaultProvider].Models {
+		name := m.Name
+		if name == "" {
+			name = m.ID
+		}
+		if strings.Contains(strings.ToLower(name), "image") {
+			return modelRef{Provider: defaultProvider, Model: strings.TrimPrefix(name, defaultProvider+"/")}, true
+		}
+	}
+	return modelRef{}, false
+}
+
+// newImageGenTool creates the generate_image tool for the configured image model,
+// or returns nil when there is none or its provider has no images API. Each image
+// costs the model's cost.output and is recorded in ledger, if any; generation is
+// refused once the budgets of guard are used up.
+func newImageGenTool(cfg *config.Config, defaultProvider string, ledger costLedger, guard *budgetGuard) *tools.ImageGenToolWrapper {
+	ref, ok := imageModel(cfg, defaultProvider)
+	if !ok {
+		return nil
+	}
+	prov, ok := cfg.Models.Providers[ref.Provider]
+	if !ok {
+		slog.Warn("image model provider not found, generate_image disabled", "model", ref.String())
+		return nil
+	}
+	if !llm.HasImagesAPI(prov) {
+		slog.Warn("image model provider has no images API, generate_image disabled", "model", ref.String(), "api", prov.API)
+		return nil
+	}
+	var cost float64
+	if m, ok := lookupModelConfig(cfg, ref); ok {
+		cost = m.Cost.Output
+	}
+	slog.Info("generate_image enabled", "model", ref.String(), "cost_per_image", cost)
+	return tools.NewImageGenTool(cfg.StorageDir, ref.String(), cost, func(ctx context.Context, prompt string, n int) ([]llm.GeneratedImage, error) {
+		sessionID, _ := runScope(ctx)
+		if guard != nil {
+			if _, err := guard.tracker.Check(budget.Call{Provider: ref.Provider, SessionID: sessionID, TaskID: cronTask(ctx)}); err != nil {
+				return nil, err
+			}
+		}
+		images, err := llm.GenerateImages(ctx, prov, ref.Model, prompt, n)
+		if err == nil && ledger != nil {
+			entry := storage.CostEntry{SessionID: sessionID, TaskID: cronTask(ctx), Model: ref.Model, Provider: ref.Provider, Cost: float64(len(images)) * cost, Source: chatCostSource(ctx)}
+			if lerr := ledger.AddCost(entry); lerr != nil {
+				slog.Warn("failed to record image generation cost", "model", ref.String(), "error", lerr)
+			}
+		}
+		return images, err
+	})
+}
@@ -0,0 +1,31 @@
+package engine
+
+import (
+	"testing"
+
+	"miri-main/src/internal/config"
+)
+
+func TestNewImageGenTool(t *testing.T) {
+	cfg := &config.Config{Models: config.ModelsConfig{Providers: map[string]config.ProviderConfig{
+		"xai": {Models: []config.ModelConfig{
+			{ID: "xai/grok-3", Name: "grok-3"},
+			{ID: "xai/grok-2-image-1212", Name: "grok-2-image-1212", Cost: config.ModelCost{Output: 0.07}},
+		}},
+		"local":   {API: "ollama"},
+		"offline": {API: "mock"},
+	}}}
+
+	tool := newImageGenTool(cfg, "xai", nil, nil)
+	if tool == nil || tool.Model != "xai/grok-2-image-1212" || tool.CostPerImage != 0.07 {
+		t.Fatalf("expected the first image model of the provider, got %+v", tool)
+	}
+	if newImageGenTool(cfg, "offline", nil, nil) != nil {
+		t.Error("expected no tool for a provider without image models")
+	}
+
+	cfg.Agents.Defaults.ImageModel = "local/flux"
+	if newImageGenTool(cfg, "xai", nil, nil) != nil {
+		t.Error("expected no tool for a provider without images API")
+	}
+}
@@ -0,0 +1,176 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+
+	"miri-main/src/internal/config"
+	"miri-main/src/internal/llm"
+	"miri-main/src/internal/session"
+	"miri-main/src/internal/storage"
+)
+
+// costLedger persists cost ledger entries; *storage.Storage implements it.
+type costLedger interface {
+	AddCost(storage.CostEntry) error
+}
+
+type costSourceKey struct{}
+
+// WithCostSource attributes the agent runs started with ctx to source (e.g.
+// storage.CostSourceCron) in the cost ledger. Without it, runs of sub-agent
+// sessions count as storage.CostSourceSubAgent and all others as chat.
+func WithCostSource(ctx context.Context, source string) context.Context {
+	return context.WithValue(ctx, costSourceKey{}, source)
+}
+
+// chatCostSource returns the ledger source of a chat model call made with ctx.
+func chatCostSource(ctx context.Context) string {
+	if source, _ := ctx.Value(costSourceKey{}).(string); source != "" {
+		return source
+	}
+	if sessionID, _ := runScope(ctx); session.IsSubAgent(sessionID) {
+		return storage.CostSourceSubAgent
+	}
+	return storage.CostSourceChat
+}
+
+// ledgerChatModel records the cost of every model call in the cost ledger.
+type ledgerChatModel struct {
+	inner  model.BaseChatModel
+	ledger costLedger
+	// source is the ledger source; chat calls are attributed by chatCostSource.
+	source string
+	// model is the "provider/model" of messages the failover chat model did not stamp.
+	model  string
+	costOf func(name string) config.ModelCost
+}
+
+// newLedgerChatModel wraps inner, or returns it unchanged when there is no ledger.
+func newLedgerChatModel(inner model.BaseChatModel, ledger costLedger, source, modelName string, costOf func(string) config.ModelCost) model.BaseChatModel {
+	if ledger == nil {
+		return inner
+	}
+	return &ledgerChatModel{inner: inner, ledger: ledger, source: source, model: modelName, costOf: costOf}
+}
+
+func (l *ledgerChatModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	msg, err := l.inner.Generate(ctx, input, opts...)
+	if err == nil {
+		l.record(ctx, msg)
+	}
+	return msg, err
+}
+
+// Stream passes the chunks through and records the call once the stream ends. A
+// stream cut short, by an error or a consumer that stopped reading, is recorded
+// too: the provider bills the prompt anyway.
+func (l *ledgerChatModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	sr, err := l.inner.Stream(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	out, sw := schema.Pipe[*schema.Message](1)
+	go func() {
+		defer sr.Close()
+		defer sw.Close()
+		var chunks []*schema.Message
+		complete := false
+		defer func() { l.recordStream(ctx, input, chunks, complete) }()
+		for {
+			chunk, err := sr.Recv()
+			if errors.Is(err, io.EOF) {
+				complete = true
+				return
+			}
+			if err != nil {
+				sw.Send(nil, err)
+				return
+			}
+			if chunk != nil {
+				chunks = append(chunks, chunk)
+			}
+			if sw.Send(chunk, nil) {
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// recordStream records a streamed call from its chunks. Without the usage chunk,
+// which providers send last, the usage of a stream cut short is estimated from
+// the input and the chunks received.
+func (l *ledgerChatModel) recordStream(ctx context.Context, input []*schema.Message, chunks []*schema.Message, complete bool) {
+	if complete && len(chunks) == 0 {
+		return
+	}
+	msg := &schema.Message{Role: schema.Assistant}
+	if len(chunks) > 0 {
+		concat, err := schema.ConcatMessages(chunks)
+		if err != nil {
+			slog.Warn("cost ledger: failed to concat stream chunks", "error", err)
+			if complete {
+				return
+			}
+		} else {
+			msg = concat
+		}
+		stampAnsweredBy(msg, answeredBy(chunks[0]))
+	}
+	if prompt, _, _, completion := llm.TokenUsage(msg); !complete && prompt == 0 && completion == 0 {
+		name := answeredBy(msg)
+		if name == "" {
+			name = l.model
+		}
+		_, modelName, _ := strings.Cut(name, "/")
+		tokens := newTokenEstimator(modelName)
+		completion := 0
+		if len(chunks) > 0 {
+			completion = tokens.message(msg)
+		}
+		meta := schema.ResponseMeta{}
+		if msg.ResponseMeta != nil {
+			meta = *msg.ResponseMeta
+		}
+		meta.Usage = &schema.TokenUsage{PromptTokens: tokens.messages(input), CompletionTokens: completion}
+		meta.Usage.TotalTokens = meta.Usage.PromptTokens + meta.Usage.CompletionTokens
+		msg.ResponseMeta = &meta
+	}
+	l.record(ctx, msg)
+}
+
+func (l *ledgerChatModel) record(ctx context.Context, msg *schema.Message) {
+	name := answeredBy(msg)
+	if name == "" {
+		name = l.model
+	}
+	source := l.source
+	if source == storage.CostSourceChat {
+		source = chatCostSource(ctx)
+	}
+	prompt, cached, cacheWrite, completion := llm.TokenUsage(msg)
+	sessionID, _ := runScope(ctx)
+	provider, modelName, _ := strings.Cut(name, "/")
+	entry := storage.CostEntry{
+		SessionID:        sessionID,
+		TaskID:           cronTask(ctx),
+		Model:            modelName,
+		Provider:         provider,
+		PromptTokens:     prompt,
+		CachedTokens:     cached,
+		CacheWriteTokens: cacheWrite,
+		CompletionTokens: completion,
+		Cost:             llm.CallCost(l.costOf(name), prompt, cached, cacheWrite, completion),
+		Source:           source,
+	}
+	if err := l.ledger.AddCost(entry); err != nil {
+		slog.Warn("failed to record model call cost", "model", name, "source", source, "error", err)
+	}
+}
@@ -0,0 +1,184 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+
+	"miri-main/src/internal/config"
+	"miri-main/src/internal/session"
+	"miri-main/src/internal/storage"
+)
+
+type memLedger struct {
+	mu      sync.Mutex
+	entries []storage.CostEntry
+}
+
+func (l *memLedger) AddCost(e storage.CostEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, e)
+	return nil
+}
+
+func (l *memLedger) snapshot() []storage.CostEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]storage.CostEntry(nil), l.entries...)
+}
+
+// usageChat answers with 1M prompt tokens, half of them cached, and 1M completion tokens.
+type usageChat struct{}
+
+func (usageChat) usage() *schema.ResponseMeta {
+	return &schema.ResponseMeta{Usage: &schema.TokenUsage{
+		PromptTokens:       1000000,
+		PromptTokenDetails: schema.PromptTokenDetails{CachedTokens: 500000},
+		CompletionTokens:   1000000,
+	}}
+}
+
+func (u usageChat) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	msg := schema.AssistantMessage("ok", nil)
+	msg.ResponseMeta = u.usage()
+	return msg, nil
+}
+
+func (u usageChat) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	return schema.StreamReaderFromArray([]*schema.Message{
+		schema.AssistantMessage("o", nil),
+		{Role: schema.Assistant, Content: "k", ResponseMeta: u.usage()},
+	}), nil
+}
+
+func TestLedgerChatModel(t *testing.T) {
+	ledger := &memLedger{}
+	fo := newFailoverChatModel(time.Minute, &failoverCandidate{name: "xai/grok-3", chat: usageChat{},
+		cost: config.ModelCost{Input: 2, Output: 10, CacheRead: 0.5}})
+	chat := newLedgerChatModel(fo, ledger, storage.CostSourceChat, "xai/grok-3", fo.costOf)
+
+	ctx := withRunScope(context.Background(), &graphInput{SessionID: "miri:main:session"})
+	if _, err := chat.Generate(ctx, []*schema.Message{schema.UserMessage("hi")}); err != nil {
+		t.Fatal(err)
+	}
+	sr, err := chat.Stream(WithCostSource(ctx, storage.CostSourceCron), []*schema.Message{schema.UserMessage("hi")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := sr.Recv(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sr.Close()
+	subCtx := withRunScope(context.Background(), &graphInput{SessionID: session.SubAgentSessionPrefix + "abc"})
+	if _, err := chat.Generate(subCtx, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The stream is recorded once it is drained, from the pipe's goroutine.
+	var entries []storage.CostEntry
+	for range 100 {
+		if entries = ledger.snapshot(); len(entries) == 3 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 ledger entries, got %+v", entries)
+	}
+	byCall := map[string]storage.CostEntry{}
+	for _, e := range entries {
+		byCall[e.Source] = e
+	}
+	chatEntry := byCall[storage.CostSourceChat]
+	if chatEntry.SessionID != "miri:main:session" || chatEntry.Provider != "xai" || chatEntry.Model != "grok-3" ||
+		chatEntry.PromptTokens != 1000000 || chatEntry.CachedTokens != 500000 || chatEntry.CompletionTokens != 1000000 {
+		t.Errorf("unexpected chat entry: %+v", chatEntry)
+	}
+	// 0.5M uncached at 2 + 0.5M cached at 0.5 + 1M completion at 10.
+	if math.Abs(chatEntry.Cost-11.25) > 1e-9 {
+		t.Errorf("expected cache-aware cost 11.25, got %v", chatEntry.Cost)
+	}
+	if e, ok := byCall[storage.CostSourceCron]; !ok || e.Cost != chatEntry.Cost {
+		t.Errorf("expected the streamed call attributed to cron, got %+v", entries)
+	}
+	if _, ok := byCall[storage.CostSourceSubAgent]; !ok {
+		t.Errorf("expected the sub-agent session's call attributed to subagent, got %+v", entries)
+	}
+
+	brain := newLedgerChatModel(usageChat{}, ledger, storage.CostSourceBrain, "xai/grok-3",
+		func(string) config.ModelCost { return config.ModelCost{Input: 1} })
+	if _, err := brain.Generate(WithCostSource(ctx, storage.CostSourceCron), nil); err != nil {
+		t.Fatal(err)
+	}
+	if e := ledger.snapshot()[3]; e.Source != storage.CostSourceBrain || e.Model != "grok-3" || e.Cost != 1 {
+		t.Errorf("unexpected brain entry: %+v", e)
+	}
+
+	if newLedgerChatModel(fo, nil, storage.CostSourceChat, "", fo.costOf) != model.BaseChatModel(fo) {
+		t.Error("expected the model unwrapped without a ledger")
+	}
+}
+
+// stallingChat streams one chunk, then stalls until the call is canceled.
+type stallingChat struct{}
+
+func (stallingChat) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (stallingChat) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	sr, sw := schema.Pipe[*schema.Message](1)
+	go func() {
+		defer sw.Close()
+		sw.Send(schema.AssistantMessage("The answer is", nil), nil)
+		<-ctx.Done()
+		sw.Send(nil, ctx.Err())
+	}()
+	return sr, nil
+}
+
+func TestLedgerChatModel_StreamCanceled(t *testing.T) {
+	ledger := &memLedger{}
+	chat := newLedgerChatModel(stallingChat{}, ledger, storage.CostSourceChat, "xai/grok-3",
+		func(string) config.ModelCost { return config.ModelCost{Input: 2, Output: 10} })
+
+	ctx, cancel := context.WithCancel(withRunScope(context.Background(), &graphInput{SessionID: "miri:main:session"}))
+	sr, err := chat.Stream(ctx, []*schema.Message{schema.UserMessage(strings.Repeat("a long prompt ", 100))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sr.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	// The client disconnects before the usage chunk.
+	cancel()
+	sr.Close()
+
+	var entries []storage.CostEntry
+	for range 100 {
+		if entries = ledger.snapshot(); len(entries) == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected the canceled stream recorded, got %+v", entries)
+	}
+	e := entries[0]
+	if e.SessionID != "miri:main:session" || e.PromptTokens < 300 || e.CompletionTokens == 0 || e.Cost <= 0 {
+		t.Errorf("expected the usage estimated from the input and the received chunk, got %+v", e)
+	}
+}
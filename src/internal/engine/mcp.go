@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cloudwego/eino/components/tool"
+
+	"miri-main/src/internal/config"
+	"miri-main/src/internal/engine/tools"
+)
+
+// subAgentRoles are the roles of the built-in sub-agents.
+var subAgentRoles = []string{"researcher", "coder", "reviewer"}
+
+// mcpServers shares the connections to the MCP servers between the engines, so a
+// server's subprocess is started once. Servers replaced after a config change are
+// retired: the engines created before may still call them, so they are closed
+// whenever no call is in flight.
+var (
+	mcpMu      sync.Mutex
+	mcpServers = make(map[string]*tools.MCPServer)
+)
+
+// mountMCPTools lists the tools of the configured MCP servers. It returns them all
+// and by the sub-agent roles that get them too. Servers that fail are skipped.
+func mountMCPTools(ctx context.Context, cfg *config.Config) (all []tool.BaseTool, byRole map[string][]tool.BaseTool) {
+	names := make([]string, 0, len(cfg.Agents.MCP.Servers))
+	for name := range cfg.Agents.MCP.Servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	byRole = make(map[string][]tool.BaseTool)
+	for _, name := range names {
+		srvCfg := cfg.Agents.MCP.Servers[name]
+		if srvCfg.Disabled {
+			continue
+		}
+		mcpTools, err := mcpServer(name, srvCfg).Tools(ctx)
+		if err != nil {
+			slog.Warn("skipping mcp server", "server", name, "error", err)
+			continue
+		}
+		roles := subAgentRoles
+		if len(srvCfg.SubAgents) > 0 {
+			roles = nil
+			for _, r := range srvCfg.SubAgents {
+				roles = append(roles, strings.ToLower(r))
+			}
+		}
+		for _, t := range mcpTools {
+			all = append(all, t)
+			for _, r := range roles {
+				if slices.Contains(subAgentRoles, r) {
+					byRole[r] = append(byRole[r], t)
+				}
+			}
+		}
+		slog.Info("mounted mcp tools", "server", name, "count", len(mcpTools))
+	}
+	return all, byRole
+}
+
+// mcpServer returns the shared server name, replacing it if its config changed.
+func mcpServer(name string, cfg config.MCPServerConfig) *tools.MCPServer {
+	mcpMu.Lock()
+	defer mcpMu.Unlock()
+	if srv, ok := mcpServers[name]; ok {
+		if reflect.DeepEqual(srv.Config(), cfg) {
+			return srv
+		}
+		srv.Retire()
+	}
+	srv := tools.NewMCPServer(name, cfg)
+	mcpServers[name] = srv
+	return srv
+}
+
+// CloseMCPServers closes the connections to the MCP servers, stopping their
+// subprocesses. It is called at shutdown, once no engine runs anymore.
+func CloseMCPServers() {
+	mcpMu.Lock()
+	defer mcpMu.Unlock()
+	for _, srv := range mcpServers {
+		if err := srv.Close(); err != nil {
+			slog.Warn("failed to close mcp server", "server", srv.Name(), "error", err)
+		}
+	}
+	mcpServers = make(map[string]*tools.MCPServer)
+}
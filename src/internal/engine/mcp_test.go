@@ -0,0 +1,45 @@
+package engine
+
+import (
+	"sync"
+	"testing"
+
+	"miri-main/src/internal/config"
+	"miri-main/src/internal/engine/tools"
+)
+
+func TestMCPServerShared(t *testing.T) {
+	t.Cleanup(CloseMCPServers)
+	cfg := config.MCPServerConfig{Command: "mcp-notes"}
+
+	// Engines created at the same time share one server.
+	servers := make([]*tools.MCPServer, 8)
+	var wg sync.WaitGroup
+	for i := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			servers[i] = mcpServer("notes", cfg)
+		}()
+	}
+	wg.Wait()
+	for _, srv := range servers {
+		if srv != servers[0] {
+			t.Fatal("expected every engine to get the same server")
+		}
+	}
+
+	// A changed config replaces the server.
+	replaced := mcpServer("notes", config.MCPServerConfig{Command: "mcp-notes", Args: []string{"--v2"}})
+	if replaced == servers[0] {
+		t.Fatal("expected a new server for the changed config")
+	}
+	if srv := mcpServer("notes", config.MCPServerConfig{Command: "mcp-notes", Args: []string{"--v2"}}); srv != replaced {
+		t.Error("expected the replacement shared")
+	}
+
+	CloseMCPServers()
+	if srv := mcpServer("notes", cfg); srv == servers[0] || srv == replaced {
+		t.Error("expected the servers forgotten after closing them")
+	}
+}
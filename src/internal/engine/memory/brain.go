@@ -2,9 +2,11 @@ package memory
 
 import (
 	"context"
+	"encoding/json"
 	"log/slog"
 	"miri-main/src/internal/config"
 	"miri-main/src/internal/engine/memory/mole_syn"
+	"miri-main/src/internal/engine/vault"
 	"miri-main/src/internal/resilience"
 	"miri-main/src/internal/storage"
 	"miri-main/src/internal/system"
@@ -41,9 +43,23 @@ type Brain struct {
 	storage           *storage.Storage
 	Graph             *mole_syn.MemoryGraph
 	sanitizeMsgs      func([]*schema.Message) []*schema.Message
+	vault             *vault.Vault
 	retrieval         config.RetrievalConfig
+	bufferStore       BufferStore
 }
 
+// BufferStore persists the short-term conversation buffer so it survives restarts.
+// Messages are passed as JSON-encoded schema.Message values.
+type BufferStore interface {
+	AppendMessage(sessionID string, msg []byte) error
+	TrimMessages(sessionID string, keep int) error
+	ClearMessages(sessionID string) error
+	LoadMessages() (map[string][][]byte, error)
+}
+
+// maxBuffer is the number of recent messages kept per session in the short-term buffer.
+const maxBuffer = 200
+
 func NewBrain(chat model.BaseChatModel, factMs, summaryMs, stepsMs MemorySystem, contextWindow int, st *storage.Storage, retrieval config.RetrievalConfig, maxNodesPerSession int) *Brain {
 	var ms mole_syn.MemorySystem
 	if stepsMs != nil {
@@ -115,6 +131,14 @@ func (b *Brain) SetSanitizeFunc(f func([]*schema.Message) []*schema.Message) {
 	b.sanitizeMsgs = f
 }
 
+// SetVault sets the vault holding the values of the placeholders in the
+// memories, exported and imported with them in snapshots.
+func (b *Brain) SetVault(v *vault.Vault) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.vault = v
+}
+
 func (b *Brain) sanitize(msgs []*schema.Message) []*schema.Message {
 	b.mu.RLock()
 	f := b.sanitizeMsgs
@@ -154,9 +178,22 @@ func (b *Brain) AddToBuffer(sessionID string, msg *schema.Message) {
 	count := b.interactionCount
 
 	// Short-term buffer: Keep last N turns (e.g., 100 messages = ~10-50 turns)
-	const maxBuffer = 200
+	trimmed := false
 	if len(b.buffer[sessionID]) > maxBuffer {
 		b.buffer[sessionID] = b.buffer[sessionID][len(b.buffer[sessionID])-maxBuffer:]
+		trimmed = true
+	}
+
+	if b.bufferStore != nil {
+		if data, err := json.Marshal(msg); err != nil {
+			slog.Warn("failed to encode buffered message", "session_id", sessionID, "error", err)
+		} else if err := b.bufferStore.AppendMessage(sessionID, data); err != nil {
+			slog.Warn("failed to persist buffered message", "session_id", sessionID, "error", err)
+		} else if trimmed {
+			if err := b.bufferStore.TrimMessages(sessionID, maxBuffer); err != nil {
+				slog.Warn("failed to trim persisted buffer", "session_id", sessionID, "error", err)
+			}
+		}
 	}
 
 	if count > 0 && count%50 == 0 {
@@ -169,6 +206,49 @@ func (b *Brain) ClearBuffer(sessionID string) {
 	defer b.mu.Unlock()
 
 	delete(b.buffer, sessionID)
+	if b.bufferStore != nil {
+		if err := b.bufferStore.ClearMessages(sessionID); err != nil {
+			slog.Warn("failed to clear persisted buffer", "session_id", sessionID, "error", err)
+		}
+	}
+}
+
+// AttachBufferStore rehydrates the short-term buffers from bs and persists every
+// later change to it. Buffers already held in memory are replaced by the stored ones.
+func (b *Brain) AttachBufferStore(bs BufferStore) error {
+	stored, err := bs.LoadMessages()
+	if err != nil {
+		return err
+	}
+
+	restored := make(map[string][]*schema.Message, len(stored))
+	for sid, raw := range stored {
+		msgs := make([]*schema.Message, 0, len(raw))
+		for _, data := range raw {
+			var m schema.Message
+			if err := json.Unmarshal(data, &m); err != nil {
+				slog.Warn("skipping undecodable buffered message", "session_id", sid, "error", err)
+				continue
+			}
+			msgs = append(msgs, &m)
+		}
+		if len(msgs) > maxBuffer {
+			msgs = msgs[len(msgs)-maxBuffer:]
+		}
+		restored[sid] = msgs
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.buffer == nil {
+		b.buffer = make(map[string][]*schema.Message)
+	}
+	for sid, msgs := range restored {
+		b.buffer[sid] = msgs
+	}
+	b.bufferStore = bs
+	slog.Info("Brain buffers restored", "sessions", len(restored))
+	return nil
 }
 
 func (b *Brain) GetBuffer(sessionID string) []*schema.Message {
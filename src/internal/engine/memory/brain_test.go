@@ -488,3 +488,42 @@ func TestBrain_HybridRetrieve(t *testing.T) {
 		t.Error("Structural priority failed: Graph should be before Vector memories")
 	}
 }
+
+func TestBrain_BufferPersistence(t *testing.T) {
+	cleanup := setupTestPrompts()
+	defer cleanup()
+
+	tmpDir := t.TempDir()
+	st, _ := storage.New(tmpDir)
+	defer st.Close()
+	ss, err := st.SessionStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chat := &mockChat{response: "[]"}
+	brain := NewBrain(chat, nil, nil, nil, 1000, st, config.RetrievalConfig{}, 0)
+	if err := brain.AttachBufferStore(ss); err != nil {
+		t.Fatalf("AttachBufferStore failed: %v", err)
+	}
+	brain.AddToBuffer("sess-a", schema.UserMessage("hello from a"))
+	brain.AddToBuffer("sess-a", schema.AssistantMessage("hi a", nil))
+	brain.AddToBuffer("sess-b", schema.UserMessage("hello from b"))
+	brain.ClearBuffer("sess-b")
+
+	// A new Brain (simulating a restart) restores the persisted buffers.
+	restarted := NewBrain(chat, nil, nil, nil, 1000, st, config.RetrievalConfig{}, 0)
+	if err := restarted.AttachBufferStore(ss); err != nil {
+		t.Fatalf("AttachBufferStore after restart failed: %v", err)
+	}
+	msgs := restarted.GetBuffer("sess-a")
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 restored messages, got %d", len(msgs))
+	}
+	if msgs[0].Role != schema.User || msgs[0].Content != "hello from a" || msgs[1].Content != "hi a" {
+		t.Errorf("unexpected restored messages: %v, %v", msgs[0], msgs[1])
+	}
+	if got := restarted.GetBuffer("sess-b"); len(got) != 0 {
+		t.Errorf("expected cleared session to stay empty, got %d messages", len(got))
+	}
+}
@@ -12,7 +12,7 @@ import (
 	"github.com/cloudwego/eino/schema"
 )
 
-func (b *Brain) ExtractFacts(ctx context.Context, messages []*schema.Message) error {
+func (b *Brain) ExtractFacts(ctx context.Context, sessionID string, messages []*schema.Message) error {
 	if b.factMemory == nil {
 		return nil
 	}
@@ -22,14 +22,9 @@ func (b *Brain) ExtractFacts(ctx context.Context, messages []*schema.Message) er
 		return fmt.Errorf("read extract prompt: %w", err)
 	}
 
-	var conv strings.Builder
-	for _, m := range messages {
-		role := string(m.Role)
-		conv.WriteString(fmt.Sprintf("%s: %s\n", role, m.Content))
-	}
-
-	fullPrompt := strings.Replace(string(prompt), "{conversation}", conv.String(), 1)
-	fullPrompt = strings.Replace(fullPrompt, "{conversation_text_or_last_N_messages}", conv.String(), 1)
+	conv := formatConversation(messages)
+	fullPrompt := strings.Replace(string(prompt), "{conversation}", conv, 1)
+	fullPrompt = strings.Replace(fullPrompt, "{conversation_text_or_last_N_messages}", conv, 1)
 
 	sanitized := b.sanitize([]*schema.Message{schema.UserMessage(fullPrompt)})
 	resp, err := b.generateWithRetry(ctx, sanitized)
@@ -43,6 +38,8 @@ func (b *Brain) ExtractFacts(ctx context.Context, messages []*schema.Message) er
 		Category   string  `json:"category"`
 		Confidence float32 `json:"confidence"`
 		SourceTurn string  `json:"source_turn"`
+		// SourceMessages are the numbers of the messages the fact comes from.
+		SourceMessages []int `json:"source_messages"`
 	}
 
 	// Try to find JSON in the response
@@ -74,7 +71,9 @@ func (b *Brain) ExtractFacts(ctx context.Context, messages []*schema.Message) er
 			"category":    f.Category,
 			"source_turn": f.SourceTurn,
 			"confidence":  fmt.Sprintf("%.2f", f.Confidence),
+			"session_id":  sessionID,
 		})
+		b.setSources(metadata, conversationSource(sessionID, messages, f.SourceMessages))
 		_ = b.factMemory.Add(ctx, f.Fact, metadata)
 		slog.Info("Extracted and stored fact", "fact", f.Fact, "category", f.Category)
 	}
@@ -82,7 +81,7 @@ func (b *Brain) ExtractFacts(ctx context.Context, messages []*schema.Message) er
 	return nil
 }
 
-func (b *Brain) Reflect(ctx context.Context, messages []*schema.Message) error {
+func (b *Brain) Reflect(ctx context.Context, sessionID string, messages []*schema.Message) error {
 	if b.summaryMemory == nil {
 		return nil
 	}
@@ -108,15 +107,17 @@ func (b *Brain) Reflect(ctx context.Context, messages []*schema.Message) error {
 	}
 
 	metadata := b.prepareMetadata(map[string]string{
-		"type": "reflection",
+		"type":       "reflection",
+		"session_id": sessionID,
 	})
+	b.setSources(metadata, conversationSource(sessionID, messages, nil))
 	_ = b.summaryMemory.Add(ctx, resp.Content, metadata)
 	slog.Info("Stored self-reflection")
 
 	return nil
 }
 
-func (b *Brain) Summarize(ctx context.Context, messages []*schema.Message) error {
+func (b *Brain) Summarize(ctx context.Context, sessionID string, messages []*schema.Message) error {
 	if b.summaryMemory == nil {
 		return nil
 	}
@@ -127,12 +128,14 @@ func (b *Brain) Summarize(ctx context.Context, messages []*schema.Message) error
 	}
 
 	var conv strings.Builder
-	for _, m := range messages {
+	var userMessages []int
+	for i, m := range messages {
 		if m.Role != schema.User {
 			continue // Summarize user requests and intent only
 		}
 		role := string(m.Role)
 		conv.WriteString(fmt.Sprintf("%s: %s\n", role, m.Content))
+		userMessages = append(userMessages, i)
 	}
 
 	fullPrompt := strings.Replace(string(prompt), "{full_or_recent_conversation_text}", conv.String(), 1)
@@ -145,8 +148,10 @@ func (b *Brain) Summarize(ctx context.Context, messages []*schema.Message) error
 	}
 
 	metadata := b.prepareMetadata(map[string]string{
-		"type": "summary",
+		"type":       "summary",
+		"session_id": sessionID,
 	})
+	b.setSources(metadata, conversationSource(sessionID, messages, userMessages))
 	_ = b.summaryMemory.Add(ctx, resp.Content, metadata)
 	slog.Info("Stored conversation summary")
 
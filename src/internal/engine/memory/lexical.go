@@ -0,0 +1,179 @@
+package memory
+
+import (
+	"maps"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// BM25 parameters: bm25K1 saturates the term frequency, bm25B normalizes it by
+// the document length.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// stopWords are left out of the lexical index: they match most memories and
+// would only add noise to the fused ranking.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"did": true, "do": true, "does": true, "for": true, "from": true, "had": true, "has": true,
+	"have": true, "how": true, "i": true, "in": true, "is": true, "it": true, "its": true, "me": true,
+	"my": true, "of": true, "on": true, "or": true, "that": true, "the": true, "this": true, "to": true,
+	"was": true, "we": true, "were": true, "what": true, "when": true, "where": true, "which": true,
+	"who": true, "why": true, "will": true, "with": true, "you": true, "your": true,
+}
+
+// tokenize splits text into lower-cased terms of letters, digits and
+// underscores, so identifiers like ERR_CONN_RESET stay whole and INC-4821 is
+// found by 4821 alone.
+func tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	terms := fields[:0]
+	for _, f := range fields {
+		if !stopWords[f] {
+			terms = append(terms, f)
+		}
+	}
+	return terms
+}
+
+type lexicalDoc struct {
+	content  string
+	metadata map[string]string
+	length   int
+}
+
+// lexicalIndex is an in-memory inverted index ranking the documents of a
+// collection by BM25. It complements the embeddings for exact names, numbers
+// and identifiers, which embedders often map to nothing useful.
+type lexicalIndex struct {
+	mu       sync.RWMutex
+	docs     map[string]lexicalDoc
+	postings map[string]map[string]int // term -> document ID -> term frequency
+	totalLen int
+}
+
+func newLexicalIndex() *lexicalIndex {
+	return &lexicalIndex{
+		docs:     make(map[string]lexicalDoc),
+		postings: make(map[string]map[string]int),
+	}
+}
+
+// add indexes a document, replacing the one of the same ID.
+func (x *lexicalIndex) add(id, content string, metadata map[string]string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.removeLocked(id)
+	terms := tokenize(content)
+	for _, t := range terms {
+		if x.postings[t] == nil {
+			x.postings[t] = make(map[string]int)
+		}
+		x.postings[t][id]++
+	}
+	x.docs[id] = lexicalDoc{content: content, metadata: maps.Clone(metadata), length: len(terms)}
+	x.totalLen += len(terms)
+}
+
+func (x *lexicalIndex) remove(id string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.removeLocked(id)
+}
+
+func (x *lexicalIndex) removeLocked(id string) {
+	doc, ok := x.docs[id]
+	if !ok {
+		return
+	}
+	for _, t := range tokenize(doc.content) {
+		delete(x.postings[t], id)
+		if len(x.postings[t]) == 0 {
+			delete(x.postings, t)
+		}
+	}
+	x.totalLen -= doc.length
+	delete(x.docs, id)
+}
+
+// search returns up to limit documents matching a term of query and every
+// key of filter, best first. Distance is 1 - score/best score, so 0 for the
+// best match.
+func (x *lexicalIndex) search(query string, limit int, filter map[string]string) []SearchResult {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if len(x.docs) == 0 || limit <= 0 {
+		return nil
+	}
+
+	n := float64(len(x.docs))
+	avgLen := float64(x.totalLen) / n
+	scores := make(map[string]float64)
+	seen := make(map[string]bool)
+	for _, t := range tokenize(query) {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		postings := x.postings[t]
+		if len(postings) == 0 {
+			continue
+		}
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for id, tf := range postings {
+			if !matchesFilter(x.docs[id].metadata, filter) {
+				continue
+			}
+			f := float64(tf)
+			norm := 1 - bm25B + bm25B*float64(x.docs[id].length)/avgLen
+			scores[id] += idf * f * (bm25K1 + 1) / (f + bm25K1*norm)
+		}
+	}
+
+	ids := make([]string, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	results := make([]SearchResult, 0, len(ids))
+	for _, id := range ids {
+		doc := x.docs[id]
+		meta := maps.Clone(doc.metadata)
+		if meta == nil {
+			meta = make(map[string]string)
+		}
+		meta["id"] = id
+		results = append(results, SearchResult{
+			Content:  doc.content,
+			Metadata: meta,
+			Distance: float32(1 - scores[id]/scores[ids[0]]),
+		})
+	}
+	return results
+}
+
+func matchesFilter(metadata, filter map[string]string) bool {
+	for k, v := range filter {
+		if metadata[k] != v {
+			return false
+		}
+	}
+	return true
+}
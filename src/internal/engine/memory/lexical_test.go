@@ -0,0 +1,116 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"miri-main/src/internal/config"
+	"miri-main/src/internal/storage"
+)
+
+func TestTokenize(t *testing.T) {
+	got := tokenize("What was the ticket for ERR_CONN_RESET on INC-4821?")
+	want := []string{"ticket", "err_conn_reset", "inc", "4821"}
+	if !slices.Equal(got, want) {
+		t.Errorf("tokenize = %v, want %v", got, want)
+	}
+}
+
+func TestLexicalIndex(t *testing.T) {
+	x := newLexicalIndex()
+	x.add("a", "The VPN issue was filed as ticket INC-4821", map[string]string{"type": "fact"})
+	x.add("b", "The user prefers green tea over coffee", map[string]string{"type": "fact"})
+	x.add("c", "Ticket triage happens on Mondays, every ticket gets a ticket owner", map[string]string{"type": "summary"})
+
+	res := x.search("what was the ticket number for the VPN issue", 10, nil)
+	if len(res) != 2 || res[0].Metadata["id"] != "a" || res[0].Distance != 0 {
+		t.Fatalf("expected the VPN ticket first, got %+v", res)
+	}
+	if res[1].Distance <= 0 || res[1].Distance >= 1 {
+		t.Errorf("expected a relative distance, got %v", res[1].Distance)
+	}
+	if res := x.search("ticket", 10, map[string]string{"type": "summary"}); len(res) != 1 || res[0].Metadata["id"] != "c" {
+		t.Errorf("expected the filter applied, got %+v", res)
+	}
+	if res := x.search("the of", 10, nil); len(res) != 0 {
+		t.Errorf("expected no match on stop words, got %+v", res)
+	}
+
+	// Replacing and removing documents update the postings.
+	x.add("a", "The VPN works again", nil)
+	if res := x.search("4821", 10, nil); len(res) != 0 {
+		t.Errorf("expected the old content unindexed, got %+v", res)
+	}
+	x.remove("a")
+	if res := x.search("vpn", 10, nil); len(res) != 0 || x.totalLen != x.docs["b"].length+x.docs["c"].length {
+		t.Errorf("expected the document removed, got %+v", res)
+	}
+}
+
+func TestFuseRankings(t *testing.T) {
+	r := func(id string) SearchResult { return SearchResult{Metadata: map[string]string{"id": id}} }
+	fused := fuseRankings(3, []SearchResult{r("a"), r("b"), r("c")}, []SearchResult{r("c"), r("d")})
+	var ids []string
+	for _, f := range fused {
+		ids = append(ids, f.Metadata["id"])
+	}
+	if !slices.Equal(ids, []string{"c", "a", "b"}) {
+		t.Errorf("unexpected fused order %v", ids)
+	}
+	if fused := fuseRankings(0, []SearchResult{r("a")}, []SearchResult{r("a")}); fused[0].Distance != 0 {
+		t.Errorf("expected distance 0 for the first of every ranking, got %v", fused[0].Distance)
+	}
+}
+
+func TestBrain_RetrieveExactTerms(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		StorageDir: tmpDir,
+		Miri: config.MiriConfig{
+			Brain: config.BrainConfig{
+				Embeddings: config.EmbeddingConfig{
+					UseNativeEmbeddings: true,
+				},
+			},
+		},
+	}
+	facts, err := NewVectorMemory(cfg, "test_lexical_facts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	summaries, err := NewVectorMemory(cfg, "test_lexical_summaries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i, content := range []string{
+		"The user lives in Berlin",
+		"The user likes green tea",
+		"The user's cat is called Miso",
+		"The user works as a nurse",
+		"The user plays the piano",
+		"The user runs on Sundays",
+		"The VPN issue was reported as ticket INC-4821",
+	} {
+		_ = facts.Add(ctx, content, map[string]string{"type": "fact", "id": string(rune('a' + i))})
+	}
+
+	// The index is rebuilt from the collection when reopened.
+	if facts, err = NewVectorMemory(cfg, "test_lexical_facts"); err != nil {
+		t.Fatal(err)
+	}
+	st, _ := storage.New(tmpDir)
+	brain := NewBrain(&mockChat{response: "[]"}, facts, summaries, facts, 1000, st, config.RetrievalConfig{FactsTopK: 2}, 0)
+
+	// The fallback embedder gives every fact the same distance, only the
+	// lexical ranking can bring the ticket up.
+	out, err := brain.Retrieve(ctx, "", "what was the ticket number for the VPN issue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "INC-4821") || strings.Index(out, "INC-4821") > strings.Index(out, "The user") {
+		t.Errorf("expected the ticket fact retrieved first, got %q", out)
+	}
+}
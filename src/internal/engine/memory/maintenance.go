@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -55,11 +56,11 @@ func (b *Brain) TriggerMaintenance(ctx context.Context, trigger MaintenanceTrigg
 		slog.Debug("Running extraction tasks for session", "session_id", sid)
 
 		withTimeout(2*time.Minute, "ExtractFacts", func(ctx context.Context) error {
-			return b.ExtractFacts(ctx, msgs)
+			return b.ExtractFacts(ctx, sid, msgs)
 		})
 
 		withTimeout(1*time.Minute, "Reflect", func(ctx context.Context) error {
-			return b.Reflect(ctx, msgs)
+			return b.Reflect(ctx, sid, msgs)
 		})
 
 		// Topology analysis
@@ -96,7 +97,7 @@ func (b *Brain) TriggerMaintenance(ctx context.Context, trigger MaintenanceTrigg
 		})
 
 		withTimeout(2*time.Minute, "Summarize", func(ctx context.Context) error {
-			if err := b.Summarize(ctx, msgs); err != nil {
+			if err := b.Summarize(ctx, sid, msgs); err != nil {
 				return err
 			}
 			// Clear buffer after successful summarization to reduce context usage
@@ -197,7 +198,7 @@ func (b *Brain) cleanup(ctx context.Context, items []SearchResult) error {
 	now := time.Now()
 	for _, item := range items {
 		id := item.Metadata["id"]
-		if id == "" {
+		if id == "" || isPinned(item) {
 			continue
 		}
 
@@ -289,6 +290,8 @@ func (b *Brain) promoteFacts(ctx context.Context, summaries []SearchResult) erro
 				"source":     "summary_promotion",
 				"confidence": fmt.Sprintf("%.2f", p.Confidence),
 			})
+			// The fact also keeps the origins of the summary.
+			b.setSources(metadata, mergeSources([]Source{summarySource(s)}, Sources(s.Metadata))...)
 			_ = b.factMemory.Add(ctx, p.Fact, metadata)
 		}
 	}
@@ -333,10 +336,7 @@ func (b *Brain) deduplicateFactsBatch(ctx context.Context, prompt string, facts
 		return err
 	}
 
-	var dups []struct {
-		PrimaryID    string   `json:"primary_id"`
-		DuplicateIDs []string `json:"duplicate_ids"`
-	}
+	var dups []duplicateGroup
 
 	content := resp.Content
 	if start := strings.Index(content, "["); start != -1 {
@@ -348,6 +348,8 @@ func (b *Brain) deduplicateFactsBatch(ctx context.Context, prompt string, facts
 	if err := json.Unmarshal([]byte(content), &dups); err != nil {
 		return err
 	}
+	keepPinned(dups, facts)
+	mergeDuplicateSources(ctx, b.factMemory, dups, facts)
 
 	// Atomic dedup: soft-mark duplicates as deprecated before hard-deleting.
 	// This prevents a race where retrieval could return a fact that is about
@@ -370,6 +372,27 @@ func (b *Brain) deduplicateFactsBatch(ctx context.Context, prompt string, facts
 
 const dedupeSummaryChunkSize = 20
 
+// duplicateGroup is a group of duplicates found by the model.
+type duplicateGroup struct {
+	PrimaryID    string   `json:"primary_id"`
+	DuplicateIDs []string `json:"duplicate_ids"`
+}
+
+// keepPinned removes the pinned memories of batch from the duplicates to delete.
+func keepPinned(dups []duplicateGroup, batch []SearchResult) {
+	pinned := make(map[string]bool)
+	for _, r := range batch {
+		if isPinned(r) {
+			pinned[r.Metadata["id"]] = true
+		}
+	}
+	for i := range dups {
+		dups[i].DuplicateIDs = slices.DeleteFunc(dups[i].DuplicateIDs, func(id string) bool {
+			return pinned[id]
+		})
+	}
+}
+
 func (b *Brain) deduplicateSummaries(ctx context.Context, summaries []SearchResult) error {
 	slog.Info("Deduplicating summaries", "count", len(summaries))
 
@@ -405,10 +428,7 @@ func (b *Brain) deduplicateSummariesBatch(ctx context.Context, prompt string, su
 		return err
 	}
 
-	var dups []struct {
-		PrimaryID    string   `json:"primary_id"`
-		DuplicateIDs []string `json:"duplicate_ids"`
-	}
+	var dups []duplicateGroup
 
 	content := resp.Content
 	if start := strings.Index(content, "["); start != -1 {
@@ -420,6 +440,8 @@ func (b *Brain) deduplicateSummariesBatch(ctx context.Context, prompt string, su
 	if err := json.Unmarshal([]byte(content), &dups); err != nil {
 		return err
 	}
+	keepPinned(dups, summaries)
+	mergeDuplicateSources(ctx, b.summaryMemory, dups, summaries)
 
 	// Atomic dedup: soft-mark then hard-delete (see deduplicateFactsBatch).
 	for _, d := range dups {
@@ -438,6 +460,8 @@ func (b *Brain) deduplicateSummariesBatch(ctx context.Context, prompt string, su
 }
 
 func (b *Brain) consolidateSummaries(ctx context.Context, summaries []SearchResult) error {
+	// Pinned summaries are kept as they are.
+	summaries = slices.DeleteFunc(slices.Clone(summaries), isPinned)
 	slog.Info("Consolidating summaries", "count", len(summaries))
 
 	prompt, err := b.GetPrompt("consolidate_summaries.prompt")
@@ -473,6 +497,11 @@ func (b *Brain) consolidateSummaries(ctx context.Context, summaries []SearchResu
 				"type":    "summary",
 				"subtype": "consolidated",
 			})
+			var sources []Source
+			for _, s := range batch {
+				sources = mergeSources(sources, Sources(s.Metadata))
+			}
+			b.setSources(metadata, sources...)
 			_ = b.summaryMemory.Add(bgCtx, resp.Content, metadata)
 			for _, s := range batch {
 				id := s.Metadata["id"]
@@ -0,0 +1,286 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Collections of the Brain's long-term memory.
+const (
+	CollectionFacts     = "facts"
+	CollectionSummaries = "summaries"
+)
+
+var (
+	ErrMemoryNotFound    = errors.New("memory not found")
+	ErrUnknownCollection = errors.New("unknown memory collection")
+)
+
+// MemoryFilter selects memories of the Brain. Empty fields match every memory.
+type MemoryFilter struct {
+	// Query ranks the memories by the hybrid score of retrieval.
+	// Without it they are listed newest first.
+	Query string
+	// Collection is CollectionFacts or CollectionSummaries; empty searches both.
+	Collection string
+	// Type is the type metadata (fact, summary, reflection, ...).
+	Type       string
+	Deprecated *bool
+	Pinned     *bool
+	SessionID  string
+	// From and To bound created_at: From <= created_at < To.
+	From, To time.Time
+	// Limit caps the number of results; 0 returns all.
+	Limit int
+}
+
+// MemoryHit is a memory of the Brain. Distance and Score are only set when
+// searching by a query: Distance fuses the vector and lexical rankings, Score
+// is the hybrid score retrieval ranks by. Lower is better for both.
+type MemoryHit struct {
+	ID         string            `json:"id"`
+	Collection string            `json:"collection"`
+	Content    string            `json:"content"`
+	Metadata   map[string]string `json:"metadata"`
+	Distance   float32           `json:"distance,omitempty"`
+	Score      float64           `json:"score,omitempty"`
+}
+
+// MemoryPatch changes a memory. Zero fields are left unchanged.
+type MemoryPatch struct {
+	Content string
+	// Metadata sets keys; an empty value removes the key.
+	Metadata   map[string]string
+	Pinned     *bool
+	Deprecated *bool
+}
+
+// isPinned reports whether a memory is exempt from cleanup, deduplication and
+// consolidation during maintenance.
+func isPinned(r SearchResult) bool {
+	return r.Metadata["pinned"] == "true"
+}
+
+func (b *Brain) collection(name string) (MemorySystem, error) {
+	switch name {
+	case CollectionFacts:
+		return b.factMemory, nil
+	case CollectionSummaries:
+		return b.summaryMemory, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCollection, name)
+	}
+}
+
+// SearchMemories returns the memories matching f. Unlike retrieval, it does
+// not count as an access to them.
+func (b *Brain) SearchMemories(ctx context.Context, f MemoryFilter) ([]MemoryHit, error) {
+	names := []string{CollectionFacts, CollectionSummaries}
+	if f.Collection != "" {
+		names = []string{f.Collection}
+	}
+
+	type result struct {
+		collection string
+		SearchResult
+	}
+	var results []result
+	for _, name := range names {
+		ms, err := b.collection(name)
+		if err != nil {
+			return nil, err
+		}
+		if ms == nil {
+			continue
+		}
+		var found []SearchResult
+		if f.Query != "" {
+			// Rank the whole collection, the filters are applied afterwards.
+			n, _ := ms.Count(ctx)
+			found, err = hybridSearch(ctx, ms, f.Query, n)
+		} else {
+			found, err = ms.ListAll(ctx)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("search %s: %w", name, err)
+		}
+		for _, r := range found {
+			if f.matches(r) {
+				results = append(results, result{name, r})
+			}
+		}
+	}
+
+	if f.Query != "" {
+		sort.SliceStable(results, func(i, j int) bool {
+			return rankBefore(results[i].SearchResult, results[j].SearchResult)
+		})
+	} else {
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].Metadata["created_at"] > results[j].Metadata["created_at"]
+		})
+	}
+	if f.Limit > 0 && len(results) > f.Limit {
+		results = results[:f.Limit]
+	}
+
+	hits := make([]MemoryHit, 0, len(results))
+	for _, r := range results {
+		h := newMemoryHit(r.collection, r.SearchResult)
+		if f.Query != "" {
+			h.Distance = r.Distance
+			h.Score = hybridScore(r.SearchResult)
+		}
+		hits = append(hits, h)
+	}
+	return hits, nil
+}
+
+func (f MemoryFilter) matches(r SearchResult) bool {
+	m := r.Metadata
+	if f.Type != "" && m["type"] != f.Type {
+		return false
+	}
+	if f.Deprecated != nil && (m["deprecated"] == "true") != *f.Deprecated {
+		return false
+	}
+	if f.Pinned != nil && isPinned(r) != *f.Pinned {
+		return false
+	}
+	// Sub-agent results record their parent session as "session".
+	if f.SessionID != "" && m["session_id"] != f.SessionID && m["session"] != f.SessionID {
+		return false
+	}
+	if !f.From.IsZero() || !f.To.IsZero() {
+		created, err := time.Parse(time.RFC3339, m["created_at"])
+		if err != nil {
+			return false
+		}
+		if !f.From.IsZero() && created.Before(f.From) {
+			return false
+		}
+		if !f.To.IsZero() && !created.Before(f.To) {
+			return false
+		}
+	}
+	return true
+}
+
+func newMemoryHit(collection string, r SearchResult) MemoryHit {
+	return MemoryHit{
+		ID:         r.Metadata["id"],
+		Collection: collection,
+		Content:    r.Content,
+		Metadata:   r.Metadata,
+	}
+}
+
+// GetMemory returns the memory id of a collection.
+func (b *Brain) GetMemory(ctx context.Context, collection, id string) (*MemoryHit, error) {
+	ms, err := b.collection(collection)
+	if err != nil {
+		return nil, err
+	}
+	if ms == nil || id == "" {
+		return nil, ErrMemoryNotFound
+	}
+	r, err := ms.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, ErrMemoryNotFound
+	}
+	h := newMemoryHit(collection, *r)
+	return &h, nil
+}
+
+// AddMemory stores a memory written by hand. Its type defaults to that of the
+// collection and its source to "manual".
+func (b *Brain) AddMemory(ctx context.Context, collection, content string, metadata map[string]string) (*MemoryHit, error) {
+	ms, err := b.collection(collection)
+	if err != nil {
+		return nil, err
+	}
+	if ms == nil {
+		return nil, fmt.Errorf("%s memory is not available", collection)
+	}
+	if strings.TrimSpace(content) == "" {
+		return nil, errors.New("content is required")
+	}
+	metadata = maps.Clone(metadata)
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+	delete(metadata, "id")
+	if metadata["type"] == "" {
+		metadata["type"] = strings.TrimSuffix(collection, "s")
+	}
+	if metadata["source"] == "" {
+		metadata["source"] = "manual"
+	}
+	metadata = b.prepareMetadata(metadata)
+	if err := ms.Add(ctx, content, metadata); err != nil {
+		return nil, err
+	}
+	return b.GetMemory(ctx, collection, metadata["id"])
+}
+
+// UpdateMemory applies patch to the memory id of a collection. Unlike
+// MemorySystem.Update, it keeps the metadata the patch does not change.
+func (b *Brain) UpdateMemory(ctx context.Context, collection, id string, patch MemoryPatch) (*MemoryHit, error) {
+	existing, err := b.GetMemory(ctx, collection, id)
+	if err != nil {
+		return nil, err
+	}
+	metadata := maps.Clone(existing.Metadata)
+	for k, v := range patch.Metadata {
+		if k == "id" {
+			continue
+		}
+		if v == "" {
+			delete(metadata, k)
+		} else {
+			metadata[k] = v
+		}
+	}
+	setFlag(metadata, "pinned", patch.Pinned)
+	setFlag(metadata, "deprecated", patch.Deprecated)
+	metadata["timestamp"] = time.Now().Format(time.RFC3339)
+
+	content := existing.Content
+	if strings.TrimSpace(patch.Content) != "" {
+		content = patch.Content
+	}
+	ms, _ := b.collection(collection)
+	if err := ms.Update(ctx, id, content, metadata); err != nil {
+		return nil, err
+	}
+	return b.GetMemory(ctx, collection, id)
+}
+
+// setFlag sets a "true" metadata flag, or removes it when it is cleared.
+func setFlag(metadata map[string]string, key string, v *bool) {
+	if v == nil {
+		return
+	}
+	if *v {
+		metadata[key] = "true"
+	} else {
+		delete(metadata, key)
+	}
+}
+
+// DeleteMemory deletes the memory id of a collection.
+func (b *Brain) DeleteMemory(ctx context.Context, collection, id string) error {
+	if _, err := b.GetMemory(ctx, collection, id); err != nil {
+		return err
+	}
+	ms, _ := b.collection(collection)
+	return ms.Delete(ctx, id)
+}
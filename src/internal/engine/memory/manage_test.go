@@ -0,0 +1,128 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"miri-main/src/internal/config"
+	"miri-main/src/internal/storage"
+)
+
+func TestBrain_ManageMemories(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		StorageDir: tmpDir,
+		Miri: config.MiriConfig{
+			Brain: config.BrainConfig{
+				Embeddings: config.EmbeddingConfig{
+					UseNativeEmbeddings: true,
+				},
+			},
+		},
+	}
+	facts, err := NewVectorMemory(cfg, "test_manage_facts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	summaries, err := NewVectorMemory(cfg, "test_manage_summaries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, _ := storage.New(tmpDir)
+	brain := NewBrain(&mockChat{response: "[]"}, facts, summaries, facts, 1000, st, config.RetrievalConfig{}, 0)
+	ctx := context.Background()
+
+	old := time.Now().Add(-48 * time.Hour).Format(time.RFC3339)
+	_ = facts.Add(ctx, "The user lives in Berlin", map[string]string{"type": "fact", "session_id": "s1", "created_at": old, "id": "f1"})
+	_ = facts.Add(ctx, "The user likes green tea", map[string]string{"type": "fact", "session_id": "s2", "deprecated": "true", "id": "f2"})
+	_ = summaries.Add(ctx, "The user planned a trip to Berlin", map[string]string{"type": "summary", "session_id": "s1", "created_at": time.Now().Format(time.RFC3339), "id": "s-1"})
+
+	// Searching ranks both collections and reports the scores.
+	hits, err := brain.SearchMemories(ctx, MemoryFilter{Query: "Berlin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 3 {
+		t.Fatalf("expected 3 hits, got %+v", hits)
+	}
+	for _, h := range hits {
+		if h.Score != hybridScore(SearchResult{Distance: h.Distance, Metadata: h.Metadata}) {
+			t.Errorf("unexpected score of %s: %v", h.ID, h.Score)
+		}
+	}
+
+	notDeprecated := false
+	hits, _ = brain.SearchMemories(ctx, MemoryFilter{Query: "tea", Collection: CollectionFacts, Deprecated: &notDeprecated})
+	if len(hits) != 1 || hits[0].ID != "f1" {
+		t.Errorf("expected only the current fact, got %+v", hits)
+	}
+	hits, _ = brain.SearchMemories(ctx, MemoryFilter{SessionID: "s1", From: time.Now().Add(-time.Hour)})
+	if len(hits) != 1 || hits[0].ID != "s-1" || hits[0].Collection != CollectionSummaries {
+		t.Errorf("expected the recent summary of s1, got %+v", hits)
+	}
+	if _, err := brain.SearchMemories(ctx, MemoryFilter{Collection: "steps"}); !errors.Is(err, ErrUnknownCollection) {
+		t.Errorf("expected ErrUnknownCollection, got %v", err)
+	}
+
+	// Manual facts get the standard metadata.
+	added, err := brain.AddMemory(ctx, CollectionFacts, "The user is vegetarian", map[string]string{"category": "diet"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added.ID == "" || added.Metadata["type"] != "fact" || added.Metadata["source"] != "manual" || added.Metadata["created_at"] == "" {
+		t.Errorf("unexpected metadata %+v", added.Metadata)
+	}
+
+	// Updates keep the metadata they do not change.
+	pin, undeprecate := true, false
+	updated, err := brain.UpdateMemory(ctx, CollectionFacts, "f2", MemoryPatch{
+		Content:    "The user likes black tea",
+		Metadata:   map[string]string{"category": "food", "session_id": ""},
+		Pinned:     &pin,
+		Deprecated: &undeprecate,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := updated.Metadata
+	if updated.Content != "The user likes black tea" || m["type"] != "fact" || m["category"] != "food" || m["pinned"] != "true" {
+		t.Errorf("unexpected update %+v", updated)
+	}
+	if _, ok := m["deprecated"]; ok {
+		t.Errorf("expected deprecated removed, got %+v", m)
+	}
+	if _, ok := m["session_id"]; ok {
+		t.Errorf("expected session_id removed, got %+v", m)
+	}
+
+	// Pinned memories survive cleanup.
+	if err := brain.cleanup(ctx, []SearchResult{{Metadata: map[string]string{"id": "f2", "type": "fact", "confidence": "0.1", "pinned": "true"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := brain.GetMemory(ctx, CollectionFacts, "f2"); err != nil {
+		t.Errorf("expected the pinned fact kept, got %v", err)
+	}
+
+	if err := brain.DeleteMemory(ctx, CollectionFacts, "f1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := brain.GetMemory(ctx, CollectionFacts, "f1"); !errors.Is(err, ErrMemoryNotFound) {
+		t.Errorf("expected ErrMemoryNotFound, got %v", err)
+	}
+	if err := brain.DeleteMemory(ctx, CollectionFacts, "f1"); !errors.Is(err, ErrMemoryNotFound) {
+		t.Errorf("expected ErrMemoryNotFound on a second delete, got %v", err)
+	}
+}
+
+func TestKeepPinned(t *testing.T) {
+	dups := []duplicateGroup{{PrimaryID: "a", DuplicateIDs: []string{"b", "c"}}}
+	keepPinned(dups, []SearchResult{
+		{Metadata: map[string]string{"id": "b", "pinned": "true"}},
+		{Metadata: map[string]string{"id": "c"}},
+	})
+	if len(dups[0].DuplicateIDs) != 1 || dups[0].DuplicateIDs[0] != "c" {
+		t.Errorf("expected the pinned duplicate kept, got %v", dups[0].DuplicateIDs)
+	}
+}
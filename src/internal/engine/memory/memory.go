@@ -21,6 +21,8 @@ type MemorySystem interface {
 	Add(ctx context.Context, content string, metadata map[string]string) error
 	// Search searches for relevant memories based on a query and optional metadata filter.
 	Search(ctx context.Context, query string, limit int, filter map[string]string) ([]SearchResult, error)
+	// LexicalSearch searches for memories sharing terms with the query, ranked by BM25.
+	LexicalSearch(ctx context.Context, query string, limit int, filter map[string]string) ([]SearchResult, error)
 	// ListAll returns all documents in the collection (use with caution).
 	ListAll(ctx context.Context) ([]SearchResult, error)
 	// GetByID retrieves a document by ID.
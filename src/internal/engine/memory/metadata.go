@@ -34,6 +34,9 @@ func (b *Brain) prepareMetadata(metadata map[string]string) map[string]string {
 	if _, ok := metadata["last_accessed"]; !ok {
 		metadata["last_accessed"] = time.Now().Format(time.RFC3339)
 	}
+	if metadata["session_id"] == "" {
+		delete(metadata, "session_id")
+	}
 
 	return metadata
 }
@@ -61,7 +64,7 @@ func (b *Brain) IngestMetadata(ctx context.Context, human, soul string) error {
 	}
 
 	// 1. Extract facts from this context
-	if err := b.ExtractFacts(ctx, msgs); err != nil {
+	if err := b.ExtractFacts(ctx, "", msgs); err != nil {
 		slog.Error("Failed to extract facts from metadata", "error", err)
 	}
 
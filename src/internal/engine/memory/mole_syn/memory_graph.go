@@ -459,6 +459,18 @@ func (mg *MemoryGraph) prevBondFromMap(pm map[string]map[string]graph.Edge[strin
 	return Explore
 }
 
+// Reload rebuilds the graph from its memory system, e.g. after steps were imported.
+func (mg *MemoryGraph) Reload(ctx context.Context) {
+	mg.mu.Lock()
+	mg.g = graph.New(graph.StringHash, graph.Directed())
+	mg.vertexData = make(map[string]Node)
+	mg.lastNode = make(map[string]string)
+	mg.edgeData = make(map[string]EdgeData)
+	mg.transCount = make(map[BondType]map[BondType]int)
+	mg.mu.Unlock()
+	mg.loadFromMemorySystem(ctx)
+}
+
 func (mg *MemoryGraph) loadFromMemorySystem(ctx context.Context) {
 	if mg.ms == nil {
 		return
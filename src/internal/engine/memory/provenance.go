@@ -0,0 +1,301 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// Kinds of memory sources.
+const (
+	SourceConversation = "conversation"
+	SourceSummary      = "summary"
+	SourceSubAgent     = "subagent"
+	SourceManual       = "manual"
+)
+
+// sourcesKey is the metadata key holding the JSON-encoded sources of a memory.
+const sourcesKey = "sources"
+
+// maxExcerptLen caps the excerpt kept per source, and maxExcerptMessageLen the
+// part of it taken from a single message.
+const (
+	maxExcerptLen        = 2000
+	maxExcerptMessageLen = 500
+)
+
+// maxSources caps the sources kept per memory when merging duplicates.
+const maxSources = 20
+
+// Source is an origin of a memory. A memory merged from duplicates keeps the
+// sources of all of them.
+type Source struct {
+	Kind      string `json:"kind"`
+	SessionID string `json:"session_id,omitempty"`
+	// Messages are the indices of the messages the memory was learned from, in
+	// the conversation window processed by the maintenance that learned it.
+	Messages      []int    `json:"messages,omitempty"`
+	ToolCallIDs   []string `json:"tool_call_ids,omitempty"`
+	URLs          []string `json:"urls,omitempty"`
+	SubAgentRunID string   `json:"subagent_run_id,omitempty"`
+	// MemoryID is the summary a fact was promoted from.
+	MemoryID string `json:"memory_id,omitempty"`
+	// Excerpt is the original text the memory was learned from. The
+	// conversation buffer is cleared once processed, so it is kept here.
+	Excerpt   string `json:"excerpt,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+}
+
+// Provenance is where a memory of the Brain came from.
+type Provenance struct {
+	ID         string   `json:"id"`
+	Collection string   `json:"collection"`
+	Content    string   `json:"content"`
+	Sources    []Source `json:"sources"`
+}
+
+// Sources returns the sources recorded in metadata. Memories stored before
+// sources were recorded get one derived from their other metadata.
+func Sources(metadata map[string]string) []Source {
+	if raw := metadata[sourcesKey]; raw != "" {
+		var sources []Source
+		if err := json.Unmarshal([]byte(raw), &sources); err == nil {
+			return sources
+		}
+	}
+	src := Source{SessionID: metadata["session_id"], CreatedAt: metadata["created_at"]}
+	switch {
+	case metadata["subagent_id"] != "":
+		src.Kind = SourceSubAgent
+		src.SubAgentRunID = metadata["subagent_id"]
+		src.SessionID = metadata["session"]
+	case metadata["source"] == "summary_promotion":
+		src.Kind = SourceSummary
+	case metadata["source"] == "manual":
+		src.Kind = SourceManual
+	case src.SessionID != "":
+		src.Kind = SourceConversation
+	default:
+		return nil
+	}
+	return []Source{src}
+}
+
+// SetSources records sources in metadata, replacing the recorded ones.
+func SetSources(metadata map[string]string, sources ...Source) {
+	if len(sources) == 0 {
+		delete(metadata, sourcesKey)
+		return
+	}
+	data, err := json.Marshal(sources)
+	if err != nil {
+		return
+	}
+	metadata[sourcesKey] = string(data)
+}
+
+// setSources is SetSources for the Brain: the excerpts and URLs, taken from the
+// original conversation, go through the sanitize func like the text sent to the
+// model, so the vault's values are stored as their placeholders.
+func (b *Brain) setSources(metadata map[string]string, sources ...Source) {
+	for i := range sources {
+		sources[i].Excerpt = b.sanitizeText(sources[i].Excerpt)
+		urls := make([]string, len(sources[i].URLs))
+		for j, u := range sources[i].URLs {
+			urls[j] = b.sanitizeText(u)
+		}
+		if len(urls) > 0 {
+			sources[i].URLs = urls
+		}
+	}
+	SetSources(metadata, sources...)
+}
+
+func (b *Brain) sanitizeText(s string) string {
+	if s == "" {
+		return s
+	}
+	return b.sanitize([]*schema.Message{schema.UserMessage(s)})[0].Content
+}
+
+// mergeSources returns the sources of a followed by those of b it lacks, at
+// most maxSources.
+func mergeSources(a, b []Source) []Source {
+	merged := slices.Clone(a)
+	seen := make(map[string]bool, len(a)+len(b))
+	for _, s := range a {
+		data, _ := json.Marshal(s)
+		seen[string(data)] = true
+	}
+	for _, s := range b {
+		data, _ := json.Marshal(s)
+		if !seen[string(data)] {
+			seen[string(data)] = true
+			merged = append(merged, s)
+		}
+	}
+	if len(merged) > maxSources {
+		merged = merged[:maxSources]
+	}
+	return merged
+}
+
+// mergeDuplicateSources adds the sources of the duplicates to their primary
+// memory in ms, before the duplicates are deleted. batch holds the memories
+// the groups were found in.
+func mergeDuplicateSources(ctx context.Context, ms MemorySystem, dups []duplicateGroup, batch []SearchResult) {
+	byID := make(map[string]SearchResult, len(batch))
+	for _, r := range batch {
+		byID[r.Metadata["id"]] = r
+	}
+	for _, d := range dups {
+		primary, ok := byID[d.PrimaryID]
+		if !ok || len(d.DuplicateIDs) == 0 {
+			continue
+		}
+		sources := Sources(primary.Metadata)
+		for _, id := range d.DuplicateIDs {
+			if dup, ok := byID[id]; ok {
+				sources = mergeSources(sources, Sources(dup.Metadata))
+			}
+		}
+		metadata := maps.Clone(primary.Metadata)
+		SetSources(metadata, sources...)
+		if metadata[sourcesKey] == primary.Metadata[sourcesKey] {
+			continue
+		}
+		if err := ms.Update(ctx, d.PrimaryID, primary.Content, metadata); err != nil {
+			slog.Warn("failed to merge sources of duplicates", "id", d.PrimaryID, "error", err)
+		}
+	}
+}
+
+// formatConversation renders messages for the learning prompts, numbered so the
+// model can cite them. Tool calls and results carry their call ID.
+func formatConversation(messages []*schema.Message) string {
+	var sb strings.Builder
+	for i, m := range messages {
+		sb.WriteString(fmt.Sprintf("[%d] %s\n", i, formatMessage(m)))
+	}
+	return sb.String()
+}
+
+func formatMessage(m *schema.Message) string {
+	content := m.Content
+	for _, tc := range m.ToolCalls {
+		content += fmt.Sprintf("\n[Tool Call %s: %s %s]", tc.ID, tc.Function.Name, tc.Function.Arguments)
+	}
+	if m.Role == schema.Tool {
+		return fmt.Sprintf("%s (%s): %s", m.Role, m.ToolCallID, content)
+	}
+	return fmt.Sprintf("%s: %s", m.Role, content)
+}
+
+// conversationSource is the source of a memory learned from the messages of
+// a session at indices. Invalid indices are dropped; without any valid one,
+// the whole conversation is the source.
+func conversationSource(sessionID string, messages []*schema.Message, indices []int) Source {
+	indices = slices.DeleteFunc(slices.Clone(indices), func(i int) bool {
+		return i < 0 || i >= len(messages)
+	})
+	slices.Sort(indices)
+	indices = slices.Compact(indices)
+	src := Source{Kind: SourceConversation, SessionID: sessionID, Messages: indices, CreatedAt: time.Now().Format(time.RFC3339)}
+	if len(indices) == 0 {
+		for i := range messages {
+			indices = append(indices, i)
+		}
+	}
+
+	// The URL of a tool result is in the arguments of its call.
+	urls := make(map[string]string)
+	for _, m := range messages {
+		for _, tc := range m.ToolCalls {
+			var args struct {
+				URL string `json:"url"`
+			}
+			if json.Unmarshal([]byte(tc.Function.Arguments), &args) == nil && args.URL != "" {
+				urls[tc.ID] = args.URL
+			}
+		}
+	}
+
+	var excerpt strings.Builder
+	for _, i := range indices {
+		m := messages[i]
+		var callIDs []string
+		for _, tc := range m.ToolCalls {
+			callIDs = append(callIDs, tc.ID)
+		}
+		if m.Role == schema.Tool && m.ToolCallID != "" {
+			callIDs = append(callIDs, m.ToolCallID)
+		}
+		for _, id := range callIDs {
+			if !slices.Contains(src.ToolCallIDs, id) {
+				src.ToolCallIDs = append(src.ToolCallIDs, id)
+			}
+			if u := urls[id]; u != "" && !slices.Contains(src.URLs, u) {
+				src.URLs = append(src.URLs, u)
+			}
+		}
+		excerpt.WriteString(truncate(formatMessage(m), maxExcerptMessageLen))
+		excerpt.WriteString("\n")
+	}
+	src.Excerpt = truncate(strings.TrimSpace(excerpt.String()), maxExcerptLen)
+	return src
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	cut := n
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "…"
+}
+
+// summarySource is the source of a fact promoted from the summary s.
+func summarySource(s SearchResult) Source {
+	return Source{
+		Kind:      SourceSummary,
+		SessionID: s.Metadata["session_id"],
+		MemoryID:  s.Metadata["id"],
+		Excerpt:   truncate(s.Content, maxExcerptLen),
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+}
+
+// SubAgentSource is the source of the result of the sub-agent run runID,
+// started from the session parentSession.
+func SubAgentSource(runID, parentSession, output string) Source {
+	return Source{
+		Kind:          SourceSubAgent,
+		SessionID:     parentSession,
+		SubAgentRunID: runID,
+		Excerpt:       truncate(output, maxExcerptLen),
+		CreatedAt:     time.Now().Format(time.RFC3339),
+	}
+}
+
+// GetProvenance returns the sources of the memory id of a collection.
+func (b *Brain) GetProvenance(ctx context.Context, collection, id string) (*Provenance, error) {
+	hit, err := b.GetMemory(ctx, collection, id)
+	if err != nil {
+		return nil, err
+	}
+	sources := Sources(hit.Metadata)
+	if sources == nil {
+		sources = []Source{}
+	}
+	return &Provenance{ID: hit.ID, Collection: collection, Content: hit.Content, Sources: sources}, nil
+}
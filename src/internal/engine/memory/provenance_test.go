@@ -0,0 +1,157 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"miri-main/src/internal/config"
+	"miri-main/src/internal/storage"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+func TestBrain_FactProvenance(t *testing.T) {
+	cleanup := setupTestPrompts()
+	defer cleanup()
+
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		StorageDir: tmpDir,
+		Miri: config.MiriConfig{
+			Brain: config.BrainConfig{
+				Embeddings: config.EmbeddingConfig{
+					UseNativeEmbeddings: true,
+				},
+			},
+		},
+	}
+	vm, err := NewVectorMemory(cfg, "test_provenance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chat := &mockChat{response: `[{"fact": "The VPN ticket is INC-4821", "category": "entity", "confidence": 0.9, "source_messages": [2, 3, 42]}]`}
+	st, _ := storage.New(tmpDir)
+	brain := NewBrain(chat, vm, vm, vm, 1000, st, config.RetrievalConfig{}, 0)
+	ctx := context.Background()
+
+	messages := []*schema.Message{
+		schema.UserMessage("Hi"),
+		schema.UserMessage("What is the status of my VPN ticket?"),
+		schema.AssistantMessage("", []schema.ToolCall{{ID: "call_1", Function: schema.FunctionCall{
+			Name: "fetch", Arguments: `{"url": "https://tickets.example.com/INC-4821"}`,
+		}}}),
+		{Role: schema.Tool, ToolCallID: "call_1", Content: "INC-4821: VPN drops every hour. Status: open"},
+	}
+	if err := brain.ExtractFacts(ctx, "sess-1", messages); err != nil {
+		t.Fatal(err)
+	}
+	facts, _ := vm.ListAll(ctx)
+	if len(facts) != 1 {
+		t.Fatalf("expected the extracted fact, got %+v", facts)
+	}
+
+	prov, err := brain.GetProvenance(ctx, CollectionFacts, facts[0].Metadata["id"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prov.Sources) != 1 {
+		t.Fatalf("expected one source, got %+v", prov.Sources)
+	}
+	src := prov.Sources[0]
+	if src.Kind != SourceConversation || src.SessionID != "sess-1" || !slices.Equal(src.Messages, []int{2, 3}) {
+		t.Errorf("unexpected source %+v", src)
+	}
+	if !slices.Equal(src.ToolCallIDs, []string{"call_1"}) || !slices.Equal(src.URLs, []string{"https://tickets.example.com/INC-4821"}) {
+		t.Errorf("expected the tool call and URL recorded, got %+v", src)
+	}
+	if !strings.Contains(src.Excerpt, "VPN drops every hour") || strings.Contains(src.Excerpt, "Hi") {
+		t.Errorf("expected the excerpt of the cited messages, got %q", src.Excerpt)
+	}
+
+	// Merging a duplicate keeps the sources of both.
+	_ = vm.Add(ctx, "The user's VPN ticket is INC-4821", map[string]string{
+		"type": "fact", "id": "dup", "subagent_id": "run-7", "session": "sess-2",
+	})
+	all, _ := vm.ListAll(ctx)
+	mergeDuplicateSources(ctx, vm, []duplicateGroup{{PrimaryID: prov.ID, DuplicateIDs: []string{"dup"}}}, all)
+	if prov, err = brain.GetProvenance(ctx, CollectionFacts, prov.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(prov.Sources) != 2 || prov.Sources[1].Kind != SourceSubAgent || prov.Sources[1].SubAgentRunID != "run-7" || prov.Sources[1].SessionID != "sess-2" {
+		t.Errorf("expected the duplicate's source merged, got %+v", prov.Sources)
+	}
+}
+
+func TestSources(t *testing.T) {
+	if s := Sources(map[string]string{"type": "fact"}); s != nil {
+		t.Errorf("expected no source, got %+v", s)
+	}
+	if s := Sources(map[string]string{"source": "summary_promotion"}); len(s) != 1 || s[0].Kind != SourceSummary {
+		t.Errorf("expected a derived summary source, got %+v", s)
+	}
+
+	metadata := map[string]string{}
+	SetSources(metadata, Source{Kind: SourceManual})
+	merged := mergeSources(Sources(metadata), []Source{{Kind: SourceManual}, {Kind: SourceSummary, MemoryID: "s1"}})
+	if len(merged) != 2 || merged[1].MemoryID != "s1" {
+		t.Errorf("expected duplicate sources dropped, got %+v", merged)
+	}
+
+	if got := truncate("héllo", 2); got != "h…" {
+		t.Errorf("truncate = %q", got)
+	}
+}
+
+func TestBrain_SourcesSanitized(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		StorageDir: tmpDir,
+		Miri: config.MiriConfig{
+			Brain: config.BrainConfig{
+				Embeddings: config.EmbeddingConfig{
+					UseNativeEmbeddings: true,
+				},
+			},
+		},
+	}
+	vm, err := NewVectorMemory(cfg, "test_provenance_sanitized")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, _ := storage.New(tmpDir)
+	brain := NewBrain(&mockChat{response: "[]"}, vm, vm, vm, 1000, st, config.RetrievalConfig{}, 0)
+	brain.SetSanitizeFunc(func(msgs []*schema.Message) []*schema.Message {
+		out := make([]*schema.Message, len(msgs))
+		for i, m := range msgs {
+			out[i] = &schema.Message{Role: m.Role, Content: strings.ReplaceAll(m.Content, "hunter2", "[PASSWORD_1]")}
+		}
+		return out
+	})
+
+	metadata := map[string]string{}
+	brain.setSources(metadata, conversationSource("sess-1", []*schema.Message{
+		schema.UserMessage("My mail password is hunter2"),
+		schema.AssistantMessage("", []schema.ToolCall{{ID: "call_1", Function: schema.FunctionCall{
+			Name: "fetch", Arguments: `{"url": "https://mail.example.com/?pass=hunter2"}`,
+		}}}),
+	}, nil))
+	if src := Sources(metadata)[0]; strings.Contains(src.Excerpt, "hunter2") || strings.Contains(src.URLs[0], "hunter2") {
+		t.Errorf("expected the password replaced in the source, got %+v", src)
+	}
+
+	// Sources of injected facts, such as sub-agent results, are sanitized too.
+	metadata = map[string]string{"id": "sub-1"}
+	SetSources(metadata, SubAgentSource("run-1", "sess-1", "Logged in with hunter2"))
+	if err := brain.StoreFact(context.Background(), "Logged in", metadata); err != nil {
+		t.Fatal(err)
+	}
+	prov, err := brain.GetProvenance(context.Background(), CollectionFacts, "sub-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if excerpt := prov.Sources[0].Excerpt; excerpt != "Logged in with [PASSWORD_1]" {
+		t.Errorf("expected the sub-agent excerpt sanitized, got %q", excerpt)
+	}
+}
@@ -0,0 +1,243 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/philippgille/chromem-go"
+)
+
+// reembedBatchSize is the number of documents embedded between two progress
+// checkpoints of a re-embedding.
+const reembedBatchSize = 50
+
+// embeddersFile records, in the vector_db directory, which chromem collection
+// holds each of our collections and the embedder its documents were embedded with.
+const embeddersFile = "embedders.json"
+
+// collectionEmbedder is the entry of a collection in embeddersFile.
+type collectionEmbedder struct {
+	// Collection is the chromem collection holding the documents.
+	Collection string `json:"collection"`
+	Embedder   string `json:"embedder"`
+	Dimension  int    `json:"dimension"`
+	// Migration is the re-embedding in progress, if any.
+	Migration *embedderMigration `json:"migration,omitempty"`
+}
+
+// embedderMigration is a re-embedding of a collection into a new chromem
+// collection. The old one is kept until all documents are re-embedded.
+type embedderMigration struct {
+	Collection string `json:"collection"`
+	Embedder   string `json:"embedder"`
+	Dimension  int    `json:"dimension"`
+	Total      int    `json:"total"`
+	Done       int    `json:"done"`
+}
+
+// embeddersMu serializes the updates of embeddersFile by the VectorMemory of
+// each collection.
+var embeddersMu sync.Mutex
+
+func loadEmbedders(dir string) (map[string]collectionEmbedder, error) {
+	m := make(map[string]collectionEmbedder)
+	data, err := os.ReadFile(filepath.Join(dir, embeddersFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", embeddersFile, err)
+	}
+	return m, nil
+}
+
+func saveEmbedders(dir string, m map[string]collectionEmbedder) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, embeddersFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, embeddersFile))
+}
+
+// openCollection returns the chromem collection holding name. If its documents
+// were embedded by another embedder, they are first re-embedded with embed into
+// a new collection, which replaces the old one once all documents are done. An
+// interrupted re-embedding resumes where it stopped.
+func openCollection(ctx context.Context, db *chromem.DB, dir, name string, embed chromem.EmbeddingFunc, embedder string) (*chromem.Collection, error) {
+	embeddersMu.Lock()
+	defer embeddersMu.Unlock()
+
+	embedders, err := loadEmbedders(dir)
+	if err != nil {
+		return nil, err
+	}
+	state, ok := embedders[name]
+	if !ok || state.Collection == "" {
+		state = collectionEmbedder{Collection: name}
+	}
+	if embedder == "" {
+		slog.Warn("no usable embedder, leaving the collection as it is", "collection", name)
+		return db.GetOrCreateCollection(state.Collection, nil, embed)
+	}
+	dim, err := embeddingDimension(ctx, embed)
+	if err != nil {
+		slog.Warn("failed to probe the embedder, leaving the collection as it is", "collection", name, "embedder", embedder, "error", err)
+		return db.GetOrCreateCollection(state.Collection, nil, embed)
+	}
+	save := func() error {
+		embedders[name] = state
+		return saveEmbedders(dir, embedders)
+	}
+
+	// A re-embedding for another embedder than the current one is abandoned.
+	if m := state.Migration; m != nil && (m.Embedder != embedder || m.Dimension != dim) {
+		slog.Info("abandoning re-embedding for a previous embedder", "collection", name, "embedder", m.Embedder)
+		if err := db.DeleteCollection(m.Collection); err != nil {
+			return nil, err
+		}
+		state.Migration = nil
+	}
+	if state.Embedder == embedder && state.Dimension == dim && state.Migration == nil {
+		return db.GetOrCreateCollection(state.Collection, nil, embed)
+	}
+
+	docs, err := collectionDocuments(db, state.Collection)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+	// Collections created before embedders were recorded are assumed to match
+	// the current embedder if their embeddings have its dimension.
+	legacy := state.Embedder == "" && (len(docs) == 0 || len(docs[0].Embedding) == dim)
+	if legacy || len(docs) == 0 {
+		state.Embedder, state.Dimension = embedder, dim
+		if err := save(); err != nil {
+			return nil, err
+		}
+		return db.GetOrCreateCollection(state.Collection, nil, embed)
+	}
+
+	slog.Warn("embedder changed, re-embedding the collection", "collection", name,
+		"from", state.Embedder, "to", embedder, "documents", len(docs))
+	return reembed(ctx, db, name, &state, docs, embed, embedder, dim, save)
+}
+
+// reembed embeds docs into the chromem collection of the new embedder in
+// batches, recording the progress after each, then switches name over to it
+// and deletes the old collection.
+func reembed(ctx context.Context, db *chromem.DB, name string, state *collectionEmbedder, docs []chromem.Document,
+	embed chromem.EmbeddingFunc, embedder string, dim int, save func() error) (*chromem.Collection, error) {
+	sum := sha256.Sum256([]byte(embedder + "/" + strconv.Itoa(dim)))
+	target := name + "@" + hex.EncodeToString(sum[:4])
+	col, err := db.GetOrCreateCollection(target, nil, embed)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []chromem.Document
+	for _, d := range docs {
+		if _, err := col.GetByID(ctx, d.ID); err == nil {
+			continue
+		}
+		if d.Content == "" {
+			slog.Warn("skipping document without content", "collection", name, "id", d.ID)
+			continue
+		}
+		pending = append(pending, chromem.Document{ID: d.ID, Metadata: d.Metadata, Content: d.Content})
+	}
+	state.Migration = &embedderMigration{
+		Collection: target,
+		Embedder:   embedder,
+		Dimension:  dim,
+		Total:      len(docs),
+		Done:       len(docs) - len(pending),
+	}
+	if err := save(); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < len(pending); i += reembedBatchSize {
+		batch := pending[i:min(i+reembedBatchSize, len(pending))]
+		if err := col.AddDocuments(ctx, batch, 4); err != nil {
+			return nil, fmt.Errorf("re-embed %s: stopped at %d/%d documents, resuming at the next start: %w",
+				name, state.Migration.Done, state.Migration.Total, err)
+		}
+		state.Migration.Done += len(batch)
+		if err := save(); err != nil {
+			return nil, err
+		}
+		slog.Info("re-embedding collection", "collection", name, "done", state.Migration.Done, "total", state.Migration.Total)
+	}
+
+	old := state.Collection
+	state.Collection, state.Embedder, state.Dimension, state.Migration = target, embedder, dim, nil
+	if err := save(); err != nil {
+		return nil, err
+	}
+	if err := db.DeleteCollection(old); err != nil {
+		slog.Warn("failed to delete the collection of the previous embedder", "collection", old, "error", err)
+	}
+	slog.Info("re-embedded collection", "collection", name, "documents", col.Count())
+	return col, nil
+}
+
+// embeddingDimension returns the dimension of the embeddings of embed.
+func embeddingDimension(ctx context.Context, embed chromem.EmbeddingFunc) (int, error) {
+	v, err := embed(ctx, "dimension probe")
+	if err != nil {
+		return 0, err
+	}
+	if len(v) == 0 {
+		return 0, errors.New("empty embedding")
+	}
+	return len(v), nil
+}
+
+// collectionDocuments returns the documents of a chromem collection, with their
+// embeddings, sorted by ID. chromem can only list documents by querying them,
+// which needs the embedder they were embedded with, so they are read from an
+// export of the collection instead.
+func collectionDocuments(db *chromem.DB, name string) ([]chromem.Document, error) {
+	var buf bytes.Buffer
+	if err := db.ExportToWriter(&buf, false, "", name); err != nil {
+		return nil, err
+	}
+	var exported struct {
+		Collections map[string]*struct {
+			Name      string
+			Metadata  map[string]string
+			Documents map[string]*chromem.Document
+		}
+	}
+	if err := gob.NewDecoder(&buf).Decode(&exported); err != nil {
+		return nil, err
+	}
+	c := exported.Collections[name]
+	if c == nil {
+		return nil, nil
+	}
+	docs := make([]chromem.Document, 0, len(c.Documents))
+	for _, d := range c.Documents {
+		docs = append(docs, *d)
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].ID < docs[j].ID })
+	return docs, nil
+}
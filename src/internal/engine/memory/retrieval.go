@@ -32,6 +32,94 @@ func (b *Brain) Retrieve(ctx context.Context, sessionID, query string) (string,
 	return sb.String(), nil
 }
 
+// rrfK dampens the lead of the top ranks in reciprocal rank fusion; 60 is the
+// value of the original paper (Cormack et al., SIGIR 2009).
+const rrfK = 60
+
+// hybridSearch returns the k best results of ms for query, fusing its vector
+// and lexical (BM25) rankings of 4k candidates each by reciprocal rank fusion.
+func hybridSearch(ctx context.Context, ms MemorySystem, query string, k int) ([]SearchResult, error) {
+	vector, err := ms.Search(ctx, query, 4*k, nil)
+	if err != nil {
+		return nil, err
+	}
+	lexical, err := ms.LexicalSearch(ctx, query, 4*k, nil)
+	if err != nil {
+		return nil, err
+	}
+	return fuseRankings(k, vector, lexical), nil
+}
+
+// fuseRankings merges rankings of the same collection by reciprocal rank
+// fusion: a result scores 1/(rrfK+rank) in each ranking it appears in. The
+// fused score is turned into a Distance from 0, for a result first in every
+// ranking, to 1, so the hybridScore re-weighting applies on top of it. At most
+// k results are returned, best first; k <= 0 returns all.
+func fuseRankings(k int, rankings ...[]SearchResult) []SearchResult {
+	scores := make(map[string]float64)
+	fused := make(map[string]SearchResult)
+	var ids []string
+	for _, ranking := range rankings {
+		for rank, r := range ranking {
+			id := r.Metadata["id"]
+			if _, ok := fused[id]; !ok {
+				fused[id] = r
+				ids = append(ids, id)
+			}
+			scores[id] += 1 / float64(rrfK+rank+1)
+		}
+	}
+	sort.SliceStable(ids, func(i, j int) bool { return scores[ids[i]] > scores[ids[j]] })
+	if k > 0 && len(ids) > k {
+		ids = ids[:k]
+	}
+
+	best := float64(len(rankings)) / float64(rrfK+1)
+	results := make([]SearchResult, 0, len(ids))
+	for _, id := range ids {
+		r := fused[id]
+		r.Distance = float32(1 - scores[id]/best)
+		results = append(results, r)
+	}
+	return results
+}
+
+// hybridScore ranks a search result; lower is better. It combines three signals:
+//
+//	a) fused distance of the vector and lexical rankings (lower = more relevant)
+//	b) deep_bond_uses — how often this fact fed into core (Deep-bond) reasoning
+//	c) importance — node importance from Mole-Syn (0.0–1.0)
+//
+// Formula: effective_distance = distance × dbu_boost × (1.0 - 0.4 × importance)
+func hybridScore(r SearchResult) float64 {
+	dbu, _ := strconv.Atoi(r.Metadata["deep_bond_uses"])
+	dbuBoost := 1.0 - min(float64(dbu)*0.05, 0.5)
+
+	imp, _ := strconv.ParseFloat(r.Metadata["importance"], 64)
+	if imp < 0 {
+		imp = 0
+	} else if imp > 1 {
+		imp = 1
+	}
+	impBoost := 1.0 - 0.4*imp
+
+	return float64(r.Distance) * dbuBoost * impBoost
+}
+
+// rankBefore orders search results by hybridScore.
+// Tie-breaker: topology_score (birth-quality of the session that created the fact).
+func rankBefore(a, b SearchResult) bool {
+	scoreA, scoreB := hybridScore(a), hybridScore(b)
+	if scoreA != scoreB {
+		return scoreA < scoreB
+	}
+
+	// Tie-breaker: higher birth-quality topology score first
+	tsA, _ := strconv.Atoi(a.Metadata["topology_score"])
+	tsB, _ := strconv.Atoi(b.Metadata["topology_score"])
+	return tsA > tsB
+}
+
 func (b *Brain) RetrieveDocuments(ctx context.Context, sessionID, query string) ([]*schema.Document, error) {
 	if b.factMemory == nil || b.summaryMemory == nil {
 		return nil, nil
@@ -77,9 +165,9 @@ func (b *Brain) RetrieveDocuments(ctx context.Context, sessionID, query string)
 		}
 	}
 
-	// 2. Vector Recall (top facts + summaries)
-	facts, _ := b.factMemory.Search(ctx, query, factsTopK, nil)
-	summaries, _ := b.summaryMemory.Search(ctx, query, summariesTopK, nil)
+	// 2. Hybrid Recall (top facts + summaries by vector and lexical ranking)
+	facts, _ := hybridSearch(ctx, b.factMemory, query, factsTopK)
+	summaries, _ := hybridSearch(ctx, b.summaryMemory, query, summariesTopK)
 
 	results := append(facts, summaries...)
 
@@ -93,39 +181,8 @@ func (b *Brain) RetrieveDocuments(ctx context.Context, sessionID, query string)
 	}
 
 	// 3. Hybrid ranking (weighted score)
-	// Combines three signals:
-	//   a) cosine distance (lower = more similar)
-	//   b) deep_bond_uses — how often this fact fed into core (Deep-bond) reasoning
-	//   c) importance — node importance from Mole-Syn (0.0–1.0)
-	// Formula: effective_distance = distance × dbu_boost × (1.0 - 0.4 × importance)
-	// Tie-breaker: topology_score (birth-quality of the session that created the fact).
 	sort.SliceStable(results, func(i, j int) bool {
-		getScore := func(r SearchResult) float64 {
-			dbu, _ := strconv.Atoi(r.Metadata["deep_bond_uses"])
-			dbuBoost := 1.0 - min(float64(dbu)*0.05, 0.5)
-
-			imp, _ := strconv.ParseFloat(r.Metadata["importance"], 64)
-			if imp < 0 {
-				imp = 0
-			} else if imp > 1 {
-				imp = 1
-			}
-			impBoost := 1.0 - 0.4*imp
-
-			return float64(r.Distance) * dbuBoost * impBoost
-		}
-
-		scoreI := getScore(results[i])
-		scoreJ := getScore(results[j])
-
-		if scoreI != scoreJ {
-			return scoreI < scoreJ
-		}
-
-		// Tie-breaker: higher birth-quality topology score first
-		tsI, _ := strconv.Atoi(results[i].Metadata["topology_score"])
-		tsJ, _ := strconv.Atoi(results[j].Metadata["topology_score"])
-		return tsI > tsJ
+		return rankBefore(results[i], results[j])
 	})
 
 	// Update access metadata for retrieved results
@@ -185,10 +242,14 @@ func (b *Brain) RetrieveDocuments(ctx context.Context, sessionID, query string)
 
 // StoreFact directly adds a fact into the fact memory store with the given metadata.
 // This is used to inject sub-agent results into the parent session's long-term memory.
+// The excerpts of the sources recorded in metadata are sanitized.
 func (b *Brain) StoreFact(ctx context.Context, content string, metadata map[string]string) error {
 	if b.factMemory == nil {
 		return nil
 	}
+	if metadata[sourcesKey] != "" {
+		b.setSources(metadata, Sources(metadata)...)
+	}
 	return b.factMemory.Add(ctx, content, metadata)
 }
 
@@ -0,0 +1,386 @@
+package memory
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"miri-main/src/internal/config"
+	"miri-main/src/internal/engine/vault"
+	"miri-main/src/internal/storage"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Names of the Brain's collections in <storage_dir>/vector_db.
+const (
+	FactsCollectionName     = "miri_facts"
+	SummariesCollectionName = "miri_summaries"
+	StepsCollectionName     = "miri_steps"
+)
+
+// SnapshotVersion is the version of the brain archive format written by
+// WriteSnapshot. ReadSnapshot rejects archives of later versions. Version 2
+// added the vault entries.
+const SnapshotVersion = 2
+
+// Snapshot is a portable copy of a Brain: its collections, of which the steps
+// hold the Mole-Syn graph, the values of the vault placeholders in them, and the
+// persona files. Documents carry no embeddings; they are embedded again on
+// import.
+type Snapshot struct {
+	Version   int        `json:"version"`
+	CreatedAt time.Time  `json:"created_at"`
+	Facts     []Document `json:"facts"`
+	Summaries []Document `json:"summaries"`
+	Steps     []Document `json:"steps"`
+	Soul      string     `json:"soul,omitempty"`
+	Human     string     `json:"human,omitempty"`
+	// Vault maps the placeholders in the documents, such as "[EMAIL_1f2e3d4c]",
+	// to their values.
+	Vault map[string]string `json:"vault,omitempty"`
+}
+
+// Stores are the parts of a Brain a snapshot is taken of. Nil collections are
+// skipped.
+type Stores struct {
+	Facts     MemorySystem
+	Summaries MemorySystem
+	Steps     MemorySystem
+	Storage   *storage.Storage
+	Vault     *vault.Vault
+}
+
+// OpenStores opens the collections of the brain of cfg, to export or import it
+// while Miri is not running.
+func OpenStores(cfg *config.Config, st *storage.Storage) (Stores, error) {
+	s := Stores{Storage: st}
+	for _, c := range []struct {
+		name string
+		ms   *MemorySystem
+	}{
+		{FactsCollectionName, &s.Facts},
+		{SummariesCollectionName, &s.Summaries},
+		{StepsCollectionName, &s.Steps},
+	} {
+		vm, err := NewVectorMemory(cfg, c.name)
+		if err != nil {
+			return s, fmt.Errorf("open %s: %w", c.name, err)
+		}
+		*c.ms = vm
+	}
+	if st != nil {
+		ss, err := st.SessionStore()
+		if err != nil {
+			return s, fmt.Errorf("open vault: %w", err)
+		}
+		s.Vault = vault.New(ss)
+	}
+	return s, nil
+}
+
+// Stores returns the collections and storage of the Brain.
+func (b *Brain) Stores() Stores {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return Stores{Facts: b.factMemory, Summaries: b.summaryMemory, Steps: b.stepsMemory, Storage: b.storage, Vault: b.vault}
+}
+
+func (s Stores) collections(snap *Snapshot) []struct {
+	name string
+	ms   MemorySystem
+	docs *[]Document
+} {
+	return []struct {
+		name string
+		ms   MemorySystem
+		docs *[]Document
+	}{
+		{CollectionFacts, s.Facts, &snap.Facts},
+		{CollectionSummaries, s.Summaries, &snap.Summaries},
+		{"steps", s.Steps, &snap.Steps},
+	}
+}
+
+// Export takes a snapshot of the stores. Documents are sorted by ID so
+// snapshots of the same brain are identical.
+func (s Stores) Export(ctx context.Context) (*Snapshot, error) {
+	snap := &Snapshot{Version: SnapshotVersion, CreatedAt: time.Now().UTC()}
+	for _, c := range s.collections(snap) {
+		if c.ms == nil {
+			continue
+		}
+		results, err := c.ms.ListAll(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("export %s: %w", c.name, err)
+		}
+		docs := make([]Document, 0, len(results))
+		for _, r := range results {
+			meta := maps.Clone(r.Metadata)
+			docs = append(docs, Document{ID: meta["id"], Content: r.Content, Metadata: meta})
+		}
+		sort.Slice(docs, func(i, j int) bool { return docs[i].ID < docs[j].ID })
+		*c.docs = docs
+	}
+	if s.Vault != nil {
+		var sb strings.Builder
+		for _, c := range s.collections(snap) {
+			for _, d := range *c.docs {
+				sb.WriteString(d.Content)
+				for _, v := range d.Metadata {
+					sb.WriteString(v)
+				}
+			}
+		}
+		if values := s.Vault.Values(sb.String()); len(values) > 0 {
+			snap.Vault = values
+		}
+	}
+	if s.Storage != nil {
+		var err error
+		if snap.Soul, err = s.Storage.GetSoul(); err != nil {
+			return nil, fmt.Errorf("export soul: %w", err)
+		}
+		if snap.Human, err = s.Storage.GetHuman(); err != nil {
+			return nil, fmt.Errorf("export human: %w", err)
+		}
+	}
+	return snap, nil
+}
+
+// ImportResult counts the documents imported per collection.
+type ImportResult struct {
+	Replace   bool `json:"replace"`
+	Facts     int  `json:"facts"`
+	Summaries int  `json:"summaries"`
+	Steps     int  `json:"steps"`
+	// Removed is the number of existing documents deleted or overwritten when
+	// replacing.
+	Removed int `json:"removed"`
+}
+
+// Import loads a snapshot into the stores. When merging, documents are added
+// to the existing ones, replacing those of the same ID, and the persona files
+// are kept. When replacing, the existing documents missing from the snapshot are
+// deleted and the persona files of the snapshot overwrite the existing ones.
+// They are deleted only once every document of the snapshot is embedded, so a
+// failing embedder leaves the brain as it was, plus the documents added so far.
+// The vault entries are registered first, so the placeholders in the documents
+// can be restored.
+func (s Stores) Import(ctx context.Context, snap *Snapshot, replace bool) (*ImportResult, error) {
+	res := &ImportResult{Replace: replace}
+	if len(snap.Vault) > 0 {
+		if s.Vault == nil {
+			return res, fmt.Errorf("import vault: no vault for %d placeholders", len(snap.Vault))
+		}
+		for _, token := range slices.Sorted(maps.Keys(snap.Vault)) {
+			if err := s.Vault.Register(token, snap.Vault[token]); err != nil {
+				return res, fmt.Errorf("import vault: %w", err)
+			}
+		}
+	}
+	counts := map[string]*int{CollectionFacts: &res.Facts, CollectionSummaries: &res.Summaries, "steps": &res.Steps}
+	type stale struct {
+		ms  MemorySystem
+		ids []string
+	}
+	var stales []stale
+	for _, c := range s.collections(snap) {
+		if c.ms == nil {
+			continue
+		}
+		var existing []SearchResult
+		if replace {
+			var err error
+			if existing, err = c.ms.ListAll(ctx); err != nil {
+				return res, fmt.Errorf("import %s: %w", c.name, err)
+			}
+		}
+		docs := make([]Document, 0, len(*c.docs))
+		imported := make(map[string]bool, len(*c.docs))
+		for _, d := range *c.docs {
+			if d.Content == "" {
+				continue
+			}
+			d.Metadata = maps.Clone(d.Metadata)
+			if d.Metadata == nil {
+				d.Metadata = make(map[string]string)
+			}
+			if d.ID == "" {
+				d.ID = d.Metadata["id"]
+			}
+			if d.ID == "" {
+				d.ID = uuid.NewString()
+			}
+			d.Metadata["id"] = d.ID
+			docs = append(docs, d)
+			imported[d.ID] = true
+		}
+		if err := c.ms.BulkAdd(ctx, docs); err != nil {
+			return res, fmt.Errorf("import %s: %w", c.name, err)
+		}
+		*counts[c.name] = len(docs)
+
+		st := stale{ms: c.ms}
+		for _, r := range existing {
+			if id := r.Metadata["id"]; !imported[id] {
+				st.ids = append(st.ids, id)
+			}
+		}
+		stales = append(stales, st)
+		// The documents of the same ID were replaced by the imported ones.
+		res.Removed += len(existing) - len(st.ids)
+	}
+	for _, st := range stales {
+		for _, id := range st.ids {
+			if err := st.ms.Delete(ctx, id); err != nil {
+				return res, fmt.Errorf("import: delete %s: %w", id, err)
+			}
+			res.Removed++
+		}
+	}
+	if replace && s.Storage != nil {
+		if snap.Soul != "" {
+			if err := s.Storage.SaveSoul(snap.Soul); err != nil {
+				return res, fmt.Errorf("import soul: %w", err)
+			}
+		}
+		if snap.Human != "" {
+			if err := s.Storage.SaveHuman(snap.Human); err != nil {
+				return res, fmt.Errorf("import human: %w", err)
+			}
+		}
+	}
+	return res, nil
+}
+
+// ExportSnapshot takes a snapshot of the Brain.
+func (b *Brain) ExportSnapshot(ctx context.Context) (*Snapshot, error) {
+	return b.Stores().Export(ctx)
+}
+
+// ImportSnapshot loads a snapshot into the Brain and rebuilds the Mole-Syn
+// graph from the imported steps.
+func (b *Brain) ImportSnapshot(ctx context.Context, snap *Snapshot, replace bool) (*ImportResult, error) {
+	res, err := b.Stores().Import(ctx, snap, replace)
+	if b.Graph != nil {
+		b.Graph.Reload(ctx)
+	}
+	return res, err
+}
+
+// WriteSnapshot writes snap as a gzip-compressed JSON archive.
+func WriteSnapshot(w io.Writer, snap *Snapshot) error {
+	zw := gzip.NewWriter(w)
+	enc := json.NewEncoder(zw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(snap); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// ReadSnapshot reads an archive written by WriteSnapshot, or its uncompressed JSON.
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	} else {
+		r = br
+	}
+	var snap Snapshot
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("invalid brain archive: %w", err)
+	}
+	if snap.Version < 1 || snap.Version > SnapshotVersion {
+		return nil, fmt.Errorf("unsupported brain archive version %d (supported: 1 to %d)", snap.Version, SnapshotVersion)
+	}
+	return &snap, nil
+}
+
+// CollectionDiff lists the IDs of the documents that differ between two
+// snapshots of a collection.
+type CollectionDiff struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+}
+
+// Empty reports whether the collection is the same in both snapshots.
+func (d CollectionDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// SnapshotDiff is the difference from one snapshot to another.
+type SnapshotDiff struct {
+	Facts        CollectionDiff `json:"facts"`
+	Summaries    CollectionDiff `json:"summaries"`
+	Steps        CollectionDiff `json:"steps"`
+	SoulChanged  bool           `json:"soul_changed"`
+	HumanChanged bool           `json:"human_changed"`
+}
+
+// Empty reports whether the snapshots hold the same brain.
+func (d SnapshotDiff) Empty() bool {
+	return d.Facts.Empty() && d.Summaries.Empty() && d.Steps.Empty() && !d.SoulChanged && !d.HumanChanged
+}
+
+// accessKeys are the metadata retrieval updates on every access. Changes to
+// them alone do not make a document differ.
+var accessKeys = []string{"access_count", "last_accessed", "interaction_count", "deep_bond_uses"}
+
+// DiffSnapshots compares the snapshot from to the snapshot to.
+func DiffSnapshots(from, to *Snapshot) SnapshotDiff {
+	return SnapshotDiff{
+		Facts:        diffDocuments(from.Facts, to.Facts),
+		Summaries:    diffDocuments(from.Summaries, to.Summaries),
+		Steps:        diffDocuments(from.Steps, to.Steps),
+		SoulChanged:  from.Soul != to.Soul,
+		HumanChanged: from.Human != to.Human,
+	}
+}
+
+func diffDocuments(from, to []Document) CollectionDiff {
+	var d CollectionDiff
+	old := make(map[string]Document, len(from))
+	for _, doc := range from {
+		old[doc.ID] = doc
+	}
+	for _, doc := range to {
+		prev, ok := old[doc.ID]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, doc.ID)
+		case prev.Content != doc.Content || !maps.Equal(withoutAccess(prev.Metadata), withoutAccess(doc.Metadata)):
+			d.Changed = append(d.Changed, doc.ID)
+		}
+		delete(old, doc.ID)
+	}
+	for id := range old {
+		d.Removed = append(d.Removed, id)
+	}
+	slices.Sort(d.Added)
+	slices.Sort(d.Removed)
+	slices.Sort(d.Changed)
+	return d
+}
+
+func withoutAccess(metadata map[string]string) map[string]string {
+	m := maps.Clone(metadata)
+	for _, k := range accessKeys {
+		delete(m, k)
+	}
+	return m
+}
@@ -0,0 +1,241 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"miri-main/src/internal/config"
+	"miri-main/src/internal/engine/vault"
+	"miri-main/src/internal/storage"
+)
+
+func newTestStores(t *testing.T) Stores {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := &config.Config{
+		StorageDir: dir,
+		Miri: config.MiriConfig{
+			Brain: config.BrainConfig{
+				Embeddings: config.EmbeddingConfig{
+					UseNativeEmbeddings: true,
+				},
+			},
+		},
+	}
+	st, err := storage.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+	stores, err := OpenStores(cfg, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stores
+}
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	src := newTestStores(t)
+	_ = src.Facts.Add(ctx, "The user lives in Berlin", map[string]string{"type": "fact", "id": "f1"})
+	_ = src.Summaries.Add(ctx, "The user planned a trip", map[string]string{"type": "summary", "id": "s1"})
+	_ = src.Steps.Add(ctx, "Step 1", map[string]string{"session": "sess", "id": "n1"})
+	_ = src.Steps.Add(ctx, "Step 2", map[string]string{"session": "sess", "parent_id": "n1", "bond": "D", "id": "n2"})
+	_ = src.Storage.SaveSoul("I am Miri")
+	_ = src.Storage.SaveHuman("Likes tea")
+
+	snap, err := src.Export(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteSnapshot(&buf, snap); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Version != SnapshotVersion || len(read.Facts) != 1 || len(read.Summaries) != 1 || len(read.Steps) != 2 || read.Soul != "I am Miri" {
+		t.Fatalf("unexpected snapshot %+v", read)
+	}
+
+	// Merging keeps the existing memories and persona.
+	dst := newTestStores(t)
+	_ = dst.Facts.Add(ctx, "The user has a cat", map[string]string{"type": "fact", "id": "f2"})
+	_ = dst.Storage.SaveSoul("I am someone else")
+	res, err := dst.Import(ctx, read, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Facts != 1 || res.Steps != 2 || res.Removed != 0 {
+		t.Errorf("unexpected merge result %+v", res)
+	}
+	if n, _ := dst.Facts.Count(ctx); n != 2 {
+		t.Errorf("expected 2 facts after merging, got %d", n)
+	}
+	if soul, _ := dst.Storage.GetSoul(); soul != "I am someone else" {
+		t.Errorf("expected the soul kept when merging, got %q", soul)
+	}
+	if f, _ := dst.Facts.GetByID(ctx, "f1"); f == nil || f.Content != "The user lives in Berlin" {
+		t.Errorf("expected the imported fact retrievable by ID, got %+v", f)
+	}
+
+	// Replacing makes the brain identical to the snapshot.
+	res, err = dst.Import(ctx, read, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Removed != 5 {
+		t.Errorf("expected 5 documents removed, got %+v", res)
+	}
+	after, _ := dst.Export(ctx)
+	if d := DiffSnapshots(read, after); !d.Empty() {
+		t.Errorf("expected no differences after replacing, got %+v", d)
+	}
+
+	// The graph is rebuilt from the imported steps.
+	brain := NewBrain(&mockChat{}, dst.Facts, dst.Summaries, dst.Steps, 1000, dst.Storage, config.RetrievalConfig{}, 0)
+	if _, err := brain.ImportSnapshot(ctx, read, true); err != nil {
+		t.Fatal(err)
+	}
+	if content, ok := brain.Graph.GetNodeContent("n2"); !ok || content != "Step 2" {
+		t.Errorf("expected the imported step in the graph, got %q, %v", content, ok)
+	}
+}
+
+func TestReadSnapshot_Version(t *testing.T) {
+	if _, err := ReadSnapshot(strings.NewReader(`{"version":99}`)); err == nil || !strings.Contains(err.Error(), "unsupported") {
+		t.Errorf("expected an unsupported version error, got %v", err)
+	}
+	if _, err := ReadSnapshot(strings.NewReader(`{"version":1,"facts":[]}`)); err != nil {
+		t.Errorf("expected uncompressed JSON accepted, got %v", err)
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	from := &Snapshot{
+		Facts: []Document{
+			{ID: "a", Content: "A", Metadata: map[string]string{"access_count": "1"}},
+			{ID: "b", Content: "B"},
+			{ID: "c", Content: "C"},
+		},
+		Soul: "soul",
+	}
+	to := &Snapshot{
+		Facts: []Document{
+			{ID: "a", Content: "A", Metadata: map[string]string{"access_count": "7"}},
+			{ID: "b", Content: "B2"},
+			{ID: "d", Content: "D"},
+		},
+		Soul: "soul",
+	}
+	d := DiffSnapshots(from, to)
+	if strings.Join(d.Facts.Added, ",") != "d" || strings.Join(d.Facts.Removed, ",") != "c" || strings.Join(d.Facts.Changed, ",") != "b" {
+		t.Errorf("unexpected diff %+v", d.Facts)
+	}
+	if d.SoulChanged || d.HumanChanged || !d.Summaries.Empty() {
+		t.Errorf("unexpected diff %+v", d)
+	}
+}
+
+// failingBulkAdd is a collection whose embedder is down.
+type failingBulkAdd struct {
+	MemorySystem
+}
+
+func (failingBulkAdd) BulkAdd(ctx context.Context, docs []Document) error {
+	return errors.New("embedding API unavailable")
+}
+
+func TestSnapshot_ReplaceKeepsBrainOnFailure(t *testing.T) {
+	ctx := context.Background()
+	dst := newTestStores(t)
+	_ = dst.Facts.Add(ctx, "The user has a cat", map[string]string{"type": "fact", "id": "f1"})
+	_ = dst.Summaries.Add(ctx, "The user adopted a cat", map[string]string{"type": "summary", "id": "s1"})
+	_ = dst.Storage.SaveSoul("I am Miri")
+
+	snap := &Snapshot{
+		Version:   SnapshotVersion,
+		Facts:     []Document{{ID: "f2", Content: "The user has a dog"}},
+		Summaries: []Document{{ID: "s2", Content: "The user adopted a dog"}},
+		Soul:      "I am someone else",
+	}
+	dst.Summaries = failingBulkAdd{dst.Summaries}
+	if _, err := dst.Import(ctx, snap, true); err == nil {
+		t.Fatal("expected the import to fail")
+	}
+	for _, c := range []struct {
+		ms MemorySystem
+		id string
+	}{{dst.Facts, "f1"}, {dst.Summaries, "s1"}} {
+		if r, _ := c.ms.GetByID(ctx, c.id); r == nil {
+			t.Errorf("expected %s kept after the failed import", c.id)
+		}
+	}
+	if soul, _ := dst.Storage.GetSoul(); soul != "I am Miri" {
+		t.Errorf("expected the soul kept after the failed import, got %q", soul)
+	}
+}
+
+func TestSnapshot_VaultEntries(t *testing.T) {
+	ctx := context.Background()
+	src := newTestStores(t)
+	src.Vault.AddDetector(vault.DefaultDetectors()[1])
+	content := src.Vault.Tokenize("", "The user's email is bob@example.com")
+	if !strings.Contains(content, "[EMAIL_") {
+		t.Fatalf("expected the email tokenized, got %q", content)
+	}
+	_ = src.Facts.Add(ctx, content, map[string]string{"type": "fact", "id": "f1"})
+
+	snap, err := src.Export(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteSnapshot(&buf, snap); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Vault) != 1 {
+		t.Fatalf("expected the email's vault entry in the archive, got %v", read.Vault)
+	}
+
+	dst := newTestStores(t)
+	if _, err := dst.Import(ctx, read, false); err != nil {
+		t.Fatal(err)
+	}
+	f, _ := dst.Facts.GetByID(ctx, "f1")
+	if f == nil {
+		t.Fatal("expected the fact imported")
+	}
+	// The placeholder is restored in a session that retrieves the memory, also
+	// after a restart.
+	ss, err := dst.Storage.SessionStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []*vault.Vault{dst.Vault, vault.New(ss)} {
+		if got := v.Restore("sess", v.Adopt("sess", f.Content)); got != "The user's email is bob@example.com" {
+			t.Errorf("expected the email restored, got %q", got)
+		}
+	}
+
+	// An entry conflicting with the vault fails the import before any document is added.
+	for token := range read.Vault {
+		read.Vault[token] = "alice@example.com"
+	}
+	read.Facts[0].ID = "f2"
+	if _, err := dst.Import(ctx, read, false); err == nil {
+		t.Error("expected a conflicting vault entry to fail the import")
+	}
+	if f, _ := dst.Facts.GetByID(ctx, "f2"); f != nil {
+		t.Error("expected no document added after the failed import")
+	}
+}
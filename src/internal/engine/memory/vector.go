@@ -21,6 +21,7 @@ import (
 type VectorMemory struct {
 	db         *chromem.DB
 	collection *chromem.Collection
+	lexical    *lexicalIndex
 }
 
 //go:embed static_qwen3_embedding_0.6b_pca384.msgpack
@@ -40,68 +41,21 @@ func NewVectorMemory(cfg *config.Config, collectionName string) (*VectorMemory,
 	}
 	slog.Info("initialized vector database", "path", dbPath)
 
-	var embedFunc chromem.EmbeddingFunc
-	if cfg.Miri.Brain.Embeddings.UseNativeEmbeddings {
-		embedder, err := LoadStaticEmbedderFromBytes(embeddedEmbeddings)
-		if err != nil {
-			slog.Warn("failed to load static embedder, using zero-vector fallback", "error", err)
-			embedFunc = func(ctx context.Context, text string) ([]float32, error) {
-				return make([]float32, 384), nil
-			}
-		} else {
-			embedFunc = embedder.Embed
-		}
-	} else {
-		// Use external embedding API
-		embType := cfg.Miri.Brain.Embeddings.Model.Type
-		apiKey := cfg.Miri.Brain.Embeddings.Model.APIKey
-
-		switch strings.ToLower(embType) {
-		case "openai":
-			// Default OpenAI model
-			embedFunc = chromem.NewEmbeddingFuncOpenAI(apiKey, chromem.EmbeddingModelOpenAI3Small)
-		case "mistral":
-			embedFunc = chromem.NewEmbeddingFuncMistral(apiKey)
-		case "cohere":
-			embedFunc = chromem.NewEmbeddingFuncCohere(apiKey, chromem.EmbeddingModelCohereEnglishV3)
-		case "ollama":
-			// Default Ollama model and localhost URL
-			embedFunc = chromem.NewEmbeddingFuncOllama("nomic-embed-text", "")
-		case "jina":
-			embedFunc = chromem.NewEmbeddingFuncJina(apiKey, chromem.EmbeddingModelJina2BaseEN)
-		case "mixedbread":
-			embedFunc = chromem.NewEmbeddingFuncMixedbread(apiKey, chromem.EmbeddingModelMixedbreadLargeV1)
-		case "localai":
-			embedFunc = chromem.NewEmbeddingFuncLocalAI("bert-cpp-minilm-v6")
-		case "openai-compatible":
-			url := cfg.Miri.Brain.Embeddings.Model.URL
-			model := cfg.Miri.Brain.Embeddings.Model.Model
-			embedFunc = chromem.NewEmbeddingFuncOpenAICompat(apiKey, url, model, nil)
-		default:
-			// Fallback to OpenAI
-			embedFunc = chromem.NewEmbeddingFuncOpenAI(apiKey, chromem.EmbeddingModelOpenAI3Small)
-		}
+	embedFunc, embedder := newEmbeddingFunc(cfg)
+	col, err := openCollection(context.Background(), db, dbPath, collectionName, embedFunc, embedder)
+	if err != nil {
+		return nil, err
 	}
+	slog.Info("using vector collection", "name", collectionName, "collection", col.Name, "embedder", embedder, "count", col.Count())
 
-	col, err := db.GetOrCreateCollection(collectionName, nil, embedFunc)
+	// The lexical index is not persisted; it is rebuilt from the collection.
+	docs, err := collectionDocuments(db, col.Name)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get or create collection: %w", err)
+		return nil, fmt.Errorf("failed to build lexical index: %w", err)
 	}
-	slog.Info("using vector collection", "name", collectionName, "count", col.Count())
-
-	// Test if data retrievable (detect embedder incompatibility/mismatch)
-	ctx := context.Background()
-	testCount := col.Count()
-	testResults, testErr := col.Query(ctx, " ", testCount, nil, nil)
-	if testErr == nil && len(testResults) == 0 && testCount > 0 {
-		slog.Warn("Test query returned no results despite count > 0; possible embedding incompatibility. Clearing collection.", "collection", collectionName, "count", testCount)
-		if clearErr := col.Delete(ctx, nil, nil); clearErr != nil {
-			slog.Error("Failed to clear incompatible collection", "collection", collectionName, "error", clearErr)
-		} else {
-			slog.Info("Cleared incompatible collection for compatibility", "collection", collectionName)
-		}
-	} else if testErr != nil {
-		slog.Warn("Test query failed", "collection", collectionName, "error", testErr)
+	lexical := newLexicalIndex()
+	for _, d := range docs {
+		lexical.add(d.ID, d.Content, d.Metadata)
 	}
 
 	system.LogMemoryUsage("vector_memory_init")
@@ -109,9 +63,56 @@ func NewVectorMemory(cfg *config.Config, collectionName string) (*VectorMemory,
 	return &VectorMemory{
 		db:         db,
 		collection: col,
+		lexical:    lexical,
 	}, nil
 }
 
+// newEmbeddingFunc returns the embedding function configured by cfg and its
+// identity, recorded per collection to detect embedder changes. The identity is
+// empty for the zero-vector fallback used when the native embeddings fail to load.
+func newEmbeddingFunc(cfg *config.Config) (chromem.EmbeddingFunc, string) {
+	if cfg.Miri.Brain.Embeddings.UseNativeEmbeddings {
+		embedder, err := LoadStaticEmbedderFromBytes(embeddedEmbeddings)
+		if err != nil {
+			slog.Warn("failed to load static embedder, using zero-vector fallback", "error", err)
+			return func(ctx context.Context, text string) ([]float32, error) {
+				return make([]float32, 384), nil
+			}, ""
+		}
+		return embedder.Embed, "native/static_qwen3_embedding_0.6b_pca384"
+	}
+
+	// Use external embedding API
+	embType := cfg.Miri.Brain.Embeddings.Model.Type
+	apiKey := cfg.Miri.Brain.Embeddings.Model.APIKey
+
+	switch strings.ToLower(embType) {
+	case "openai":
+		// Default OpenAI model
+		return chromem.NewEmbeddingFuncOpenAI(apiKey, chromem.EmbeddingModelOpenAI3Small), "openai/" + string(chromem.EmbeddingModelOpenAI3Small)
+	case "mistral":
+		return chromem.NewEmbeddingFuncMistral(apiKey), "mistral/mistral-embed"
+	case "cohere":
+		return chromem.NewEmbeddingFuncCohere(apiKey, chromem.EmbeddingModelCohereEnglishV3), "cohere/" + string(chromem.EmbeddingModelCohereEnglishV3)
+	case "ollama":
+		// Default Ollama model and localhost URL
+		return chromem.NewEmbeddingFuncOllama("nomic-embed-text", ""), "ollama/nomic-embed-text"
+	case "jina":
+		return chromem.NewEmbeddingFuncJina(apiKey, chromem.EmbeddingModelJina2BaseEN), "jina/" + string(chromem.EmbeddingModelJina2BaseEN)
+	case "mixedbread":
+		return chromem.NewEmbeddingFuncMixedbread(apiKey, chromem.EmbeddingModelMixedbreadLargeV1), "mixedbread/" + string(chromem.EmbeddingModelMixedbreadLargeV1)
+	case "localai":
+		return chromem.NewEmbeddingFuncLocalAI("bert-cpp-minilm-v6"), "localai/bert-cpp-minilm-v6"
+	case "openai-compatible":
+		url := cfg.Miri.Brain.Embeddings.Model.URL
+		model := cfg.Miri.Brain.Embeddings.Model.Model
+		return chromem.NewEmbeddingFuncOpenAICompat(url, apiKey, model, nil), "openai-compatible/" + model
+	default:
+		// Fallback to OpenAI
+		return chromem.NewEmbeddingFuncOpenAI(apiKey, chromem.EmbeddingModelOpenAI3Small), "openai/" + string(chromem.EmbeddingModelOpenAI3Small)
+	}
+}
+
 func (v *VectorMemory) Add(ctx context.Context, content string, metadata map[string]string) error {
 	id := uuid.New().String()
 	// If ID is provided in metadata, use it
@@ -131,6 +132,7 @@ func (v *VectorMemory) Add(ctx context.Context, content string, metadata map[str
 		slog.Error("failed to add document to vector memory", "error", err)
 		return err
 	}
+	v.lexical.add(id, content, metadata)
 	slog.Debug("added document to vector memory", "id", doc.ID, "content_len", len(content))
 	return nil
 }
@@ -185,6 +187,12 @@ func (v *VectorMemory) Search(ctx context.Context, query string, limit int, filt
 	return searchResults, nil
 }
 
+// LexicalSearch ranks the documents by BM25 over their content, without
+// embeddings. Distance is relative to the best match, which has 0.
+func (v *VectorMemory) LexicalSearch(ctx context.Context, query string, limit int, filter map[string]string) ([]SearchResult, error) {
+	return v.lexical.search(query, limit, filter), nil
+}
+
 func (v *VectorMemory) ListAll(ctx context.Context) ([]SearchResult, error) {
 	// chromem-go doesn't have a direct ListAll, but we can query with a dummy string or use the underlying store.
 	// Querying with a very large limit and a wildcard-like behavior.
@@ -234,7 +242,11 @@ func (v *VectorMemory) GetByID(ctx context.Context, id string) (*SearchResult, e
 }
 
 func (v *VectorMemory) Delete(ctx context.Context, id string) error {
-	return v.collection.Delete(ctx, nil, nil, id)
+	if err := v.collection.Delete(ctx, nil, nil, id); err != nil {
+		return err
+	}
+	v.lexical.remove(id)
+	return nil
 }
 
 func (v *VectorMemory) Update(ctx context.Context, id string, content string, metadata map[string]string) error {
@@ -264,6 +276,7 @@ func (v *VectorMemory) Update(ctx context.Context, id string, content string, me
 		slog.Error("failed to update document in vector memory", "id", id, "error", err)
 		return err
 	}
+	v.lexical.add(id, content, metadata)
 	slog.Debug("updated document in vector memory", "id", doc.ID)
 	return nil
 }
@@ -287,6 +300,7 @@ func (v *VectorMemory) BulkAdd(ctx context.Context, docs []Document) error {
 			slog.Error("failed to add document in bulk", "id", id, "error", err)
 			return err
 		}
+		v.lexical.add(id, doc.Content, doc.Metadata)
 	}
 	return nil
 }
@@ -2,8 +2,13 @@ package memory
 
 import (
 	"context"
+	"encoding/json"
 	"miri-main/src/internal/config"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 )
 
@@ -153,3 +158,102 @@ func TestVectorMemory_NewMethods(t *testing.T) {
 		t.Errorf("expected 3 imported got %d", c2)
 	}
 }
+
+// newTestEmbeddingServer serves OpenAI-compatible embeddings whose dimension is
+// the length of the model name. Requests fail once remaining drops below zero.
+func newTestEmbeddingServer(t *testing.T, remaining *atomic.Int64) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input string `json:"input"`
+			Model string `json:"model"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || remaining.Add(-1) < 0 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		embedding := make([]float32, len(req.Model))
+		for i := range embedding {
+			embedding[i] = float32(len(req.Input) + i + 1)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": []map[string]any{{"embedding": embedding}}})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestVectorMemory_ReembedOnEmbedderChange(t *testing.T) {
+	var remaining atomic.Int64
+	remaining.Store(1 << 20)
+	srv := newTestEmbeddingServer(t, &remaining)
+	tmpDir := t.TempDir()
+	cfgFor := func(model string) *config.Config {
+		return &config.Config{
+			StorageDir: tmpDir,
+			Miri: config.MiriConfig{
+				Brain: config.BrainConfig{
+					Embeddings: config.EmbeddingConfig{
+						Model: config.EmbeddingModelConfig{Type: "openai-compatible", URL: srv.URL, Model: model},
+					},
+				},
+			},
+		}
+	}
+	ctx := context.Background()
+
+	vm, err := NewVectorMemory(cfgFor("abcd"), "test_reembed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, content := range []string{"User likes coffee", "User lives in Berlin", "User has a cat"} {
+		if err := vm.Add(ctx, content, map[string]string{"id": string(rune('a' + i)), "type": "fact"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Reopening with the same embedder keeps the collection as is.
+	if vm, err = NewVectorMemory(cfgFor("abcd"), "test_reembed"); err != nil || vm.collection.Name != "test_reembed" {
+		t.Fatalf("expected the same collection, got %v", err)
+	}
+
+	// A change of embedder failing midway keeps the old collection and records
+	// the progress of the re-embedding.
+	remaining.Store(2)
+	if _, err := NewVectorMemory(cfgFor("abcdef"), "test_reembed"); err == nil {
+		t.Fatal("expected an error while the embedder fails")
+	}
+	remaining.Store(1 << 20)
+	dir := filepath.Join(tmpDir, "vector_db")
+	embedders, err := loadEmbedders(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := embedders["test_reembed"]; state.Collection != "test_reembed" || state.Migration == nil || state.Migration.Total != 3 {
+		t.Fatalf("expected a pending re-embedding of the old collection, got %+v", state)
+	}
+
+	// The next start resumes the re-embedding.
+	if vm, err = NewVectorMemory(cfgFor("abcdef"), "test_reembed"); err != nil {
+		t.Fatal(err)
+	}
+	if c, _ := vm.Count(ctx); c != 3 {
+		t.Errorf("expected 3 re-embedded documents, got %d", c)
+	}
+	res, err := vm.Search(ctx, "coffee", 3, nil)
+	if err != nil || len(res) != 3 {
+		t.Fatalf("expected the documents searchable with the new embedder, got %d (%v)", len(res), err)
+	}
+	if r, _ := vm.GetByID(ctx, "b"); r == nil || r.Content != "User lives in Berlin" || r.Metadata["type"] != "fact" {
+		t.Errorf("expected the document kept, got %+v", r)
+	}
+
+	if embedders, err = loadEmbedders(dir); err != nil {
+		t.Fatal(err)
+	}
+	state := embedders["test_reembed"]
+	if state.Embedder != "openai-compatible/abcdef" || state.Dimension != 6 || state.Migration != nil || state.Collection == "test_reembed" {
+		t.Errorf("unexpected recorded embedder %+v", state)
+	}
+	if vm.db.GetCollection("test_reembed", nil) != nil {
+		t.Error("expected the collection of the old embedder deleted")
+	}
+}
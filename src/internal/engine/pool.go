@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"fmt"
+	"log/slog"
+	"miri-main/src/internal/config"
+	"sync"
+	"time"
+)
+
+// defaultEngineIdleTTL is how long an unused per-model engine is kept in the pool.
+const defaultEngineIdleTTL = 30 * time.Minute
+
+type poolEntry struct {
+	eng      *EinoEngine
+	lastUsed time.Time
+}
+
+// EnginePool hands out engines for per-request model overrides. Engines are derived
+// from the primary engine and share its Brain, tools, skills and task gateway; only
+// the chat model chain and compiled graph are built per model. Engines unused for
+// longer than the idle TTL are evicted.
+type EnginePool struct {
+	base    *EinoEngine
+	cfg     *config.Config
+	idleTTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*poolEntry
+}
+
+// NewEnginePool creates a pool around the primary engine. A non-positive idleTTL
+// uses the default of 30 minutes.
+func NewEnginePool(base *EinoEngine, cfg *config.Config, idleTTL time.Duration) *EnginePool {
+	if idleTTL <= 0 {
+		idleTTL = defaultEngineIdleTTL
+	}
+	return &EnginePool{
+		base:    base,
+		cfg:     cfg,
+		idleTTL: idleTTL,
+		entries: make(map[string]*poolEntry),
+	}
+}
+
+// Get returns the engine for a model reference ("provider/model" or a bare model ID).
+// An empty reference or the primary model returns the primary engine.
+func (p *EnginePool) Get(ref string) (Engine, error) {
+	if ref == "" {
+		return p.base, nil
+	}
+	mr := resolveModelRef(p.cfg, ref, p.base.primary.Provider)
+	if mr == p.base.primary {
+		return p.base, nil
+	}
+	key := mr.String()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	p.evictIdle(now)
+	if e, ok := p.entries[key]; ok {
+		e.lastUsed = now
+		return e.eng, nil
+	}
+
+	eng, err := p.base.forModel(p.cfg, mr)
+	if err != nil {
+		return nil, fmt.Errorf("engine for model %s: %w", key, err)
+	}
+	slog.Info("Engine pool: created engine", "model", key)
+	p.entries[key] = &poolEntry{eng: eng, lastUsed: now}
+	return eng, nil
+}
+
+// Len returns the number of pooled (non-primary) engines.
+func (p *EnginePool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.entries)
+}
+
+// evictIdle drops engines unused since before now-idleTTL. The caller holds p.mu.
+func (p *EnginePool) evictIdle(now time.Time) {
+	for key, e := range p.entries {
+		if now.Sub(e.lastUsed) > p.idleTTL {
+			slog.Info("Engine pool: evicted idle engine", "model", key)
+			delete(p.entries, key)
+		}
+	}
+}
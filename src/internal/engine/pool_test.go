@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"miri-main/src/internal/config"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+func newTestPool(t *testing.T, idleTTL time.Duration) *EnginePool {
+	t.Helper()
+	cfg := &config.Config{Models: config.ModelsConfig{Providers: map[string]config.ProviderConfig{
+		"xai":    {BaseURL: "http://127.0.0.1:1", APIKey: "test", Models: []config.ModelConfig{{ID: "xai/grok-4", Name: "grok-4", ContextWindow: 128000}}},
+		"nvidia": {BaseURL: "http://127.0.0.1:1", APIKey: "test", Models: []config.ModelConfig{{ID: "kimi-k2.5", ContextWindow: 64000}}},
+	}}}
+	base := &EinoEngine{
+		primary:       modelRef{Provider: "xai", Model: "grok-4"},
+		contextWindow: 128000,
+		toolInfos:     []*schema.ToolInfo{{Name: "noop", Desc: "does nothing"}},
+	}
+	return NewEnginePool(base, cfg, idleTTL)
+}
+
+func TestEnginePool_PrimaryAndReuse(t *testing.T) {
+	p := newTestPool(t, time.Minute)
+
+	for _, ref := range []string{"", "xai/grok-4"} {
+		eng, err := p.Get(ref)
+		if err != nil {
+			t.Fatalf("Get(%q) failed: %v", ref, err)
+		}
+		if eng != p.base {
+			t.Errorf("Get(%q) should return the primary engine", ref)
+		}
+	}
+
+	first, err := p.Get("kimi-k2.5")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	second, err := p.Get("nvidia/kimi-k2.5")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if first != second {
+		t.Error("expected the same engine for equivalent model references")
+	}
+	if p.Len() != 1 {
+		t.Errorf("expected 1 pooled engine, got %d", p.Len())
+	}
+
+	derived := first.(*EinoEngine)
+	if derived.primary != (modelRef{Provider: "nvidia", Model: "kimi-k2.5"}) {
+		t.Errorf("unexpected primary model %+v", derived.primary)
+	}
+	if derived.contextWindow != 64000 {
+		t.Errorf("expected context window of the override model, got %d", derived.contextWindow)
+	}
+	if p.base.primary.Model != "grok-4" {
+		t.Error("deriving an engine must not modify the primary engine")
+	}
+}
+
+func TestEnginePool_EvictsIdle(t *testing.T) {
+	p := newTestPool(t, 20*time.Millisecond)
+
+	if _, err := p.Get("nvidia/kimi-k2.5"); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, err := p.Get("xai/grok-4-fast"); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if p.Len() != 1 {
+		t.Errorf("expected idle engine to be evicted, got %d pooled engines", p.Len())
+	}
+}
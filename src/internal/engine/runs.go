@@ -0,0 +1,255 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"miri-main/src/internal/llm"
+	"miri-main/src/internal/session"
+	"miri-main/src/internal/storage"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrRunNotFound is returned for run IDs without a checkpoint.
+	ErrRunNotFound = errors.New("run not found")
+	// ErrRunActive is returned when a run is still executing.
+	ErrRunActive = errors.New("run is still running")
+	// ErrRunWaiting is returned when a run is suspended on a question to the human,
+	// which only an answer (or its expiry) continues.
+	ErrRunWaiting = errors.New("run is waiting for a human answer")
+	// ErrRunNotWaiting is returned when answering a run that is not suspended on a
+	// question to the human.
+	ErrRunNotWaiting = errors.New("run is not waiting for an answer")
+)
+
+// defaultAskHumanTimeout is how long a run waits for the human to answer (ask_human).
+const defaultAskHumanTimeout = 24 * time.Hour
+
+// noAnswerResult replaces the ask_human result when the question expired unanswered.
+const noAnswerResult = "The human did not answer in time. Continue on your own best judgement and state the assumptions you made."
+
+// RunInfo describes an interrupted agent run that can be resumed or discarded.
+type RunInfo struct {
+	ID        string    `json:"id"`
+	SessionID string    `json:"session_id"`
+	Prompt    string    `json:"prompt"`
+	Model     string    `json:"model,omitempty"`
+	Step      int       `json:"step"`
+	LastTool  string    `json:"last_tool,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// WaitingFor is the ID of the pending human question the run is suspended on.
+	WaitingFor string `json:"waiting_for,omitempty"`
+}
+
+// activeRuns holds the IDs of runs executing in this process. Checkpoints of any
+// other run belong to a run that was interrupted (crash, restart or error).
+var activeRuns sync.Map
+
+func runInfo(st *engineState) RunInfo {
+	return RunInfo{
+		ID:         st.RunID,
+		SessionID:  st.SessionID,
+		Prompt:     st.Prompt,
+		Model:      st.Model,
+		Step:       st.Step,
+		LastTool:   st.LastTool,
+		UpdatedAt:  st.UpdatedAt,
+		WaitingFor: st.WaitingFor,
+	}
+}
+
+// startRun allocates and activates a run ID for a conversation turn. Sub-agent runs
+// and engines without a checkpoint store are not checkpointed and get no ID.
+func (e *EinoEngine) startRun(sessionID string) string {
+	if e.checkPointStore == nil || session.IsSubAgent(sessionID) {
+		return ""
+	}
+	id := uuid.NewString()
+	activeRuns.Store(id, struct{}{})
+	return id
+}
+
+// finishRun deactivates a run. The checkpoint of a successful run is removed; a
+// failed run keeps it so the run can be resumed.
+func (e *EinoEngine) finishRun(runID string, ok bool) {
+	if runID == "" {
+		return
+	}
+	activeRuns.Delete(runID)
+	if ok {
+		if err := e.checkPointStore.DeleteRun(runID); err != nil {
+			slog.Warn("failed to delete run checkpoint", "run_id", runID, "error", err)
+		}
+	}
+}
+
+// checkpointRun saves the loop state after a tool step; step is the next step to run.
+func (e *EinoEngine) checkpointRun(input *graphInput, msgs []*schema.Message, step int, lastTool string, usage llm.Usage) {
+	if input.RunID == "" {
+		return
+	}
+	e.saveRun(e.runState(input, msgs, step, lastTool, usage))
+}
+
+// suspendRun checkpoints a run that waits for the human to answer question q, asked
+// by the ask_human tool call callID.
+func (e *EinoEngine) suspendRun(input *graphInput, msgs []*schema.Message, step int, q *storage.HumanQuestion, callID string, usage llm.Usage) {
+	st := e.runState(input, msgs, step, "ask_human", usage)
+	st.WaitingFor = q.ID
+	st.WaitingCallID = callID
+	e.saveRun(st)
+}
+
+func (e *EinoEngine) runState(input *graphInput, msgs []*schema.Message, step int, lastTool string, usage llm.Usage) *engineState {
+	return &engineState{
+		RunID:     input.RunID,
+		SessionID: input.SessionID,
+		Prompt:    input.Prompt,
+		Model:     e.primary.String(),
+		Messages:  msgs,
+		Step:      step,
+		LastTool:  lastTool,
+		Usage:     usage,
+		UpdatedAt: time.Now().UTC(),
+	}
+}
+
+func (e *EinoEngine) saveRun(st *engineState) {
+	if err := e.checkPointStore.SaveRun(st); err != nil {
+		slog.Warn("failed to checkpoint run", "run_id", st.RunID, "step", st.Step, "error", err)
+	}
+}
+
+// ListRuns returns the interrupted runs and the runs waiting for a human answer,
+// most recently updated first.
+func (e *EinoEngine) ListRuns() ([]RunInfo, error) {
+	if e.checkPointStore == nil {
+		return nil, nil
+	}
+	states, err := e.checkPointStore.ListRuns()
+	if err != nil {
+		return nil, err
+	}
+	runs := make([]RunInfo, 0, len(states))
+	for _, st := range states {
+		if _, active := activeRuns.Load(st.RunID); active {
+			continue
+		}
+		runs = append(runs, runInfo(st))
+	}
+	return runs, nil
+}
+
+// GetRun returns an interrupted run.
+func (e *EinoEngine) GetRun(id string) (*RunInfo, error) {
+	if e.checkPointStore == nil {
+		return nil, errors.New("run checkpoints are not available")
+	}
+	if _, active := activeRuns.Load(id); active {
+		return nil, fmt.Errorf("run %s: %w", id, ErrRunActive)
+	}
+	st, err := e.checkPointStore.LoadRun(id)
+	if err != nil {
+		return nil, err
+	}
+	info := runInfo(st)
+	return &info, nil
+}
+
+// ResumeRun continues an interrupted run of sess from its last checkpointed step.
+func (e *EinoEngine) ResumeRun(ctx context.Context, sess *session.Session, id string) (string, *llm.Usage, error) {
+	if e.checkPointStore == nil {
+		return "", nil, errors.New("run checkpoints are not available")
+	}
+	st, err := e.checkPointStore.LoadRun(id)
+	if err != nil {
+		return "", nil, err
+	}
+	if st.SessionID != sess.ID {
+		return "", nil, fmt.Errorf("run %s belongs to session %s", id, st.SessionID)
+	}
+	if st.WaitingFor != "" {
+		return "", nil, fmt.Errorf("run %s (question %s): %w", id, st.WaitingFor, ErrRunWaiting)
+	}
+	if _, running := activeRuns.LoadOrStore(id, struct{}{}); running {
+		return "", nil, fmt.Errorf("run %s: %w", id, ErrRunActive)
+	}
+	slog.Info("Resuming agent run", "run_id", id, "session_id", sess.ID, "step", st.Step, "last_tool", st.LastTool)
+	return e.continueRun(ctx, sess, st)
+}
+
+// AnswerRun continues a run suspended on a question to the human with their answer.
+// An empty answer means the question expired unanswered; the agent is told to go on
+// without it.
+func (e *EinoEngine) AnswerRun(ctx context.Context, sess *session.Session, id, answer string) (string, *llm.Usage, error) {
+	if e.checkPointStore == nil {
+		return "", nil, errors.New("run checkpoints are not available")
+	}
+	// The run is activated before its checkpoint is loaded: a run still executing
+	// the step that asked the question has not suspended yet.
+	if _, running := activeRuns.LoadOrStore(id, struct{}{}); running {
+		return "", nil, fmt.Errorf("run %s: %w", id, ErrRunActive)
+	}
+	st, err := e.checkPointStore.LoadRun(id)
+	switch {
+	case err != nil:
+	case st.SessionID != sess.ID:
+		err = fmt.Errorf("run %s belongs to session %s", id, st.SessionID)
+	case st.WaitingFor == "":
+		err = fmt.Errorf("run %s: %w", id, ErrRunNotWaiting)
+	}
+	if err != nil {
+		activeRuns.Delete(id)
+		return "", nil, err
+	}
+	slog.Info("Answering suspended agent run", "run_id", id, "session_id", sess.ID, "question_id", st.WaitingFor, "answered", answer != "")
+
+	result := noAnswerResult
+	if answer != "" {
+		answer = e.sanitizeString(sess.ID, answer)
+		result = "The human answered: " + answer
+		// The answer is part of the conversation, like a prompt
+		if e.brain != nil {
+			e.brain.AddToBuffer(sess.ID, schema.UserMessage(answer))
+		}
+	}
+	for _, m := range st.Messages {
+		if m.Role == schema.Tool && m.ToolCallID == st.WaitingCallID {
+			m.Content = result
+		}
+	}
+	st.WaitingFor, st.WaitingCallID = "", ""
+	return e.continueRun(ctx, sess, st)
+}
+
+// continueRun runs the graph from checkpoint st; the caller has activated the run.
+func (e *EinoEngine) continueRun(ctx context.Context, sess *session.Session, st *engineState) (string, *llm.Usage, error) {
+	input := &graphInput{
+		SessionID: sess.ID,
+		Prompt:    st.Prompt,
+		CallOpts:  callOptionsFrom(ctx),
+		RunID:     st.RunID,
+		Resume:    st,
+	}
+	return e.runGraph(ctx, sess, input)
+}
+
+// DiscardRun deletes the checkpoint of an interrupted run.
+func (e *EinoEngine) DiscardRun(id string) error {
+	if e.checkPointStore == nil {
+		return errors.New("run checkpoints are not available")
+	}
+	if _, active := activeRuns.Load(id); active {
+		return fmt.Errorf("run %s: %w", id, ErrRunActive)
+	}
+	if _, err := e.checkPointStore.LoadRun(id); err != nil {
+		return err
+	}
+	return e.checkPointStore.DeleteRun(id)
+}
@@ -0,0 +1,247 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"miri-main/src/internal/engine/skills"
+	"miri-main/src/internal/llm"
+	"miri-main/src/internal/session"
+	"miri-main/src/internal/storage"
+	"miri-main/src/internal/tasks"
+	"testing"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+)
+
+// scriptedChat answers with its replies in order and records the last input.
+type scriptedChat struct {
+	replies []*schema.Message
+	calls   int
+	last    []*schema.Message
+}
+
+func (s *scriptedChat) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	if s.calls >= len(s.replies) {
+		return nil, errors.New("no more replies")
+	}
+	s.last = input
+	msg := s.replies[s.calls]
+	s.calls++
+	return msg, nil
+}
+
+func (s *scriptedChat) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	msg, err := s.Generate(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return schema.StreamReaderFromArray([]*schema.Message{msg}), nil
+}
+
+// countingTool records its calls and fails while fail is set.
+type countingTool struct {
+	name  string
+	fail  bool
+	calls int
+}
+
+func (t *countingTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{Name: t.name, Desc: t.name}, nil
+}
+
+func (t *countingTool) InvokableRun(ctx context.Context, args string, opts ...tool.Option) (string, error) {
+	t.calls++
+	if t.fail {
+		return "", errors.New("connection reset")
+	}
+	return t.name + " ok", nil
+}
+
+func toolCallMsg(id, name string) *schema.Message {
+	return schema.AssistantMessage("", []schema.ToolCall{{ID: id, Function: schema.FunctionCall{Name: name, Arguments: "{}"}}})
+}
+
+func TestRun_CheckpointAndResume(t *testing.T) {
+	store, err := NewFileCheckPointStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	search := &countingTool{name: "search"}
+	fetch := &countingTool{name: "fetch", fail: true}
+	toolsNode, err := compose.NewToolNode(context.Background(), &compose.ToolsNodeConfig{
+		Tools: []tool.BaseTool{search, fetch},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chat := &scriptedChat{replies: []*schema.Message{
+		toolCallMsg("c1", "search"),
+		toolCallMsg("c2", "fetch"),
+		toolCallMsg("c3", "fetch"),
+		schema.AssistantMessage("done", nil),
+	}}
+	e := &EinoEngine{
+		chat:            chat,
+		tools:           toolsNode,
+		maxSteps:        5,
+		checkPointStore: store,
+		skillLoader:     skills.NewSkillLoader(t.TempDir(), t.TempDir()),
+		primary:         modelRef{Provider: "xai", Model: "grok-4"},
+	}
+
+	input := &graphInput{SessionID: "miri:session:test", Prompt: "research", RunID: e.startRun("miri:session:test")}
+	if _, err := e.agentInvoke(context.Background(), input); err == nil {
+		t.Fatal("expected the run to fail at the fetch step")
+	}
+	e.finishRun(input.RunID, false)
+
+	runs, err := e.ListRuns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 {
+		t.Fatalf("expected 1 interrupted run, got %d", len(runs))
+	}
+	if runs[0].Step != 1 || runs[0].LastTool != "search" || runs[0].Model != "xai/grok-4" {
+		t.Errorf("unexpected run info %+v", runs[0])
+	}
+
+	// Resume picks up at step 1: search is not repeated, fetch is retried.
+	fetch.fail = false
+	st, err := store.LoadRun(runs[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	activeRuns.Store(st.RunID, struct{}{})
+	out, err := e.agentInvoke(context.Background(), &graphInput{SessionID: st.SessionID, Prompt: st.Prompt, RunID: st.RunID, Resume: st})
+	if err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	e.finishRun(st.RunID, true)
+
+	if out.Answer != "done" {
+		t.Errorf("answer = %q, want done", out.Answer)
+	}
+	if search.calls != 1 {
+		t.Errorf("search ran %d times, want 1", search.calls)
+	}
+	if runs, _ := e.ListRuns(); len(runs) != 0 {
+		t.Errorf("expected the finished run to be removed, got %d", len(runs))
+	}
+}
+
+func TestRun_ActiveRunsAreNotListed(t *testing.T) {
+	store, err := NewFileCheckPointStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &EinoEngine{checkPointStore: store}
+
+	id := e.startRun("miri:session:test")
+	e.checkpointRun(&graphInput{SessionID: "miri:session:test", RunID: id}, nil, 3, "fetch", llm.Usage{})
+	defer e.finishRun(id, true)
+
+	if runs, _ := e.ListRuns(); len(runs) != 0 {
+		t.Errorf("active run must not be listed as interrupted, got %d", len(runs))
+	}
+	if err := e.DiscardRun(id); !errors.Is(err, ErrRunActive) {
+		t.Errorf("DiscardRun of active run: got %v, want ErrRunActive", err)
+	}
+	// An answer arriving before the run suspends finds it active, not unwilling.
+	sess := &session.Session{ID: "miri:session:test"}
+	if _, _, err := e.AnswerRun(context.Background(), sess, id, "Zurich"); !errors.Is(err, ErrRunActive) {
+		t.Errorf("AnswerRun of active run: got %v, want ErrRunActive", err)
+	}
+	if _, err := e.GetRun("missing"); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("GetRun of unknown run: got %v, want ErrRunNotFound", err)
+	}
+	if id := e.startRun("subagent-123"); id != "" {
+		t.Error("sub-agent runs must not be checkpointed")
+	}
+}
+
+// humanGateway files questions in memory.
+type humanGateway struct {
+	asked []*storage.HumanQuestion
+}
+
+func (g *humanGateway) AskHuman(q *storage.HumanQuestion) error {
+	g.asked = append(g.asked, q)
+	return nil
+}
+
+func (g *humanGateway) AddTask(t *tasks.Task) error                  { return nil }
+func (g *humanGateway) DeleteTask(id string) error                   { return nil }
+func (g *humanGateway) ListTasks() ([]*tasks.Task, error)            { return nil, nil }
+func (g *humanGateway) GetTask(id string) (*tasks.Task, error)       { return nil, nil }
+func (g *humanGateway) ChannelSendFile(c, d, path, cap string) error { return nil }
+func (g *humanGateway) InstallSkill(ctx context.Context, name string) (string, error) {
+	return "", nil
+}
+
+func TestRun_AskHumanSuspendsUntilAnswered(t *testing.T) {
+	store, err := NewFileCheckPointStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	toolsNode, err := compose.NewToolNode(context.Background(), &compose.ToolsNodeConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ask := toolCallMsg("c1", "ask_human")
+	ask.ToolCalls[0].Function.Arguments = `{"question":"Which city should I book?"}`
+	chat := &scriptedChat{replies: []*schema.Message{ask, schema.AssistantMessage("Booked Zurich", nil)}}
+	gw := &humanGateway{}
+	e := &EinoEngine{
+		chat:            chat,
+		tools:           toolsNode,
+		maxSteps:        5,
+		checkPointStore: store,
+		skillLoader:     skills.NewSkillLoader(t.TempDir(), t.TempDir()),
+		taskGateway:     gw,
+		askHumanTimeout: defaultAskHumanTimeout,
+		primary:         modelRef{Provider: "xai", Model: "grok-4"},
+	}
+	if err := e.buildGraph(); err != nil {
+		t.Fatal(err)
+	}
+	sess := &session.Session{ID: "miri:session:test"}
+
+	input := &graphInput{SessionID: sess.ID, Prompt: "book a hotel", RunID: e.startRun(sess.ID)}
+	answer, _, err := e.runGraph(context.Background(), sess, input)
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if answer != "Which city should I book?" {
+		t.Errorf("answer = %q, want the question", answer)
+	}
+	if len(gw.asked) != 1 || gw.asked[0].RunID != input.RunID || gw.asked[0].Status != storage.HumanQuestionPending {
+		t.Fatalf("expected one pending question for the run, got %+v", gw.asked)
+	}
+
+	runs, _ := e.ListRuns()
+	if len(runs) != 1 || runs[0].WaitingFor != gw.asked[0].ID {
+		t.Fatalf("expected the run to wait for the question, got %+v", runs)
+	}
+	if _, _, err := e.ResumeRun(context.Background(), sess, input.RunID); !errors.Is(err, ErrRunWaiting) {
+		t.Errorf("ResumeRun of waiting run: got %v, want ErrRunWaiting", err)
+	}
+
+	answer, _, err = e.AnswerRun(context.Background(), sess, input.RunID, "Zurich")
+	if err != nil {
+		t.Fatalf("AnswerRun failed: %v", err)
+	}
+	if answer != "Booked Zurich" {
+		t.Errorf("answer = %q, want Booked Zurich", answer)
+	}
+	last := chat.last[len(chat.last)-1]
+	if last.Role != schema.Tool || last.ToolCallID != "c1" || last.Content != "The human answered: Zurich" {
+		t.Errorf("expected the answer as ask_human result, got %+v", last)
+	}
+	if runs, _ := e.ListRuns(); len(runs) != 0 {
+		t.Errorf("expected the answered run to finish, got %d", len(runs))
+	}
+}
@@ -42,7 +42,10 @@ func getInstruction(st *storage.Storage, role string) string {
 	return strings.TrimSpace(string(data))
 }
 
-func BuildSubAgentTools(ctx context.Context, chatModel model.BaseChatModel, storageDir string, st *storage.Storage) []einotool.BaseTool {
+// extra holds further tools by lower-case role, such as those of MCP servers.
+// wrap, if not nil, wraps every tool of the sub-agents, e.g. to hold their calls
+// back for approval.
+func BuildSubAgentTools(ctx context.Context, chatModel model.BaseChatModel, storageDir string, st *storage.Storage, extra map[string][]einotool.BaseTool, wrap func(einotool.BaseTool) einotool.BaseTool) []einotool.BaseTool {
 	// Sync subagent prompts from templates to storage
 	templateDir := filepath.Join(system.GetProjectRoot(), "templates", "subagents")
 	if err := st.SyncSubAgentPrompts(templateDir); err != nil {
@@ -68,6 +71,16 @@ func BuildSubAgentTools(ctx context.Context, chatModel model.BaseChatModel, stor
 		&tools.SearchToolWrapper{},
 		&tools.FetchToolWrapper{},
 	}
+	researcherTools = append(researcherTools, extra["researcher"]...)
+	coderTools = append(coderTools, extra["coder"]...)
+	reviewerTools = append(reviewerTools, extra["reviewer"]...)
+	if wrap != nil {
+		for _, ts := range [][]einotool.BaseTool{researcherTools, coderTools, reviewerTools} {
+			for i, t := range ts {
+				ts[i] = wrap(t)
+			}
+		}
+	}
 
 	innerResearcher := &SubAgentTool{
 		name: "Researcher",
@@ -240,6 +253,7 @@ func (w *LoggingWrapper) InvokableRun(ctx context.Context, argumentsInJSON strin
 	go func(opts ...einotool.Option) {
 		execCtx, execCancel := context.WithTimeout(context.Background(), w.timeout)
 		defer execCancel()
+		execCtx = context.WithValue(execCtx, parentSessionKey, parentSession)
 		invoker, ok := w.tool.(einotool.InvokableTool)
 		if !ok {
 			finishTime := time.Now().UTC().Format(time.RFC3339)
@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// Token costs the estimator adds on top of the text.
+const (
+	messageOverheadTokens  = 4    // role and framing of a chat message
+	toolCallOverheadTokens = 8    // id, type and name framing of a tool call
+	mediaPartTokens        = 1000 // image, audio or video part of a message
+	defaultCharsPerToken   = 3.2
+)
+
+// tokenRatios are the characters per token of English text and code for model
+// families, matched in order against the lower-cased model name.
+var tokenRatios = []struct {
+	family string
+	chars  float64
+}{
+	{"gpt-4o", 4.0},
+	{"gpt-4.1", 4.0},
+	{"gpt-5", 4.0},
+	{"gpt", 3.7},
+	{"gemini", 3.8},
+	{"grok", 3.6},
+	{"llama", 3.6},
+	{"nemotron", 3.6},
+	{"claude", 3.5},
+	{"mistral", 3.4},
+	{"qwen", 3.4},
+	{"deepseek", 3.4},
+	{"kimi", 3.4},
+}
+
+// tokenEstimator approximates the tokenizer of a model without loading it. ASCII
+// text is counted in characters per token of the model family and any other rune
+// as a token of its own, which errs on the side of too many tokens.
+type tokenEstimator struct {
+	charsPerToken float64
+}
+
+func newTokenEstimator(modelName string) tokenEstimator {
+	name := strings.ToLower(modelName)
+	for _, r := range tokenRatios {
+		if strings.Contains(name, r.family) {
+			return tokenEstimator{charsPerToken: r.chars}
+		}
+	}
+	return tokenEstimator{charsPerToken: defaultCharsPerToken}
+}
+
+// text returns the estimated tokens of s.
+func (t tokenEstimator) text(s string) int {
+	if s == "" {
+		return 0
+	}
+	ascii, other := 0, 0
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	ratio := t.charsPerToken
+	if ratio <= 0 {
+		ratio = defaultCharsPerToken
+	}
+	return int(math.Ceil(float64(ascii)/ratio)) + other
+}
+
+// message returns the estimated tokens of a chat message, tool calls included.
+func (t tokenEstimator) message(m *schema.Message) int {
+	n := messageOverheadTokens + t.text(m.Content) + t.text(m.ReasoningContent)
+	for _, tc := range m.ToolCalls {
+		n += toolCallOverheadTokens + t.text(tc.Function.Name) + t.text(tc.Function.Arguments)
+	}
+	for _, p := range m.MultiContent {
+		if p.Type == schema.ChatMessagePartTypeText {
+			n += t.text(p.Text)
+		} else {
+			n += mediaPartTokens
+		}
+	}
+	for _, p := range m.UserInputMultiContent {
+		if p.Type == schema.ChatMessagePartTypeText {
+			n += t.text(p.Text)
+		} else {
+			n += mediaPartTokens
+		}
+	}
+	return n
+}
+
+// messages returns the estimated tokens of msgs.
+func (t tokenEstimator) messages(msgs []*schema.Message) int {
+	n := 0
+	for _, m := range msgs {
+		n += t.message(m)
+	}
+	return n
+}
+
+// tools returns the estimated tokens of the tool definitions sent with every call.
+func (t tokenEstimator) tools(infos []*schema.ToolInfo) int {
+	n := 0
+	for _, info := range infos {
+		if info == nil {
+			continue
+		}
+		n += toolCallOverheadTokens + t.text(info.Name) + t.text(info.Desc)
+		if info.ParamsOneOf == nil {
+			continue
+		}
+		if js, err := info.ParamsOneOf.ToJSONSchema(); err == nil && js != nil {
+			if data, err := json.Marshal(js); err == nil {
+				n += t.text(string(data))
+			}
+		}
+	}
+	return n
+}
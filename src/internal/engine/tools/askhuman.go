@@ -0,0 +1,89 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"miri-main/src/internal/storage"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+)
+
+// HumanGateway files questions for the human and notifies the session they came from.
+type HumanGateway interface {
+	AskHuman(q *storage.HumanQuestion) error
+}
+
+// AskHumanToolWrapper lets the agent ask the human a question mid-run. The question
+// is filed as pending and the engine suspends the run until it is answered or expires.
+// Without a gateway or a resumable run the tool tells the agent to decide on its own.
+type AskHumanToolWrapper struct {
+	gw        HumanGateway
+	sessionID string
+	runID     string
+	timeout   time.Duration
+	asked     *storage.HumanQuestion
+}
+
+func NewAskHumanTool(gw HumanGateway, sessionID, runID string, timeout time.Duration) *AskHumanToolWrapper {
+	return &AskHumanToolWrapper{gw: gw, sessionID: sessionID, runID: runID, timeout: timeout}
+}
+
+func (a *AskHumanToolWrapper) GetInfo() *schema.ToolInfo {
+	return &schema.ToolInfo{
+		Name: "ask_human",
+		Desc: "Ask the human a question and wait for the answer. Use it when you need a decision, a preference or information only the human has, instead of guessing. The run pauses until the human answers; if they do not answer in time you continue on your own best judgement.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"question": {
+				Type:     schema.String,
+				Desc:     "The question, self-contained and answerable without further context",
+				Required: true,
+			},
+		}),
+	}
+}
+
+func (a *AskHumanToolWrapper) Info(_ context.Context) (*schema.ToolInfo, error) {
+	return a.GetInfo(), nil
+}
+
+func (a *AskHumanToolWrapper) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	var args struct {
+		Question string `json:"question"`
+	}
+	if err := json.Unmarshal([]byte(argumentsInJSON), &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	question := strings.TrimSpace(args.Question)
+	if question == "" {
+		return "", fmt.Errorf("question is required")
+	}
+	if a.gw == nil || a.runID == "" {
+		return "The human cannot be asked from this run. Continue on your own best judgement and state the assumptions you made.", nil
+	}
+
+	now := time.Now().UTC()
+	q := &storage.HumanQuestion{
+		ID:        uuid.NewString(),
+		Status:    storage.HumanQuestionPending,
+		Question:  question,
+		SessionID: a.sessionID,
+		RunID:     a.runID,
+		Created:   now,
+		ExpiresAt: now.Add(a.timeout),
+	}
+	if err := a.gw.AskHuman(q); err != nil {
+		return "", fmt.Errorf("failed to ask the human: %w", err)
+	}
+	a.asked = q
+	return "Waiting for the human to answer.", nil
+}
+
+// Asked returns the question filed by the last successful call, if any.
+func (a *AskHumanToolWrapper) Asked() *storage.HumanQuestion {
+	return a.asked
+}
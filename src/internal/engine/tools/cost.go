@@ -0,0 +1,40 @@
+package tools
+
+import (
+	"context"
+	"sync"
+)
+
+// CostMeter sums what paid tool calls (generate_image) cost during an agent run,
+// so the run's usage includes it next to the model tokens.
+type CostMeter struct {
+	mu    sync.Mutex
+	total float64
+}
+
+// Take returns the cost added since the last call.
+func (m *CostMeter) Take() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	total := m.total
+	m.total = 0
+	return total
+}
+
+type costMeterKey struct{}
+
+// WithCostMeter makes m collect the cost of the tool calls made with ctx.
+func WithCostMeter(ctx context.Context, m *CostMeter) context.Context {
+	return context.WithValue(ctx, costMeterKey{}, m)
+}
+
+// AddCost adds cost to the meter of ctx, if any.
+func AddCost(ctx context.Context, cost float64) {
+	m, _ := ctx.Value(costMeterKey{}).(*CostMeter)
+	if m == nil || cost == 0 {
+		return
+	}
+	m.mu.Lock()
+	m.total += cost
+	m.mu.Unlock()
+}
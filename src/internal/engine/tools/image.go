@@ -0,0 +1,140 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+
+	"miri-main/src/internal/llm"
+)
+
+// maxImagesPerCall caps the n argument of generate_image.
+const maxImagesPerCall = 4
+
+// ImageGenerateFunc generates n images of prompt.
+type ImageGenerateFunc func(ctx context.Context, prompt string, n int) ([]llm.GeneratedImage, error)
+
+// ImageGenToolWrapper is the generate_image tool. Images are saved into
+// <storage>/generated, from where file_manager shares them.
+type ImageGenToolWrapper struct {
+	StorageDir string
+	Model      string
+	// CostPerImage is charged for every generated image (the model's cost.output).
+	CostPerImage float64
+	generate     ImageGenerateFunc
+}
+
+func NewImageGenTool(storageDir, model string, costPerImage float64, generate ImageGenerateFunc) *ImageGenToolWrapper {
+	return &ImageGenToolWrapper{StorageDir: storageDir, Model: model, CostPerImage: costPerImage, generate: generate}
+}
+
+func (g *ImageGenToolWrapper) GetInfo() *schema.ToolInfo {
+	return &schema.ToolInfo{
+		Name: "generate_image",
+		Desc: "Generate images from a text description. The images are saved in generated/; share them with file_manager (action 'share') to send them to the user.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"prompt": {
+				Type:     schema.String,
+				Desc:     "Detailed description of the image to generate",
+				Required: true,
+			},
+			"n": {
+				Type:     schema.Integer,
+				Desc:     fmt.Sprintf("Number of images to generate (1-%d, default 1)", maxImagesPerCall),
+				Required: false,
+			},
+		}),
+	}
+}
+
+func (g *ImageGenToolWrapper) Info(_ context.Context) (*schema.ToolInfo, error) {
+	return g.GetInfo(), nil
+}
+
+func (g *ImageGenToolWrapper) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	var args struct {
+		Prompt string `json:"prompt"`
+		N      int    `json:"n"`
+	}
+	if err := json.Unmarshal([]byte(argumentsInJSON), &args); err != nil {
+		slog.Error("failed to unmarshal generate_image arguments", "error", err, "input", argumentsInJSON)
+		return "", err
+	}
+	if strings.TrimSpace(args.Prompt) == "" {
+		return "", fmt.Errorf("prompt is required")
+	}
+	args.N = min(max(args.N, 1), maxImagesPerCall)
+
+	images, err := g.generate(ctx, args.Prompt, args.N)
+	if err != nil {
+		slog.Error("image generation failed", "model", g.Model, "error", err)
+		return "", err
+	}
+	cost := float64(len(images)) * g.CostPerImage
+	AddCost(ctx, cost)
+
+	storageDir := g.StorageDir
+	if strings.HasPrefix(storageDir, "~") {
+		home, _ := os.UserHomeDir()
+		storageDir = filepath.Join(home, storageDir[1:])
+	}
+	genDir := filepath.Join(storageDir, "generated")
+	if err := os.MkdirAll(genDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create generated directory: %w", err)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Generated %d image(s) with %s (cost $%.4f):\n", len(images), g.Model, cost)
+	base := fmt.Sprintf("%s-%s", time.Now().Format("20060102-150405"), imageSlug(args.Prompt))
+	for i, img := range images {
+		name := fmt.Sprintf("%s-%d%s", base, i+1, imageExt(img.Data))
+		if err := os.WriteFile(filepath.Join(genDir, name), img.Data, 0644); err != nil {
+			return "", fmt.Errorf("failed to save image: %w", err)
+		}
+		slog.Info("generated image saved", "model", g.Model, "path", filepath.Join(genDir, name), "bytes", len(img.Data))
+		fmt.Fprintf(&sb, "- generated/%s (download: /api/v1/files/generated/%s)\n", name, name)
+		if img.RevisedPrompt != "" {
+			fmt.Fprintf(&sb, "  revised prompt: %s\n", img.RevisedPrompt)
+		}
+	}
+	sb.WriteString("Use file_manager with action 'share' and the path above to send an image to the user.")
+	return sb.String(), nil
+}
+
+var slugRegex = regexp.MustCompile(`[^a-z0-9]+`)
+
+// imageSlug turns the start of a prompt into a file name part.
+func imageSlug(prompt string) string {
+	slug := strings.Trim(slugRegex.ReplaceAllString(strings.ToLower(prompt), "-"), "-")
+	if len(slug) > 40 {
+		slug = strings.TrimRight(slug[:40], "-")
+	}
+	if slug == "" {
+		slug = "image"
+	}
+	return slug
+}
+
+// imageExt returns the file extension of image data.
+func imageExt(data []byte) string {
+	switch http.DetectContentType(data) {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	default:
+		return ".png"
+	}
+}
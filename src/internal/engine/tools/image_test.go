@@ -0,0 +1,60 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"miri-main/src/internal/llm"
+)
+
+func TestImageGenTool(t *testing.T) {
+	dir := t.TempDir()
+	var gotN int
+	gen := func(ctx context.Context, prompt string, n int) ([]llm.GeneratedImage, error) {
+		gotN = n
+		return []llm.GeneratedImage{
+			{Data: []byte("\x89PNG\r\n\x1a\n....")},
+			{Data: []byte("\xff\xd8\xff\xe0....JFIF"), RevisedPrompt: "a sunset over the sea"},
+		}, nil
+	}
+	tool := NewImageGenTool(dir, "xai/grok-2-image-1212", 0.07, gen)
+
+	meter := &CostMeter{}
+	res, err := tool.InvokableRun(WithCostMeter(context.Background(), meter), `{"prompt":"Sunset over the sea!","n":9}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotN != maxImagesPerCall {
+		t.Errorf("expected n capped at %d, got %d", maxImagesPerCall, gotN)
+	}
+	if cost := meter.Take(); cost < 0.1399 || cost > 0.1401 {
+		t.Errorf("expected cost 0.14, got %f", cost)
+	}
+	if meter.Take() != 0 {
+		t.Error("Take should reset the meter")
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "generated"))
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("expected 2 saved images, got %v (%v)", entries, err)
+	}
+	for i, ext := range []string{"-1.png", "-2.jpg"} {
+		name := entries[i].Name()
+		if !strings.HasSuffix(name, "sunset-over-the-sea"+ext) {
+			t.Errorf("unexpected file name %s", name)
+		}
+		if !strings.Contains(res, "generated/"+name) {
+			t.Errorf("result does not mention %s: %s", name, res)
+		}
+	}
+	if !strings.Contains(res, "revised prompt: a sunset over the sea") || !strings.Contains(res, "file_manager") {
+		t.Errorf("unexpected result: %s", res)
+	}
+
+	if _, err := tool.InvokableRun(context.Background(), `{"prompt":"  "}`); err == nil {
+		t.Error("expected an error for an empty prompt")
+	}
+}
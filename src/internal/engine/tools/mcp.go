@@ -0,0 +1,308 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+	"github.com/eino-contrib/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"miri-main/src/internal/config"
+)
+
+// defaultMCPTimeout bounds connecting to an MCP server and, unless configured
+// otherwise, each of its tool calls.
+const defaultMCPTimeout = 60 * time.Second
+
+// MCPServer is an external MCP server whose tools are mounted as "<server>__<tool>".
+// It connects on first use and reconnects after the connection is lost.
+type MCPServer struct {
+	name string
+	cfg  config.MCPServerConfig
+
+	mu      sync.Mutex
+	session *mcp.ClientSession
+	calls   int  // calls in flight
+	retired bool // close the connection once idle
+}
+
+// NewMCPServer returns the server name configured by cfg, not yet connected.
+func NewMCPServer(name string, cfg config.MCPServerConfig) *MCPServer {
+	return &MCPServer{name: name, cfg: cfg}
+}
+
+// Name returns the configured name of the server.
+func (s *MCPServer) Name() string {
+	return s.name
+}
+
+// Config returns the configuration of the server.
+func (s *MCPServer) Config() config.MCPServerConfig {
+	return s.cfg
+}
+
+func (s *MCPServer) transport() (mcp.Transport, error) {
+	switch {
+	case s.cfg.Command != "" && s.cfg.URL != "":
+		return nil, fmt.Errorf("mcp server %s: only one of command and url may be set", s.name)
+	case s.cfg.Command != "":
+		cmd := exec.Command(s.cfg.Command, s.cfg.Args...)
+		cmd.Env = os.Environ()
+		for k, v := range s.cfg.Env {
+			// The config loader lower-cases map keys.
+			cmd.Env = append(cmd.Env, strings.ToUpper(k)+"="+os.ExpandEnv(v))
+		}
+		cmd.Stderr = os.Stderr
+		return &mcp.CommandTransport{Command: cmd}, nil
+	case s.cfg.URL != "":
+		client := &http.Client{}
+		if len(s.cfg.Headers) > 0 {
+			client.Transport = &headerTransport{headers: s.cfg.Headers, next: http.DefaultTransport}
+		}
+		return &mcp.StreamableClientTransport{Endpoint: s.cfg.URL, HTTPClient: client}, nil
+	default:
+		return nil, fmt.Errorf("mcp server %s: command or url is required", s.name)
+	}
+}
+
+// connect returns the session of the server, connecting if needed.
+func (s *MCPServer) connect(ctx context.Context) (*mcp.ClientSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.session != nil {
+		return s.session, nil
+	}
+	t, err := s.transport()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, defaultMCPTimeout)
+	defer cancel()
+	client := mcp.NewClient(&mcp.Implementation{Name: "miri", Version: "1.0"}, nil)
+	session, err := client.Connect(ctx, t, nil)
+	if err != nil {
+		return nil, fmt.Errorf("connect to mcp server %s: %w", s.name, err)
+	}
+	slog.Info("connected to mcp server", "server", s.name)
+	s.session = session
+	return session, nil
+}
+
+// drop forgets session after it failed, so the next call reconnects.
+func (s *MCPServer) drop(session *mcp.ClientSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.session == session {
+		s.session = nil
+		_ = session.Close()
+	}
+}
+
+// Close closes the connection to the server, stopping its subprocess.
+func (s *MCPServer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeLocked()
+}
+
+func (s *MCPServer) closeLocked() error {
+	if s.session == nil {
+		return nil
+	}
+	err := s.session.Close()
+	s.session = nil
+	return err
+}
+
+// Retire closes the connection to the server once no call is in flight, and
+// again after each later call, so a replaced server does not keep its
+// subprocess running for the engines that still hold its tools.
+func (s *MCPServer) Retire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retired = true
+	if s.calls == 0 {
+		if err := s.closeLocked(); err != nil {
+			slog.Warn("failed to close retired mcp server", "server", s.name, "error", err)
+		}
+	}
+}
+
+// begin counts a call in flight until the returned func is called.
+func (s *MCPServer) begin() func() {
+	s.mu.Lock()
+	s.calls++
+	s.mu.Unlock()
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.calls--
+		if s.retired && s.calls == 0 {
+			if err := s.closeLocked(); err != nil {
+				slog.Warn("failed to close retired mcp server", "server", s.name, "error", err)
+			}
+		}
+	}
+}
+
+// Tools lists the tools of the server, limited to the configured ones.
+func (s *MCPServer) Tools(ctx context.Context) ([]*MCPTool, error) {
+	defer s.begin()()
+	session, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out []*MCPTool
+	for t, err := range session.Tools(ctx, nil) {
+		if err != nil {
+			s.drop(session)
+			return nil, fmt.Errorf("list tools of mcp server %s: %w", s.name, err)
+		}
+		if len(s.cfg.Tools) > 0 && !slices.Contains(s.cfg.Tools, t.Name) {
+			continue
+		}
+		out = append(out, s.newTool(t))
+	}
+	return out, nil
+}
+
+var mcpNameRegex = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// MCPToolName is the name a tool of an MCP server is mounted as.
+func MCPToolName(server, name string) string {
+	full := mcpNameRegex.ReplaceAllString(server, "_") + "__" + mcpNameRegex.ReplaceAllString(name, "_")
+	if len(full) > 64 {
+		full = full[:64]
+	}
+	return full
+}
+
+func (s *MCPServer) newTool(t *mcp.Tool) *MCPTool {
+	params := &jsonschema.Schema{Type: "object"}
+	if t.InputSchema != nil {
+		if b, err := json.Marshal(t.InputSchema); err == nil {
+			var parsed jsonschema.Schema
+			if err := json.Unmarshal(b, &parsed); err == nil {
+				params = &parsed
+			} else {
+				slog.Warn("mcp tool has an invalid input schema, offering it without parameters", "server", s.name, "tool", t.Name, "error", err)
+			}
+		}
+	}
+	desc := t.Description
+	if desc == "" {
+		desc = t.Title
+	}
+	return &MCPTool{
+		server: s,
+		name:   t.Name,
+		info: &schema.ToolInfo{
+			Name:        MCPToolName(s.name, t.Name),
+			Desc:        fmt.Sprintf("[MCP server %s] %s", s.name, desc),
+			ParamsOneOf: schema.NewParamsOneOfByJSONSchema(params),
+		},
+	}
+}
+
+// MCPTool is a tool of an MCP server.
+type MCPTool struct {
+	server *MCPServer
+	name   string
+	info   *schema.ToolInfo
+}
+
+func (t *MCPTool) GetInfo() *schema.ToolInfo {
+	return t.info
+}
+
+func (t *MCPTool) Info(_ context.Context) (*schema.ToolInfo, error) {
+	return t.info, nil
+}
+
+// InvokableRun calls the tool on its server. Failed calls are reported to the
+// model in the result.
+func (t *MCPTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	if strings.TrimSpace(argumentsInJSON) == "" {
+		argumentsInJSON = "{}"
+	}
+	timeout := defaultMCPTimeout
+	if secs := t.server.cfg.TimeoutSeconds; secs > 0 {
+		timeout = time.Duration(secs) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	defer t.server.begin()()
+
+	session, err := t.server.connect(ctx)
+	if err != nil {
+		return dynamicError(err), nil
+	}
+	slog.Info("mcp tool: calling", "server", t.server.name, "tool", t.name)
+	res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: t.name, Arguments: json.RawMessage(argumentsInJSON)})
+	if err != nil {
+		if ctx.Err() == nil {
+			t.server.drop(session)
+		}
+		return dynamicError(fmt.Errorf("mcp tool %s: %w", t.info.Name, err)), nil
+	}
+	out := mcpResultText(res)
+	if res.IsError {
+		return "Error: " + out, nil
+	}
+	return out, nil
+}
+
+// mcpResultText renders the content of a tool result as text for the model.
+func mcpResultText(res *mcp.CallToolResult) string {
+	var parts []string
+	for _, c := range res.Content {
+		switch c := c.(type) {
+		case *mcp.TextContent:
+			parts = append(parts, c.Text)
+		case *mcp.ImageContent:
+			parts = append(parts, fmt.Sprintf("[image %s, %d bytes]", c.MIMEType, len(c.Data)))
+		case *mcp.AudioContent:
+			parts = append(parts, fmt.Sprintf("[audio %s, %d bytes]", c.MIMEType, len(c.Data)))
+		case *mcp.ResourceLink:
+			parts = append(parts, fmt.Sprintf("[resource %s: %s]", c.Name, c.URI))
+		case *mcp.EmbeddedResource:
+			if c.Resource != nil && c.Resource.Text != "" {
+				parts = append(parts, c.Resource.Text)
+			} else if c.Resource != nil {
+				parts = append(parts, fmt.Sprintf("[resource %s]", c.Resource.URI))
+			}
+		}
+	}
+	if len(parts) == 0 && res.StructuredContent != nil {
+		if b, err := json.Marshal(res.StructuredContent); err == nil {
+			parts = append(parts, string(b))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// headerTransport adds the configured headers to the requests to an MCP server.
+type headerTransport struct {
+	headers map[string]string
+	next    http.RoundTripper
+}
+
+func (h *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range h.headers {
+		req.Header.Set(k, os.ExpandEnv(v))
+	}
+	return h.next.RoundTrip(req)
+}
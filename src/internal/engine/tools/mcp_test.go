@@ -0,0 +1,150 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"miri-main/src/internal/config"
+)
+
+type greetArgs struct {
+	Name string `json:"name" jsonschema:"who to greet"`
+}
+
+func newTestMCPServer(t *testing.T, auth *atomic.Value) *httptest.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "test", Version: "1.0"}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "greet", Description: "Greets someone"},
+		func(ctx context.Context, req *mcp.CallToolRequest, args greetArgs) (*mcp.CallToolResult, any, error) {
+			if args.Name == "" {
+				return nil, nil, fmt.Errorf("name is required")
+			}
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "Hello, " + args.Name}}}, nil, nil
+		})
+	mcp.AddTool(server, &mcp.Tool{Name: "farewell.say"},
+		func(ctx context.Context, req *mcp.CallToolRequest, args struct{}) (*mcp.CallToolResult, any, error) {
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "Bye"}}}, nil, nil
+		})
+	handler := mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return server }, nil)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth.Store(r.Header.Get("Authorization"))
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestMCPServer_HTTP(t *testing.T) {
+	t.Setenv("MIRI_TEST_MCP_TOKEN", "s3cret")
+	var auth atomic.Value
+	srv := newTestMCPServer(t, &auth)
+
+	s := NewMCPServer("my-server", config.MCPServerConfig{
+		URL:     srv.URL,
+		Headers: map[string]string{"Authorization": "Bearer $MIRI_TEST_MCP_TOKEN"},
+	})
+	defer s.Close()
+
+	ctx := context.Background()
+	tools, err := s.Tools(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := auth.Load(); got != "Bearer s3cret" {
+		t.Errorf("expected the configured header, got %v", got)
+	}
+	names := map[string]*MCPTool{}
+	for _, tl := range tools {
+		names[tl.GetInfo().Name] = tl
+	}
+	greet := names["my-server__greet"]
+	if greet == nil || names["my-server__farewell_say"] == nil {
+		t.Fatalf("expected namespaced tools, got %v", names)
+	}
+	if !strings.Contains(greet.GetInfo().Desc, "Greets someone") {
+		t.Errorf("unexpected description %q", greet.GetInfo().Desc)
+	}
+	js, err := greet.GetInfo().ParamsOneOf.ToJSONSchema()
+	if err != nil || js.Properties == nil {
+		t.Fatalf("expected the input schema converted, got %+v, %v", js, err)
+	}
+	if prop, ok := js.Properties.Get("name"); !ok || prop.Description != "who to greet" {
+		t.Errorf("expected the name parameter, got %+v", prop)
+	}
+
+	out, err := greet.InvokableRun(ctx, `{"name":"Bob"}`)
+	if err != nil || out != "Hello, Bob" {
+		t.Errorf("InvokableRun = %q, %v", out, err)
+	}
+	out, err = greet.InvokableRun(ctx, `{}`)
+	if err != nil || !strings.HasPrefix(out, "Error: ") {
+		t.Errorf("expected the tool error in the result, got %q, %v", out, err)
+	}
+
+	// A configured tool list limits the mounted tools.
+	limited := NewMCPServer("my-server", config.MCPServerConfig{URL: srv.URL, Tools: []string{"greet"}})
+	defer limited.Close()
+	if tools, err := limited.Tools(ctx); err != nil || len(tools) != 1 {
+		t.Errorf("expected only greet, got %d tools (%v)", len(tools), err)
+	}
+}
+
+func TestMCPServer_InvalidConfig(t *testing.T) {
+	if _, err := NewMCPServer("none", config.MCPServerConfig{}).Tools(context.Background()); err == nil {
+		t.Error("expected an error without command and url")
+	}
+	if _, err := NewMCPServer("both", config.MCPServerConfig{Command: "cat", URL: "http://localhost"}).Tools(context.Background()); err == nil {
+		t.Error("expected an error with both command and url")
+	}
+}
+
+func TestMCPServer_Retire(t *testing.T) {
+	var auth atomic.Value
+	srv := newTestMCPServer(t, &auth)
+	ctx := context.Background()
+
+	// An idle server is closed right away.
+	idle := NewMCPServer("idle", config.MCPServerConfig{URL: srv.URL})
+	if _, err := idle.Tools(ctx); err != nil {
+		t.Fatal(err)
+	}
+	idle.Retire()
+	if idle.session != nil {
+		t.Error("expected the idle server closed")
+	}
+
+	// A busy server is closed after its last call.
+	s := NewMCPServer("busy", config.MCPServerConfig{URL: srv.URL})
+	tools, err := s.Tools(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	end := s.begin()
+	s.Retire()
+	if s.session == nil {
+		t.Fatal("expected the server kept open during a call")
+	}
+	end()
+	if s.session != nil {
+		t.Error("expected the server closed after the call")
+	}
+
+	// Engines still holding its tools can call them, and it is closed again.
+	for _, tl := range tools {
+		if tl.GetInfo().Name != "busy__greet" {
+			continue
+		}
+		if out, err := tl.InvokableRun(ctx, `{"name":"Bob"}`); err != nil || out != "Hello, Bob" {
+			t.Errorf("InvokableRun = %q, %v", out, err)
+		}
+	}
+	if s.session != nil {
+		t.Error("expected the server closed after the later call")
+	}
+}
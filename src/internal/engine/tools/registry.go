@@ -1,70 +1,357 @@
 package tools
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"text/template"
+	"time"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+	"github.com/eino-contrib/jsonschema"
 )
 
-type ToolFunc func(context.Context, map[string]any) (any, error)
+// DynamicToolDef is a tool declared in <storage_dir>/tools/*.json. Exactly one of
+// Command and HTTP is set; their templates reference the arguments as {{.name}}.
+type DynamicToolDef struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Parameters is the JSON schema of the arguments, an object schema.
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+	// Command is the shell command run in the sandbox; arguments are shell-quoted.
+	Command string `json:"command,omitempty"`
+	// Fn is the former name of Command.
+	Fn   string           `json:"fn,omitempty"`
+	HTTP *DynamicHTTPCall `json:"http,omitempty"`
+}
+
+// DynamicHTTPCall is the HTTP request of a dynamic tool.
+type DynamicHTTPCall struct {
+	// Method defaults to GET.
+	Method string `json:"method,omitempty"`
+	// URL is a template whose arguments are query-escaped.
+	URL string `json:"url"`
+	// Headers values may reference environment variables as $VAR or ${VAR}.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Body is a template whose arguments are JSON-encoded.
+	Body string `json:"body,omitempty"`
+}
+
+// DynamicTool runs a DynamicToolDef.
+type DynamicTool struct {
+	def      DynamicToolDef
+	info     *schema.ToolInfo
+	params   []string
+	required []string
+	command  *template.Template
+	url      *template.Template
+	body     *template.Template
+	sandbox  *CmdToolWrapper
+	client   *http.Client
+}
+
+var dynamicToolNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// maxDynamicHTTPBody bounds the response body returned to the model.
+const maxDynamicHTTPBody = 64 * 1024
+
+// NewDynamicTool validates def and compiles its templates. Commands run in
+// sandboxDir like those of execute_command.
+func NewDynamicTool(def DynamicToolDef, sandboxDir string) (*DynamicTool, error) {
+	if !dynamicToolNameRegex.MatchString(def.Name) {
+		return nil, fmt.Errorf("invalid tool name %q", def.Name)
+	}
+	if def.Command == "" {
+		def.Command = def.Fn
+	}
+	if (def.Command == "") == (def.HTTP == nil) {
+		return nil, fmt.Errorf("tool %s: exactly one of command and http must be set", def.Name)
+	}
+
+	t := &DynamicTool{def: def}
+	params := &jsonschema.Schema{Type: "object"}
+	if len(def.Parameters) > 0 {
+		if err := json.Unmarshal(def.Parameters, params); err != nil {
+			return nil, fmt.Errorf("tool %s: invalid parameters schema: %w", def.Name, err)
+		}
+		if params.Type != "object" {
+			return nil, fmt.Errorf("tool %s: parameters must be an object schema", def.Name)
+		}
+		var props struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		}
+		_ = json.Unmarshal(def.Parameters, &props)
+		for name := range props.Properties {
+			t.params = append(t.params, name)
+		}
+		sort.Strings(t.params)
+		t.required = params.Required
+	}
+	t.info = &schema.ToolInfo{
+		Name:        def.Name,
+		Desc:        def.Description,
+		ParamsOneOf: schema.NewParamsOneOfByJSONSchema(params),
+	}
+
+	var err error
+	if def.Command != "" {
+		if t.command, err = t.parse("command", def.Command); err != nil {
+			return nil, err
+		}
+		t.sandbox = NewCmdTool(sandboxDir)
+		return t, nil
+	}
+	if def.HTTP.URL == "" {
+		return nil, fmt.Errorf("tool %s: http.url is required", def.Name)
+	}
+	if t.url, err = t.parse("url", def.HTTP.URL); err != nil {
+		return nil, err
+	}
+	if def.HTTP.Body != "" {
+		if t.body, err = t.parse("body", def.HTTP.Body); err != nil {
+			return nil, err
+		}
+	}
+	t.client = &http.Client{Timeout: 60 * time.Second}
+	return t, nil
+}
+
+// parse compiles a template and checks that it only references declared parameters.
+func (t *DynamicTool) parse(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("tool %s: invalid %s template: %w", t.def.Name, name, err)
+	}
+	if _, err := t.render(tmpl, nil, func(any) string { return "" }); err != nil {
+		return nil, fmt.Errorf("tool %s: %s template: %w", t.def.Name, name, err)
+	}
+	return tmpl, nil
+}
+
+// render executes tmpl with every declared parameter set to its escaped argument,
+// or to the escaped nil if it is missing.
+func (t *DynamicTool) render(tmpl *template.Template, args map[string]any, escape func(any) string) (string, error) {
+	data := make(map[string]string, len(t.params))
+	for _, p := range t.params {
+		data[p] = escape(args[p])
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// argString is the text of an argument: strings as they are, other values as JSON.
+func argString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
+
+func shellEscape(v any) string {
+	return "'" + strings.ReplaceAll(argString(v), "'", `'\''`) + "'"
+}
+
+func urlEscape(v any) string {
+	return strings.ReplaceAll(url.QueryEscape(argString(v)), "+", "%20")
+}
+
+func jsonEscape(v any) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "null"
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// Definition returns the definition of the tool.
+func (t *DynamicTool) Definition() DynamicToolDef {
+	return t.def
+}
+
+func (t *DynamicTool) GetInfo() *schema.ToolInfo {
+	return t.info
+}
+
+func (t *DynamicTool) Info(_ context.Context) (*schema.ToolInfo, error) {
+	return t.info, nil
+}
+
+// InvokableRun runs the command or HTTP call of the tool. Invalid arguments and
+// failed requests are reported to the model in the result.
+func (t *DynamicTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	args := map[string]any{}
+	if strings.TrimSpace(argumentsInJSON) != "" {
+		if err := json.Unmarshal([]byte(argumentsInJSON), &args); err != nil {
+			return dynamicError(fmt.Errorf("invalid arguments: %w", err)), nil
+		}
+	}
+	for _, r := range t.required {
+		if _, ok := args[r]; !ok {
+			return dynamicError(fmt.Errorf("missing required argument %q", r)), nil
+		}
+	}
+
+	if t.command != nil {
+		command, err := t.render(t.command, args, shellEscape)
+		if err != nil {
+			return dynamicError(err), nil
+		}
+		in, _ := json.Marshal(map[string]string{"command": command})
+		slog.Info("dynamic tool: running command", "tool", t.def.Name)
+		return t.sandbox.InvokableRun(ctx, string(in))
+	}
+	return t.doHTTP(ctx, args)
+}
+
+func (t *DynamicTool) doHTTP(ctx context.Context, args map[string]any) (string, error) {
+	u, err := t.render(t.url, args, urlEscape)
+	if err != nil {
+		return dynamicError(err), nil
+	}
+	if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return dynamicError(fmt.Errorf("invalid url %q", u)), nil
+	}
+	var body io.Reader
+	if t.body != nil {
+		b, err := t.render(t.body, args, jsonEscape)
+		if err != nil {
+			return dynamicError(err), nil
+		}
+		body = strings.NewReader(b)
+	}
+	method := strings.ToUpper(t.def.HTTP.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return dynamicError(err), nil
+	}
+	req.Header.Set("User-Agent", "Miri-AI-Agent/1.0")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range t.def.HTTP.Headers {
+		req.Header.Set(k, os.ExpandEnv(v))
+	}
+
+	slog.Info("dynamic tool: calling", "tool", t.def.Name, "method", method, "host", req.URL.Host)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return dynamicError(err), nil
+	}
+	defer resp.Body.Close()
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(resp.Body, maxDynamicHTTPBody+1))
+	if err != nil {
+		return dynamicError(fmt.Errorf("read response: %w", err)), nil
+	}
+	respBody := buf.String()
+	if n > maxDynamicHTTPBody {
+		respBody = respBody[:maxDynamicHTTPBody] + "\n... (body truncated)"
+	}
+	res, _ := json.Marshal(struct {
+		Status int    `json:"status"`
+		Body   string `json:"body"`
+	}{resp.StatusCode, respBody})
+	return string(res), nil
+}
+
+func dynamicError(err error) string {
+	b, _ := json.Marshal(map[string]string{"error": err.Error()})
+	return string(b)
+}
 
 var (
 	dynamicMu    sync.RWMutex
-	dynamicTools = make(map[string]ToolFunc)
+	dynamicTools = make(map[string]*DynamicTool)
 )
 
-func RegisterDynamicTool(name string, fn ToolFunc) {
+// RegisterDynamicTool adds t to the dynamic tools, replacing one of the same name.
+func RegisterDynamicTool(t *DynamicTool) {
 	dynamicMu.Lock()
 	defer dynamicMu.Unlock()
-	dynamicTools[name] = fn
+	dynamicTools[t.def.Name] = t
+}
+
+// DynamicTools returns the registered dynamic tools sorted by name.
+func DynamicTools() []*DynamicTool {
+	dynamicMu.RLock()
+	defer dynamicMu.RUnlock()
+	out := make([]*DynamicTool, 0, len(dynamicTools))
+	for _, t := range dynamicTools {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].def.Name < out[j].def.Name })
+	return out
 }
 
+// LoadDynamicTools replaces the dynamic tools with those defined in <dir>/tools;
+// their commands run in <dir>/uploads. Invalid definitions are skipped and
+// reported in the returned error.
 func LoadDynamicTools(dir string) error {
 	d := filepath.Join(dir, "tools")
 	entries, err := os.ReadDir(d)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
+	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
+	loaded := make(map[string]*DynamicTool)
+	var errs []error
 	for _, e := range entries {
-		if e.IsDir() {
-			continue
-		}
-		if !strings.HasSuffix(e.Name(), ".json") {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
 			continue
 		}
-		fpath := filepath.Join(d, e.Name())
-		data, err := os.ReadFile(fpath)
+		data, err := os.ReadFile(filepath.Join(d, e.Name()))
 		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", e.Name(), err))
 			continue
 		}
-		type ToolJSON struct {
-			Name        string                 `json:"name"`
-			Description string                 `json:"description"`
-			Parameters  map[string]interface{} `json:"parameters"`
-			Fn          string                 `json:"fn"`
-		}
-		var tj ToolJSON
-		if err := json.Unmarshal(data, &tj); err != nil {
+		var def DynamicToolDef
+		if err := json.Unmarshal(data, &def); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", e.Name(), err))
 			continue
 		}
-		// Safety validation (med priority)
-		if len(tj.Fn) > 1024 || strings.ContainsAny(tj.Fn, ";|&`><$()[]{}") {
-			slog.Warn("skipped unsafe dynamic tool", slog.String("name", tj.Name), slog.String("reason", "invalid fn chars or too long"))
+		t, err := NewDynamicTool(def, filepath.Join(dir, "uploads"))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", e.Name(), err))
 			continue
 		}
-		fn := func(ctx context.Context, args map[string]any) (any, error) {
-			// Stub: template + sandbox exec later
-			return fmt.Sprintf("dynamic tool %s executed fn: %s args: %v", tj.Name, tj.Fn, args), nil
+		if _, dup := loaded[def.Name]; dup {
+			errs = append(errs, fmt.Errorf("%s: duplicate tool name %q", e.Name(), def.Name))
+			continue
 		}
-		RegisterDynamicTool(tj.Name, fn)
+		loaded[def.Name] = t
 	}
-	return nil
+	for _, err := range errs {
+		slog.Warn("skipped invalid dynamic tool", "error", err)
+	}
+
+	dynamicMu.Lock()
+	dynamicTools = loaded
+	dynamicMu.Unlock()
+	slog.Info("loaded dynamic tools", "dir", d, "count", len(loaded))
+	return errors.Join(errs...)
 }
@@ -0,0 +1,124 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDynamicTool_Command(t *testing.T) {
+	tool, err := NewDynamicTool(DynamicToolDef{
+		Name:        "greet",
+		Description: "Greets someone",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"name":{"type":"string"},"times":{"type":"integer"}},"required":["name"]}`),
+		Command:     "printf '%s x%s' {{.name}} {{.times}}",
+	}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, _ := tool.Info(context.Background())
+	js, err := info.ParamsOneOf.ToJSONSchema()
+	if err != nil || js.Required[0] != "name" {
+		t.Fatalf("unexpected parameters %+v, %v", js, err)
+	}
+
+	// Arguments are quoted, so they cannot break out of the command.
+	out, err := tool.InvokableRun(context.Background(), `{"name":"bob; echo pwned","times":2}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res struct {
+		Stdout string `json:"stdout"`
+	}
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("unexpected result %s", out)
+	}
+	if res.Stdout != "bob; echo pwned x2" {
+		t.Errorf("stdout = %q", res.Stdout)
+	}
+
+	if out, _ := tool.InvokableRun(context.Background(), `{"times":2}`); !strings.Contains(out, `missing required argument \"name\"`) {
+		t.Errorf("expected a missing argument error, got %s", out)
+	}
+}
+
+func TestDynamicTool_HTTP(t *testing.T) {
+	t.Setenv("MIRI_TEST_TOKEN", "s3cret")
+	var gotPath, gotQuery, gotAuth, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery, gotAuth = r.URL.Path, r.URL.Query().Get("q"), r.Header.Get("Authorization")
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	tool, err := NewDynamicTool(DynamicToolDef{
+		Name:       "create_issue",
+		Parameters: json.RawMessage(`{"type":"object","properties":{"title":{"type":"string"},"labels":{"type":"array"}}}`),
+		HTTP: &DynamicHTTPCall{
+			Method:  "post",
+			URL:     srv.URL + "/issues?q={{.title}}",
+			Headers: map[string]string{"Authorization": "Bearer ${MIRI_TEST_TOKEN}"},
+			Body:    `{"title":{{.title}},"labels":{{.labels}}}`,
+		},
+	}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := tool.InvokableRun(context.Background(), `{"title":"a \"b\" & c"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != `{"status":201,"body":"{\"ok\":true}"}` {
+		t.Errorf("unexpected result %s", out)
+	}
+	if gotPath != "/issues" || gotQuery != `a "b" & c` || gotAuth != "Bearer s3cret" {
+		t.Errorf("unexpected request path=%q q=%q auth=%q", gotPath, gotQuery, gotAuth)
+	}
+	if gotBody != `{"title":"a \"b\" & c","labels":null}` {
+		t.Errorf("unexpected body %s", gotBody)
+	}
+}
+
+func TestLoadDynamicTools(t *testing.T) {
+	dir := t.TempDir()
+	toolsDir := filepath.Join(dir, "tools")
+	if err := os.MkdirAll(toolsDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(toolsDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("date.json", `{"name":"today","description":"Prints the date","fn":"date +%F"}`)
+	write("undeclared.json", `{"name":"bad","command":"echo {{.missing}}"}`)
+	write("both.json", `{"name":"both","command":"true","http":{"url":"https://example.com"}}`)
+
+	err := LoadDynamicTools(dir)
+	if err == nil || !strings.Contains(err.Error(), "undeclared.json") || !strings.Contains(err.Error(), "both.json") {
+		t.Errorf("expected the invalid definitions reported, got %v", err)
+	}
+	loaded := DynamicTools()
+	if len(loaded) != 1 || loaded[0].Definition().Name != "today" || loaded[0].Definition().Command != "date +%F" {
+		t.Fatalf("expected only today loaded, got %+v", loaded)
+	}
+
+	// Reloading replaces the registered tools.
+	if err := os.RemoveAll(toolsDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadDynamicTools(dir); err != nil || len(DynamicTools()) != 0 {
+		t.Errorf("expected no tools after reload, got %d (%v)", len(DynamicTools()), err)
+	}
+}
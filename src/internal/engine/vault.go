@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/cloudwego/eino/compose"
+
+	"miri-main/src/internal/config"
+	"miri-main/src/internal/engine/vault"
+	"miri-main/src/internal/storage"
+)
+
+// vaults shares one vault between the engines of a storage directory, so that a
+// value gets the same placeholder in every session.
+var vaults sync.Map // *storage.Storage -> *vault.Vault
+
+// sharedVault returns the vault of st, creating it with the default detectors and
+// those of agents.vault.patterns.
+func sharedVault(cfg *config.Config, st *storage.Storage) *vault.Vault {
+	if v, ok := vaults.Load(st); ok {
+		return v.(*vault.Vault)
+	}
+	var store vault.Store
+	if st != nil {
+		if ss, err := st.SessionStore(); err != nil {
+			slog.Warn("vault: no session store, placeholders will not survive restarts", "error", err)
+		} else {
+			store = ss
+		}
+	}
+	v := vault.New(store, vault.DefaultDetectors()...)
+	for kind, pattern := range cfg.Agents.Vault.Patterns {
+		kind = strings.ToUpper(kind)
+		re, err := regexp.Compile(pattern)
+		if err != nil || !vaultKindRegex.MatchString(kind) {
+			slog.Warn("vault: ignoring invalid pattern", "kind", kind, "pattern", pattern, "error", err)
+			continue
+		}
+		v.AddDetector(vault.Regexp(kind, re))
+	}
+	actual, _ := vaults.LoadOrStore(st, v)
+	return actual.(*vault.Vault)
+}
+
+var vaultKindRegex = regexp.MustCompile(`^[A-Z][A-Z0-9]*$`)
+
+// vaultMiddleware restores the placeholders in the arguments of a tool call, so the
+// tool (and the approval and cassette of the call) get the real values.
+func (e *EinoEngine) vaultMiddleware(next compose.InvokableToolEndpoint) compose.InvokableToolEndpoint {
+	return func(ctx context.Context, in *compose.ToolInput) (*compose.ToolOutput, error) {
+		if sessionID, _ := runScope(ctx); sessionID != "" {
+			restored := *in
+			restored.Arguments = e.vault.RestoreJSON(sessionID, in.Arguments)
+			in = &restored
+		}
+		return next(ctx, in)
+	}
+}
@@ -0,0 +1,351 @@
+// Package vault swaps sensitive values for stable placeholders before text goes to
+// a model and restores them where the model's output is used: in tool call
+// arguments and in the answers shown to the user.
+//
+// A value always gets the same placeholder (e.g. "[EMAIL_1f2e3d4c]"), but a session
+// can only restore the placeholders of values that were tokenized in it, so a
+// placeholder leaked into another session's context stays a placeholder.
+package vault
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Detector finds sensitive values in text.
+type Detector interface {
+	// Kind names the values found, e.g. "EMAIL". It is the prefix of their
+	// placeholders and consists of upper-case letters and digits.
+	Kind() string
+	// Find returns the [start, end) byte offsets of the values in s.
+	Find(s string) [][]int
+}
+
+type regexpDetector struct {
+	kind string
+	re   *regexp.Regexp
+}
+
+// Regexp returns a detector of the matches of re, or of its first group if it has one.
+func Regexp(kind string, re *regexp.Regexp) Detector {
+	return &regexpDetector{kind: kind, re: re}
+}
+
+func (d *regexpDetector) Kind() string { return d.kind }
+
+func (d *regexpDetector) Find(s string) [][]int {
+	var out [][]int
+	for _, m := range d.re.FindAllStringSubmatchIndex(s, -1) {
+		if len(m) >= 4 && m[2] >= 0 {
+			out = append(out, m[2:4])
+		} else {
+			out = append(out, m[:2])
+		}
+	}
+	return out
+}
+
+// DefaultDetectors find emails, xAI team and API key IDs, and long hex strings
+// such as keys, tokens and commit hashes.
+func DefaultDetectors() []Detector {
+	return []Detector{
+		Regexp("ID", regexp.MustCompile(`(?i)(?:Team|API key ID):? ([0-9a-f-]{36})`)),
+		Regexp("EMAIL", regexp.MustCompile(`(?i)[a-z0-9._%+-]+@[a-z0-9.-]+\.[a-z]{2,}`)),
+		Regexp("HEX", regexp.MustCompile(`(?i)\b[0-9a-f]{32,}\b`)),
+	}
+}
+
+// placeholderRegex matches the placeholders of any kind.
+var placeholderRegex = regexp.MustCompile(`\[[A-Z][A-Z0-9]*_[0-9a-f]{8}\]`)
+
+// maxPlaceholderLen bounds how much of a stream a Restorer holds back.
+const maxPlaceholderLen = 64
+
+// Store persists the placeholders of a vault; *storage.SessionStore implements it.
+// Entries map a placeholder to its value for a session; those without a session
+// were tokenized outside of one (by the Brain) and are restored nowhere.
+type Store interface {
+	AddVaultEntry(sessionID, token, value string) error
+	// LoadVaultEntries returns the values by placeholder by session.
+	LoadVaultEntries() (map[string]map[string]string, error)
+}
+
+// Vault holds the placeholders of all sessions.
+type Vault struct {
+	detectors []Detector
+	store     Store
+
+	load    sync.Once
+	mu      sync.Mutex
+	values  map[string]string          // token -> value
+	tokens  map[string]string          // value -> token
+	granted map[string]map[string]bool // session -> tokens it may restore
+}
+
+// New creates a vault using detectors, persisting its entries in store if it is
+// not nil.
+func New(store Store, detectors ...Detector) *Vault {
+	return &Vault{
+		detectors: detectors,
+		store:     store,
+		values:    make(map[string]string),
+		tokens:    make(map[string]string),
+		granted:   make(map[string]map[string]bool),
+	}
+}
+
+// AddDetector adds a detector to those the vault tokenizes with.
+func (v *Vault) AddDetector(d Detector) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.detectors = append(v.detectors, d)
+}
+
+func (v *Vault) loadStore() {
+	v.load.Do(func() {
+		if v.store == nil {
+			return
+		}
+		entries, err := v.store.LoadVaultEntries()
+		if err != nil {
+			slog.Error("vault: failed to load placeholders, earlier ones will not be restored", "error", err)
+			return
+		}
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		for sessionID, values := range entries {
+			for token, value := range values {
+				v.values[token] = value
+				v.tokens[value] = token
+				v.grant(sessionID, token)
+			}
+		}
+	})
+}
+
+// grant lets sessionID restore token; v.mu is held.
+func (v *Vault) grant(sessionID, token string) bool {
+	if sessionID == "" {
+		return false
+	}
+	tokens := v.granted[sessionID]
+	if tokens == nil {
+		tokens = make(map[string]bool)
+		v.granted[sessionID] = tokens
+	}
+	if tokens[token] {
+		return false
+	}
+	tokens[token] = true
+	return true
+}
+
+// Tokenize replaces the sensitive values in s with their placeholders, which
+// sessionID may restore from then on.
+func (v *Vault) Tokenize(sessionID, s string) string {
+	if v == nil || s == "" {
+		return s
+	}
+	v.loadStore()
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	type match struct {
+		start, end int
+		kind       string
+	}
+	var matches []match
+	for _, d := range v.detectors {
+		for _, r := range d.Find(s) {
+			if r[0] < r[1] {
+				matches = append(matches, match{r[0], r[1], d.Kind()})
+			}
+		}
+	}
+	if len(matches) == 0 {
+		return s
+	}
+	// Earlier and then longer matches win over the ones they overlap.
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].start != matches[j].start {
+			return matches[i].start < matches[j].start
+		}
+		return matches[i].end > matches[j].end
+	})
+
+	var sb strings.Builder
+	last := 0
+	for _, m := range matches {
+		if m.start < last {
+			continue
+		}
+		sb.WriteString(s[last:m.start])
+		sb.WriteString(v.token(sessionID, m.kind, s[m.start:m.end]))
+		last = m.end
+	}
+	sb.WriteString(s[last:])
+	return sb.String()
+}
+
+// token returns the placeholder of value, creating it if needed; v.mu is held.
+func (v *Vault) token(sessionID, kind, value string) string {
+	token, known := v.tokens[value]
+	for !known {
+		var b [4]byte
+		rand.Read(b[:])
+		token = "[" + kind + "_" + hex.EncodeToString(b[:]) + "]"
+		if _, taken := v.values[token]; !taken {
+			v.values[token] = value
+			v.tokens[value] = token
+			break
+		}
+	}
+	// New values are persisted even without a session, so they keep their placeholder.
+	if v.grant(sessionID, token) || (!known && sessionID == "") {
+		v.persist(sessionID, token, value)
+	}
+	return token
+}
+
+// persist stores an entry, logging failures; v.mu is held.
+func (v *Vault) persist(sessionID, token, value string) {
+	if v.store == nil {
+		return
+	}
+	if err := v.store.AddVaultEntry(sessionID, token, value); err != nil {
+		slog.Warn("vault: failed to persist placeholder", "token", token, "error", err)
+	}
+}
+
+// Adopt is Tokenize for text that may already hold placeholders of other sessions,
+// such as memories retrieved for sessionID: they become restorable in sessionID.
+func (v *Vault) Adopt(sessionID, s string) string {
+	if v == nil || s == "" {
+		return s
+	}
+	v.loadStore()
+	v.mu.Lock()
+	for _, token := range placeholderRegex.FindAllString(s, -1) {
+		if value, ok := v.values[token]; ok && v.grant(sessionID, token) {
+			v.persist(sessionID, token, value)
+		}
+	}
+	v.mu.Unlock()
+	return v.Tokenize(sessionID, s)
+}
+
+// Values returns the values of the placeholders in s, in any session.
+func (v *Vault) Values(s string) map[string]string {
+	out := make(map[string]string)
+	if v == nil || !strings.Contains(s, "[") {
+		return out
+	}
+	v.loadStore()
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, token := range placeholderRegex.FindAllString(s, -1) {
+		if value, ok := v.values[token]; ok {
+			out[token] = value
+		}
+	}
+	return out
+}
+
+// Register adds the placeholder token of value without a session, as for values
+// tokenized by the Brain, so memories holding it can be adopted. It fails if token
+// already stands for another value.
+func (v *Vault) Register(token, value string) error {
+	if placeholderRegex.FindString(token) != token {
+		return fmt.Errorf("invalid placeholder %q", token)
+	}
+	v.loadStore()
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if known, ok := v.values[token]; ok {
+		if known != value {
+			return fmt.Errorf("placeholder %s already stands for another value", token)
+		}
+		return nil
+	}
+	v.values[token] = value
+	if _, ok := v.tokens[value]; !ok {
+		v.tokens[value] = token
+	}
+	if v.store == nil {
+		return nil
+	}
+	return v.store.AddVaultEntry("", token, value)
+}
+
+// Restore replaces the placeholders sessionID may restore in s with their values.
+func (v *Vault) Restore(sessionID, s string) string {
+	return v.restore(sessionID, s, func(value string) string { return value })
+}
+
+// RestoreJSON is Restore for JSON text, such as tool call arguments: the values
+// are escaped as the contents of JSON strings.
+func (v *Vault) RestoreJSON(sessionID, s string) string {
+	return v.restore(sessionID, s, func(value string) string {
+		b, err := json.Marshal(value)
+		if err != nil {
+			return value
+		}
+		return string(b[1 : len(b)-1])
+	})
+}
+
+func (v *Vault) restore(sessionID, s string, encode func(string) string) string {
+	if v == nil || sessionID == "" || !strings.Contains(s, "[") {
+		return s
+	}
+	v.loadStore()
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	granted := v.granted[sessionID]
+	if len(granted) == 0 {
+		return s
+	}
+	return placeholderRegex.ReplaceAllStringFunc(s, func(token string) string {
+		if !granted[token] {
+			return token
+		}
+		return encode(v.values[token])
+	})
+}
+
+// Restorer restores the placeholders of a session in text that arrives in pieces,
+// holding back what may be the start of a placeholder until it is complete.
+type Restorer struct {
+	v         *Vault
+	sessionID string
+	pending   string
+}
+
+// Restorer returns a Restorer of the placeholders of sessionID.
+func (v *Vault) Restorer(sessionID string) *Restorer {
+	return &Restorer{v: v, sessionID: sessionID}
+}
+
+// Write returns the restored text of delta that is ready to be passed on.
+func (r *Restorer) Write(delta string) string {
+	s := r.pending + delta
+	r.pending = ""
+	if i := strings.LastIndexByte(s, '['); i >= 0 && len(s)-i < maxPlaceholderLen && !strings.Contains(s[i:], "]") {
+		s, r.pending = s[:i], s[i:]
+	}
+	return r.v.Restore(r.sessionID, s)
+}
+
+// Flush returns the text held back.
+func (r *Restorer) Flush() string {
+	s := r.pending
+	r.pending = ""
+	return r.v.Restore(r.sessionID, s)
+}
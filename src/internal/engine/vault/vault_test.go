@@ -0,0 +1,110 @@
+package vault
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+type memStore map[string]map[string]string
+
+func (m memStore) AddVaultEntry(sessionID, token, value string) error {
+	if m[sessionID] == nil {
+		m[sessionID] = map[string]string{}
+	}
+	m[sessionID][token] = value
+	return nil
+}
+
+func (m memStore) LoadVaultEntries() (map[string]map[string]string, error) {
+	return m, nil
+}
+
+const sha = "3f786850e387550fdab836ed7e6dc881de23001b"
+
+func TestVault_TokenizeRestore(t *testing.T) {
+	v := New(nil, DefaultDetectors()...)
+
+	in := "Mail bob@example.com about commit " + sha + ", and again bob@example.com."
+	out := v.Tokenize("s1", in)
+	if strings.Contains(out, "bob@example.com") || strings.Contains(out, sha) {
+		t.Fatalf("sensitive values left in %q", out)
+	}
+	tokens := placeholderRegex.FindAllString(out, -1)
+	if len(tokens) != 3 || tokens[0] != tokens[2] || !strings.HasPrefix(tokens[0], "[EMAIL_") || !strings.HasPrefix(tokens[1], "[HEX_") {
+		t.Fatalf("expected stable EMAIL and HEX placeholders, got %q", out)
+	}
+	if got := v.Restore("s1", out); got != in {
+		t.Errorf("Restore = %q, want %q", got, in)
+	}
+	if again := v.Tokenize("s2", "bob@example.com"); again != tokens[0] {
+		t.Errorf("expected the same placeholder in another session, got %q", again)
+	}
+
+	// A session only restores the placeholders tokenized in it.
+	if got := v.Restore("s3", out); got != out {
+		t.Errorf("expected placeholders of s1 kept in s3, got %q", got)
+	}
+	if got := v.Restore("s1", "[EMAIL_00000000]"); got != "[EMAIL_00000000]" {
+		t.Errorf("expected unknown placeholder kept, got %q", got)
+	}
+
+	xai := v.Tokenize("s1", "Team: 0b4e9a63-2d3c-4b7e-9a4f-1c2d3e4f5a6b")
+	if !strings.HasPrefix(xai, "Team: [ID_") {
+		t.Errorf("expected the team ID tokenized after its label, got %q", xai)
+	}
+}
+
+func TestVault_RestoreJSON(t *testing.T) {
+	v := New(nil, Regexp("NAME", regexp.MustCompile(`say "\w+"`)))
+	args, _ := json.Marshal(map[string]string{"text": v.Tokenize("s1", `please say "hi"`)})
+
+	var got map[string]string
+	if err := json.Unmarshal([]byte(v.RestoreJSON("s1", string(args))), &got); err != nil {
+		t.Fatalf("restored arguments are not valid JSON: %v", err)
+	}
+	if got["text"] != `please say "hi"` {
+		t.Errorf("unexpected restored argument %q", got["text"])
+	}
+}
+
+func TestVault_Restorer(t *testing.T) {
+	v := New(nil, DefaultDetectors()...)
+	text := v.Tokenize("s1", "Your key is "+sha+" [sic]")
+
+	r := v.Restorer("s1")
+	var sb strings.Builder
+	for i := 0; i < len(text); i += 3 {
+		sb.WriteString(r.Write(text[i:min(i+3, len(text))]))
+	}
+	sb.WriteString(r.Flush())
+	if got := sb.String(); got != "Your key is "+sha+" [sic]" {
+		t.Errorf("streamed restore = %q", got)
+	}
+}
+
+func TestVault_PersistAndAdopt(t *testing.T) {
+	store := memStore{}
+	v := New(store, DefaultDetectors()...)
+	memory := v.Tokenize("", "The user's email is alice@example.com")
+	if v.Restore("s1", memory) != memory {
+		t.Fatal("placeholders tokenized outside a session must not be restorable")
+	}
+
+	// A new vault on the same store keeps the placeholders.
+	reloaded := New(store, DefaultDetectors()...)
+	if got := reloaded.Tokenize("", "alice@example.com"); !strings.Contains(memory, got) {
+		t.Fatalf("expected the persisted placeholder %q in %q", got, memory)
+	}
+	adopted := reloaded.Adopt("s1", memory)
+	if adopted != memory {
+		t.Errorf("Adopt changed the placeholders: %q", adopted)
+	}
+	if got := reloaded.Restore("s1", adopted); got != "The user's email is alice@example.com" {
+		t.Errorf("expected adopted placeholders restorable, got %q", got)
+	}
+	if len(store["s1"]) != 1 {
+		t.Errorf("expected the adoption persisted, got %v", store)
+	}
+}
@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/compose"
+
+	"miri-main/src/internal/engine/vault"
+)
+
+func TestVaultMiddleware(t *testing.T) {
+	e := &EinoEngine{
+		sensitiveStrings: []string{"xai-secret-api-key"},
+		vault:            vault.New(nil, vault.DefaultDetectors()...),
+	}
+	args := e.sanitizeString("miri:main:session", `{"to":"bob@example.com","body":"key xai-secret-api-key"}`)
+	if strings.Contains(args, "bob@example.com") || strings.Contains(args, "xai-secret-api-key") {
+		t.Fatalf("sensitive values left in %s", args)
+	}
+
+	var got string
+	endpoint := e.vaultMiddleware(func(ctx context.Context, in *compose.ToolInput) (*compose.ToolOutput, error) {
+		got = in.Arguments
+		return &compose.ToolOutput{}, nil
+	})
+	ctx := withRunScope(context.Background(), &graphInput{SessionID: "miri:main:session"})
+	if _, err := endpoint(ctx, &compose.ToolInput{Name: "send", Arguments: args}); err != nil {
+		t.Fatal(err)
+	}
+	// API keys are redacted for good; the email is restored for the tool.
+	if got != `{"to":"bob@example.com","body":"key [REDACTED_SENSITIVE]"}` {
+		t.Errorf("unexpected tool arguments %s", got)
+	}
+
+	other := withRunScope(context.Background(), &graphInput{SessionID: "miri:other:session"})
+	if _, err := endpoint(other, &compose.ToolInput{Name: "send", Arguments: args}); err != nil {
+		t.Fatal(err)
+	}
+	if got != args {
+		t.Errorf("expected another session's call to keep the placeholders, got %s", got)
+	}
+}
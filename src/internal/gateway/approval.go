@@ -0,0 +1,146 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"miri-main/src/internal/engine"
+	"miri-main/src/internal/session"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrApprovalNotFound is returned when deciding on an unknown or already decided request.
+var ErrApprovalNotFound = errors.New("approval request not found")
+
+type approvalDecision struct {
+	approved bool
+	reason   string
+}
+
+type pendingApproval struct {
+	req      *engine.ApprovalRequest
+	decision chan approvalDecision
+}
+
+// RequestApproval holds a tool call of the agent back until the human approves or
+// denies it, the request expires (denied) or ctx is done. The request is pushed to the
+// WebSocket clients and the channel device of the session that made it.
+func (gw *Gateway) RequestApproval(ctx context.Context, req *engine.ApprovalRequest) (bool, string, error) {
+	p := &pendingApproval{req: req, decision: make(chan approvalDecision, 1)}
+	gw.approvalMu.Lock()
+	gw.approvals[req.ID] = p
+	gw.approvalMu.Unlock()
+	defer func() {
+		gw.approvalMu.Lock()
+		delete(gw.approvals, req.ID)
+		gw.approvalMu.Unlock()
+	}()
+
+	gw.notifyApproval(req)
+
+	timer := time.NewTimer(time.Until(req.ExpiresAt))
+	defer timer.Stop()
+	select {
+	case d := <-p.decision:
+		return d.approved, d.reason, nil
+	case <-timer.C:
+		slog.Warn("Approval request expired", "approval_id", req.ID, "tool", req.Tool, "session_id", req.SessionID)
+		return false, fmt.Sprintf("no decision within %s.", req.ExpiresAt.Sub(req.Created).Round(time.Second)), nil
+	case <-ctx.Done():
+		return false, "", ctx.Err()
+	}
+}
+
+// PendingApprovals returns the tool calls waiting for a decision, oldest first. If
+// sessionID is non-empty, only requests of that session are returned.
+func (gw *Gateway) PendingApprovals(sessionID string) []*engine.ApprovalRequest {
+	gw.approvalMu.Lock()
+	defer gw.approvalMu.Unlock()
+	res := make([]*engine.ApprovalRequest, 0, len(gw.approvals))
+	for _, p := range gw.approvals {
+		if sessionID == "" || p.req.SessionID == sessionID {
+			res = append(res, p.req)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Created.Before(res[j].Created)
+	})
+	return res
+}
+
+// DecideApproval approves or denies a pending tool call, which unblocks its run.
+func (gw *Gateway) DecideApproval(id string, approved bool, reason string) error {
+	gw.approvalMu.Lock()
+	p, ok := gw.approvals[id]
+	if ok {
+		delete(gw.approvals, id)
+	}
+	gw.approvalMu.Unlock()
+	if !ok {
+		return fmt.Errorf("approval %s: %w", id, ErrApprovalNotFound)
+	}
+	p.decision <- approvalDecision{approved: approved, reason: reason}
+	return nil
+}
+
+// decideApprovalReply treats a channel message as the decision on the session's
+// oldest pending request if it reads as one ("approve"/"yes" or "deny"/"no").
+func (gw *Gateway) decideApprovalReply(sessionID, msg string) bool {
+	var approved bool
+	switch strings.ToLower(strings.TrimSpace(msg)) {
+	case "approve", "approved", "yes", "y", "ok":
+		approved = true
+	case "deny", "denied", "no", "n":
+		approved = false
+	default:
+		return false
+	}
+	for _, req := range gw.PendingApprovals("") {
+		if gw.ownerSession(req.SessionID) == sessionID {
+			return gw.DecideApproval(req.ID, approved, "") == nil
+		}
+	}
+	return false
+}
+
+func (gw *Gateway) notifyApproval(req *engine.ApprovalRequest) {
+	sessionID := gw.ownerSession(req.SessionID)
+
+	gw.reportMu.RLock()
+	handler := gw.approvalHandler
+	gw.reportMu.RUnlock()
+	if handler != nil {
+		handler(sessionID, req)
+	}
+
+	if channel, device, ok := gw.channelOf(sessionID); ok {
+		msg := fmt.Sprintf("Approval needed: %s %s\nReply \"approve\" or \"deny\".", req.Tool, req.Arguments)
+		if err := gw.ChannelSend(channel, device, msg); err != nil {
+			slog.Error("failed to send approval request to channel", "approval_id", req.ID, "channel", channel, "device", device, "error", err)
+		}
+	}
+}
+
+// ownerSession returns the conversation session a dynamic sub-agent session belongs
+// to, or sessionID itself.
+func (gw *Gateway) ownerSession(sessionID string) string {
+	if !session.IsSubAgent(sessionID) {
+		return sessionID
+	}
+	run, err := gw.Storage.LoadSubAgentRun(strings.TrimPrefix(sessionID, session.SubAgentSessionPrefix))
+	if err != nil || run.ParentSession == "" {
+		return sessionID
+	}
+	return run.ParentSession
+}
+
+// SetApprovalHandler sets the function that pushes approval requests to the WebSocket
+// clients of a session.
+func (gw *Gateway) SetApprovalHandler(h func(sessionID string, req *engine.ApprovalRequest)) {
+	gw.reportMu.Lock()
+	defer gw.reportMu.Unlock()
+	gw.approvalHandler = h
+}
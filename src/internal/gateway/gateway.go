@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"log/slog"
 	"miri-main/src/internal/agent"
+	"miri-main/src/internal/budget"
 	"miri-main/src/internal/channels"
 	"miri-main/src/internal/config"
 	"miri-main/src/internal/cron"
 	"miri-main/src/internal/engine"
 	"miri-main/src/internal/engine/skills"
 	"miri-main/src/internal/engine/tools"
+	"miri-main/src/internal/llm"
 	"miri-main/src/internal/session"
 	"miri-main/src/internal/storage"
 	"miri-main/src/internal/subagent"
@@ -31,9 +33,19 @@ type Gateway struct {
 	Channels     map[string]channels.Channel
 	cronMgr      *cron.CronManager
 	engine       *engine.Loop
+	budget       *budget.Tracker
 
 	taskReportHandler func(sessionID, taskName, taskID, message string)
+	humanHandler      func(sessionID, questionID, kind, message string)
+	approvalHandler   func(sessionID string, req *engine.ApprovalRequest)
 	reportMu          sync.RWMutex
+
+	// humanMu serializes status changes of human questions (answer vs. expiry)
+	humanMu sync.Mutex
+
+	// approvals holds the tool calls waiting for a decision, by request ID
+	approvals  map[string]*pendingApproval
+	approvalMu sync.Mutex
 }
 
 func New(cfg *config.Config, st *storage.Storage) *Gateway {
@@ -42,7 +54,9 @@ func New(cfg *config.Config, st *storage.Storage) *Gateway {
 		Storage:    st,
 		SessionMgr: session.NewSessionManager(),
 		Channels:   make(map[string]channels.Channel),
+		approvals:  make(map[string]*pendingApproval),
 	}
+	gw.budget = budget.New(cfg, st, gw.sendBudgetAlert)
 
 	// Initialize KeePass if configured
 	if cfg.Miri.KeePass.DBPath != "" {
@@ -53,6 +67,18 @@ func New(cfg *config.Config, st *storage.Storage) *Gateway {
 	}
 
 	gw.PrimaryAgent = agent.NewAgent(cfg, gw.SessionMgr, gw.Storage, gw)
+
+	// Sessions and conversation buffers survive restarts via the SQLite session store
+	if ss, err := st.SessionStore(); err != nil {
+		slog.Error("failed to open session store, sessions will not be persisted", "error", err)
+	} else {
+		if err := gw.SessionMgr.AttachStore(ss); err != nil {
+			slog.Error("failed to restore sessions", "error", err)
+		}
+		if err := gw.PrimaryAgent.PersistBuffers(ss); err != nil {
+			slog.Error("failed to restore conversation buffers", "error", err)
+		}
+	}
 	numSub := gw.Config.Agents.SubAgents
 	gw.SubAgents = make([]*agent.Agent, numSub)
 	for i := range gw.SubAgents {
@@ -74,7 +100,14 @@ func New(cfg *config.Config, st *storage.Storage) *Gateway {
 				parts = strings.SplitN(primary, "/", 2)
 			}
 			provider, modelName := parts[0], parts[1]
-			return engine.NewEinoEngine(cfg, st, provider, modelName, nil)
+			eng, err := engine.NewEinoEngine(cfg, st, provider, modelName, nil)
+			if err != nil {
+				return nil, err
+			}
+			// Tool calls of sub-agents are approved in their parent's session
+			eng.SetApprover(gw)
+			eng.SetBudget(gw.budget)
+			return eng, nil
 		},
 		gw.SessionMgr,
 		gw.Storage,
@@ -82,7 +115,7 @@ func New(cfg *config.Config, st *storage.Storage) *Gateway {
 	)
 
 	gw.cronMgr = cron.NewCronManager(gw.Storage, func(ctx context.Context, sessionID, prompt string, opts engine.Options) (string, error) {
-		return gw.PrimaryAgent.DelegatePromptWithOptions(ctx, sessionID, prompt, opts)
+		return gw.PrimaryAgent.DelegatePromptWithOptions(engine.WithCostSource(ctx, storage.CostSourceCron), sessionID, prompt, opts)
 	}, func(t *tasks.Task, response string) {
 		if t.Silent {
 			slog.Info("task execution silent, skipping reports", "task_id", t.ID, "task_name", t.Name)
@@ -148,34 +181,19 @@ func New(cfg *config.Config, st *storage.Storage) *Gateway {
 	}
 
 	gw.engine = engine.New()
+	gw.engine.Register(gw.expireHumanQuestions)
 
 	if w, ok := gw.Channels["whatsapp"].(*channels.Whatsapp); ok {
 		w.SetMessageHandler(func(device, msg string) {
-			sessionID := session.DefaultSessionID
-			resp, err := gw.PrimaryAgent.DelegatePrompt(sessionID, msg)
-			if err != nil {
-				slog.Error("failed to handle incoming whatsapp msg", "device", device, "error", err)
-				return
-			}
-			if err := gw.ChannelSend("whatsapp", device, resp); err != nil {
-				slog.Error("failed to send auto-response", "device", device, "error", err)
-			}
+			gw.handleChannelMessage("whatsapp", device, msg)
 		})
 		gw.engine.Register(w.Poll)
 	}
 
 	if i, ok := gw.Channels["irc"].(*channels.IRC); ok {
 		i.SetMessageHandler(func(target, msg string) {
-			// For IRC, we use the target (channel or nick) as the session ID prefix or client ID
-			sessionID := session.DefaultSessionID
-			resp, err := gw.PrimaryAgent.DelegatePrompt(sessionID, msg)
-			if err != nil {
-				slog.Error("failed to handle incoming irc msg", "target", target, "error", err)
-				return
-			}
-			if err := gw.ChannelSend("irc", target, resp); err != nil {
-				slog.Error("failed to send irc response", "target", target, "error", err)
-			}
+			// For IRC, the target (channel or nick) is the device
+			gw.handleChannelMessage("irc", target, msg)
 		})
 		gw.engine.Register(func() {
 			if err := i.Run(); err != nil {
@@ -215,6 +233,31 @@ func (gw *Gateway) ChannelSend(channel, device, msg string) error {
 	return fmt.Errorf("channel %q not found", channel)
 }
 
+// Budget returns the tracker of the spending budgets (agents.budgets).
+func (gw *Gateway) Budget() *budget.Tracker {
+	return gw.budget
+}
+
+// sendBudgetAlert sends a budget alert to agents.budgets.alert_target
+// ("channel:device"), if one is configured.
+func (gw *Gateway) sendBudgetAlert(msg string) {
+	target := gw.Config.Agents.Budgets.AlertTarget
+	if target == "" {
+		return
+	}
+	channel, device, ok := strings.Cut(target, ":")
+	if !ok {
+		slog.Warn("invalid budget alert target, expected channel:device", "target", target)
+		return
+	}
+	// Alerts are raised from model calls, which must not wait for the channel.
+	go func() {
+		if err := gw.ChannelSend(channel, device, msg); err != nil {
+			slog.Warn("failed to send budget alert", "target", target, "error", err)
+		}
+	}()
+}
+
 func (gw *Gateway) ChannelSendFile(channel, device, filePath, caption string) error {
 	if ch, ok := gw.Channels[channel]; ok {
 		return ch.SendFile(context.Background(), device, filePath, caption)
@@ -222,8 +265,32 @@ func (gw *Gateway) ChannelSendFile(channel, device, filePath, caption string) er
 	return fmt.Errorf("channel %q not found", channel)
 }
 
+// handleChannelMessage answers an incoming channel message in the conversation
+// session of its sender and sends the reply back over the same channel.
+func (gw *Gateway) handleChannelMessage(channel, device, msg string) {
+	sessionID := session.ChannelSessionID(channel, device)
+	// A tool call waiting for approval is decided by an approve/deny reply
+	if gw.decideApprovalReply(sessionID, msg) {
+		return
+	}
+	// While the agent waits for an answer, the next message is that answer
+	if q := gw.pendingHumanQuestion(sessionID); q != nil {
+		if _, err := gw.AnswerHumanQuestion(q.ID, msg); err == nil {
+			return
+		}
+	}
+	resp, err := gw.PrimaryAgent.DelegatePrompt(sessionID, msg)
+	if err != nil {
+		slog.Error("failed to handle incoming channel msg", "channel", channel, "device", device, "session_id", sessionID, "error", err)
+		return
+	}
+	if err := gw.ChannelSend(channel, device, resp); err != nil {
+		slog.Error("failed to send channel response", "channel", channel, "device", device, "error", err)
+	}
+}
+
 func (gw *Gateway) ChannelChat(channel, device, prompt string) (string, error) {
-	resp, err := gw.PrimaryAgent.DelegatePrompt(device, prompt)
+	resp, err := gw.PrimaryAgent.DelegatePrompt(session.ChannelSessionID(channel, device), prompt)
 	if err != nil {
 		return "", err
 	}
@@ -233,15 +300,9 @@ func (gw *Gateway) ChannelChat(channel, device, prompt string) (string, error) {
 	return resp, nil
 }
 
+// CreateNewSession starts a fresh, empty conversation session and returns its ID.
 func (gw *Gateway) CreateNewSession() string {
-	sessionID := gw.SessionMgr.CreateNewSession()
-	if gw.PrimaryAgent != nil {
-		go gw.PrimaryAgent.CompactMemory(context.Background(), sessionID)
-		if gw.PrimaryAgent.Eng != nil {
-			gw.PrimaryAgent.Eng.ClearHistory(sessionID)
-		}
-	}
-	return sessionID
+	return gw.SessionMgr.CreateNewSession()
 }
 
 func (gw *Gateway) ListSessions() []string {
@@ -254,6 +315,7 @@ func (gw *Gateway) NumSubAgents() int {
 
 func (gw *Gateway) UpdateConfig(newCfg *config.Config) {
 	gw.Config = newCfg
+	gw.budget.SetConfig(newCfg)
 
 	// 1. Refresh Agents
 	gw.PrimaryAgent.Config = newCfg
@@ -276,15 +338,7 @@ func (gw *Gateway) UpdateConfig(newCfg *config.Config) {
 		if ch != nil {
 			gw.Channels["whatsapp"] = ch
 			ch.SetMessageHandler(func(device, msg string) {
-				sessionID := session.DefaultSessionID
-				resp, err := gw.PrimaryAgent.DelegatePrompt(sessionID, msg)
-				if err != nil {
-					slog.Error("failed to handle incoming whatsapp msg", "device", device, "error", err)
-					return
-				}
-				if err := gw.ChannelSend("whatsapp", device, resp); err != nil {
-					slog.Error("failed to send auto-response", "device", device, "error", err)
-				}
+				gw.handleChannelMessage("whatsapp", device, msg)
 			})
 			slog.Info("whatsapp channel re-initialized")
 		}
@@ -295,15 +349,7 @@ func (gw *Gateway) UpdateConfig(newCfg *config.Config) {
 		if ch != nil {
 			gw.Channels["irc"] = ch
 			ch.SetMessageHandler(func(target, msg string) {
-				sessionID := session.DefaultSessionID
-				resp, err := gw.PrimaryAgent.DelegatePrompt(sessionID, msg)
-				if err != nil {
-					slog.Error("failed to handle incoming irc msg", "target", target, "error", err)
-					return
-				}
-				if err := gw.ChannelSend("irc", target, resp); err != nil {
-					slog.Error("failed to send irc response", "target", target, "error", err)
-				}
+				gw.handleChannelMessage("irc", target, msg)
 			})
 			slog.Info("irc channel re-initialized")
 		}
@@ -365,6 +411,23 @@ func (gw *Gateway) GetSkill(name string) (*skills.Skill, error) {
 	return gw.PrimaryAgent.GetSkill(name)
 }
 
+// ListDynamicTools returns the definitions of the loaded dynamic tools.
+func (gw *Gateway) ListDynamicTools() []tools.DynamicToolDef {
+	loaded := tools.DynamicTools()
+	defs := make([]tools.DynamicToolDef, 0, len(loaded))
+	for _, t := range loaded {
+		defs = append(defs, t.Definition())
+	}
+	return defs
+}
+
+// ReloadDynamicTools reloads the dynamic tools from the storage directory. The
+// engines offer them from their next model call on.
+func (gw *Gateway) ReloadDynamicTools() ([]tools.DynamicToolDef, error) {
+	err := tools.LoadDynamicTools(gw.Config.StorageDir)
+	return gw.ListDynamicTools(), err
+}
+
 func (gw *Gateway) AddTask(t *tasks.Task) error {
 	if t.ID == "" {
 		t.ID = uuid.New().String()[:8]
@@ -411,6 +474,18 @@ func (gw *Gateway) CancelSubAgent(id string) error {
 	return gw.DynamicPool.Cancel(id)
 }
 
+func (gw *Gateway) ListRuns() ([]engine.RunInfo, error) {
+	return gw.PrimaryAgent.ListRuns()
+}
+
+func (gw *Gateway) ResumeRun(ctx context.Context, runID string) (string, *llm.Usage, error) {
+	return gw.PrimaryAgent.ResumeRun(ctx, runID)
+}
+
+func (gw *Gateway) DiscardRun(runID string) error {
+	return gw.PrimaryAgent.DiscardRun(runID)
+}
+
 func (gw *Gateway) SetTaskReportHandler(h func(sessionID, taskName, taskID, message string)) {
 	gw.reportMu.Lock()
 	defer gw.reportMu.Unlock()
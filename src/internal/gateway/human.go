@@ -0,0 +1,195 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"miri-main/src/internal/engine"
+	"miri-main/src/internal/session"
+	"miri-main/src/internal/storage"
+	"strings"
+	"time"
+)
+
+// ErrQuestionNotPending is returned when answering a question that was already
+// answered or has expired.
+var ErrQuestionNotPending = errors.New("question is not pending")
+
+// Kinds of human question notifications.
+const (
+	humanNoticeQuestion = "question"
+	humanNoticeAnswer   = "answer"
+)
+
+// AskHuman files a question of the agent (ask_human tool) and pushes it to the
+// WebSocket clients of its session. Channel users get the question as the reply to
+// their message, which the suspended run returns.
+func (gw *Gateway) AskHuman(q *storage.HumanQuestion) error {
+	if err := gw.Storage.SaveHumanQuestion(q); err != nil {
+		return fmt.Errorf("save question: %w", err)
+	}
+	gw.notifyHuman(q, humanNoticeQuestion, q.Question)
+	return nil
+}
+
+// PendingHumanQuestions returns the unanswered questions, oldest first. If sessionID is
+// non-empty, only questions of that session are returned.
+func (gw *Gateway) PendingHumanQuestions(sessionID string) ([]*storage.HumanQuestion, error) {
+	return gw.Storage.ListHumanQuestions(storage.HumanQuestionPending, sessionID)
+}
+
+// AnswerHumanQuestion records the human's answer and continues the suspended run in
+// the background. Its result is delivered to the session the question came from.
+func (gw *Gateway) AnswerHumanQuestion(id, response string) (*storage.HumanQuestion, error) {
+	gw.humanMu.Lock()
+	q, err := gw.Storage.LoadHumanQuestion(id)
+	if err != nil {
+		gw.humanMu.Unlock()
+		return nil, err
+	}
+	if q.Status != storage.HumanQuestionPending {
+		gw.humanMu.Unlock()
+		return nil, fmt.Errorf("question %s is %s: %w", id, q.Status, ErrQuestionNotPending)
+	}
+	q.Status = storage.HumanQuestionAnswered
+	q.Response = response
+	q.AnsweredAt = time.Now().UTC()
+	err = gw.Storage.SaveHumanQuestion(q)
+	gw.humanMu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("save question: %w", err)
+	}
+
+	slog.Info("Human answered question", "question_id", q.ID, "session_id", q.SessionID, "run_id", q.RunID)
+	if q.RunID != "" {
+		go gw.continueAskedRun(q, response)
+	}
+	return q, nil
+}
+
+// expireHumanQuestions continues the runs whose questions were not answered in time;
+// the agent is told to proceed on its own judgement.
+func (gw *Gateway) expireHumanQuestions() {
+	gw.humanMu.Lock()
+	pending, err := gw.PendingHumanQuestions("")
+	if err != nil {
+		gw.humanMu.Unlock()
+		slog.Error("failed to list pending human questions", "error", err)
+		return
+	}
+	now := time.Now()
+	var expired []*storage.HumanQuestion
+	for _, q := range pending {
+		if q.ExpiresAt.IsZero() || now.Before(q.ExpiresAt) {
+			continue
+		}
+		q.Status = storage.HumanQuestionExpired
+		if err := gw.Storage.SaveHumanQuestion(q); err != nil {
+			slog.Error("failed to expire human question", "question_id", q.ID, "error", err)
+			continue
+		}
+		expired = append(expired, q)
+	}
+	gw.humanMu.Unlock()
+
+	for _, q := range expired {
+		slog.Info("Human question expired unanswered", "question_id", q.ID, "session_id", q.SessionID, "run_id", q.RunID)
+		if q.RunID != "" {
+			gw.continueAskedRun(q, "")
+		}
+	}
+}
+
+// answerRetryInterval is how often an answer is offered again to a run that has not
+// suspended on its question yet.
+var answerRetryInterval = time.Second
+
+// continueAskedRun resumes the run that asked q and delivers its result. The question
+// is pushed while the step that asked it still runs its other tool calls (which may
+// wait for an approval), so the answer waits for the run to suspend. An answer the
+// run cannot take puts the question back to pending.
+func (gw *Gateway) continueAskedRun(q *storage.HumanQuestion, answer string) {
+	for {
+		resp, _, err := gw.PrimaryAgent.AnswerRun(context.Background(), q.RunID, answer)
+		if errors.Is(err, engine.ErrRunActive) {
+			time.Sleep(answerRetryInterval)
+			continue
+		}
+		if err != nil {
+			slog.Error("failed to continue run after human question", "question_id", q.ID, "run_id", q.RunID, "error", err)
+			if answer != "" {
+				gw.reopenHumanQuestion(q.ID)
+			}
+			return
+		}
+		gw.notifyHuman(q, humanNoticeAnswer, resp)
+		return
+	}
+}
+
+// reopenHumanQuestion puts an answered question back to pending, so it can be
+// answered again or expire.
+func (gw *Gateway) reopenHumanQuestion(id string) {
+	gw.humanMu.Lock()
+	defer gw.humanMu.Unlock()
+	q, err := gw.Storage.LoadHumanQuestion(id)
+	if err != nil || q.Status != storage.HumanQuestionAnswered {
+		return
+	}
+	q.Status = storage.HumanQuestionPending
+	q.Response = ""
+	q.AnsweredAt = time.Time{}
+	if err := gw.Storage.SaveHumanQuestion(q); err != nil {
+		slog.Error("failed to reopen human question", "question_id", id, "error", err)
+	}
+}
+
+// pendingHumanQuestion returns the newest unanswered question of a session, if any.
+func (gw *Gateway) pendingHumanQuestion(sessionID string) *storage.HumanQuestion {
+	pending, err := gw.PendingHumanQuestions(sessionID)
+	if err != nil || len(pending) == 0 {
+		return nil
+	}
+	return pending[len(pending)-1]
+}
+
+// notifyHuman pushes a question or the result of an answered run to the WebSocket
+// clients of the question's session. Results also go to the channel device the
+// session belongs to.
+func (gw *Gateway) notifyHuman(q *storage.HumanQuestion, kind, message string) {
+	gw.reportMu.RLock()
+	handler := gw.humanHandler
+	gw.reportMu.RUnlock()
+	if handler != nil {
+		handler(q.SessionID, q.ID, kind, message)
+	}
+
+	if kind != humanNoticeAnswer {
+		return
+	}
+	if channel, device, ok := gw.channelOf(q.SessionID); ok {
+		if err := gw.ChannelSend(channel, device, message); err != nil {
+			slog.Error("failed to send run result to channel", "question_id", q.ID, "channel", channel, "device", device, "error", err)
+		}
+	}
+}
+
+// channelOf returns the channel and device of a channel conversation session.
+func (gw *Gateway) channelOf(sessionID string) (string, string, bool) {
+	for name := range gw.Channels {
+		prefix := session.ChannelSessionID(name, "")
+		if device, ok := strings.CutPrefix(sessionID, prefix); ok && device != "" {
+			return name, device, true
+		}
+	}
+	return "", "", false
+}
+
+// SetHumanQuestionHandler sets the function that delivers human question notifications
+// (kind "question" or "answer") to the WebSocket clients of a session.
+func (gw *Gateway) SetHumanQuestionHandler(h func(sessionID, questionID, kind, message string)) {
+	gw.reportMu.Lock()
+	defer gw.reportMu.Unlock()
+	gw.humanHandler = h
+}
@@ -0,0 +1,125 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"miri-main/src/internal/agent"
+	"miri-main/src/internal/engine"
+	"miri-main/src/internal/llm"
+	"miri-main/src/internal/session"
+	"miri-main/src/internal/storage"
+)
+
+// askingEngine holds a run that asked a question and suspends once suspended is set.
+type askingEngine struct {
+	engine.Engine
+
+	mu        sync.Mutex
+	suspended bool
+	waiting   bool
+}
+
+func (e *askingEngine) suspend(waiting bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.suspended, e.waiting = true, waiting
+}
+
+func (e *askingEngine) GetRun(id string) (*engine.RunInfo, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.suspended {
+		return nil, fmt.Errorf("run %s: %w", id, engine.ErrRunActive)
+	}
+	return &engine.RunInfo{ID: id, SessionID: "miri:session:test"}, nil
+}
+
+func (e *askingEngine) AnswerRun(ctx context.Context, sess *session.Session, id, answer string) (string, *llm.Usage, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.waiting {
+		return "", nil, fmt.Errorf("run %s: %w", id, engine.ErrRunNotWaiting)
+	}
+	return "Booked " + answer, nil, nil
+}
+
+func newHumanTestGateway(t *testing.T, eng engine.Engine) *Gateway {
+	t.Helper()
+	st, err := storage.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+	old := answerRetryInterval
+	answerRetryInterval = time.Millisecond
+	t.Cleanup(func() { answerRetryInterval = old })
+	return &Gateway{
+		Storage:      st,
+		PrimaryAgent: &agent.Agent{Eng: eng, SessionMgr: session.NewSessionManager()},
+	}
+}
+
+func TestAnswerHumanQuestion_BeforeRunSuspends(t *testing.T) {
+	eng := &askingEngine{}
+	gw := newHumanTestGateway(t, eng)
+	results := make(chan string, 1)
+	gw.SetHumanQuestionHandler(func(sessionID, questionID, kind, message string) {
+		if kind == humanNoticeAnswer {
+			results <- message
+		}
+	})
+	q := &storage.HumanQuestion{ID: "q1", Status: storage.HumanQuestionPending, Question: "Which city?", SessionID: "miri:session:test", RunID: "r1"}
+	if err := gw.AskHuman(q); err != nil {
+		t.Fatal(err)
+	}
+
+	// The step that asked is still running when the human answers.
+	if _, err := gw.AnswerHumanQuestion("q1", "Zurich"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	eng.suspend(true)
+	select {
+	case got := <-results:
+		if got != "Booked Zurich" {
+			t.Errorf("result = %q, want Booked Zurich", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the run continued once suspended")
+	}
+}
+
+func TestAnswerHumanQuestion_ReopenedWhenRunCannotTakeIt(t *testing.T) {
+	eng := &askingEngine{}
+	eng.suspend(false)
+	gw := newHumanTestGateway(t, eng)
+	q := &storage.HumanQuestion{ID: "q1", Status: storage.HumanQuestionPending, Question: "Which city?", SessionID: "miri:session:test", RunID: "r1"}
+	if err := gw.AskHuman(q); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gw.AnswerHumanQuestion("q1", "Zurich"); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		q, err := gw.Storage.LoadHumanQuestion("q1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q.Status == storage.HumanQuestionPending {
+			if q.Response != "" {
+				t.Errorf("expected the response cleared, got %q", q.Response)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the question pending again, got %s", q.Status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,458 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+
+	"miri-main/src/internal/config"
+)
+
+const (
+	anthropicDefaultBaseURL = "https://api.anthropic.com"
+	anthropicVersion        = "2023-06-01"
+	// anthropicMinThinkingBudget is the smallest thinking budget the API accepts.
+	anthropicMinThinkingBudget = 1024
+)
+
+// ThinkingSignatureKey is the schema.Message Extra key holding the signature of an
+// Anthropic thinking block, which must be sent back with the reasoning on tool turns.
+const ThinkingSignatureKey = "anthropic_thinking_signature"
+
+// anthropicChatModel speaks the Anthropic Messages API.
+type anthropicChatModel struct {
+	url       string
+	header    http.Header
+	model     string
+	maxTokens int
+	reasoning bool
+	tools     []*schema.ToolInfo
+	client    *http.Client
+}
+
+func newAnthropicChatModel(prov config.ProviderConfig, modelName string, mc config.ModelConfig) *anthropicChatModel {
+	base := strings.TrimRight(prov.BaseURL, "/")
+	if base == "" {
+		base = anthropicDefaultBaseURL
+	}
+	if !strings.HasSuffix(base, "/v1") {
+		base += "/v1"
+	}
+	header := http.Header{}
+	header.Set("anthropic-version", anthropicVersion)
+	if prov.APIKey != "" {
+		header.Set("x-api-key", prov.APIKey)
+	}
+	return &anthropicChatModel{
+		url:       base + "/messages",
+		header:    header,
+		model:     modelName,
+		maxTokens: mc.MaxTokens,
+		reasoning: mc.Reasoning,
+		client:    &http.Client{Timeout: requestTimeout},
+	}
+}
+
+func (m *anthropicChatModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	bound := *m
+	bound.tools = tools
+	return &bound, nil
+}
+
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	MaxTokens   int                `json:"max_tokens"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	Tools       []anthropicTool    `json:"tools,omitempty"`
+	ToolChoice  *anthropicChoice   `json:"tool_choice,omitempty"`
+	Temperature *float32           `json:"temperature,omitempty"`
+	TopP        *float32           `json:"top_p,omitempty"`
+	Stop        []string           `json:"stop_sequences,omitempty"`
+	Thinking    *anthropicThinking `json:"thinking,omitempty"`
+	Stream      bool               `json:"stream,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+// anthropicBlock is a content block of a request or response.
+type anthropicBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	Thinking  string          `json:"thinking,omitempty"`
+	Signature string          `json:"signature,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+	Source    *anthropicImage `json:"source,omitempty"`
+}
+
+// anthropicImage is the source of an image block: base64 data or a URL.
+type anthropicImage struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicChoice struct {
+	Type string `json:"type"`
+}
+
+type anthropicThinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+}
+
+type anthropicResponse struct {
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      anthropicUsage   `json:"usage"`
+}
+
+func (m *anthropicChatModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	req, err := m.buildRequest(input, callOptions(m.tools, opts))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := postJSON(ctx, m.client, m.url, m.header, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out anthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	msg := &schema.Message{Role: schema.Assistant}
+	var text []string
+	for _, b := range out.Content {
+		switch b.Type {
+		case "text":
+			text = append(text, b.Text)
+		case "thinking":
+			msg.ReasoningContent += b.Thinking
+			if b.Signature != "" {
+				msg.Extra = map[string]any{ThinkingSignatureKey: b.Signature}
+			}
+		case "tool_use":
+			args := string(b.Input)
+			if args == "" {
+				args = "{}"
+			}
+			msg.ToolCalls = append(msg.ToolCalls, schema.ToolCall{
+				ID:       b.ID,
+				Type:     "function",
+				Function: schema.FunctionCall{Name: b.Name, Arguments: args},
+			})
+		}
+	}
+	msg.Content = strings.Join(text, "")
+	msg.ResponseMeta = anthropicMeta(out.StopReason, out.Usage)
+	setCacheWrite(msg, out.Usage)
+	return msg, nil
+}
+
+func (m *anthropicChatModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	req, err := m.buildRequest(input, callOptions(m.tools, opts))
+	if err != nil {
+		return nil, err
+	}
+	req.Stream = true
+	resp, err := postJSON(ctx, m.client, m.url, m.header, req)
+	if err != nil {
+		return nil, err
+	}
+
+	sr, sw := schema.Pipe[*schema.Message](16)
+	go func() {
+		defer resp.Body.Close()
+		defer sw.Close()
+		if err := readAnthropicStream(resp.Body, sw); err != nil {
+			sw.Send(nil, err)
+		}
+	}()
+	return sr, nil
+}
+
+// anthropicEvent is a server-sent event of a streamed message.
+type anthropicEvent struct {
+	Type  string `json:"type"`
+	Index int    `json:"index"`
+	// message_start
+	Message struct {
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	// content_block_start
+	ContentBlock anthropicBlock `json:"content_block"`
+	// content_block_delta and message_delta
+	Delta struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		Thinking    string `json:"thinking"`
+		Signature   string `json:"signature"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	// message_delta
+	Usage anthropicUsage `json:"usage"`
+	// error
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// readAnthropicStream converts the events of a streamed message into message chunks.
+// Tool calls are keyed by their content block index so schema.ConcatMessages can
+// join their argument deltas; usage and the stop reason come last.
+func readAnthropicStream(body io.Reader, sw *schema.StreamWriter[*schema.Message]) error {
+	var (
+		usage      anthropicUsage
+		stopReason string
+		signature  strings.Builder
+		toolIndex  = map[int]int{}
+	)
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		var ev anthropicEvent
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &ev); err != nil {
+			return fmt.Errorf("decode stream event: %w", err)
+		}
+
+		var chunk *schema.Message
+		switch ev.Type {
+		case "message_start":
+			usage = ev.Message.Usage
+		case "content_block_start":
+			if ev.ContentBlock.Type == "tool_use" {
+				idx := len(toolIndex)
+				toolIndex[ev.Index] = idx
+				chunk = &schema.Message{Role: schema.Assistant, ToolCalls: []schema.ToolCall{{
+					Index:    &idx,
+					ID:       ev.ContentBlock.ID,
+					Type:     "function",
+					Function: schema.FunctionCall{Name: ev.ContentBlock.Name},
+				}}}
+			}
+		case "content_block_delta":
+			switch ev.Delta.Type {
+			case "text_delta":
+				chunk = &schema.Message{Role: schema.Assistant, Content: ev.Delta.Text}
+			case "thinking_delta":
+				chunk = &schema.Message{Role: schema.Assistant, ReasoningContent: ev.Delta.Thinking}
+			case "signature_delta":
+				signature.WriteString(ev.Delta.Signature)
+			case "input_json_delta":
+				if idx, ok := toolIndex[ev.Index]; ok && ev.Delta.PartialJSON != "" {
+					chunk = &schema.Message{Role: schema.Assistant, ToolCalls: []schema.ToolCall{{
+						Index:    &idx,
+						Function: schema.FunctionCall{Arguments: ev.Delta.PartialJSON},
+					}}}
+				}
+			}
+		case "message_delta":
+			if ev.Delta.StopReason != "" {
+				stopReason = ev.Delta.StopReason
+			}
+			if ev.Usage.OutputTokens > 0 {
+				usage.OutputTokens = ev.Usage.OutputTokens
+			}
+		case "error":
+			return fmt.Errorf("API error: %s - %s", ev.Error.Type, ev.Error.Message)
+		}
+		if chunk != nil && sw.Send(chunk, nil) {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	last := &schema.Message{Role: schema.Assistant, ResponseMeta: anthropicMeta(stopReason, usage)}
+	if signature.Len() > 0 {
+		last.Extra = map[string]any{ThinkingSignatureKey: signature.String()}
+	}
+	setCacheWrite(last, usage)
+	sw.Send(last, nil)
+	return nil
+}
+
+// anthropicMeta maps a stop reason and usage to response metadata. Cached input
+// tokens count towards the prompt.
+func anthropicMeta(stopReason string, u anthropicUsage) *schema.ResponseMeta {
+	meta := newUsage(stopReason, u.InputTokens+u.CacheReadInputTokens+u.CacheCreationInputTokens, u.OutputTokens)
+	meta.Usage.PromptTokenDetails.CachedTokens = u.CacheReadInputTokens
+	return meta
+}
+
+// setCacheWrite records the tokens written to the prompt cache on msg, which are
+// priced differently from plain input.
+func setCacheWrite(msg *schema.Message, u anthropicUsage) {
+	if u.CacheCreationInputTokens == 0 {
+		return
+	}
+	if msg.Extra == nil {
+		msg.Extra = make(map[string]any)
+	}
+	msg.Extra[CacheWriteTokensKey] = u.CacheCreationInputTokens
+}
+
+func (m *anthropicChatModel) buildRequest(input []*schema.Message, opts *model.Options) (*anthropicRequest, error) {
+	req := &anthropicRequest{
+		Model:       m.model,
+		MaxTokens:   m.maxTokens,
+		Temperature: opts.Temperature,
+		TopP:        opts.TopP,
+		Stop:        opts.Stop,
+	}
+	if opts.Model != nil && *opts.Model != "" {
+		req.Model = *opts.Model
+	}
+	if opts.MaxTokens != nil && *opts.MaxTokens > 0 {
+		req.MaxTokens = *opts.MaxTokens
+	}
+	if req.MaxTokens <= 0 {
+		req.MaxTokens = defaultMaxTokens
+	}
+	if m.reasoning {
+		budget := max(req.MaxTokens/2, anthropicMinThinkingBudget)
+		if req.MaxTokens <= budget {
+			req.MaxTokens = budget + defaultMaxTokens
+		}
+		req.Thinking = &anthropicThinking{Type: "enabled", BudgetTokens: budget}
+		// Extended thinking rejects sampling overrides.
+		req.Temperature, req.TopP = nil, nil
+	}
+
+	for _, t := range opts.Tools {
+		params, err := toolParameters(t)
+		if err != nil {
+			return nil, err
+		}
+		req.Tools = append(req.Tools, anthropicTool{Name: t.Name, Description: t.Desc, InputSchema: params})
+	}
+	if opts.ToolChoice != nil && len(req.Tools) > 0 {
+		switch *opts.ToolChoice {
+		case schema.ToolChoiceForbidden:
+			req.ToolChoice = &anthropicChoice{Type: "none"}
+		case schema.ToolChoiceForced:
+			req.ToolChoice = &anthropicChoice{Type: "any"}
+		}
+	}
+
+	var system []string
+	for _, msg := range input {
+		switch msg.Role {
+		case schema.System:
+			system = append(system, textOf(msg))
+		case schema.User:
+			blocks, err := userBlocks(msg)
+			if err != nil {
+				return nil, err
+			}
+			req.appendBlocks("user", blocks...)
+		case schema.Assistant:
+			req.appendBlocks("assistant", assistantBlocks(msg)...)
+		case schema.Tool:
+			req.appendBlocks("user", anthropicBlock{Type: "tool_result", ToolUseID: msg.ToolCallID, Content: msg.Content})
+		}
+	}
+	req.System = strings.Join(system, "\n\n")
+	if len(req.Messages) == 0 {
+		return nil, errors.New("no messages to send")
+	}
+	return req, nil
+}
+
+// appendBlocks adds blocks to the conversation, merging them into the previous
+// message when it has the same role: the API requires alternating roles.
+func (r *anthropicRequest) appendBlocks(role string, blocks ...anthropicBlock) {
+	if len(blocks) == 0 {
+		return
+	}
+	if n := len(r.Messages); n > 0 && r.Messages[n-1].Role == role {
+		r.Messages[n-1].Content = append(r.Messages[n-1].Content, blocks...)
+		return
+	}
+	r.Messages = append(r.Messages, anthropicMessage{Role: role, Content: blocks})
+}
+
+// userBlocks converts a user message, including the images of multimodal input.
+func userBlocks(msg *schema.Message) ([]anthropicBlock, error) {
+	if len(msg.UserInputMultiContent) == 0 {
+		return []anthropicBlock{{Type: "text", Text: textOf(msg)}}, nil
+	}
+	var blocks []anthropicBlock
+	if msg.Content != "" {
+		blocks = append(blocks, anthropicBlock{Type: "text", Text: msg.Content})
+	}
+	for _, p := range msg.UserInputMultiContent {
+		switch {
+		case p.Type == schema.ChatMessagePartTypeText:
+			blocks = append(blocks, anthropicBlock{Type: "text", Text: p.Text})
+		case p.Type == schema.ChatMessagePartTypeImageURL && p.Image != nil && p.Image.Base64Data != nil:
+			blocks = append(blocks, anthropicBlock{Type: "image", Source: &anthropicImage{
+				Type: "base64", MediaType: p.Image.MIMEType, Data: *p.Image.Base64Data,
+			}})
+		case p.Type == schema.ChatMessagePartTypeImageURL && p.Image != nil && p.Image.URL != nil:
+			blocks = append(blocks, anthropicBlock{Type: "image", Source: &anthropicImage{Type: "url", URL: *p.Image.URL}})
+		default:
+			return nil, fmt.Errorf("unsupported user input part %q", p.Type)
+		}
+	}
+	return blocks, nil
+}
+
+// assistantBlocks converts an assistant message, replaying signed reasoning so
+// thinking models can continue after tool calls.
+func assistantBlocks(msg *schema.Message) []anthropicBlock {
+	var blocks []anthropicBlock
+	if sig, _ := msg.Extra[ThinkingSignatureKey].(string); sig != "" && msg.ReasoningContent != "" {
+		blocks = append(blocks, anthropicBlock{Type: "thinking", Thinking: msg.ReasoningContent, Signature: sig})
+	}
+	if text := textOf(msg); text != "" {
+		blocks = append(blocks, anthropicBlock{Type: "text", Text: text})
+	}
+	for _, tc := range msg.ToolCalls {
+		input := json.RawMessage(tc.Function.Arguments)
+		if !json.Valid(input) {
+			input = json.RawMessage("{}")
+		}
+		blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: tc.ID, Name: tc.Function.Name, Input: input})
+	}
+	return blocks
+}
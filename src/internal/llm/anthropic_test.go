@@ -0,0 +1,238 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+
+	"miri-main/src/internal/config"
+)
+
+var weatherTool = &schema.ToolInfo{
+	Name: "weather",
+	Desc: "Current weather of a city",
+	ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+		"city": {Type: schema.String, Required: true},
+	}),
+}
+
+// drain concatenates a message stream.
+func drain(t *testing.T, sr *schema.StreamReader[*schema.Message]) *schema.Message {
+	t.Helper()
+	defer sr.Close()
+	var chunks []*schema.Message
+	for {
+		chunk, err := sr.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	msg, err := schema.ConcatMessages(chunks)
+	if err != nil {
+		t.Fatalf("ConcatMessages failed: %v", err)
+	}
+	return msg
+}
+
+func TestAnthropic_GenerateToolCall(t *testing.T) {
+	var got anthropicRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("x-api-key") != "sk-test" || r.Header.Get("anthropic-version") == "" {
+			t.Errorf("missing auth headers: %v", r.Header)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		fmt.Fprint(w, `{"content":[
+			{"type":"thinking","thinking":"Need the weather.","signature":"sig-1"},
+			{"type":"text","text":"Checking."},
+			{"type":"tool_use","id":"toolu_1","name":"weather","input":{"city":"Paris"}}],
+			"stop_reason":"tool_use","usage":{"input_tokens":20,"output_tokens":7,"cache_read_input_tokens":5,"cache_creation_input_tokens":10}}`)
+	}))
+	defer srv.Close()
+
+	prov := config.ProviderConfig{BaseURL: srv.URL, APIKey: "sk-test", API: "anthropic-messages",
+		Models: []config.ModelConfig{{ID: "claude-test", MaxTokens: 8192, Reasoning: true}}}
+	cm, err := NewChatModel(prov, "claude-test")
+	if err != nil {
+		t.Fatalf("NewChatModel failed: %v", err)
+	}
+	cm, _ = cm.WithTools([]*schema.ToolInfo{weatherTool})
+
+	msg, err := cm.Generate(context.Background(), []*schema.Message{
+		schema.SystemMessage("Be brief."),
+		schema.UserMessage("Weather in Paris?"),
+	})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	if got.System != "Be brief." || len(got.Messages) != 1 || got.Messages[0].Role != "user" {
+		t.Errorf("system prompt not split from messages: %+v", got)
+	}
+	if len(got.Tools) != 1 || got.Tools[0].Name != "weather" {
+		t.Errorf("tools not sent: %+v", got.Tools)
+	}
+	if got.Thinking == nil || got.Thinking.BudgetTokens != 4096 || got.MaxTokens != 8192 {
+		t.Errorf("unexpected thinking config: %+v max_tokens=%d", got.Thinking, got.MaxTokens)
+	}
+
+	if msg.Content != "Checking." || msg.ReasoningContent != "Need the weather." {
+		t.Errorf("unexpected content %q / reasoning %q", msg.Content, msg.ReasoningContent)
+	}
+	if len(msg.ToolCalls) != 1 || msg.ToolCalls[0].ID != "toolu_1" || msg.ToolCalls[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Errorf("unexpected tool calls: %+v", msg.ToolCalls)
+	}
+	if msg.Extra[ThinkingSignatureKey] != "sig-1" {
+		t.Errorf("thinking signature not kept: %v", msg.Extra)
+	}
+	if u := msg.ResponseMeta.Usage; u.PromptTokens != 35 || u.CompletionTokens != 7 || u.PromptTokenDetails.CachedTokens != 5 {
+		t.Errorf("unexpected usage: %+v", u)
+	}
+	if msg.Extra[CacheWriteTokensKey] != 10 {
+		t.Errorf("cache write tokens not kept: %v", msg.Extra)
+	}
+}
+
+func TestAnthropic_ToolResultsFollowToolUse(t *testing.T) {
+	m := newAnthropicChatModel(config.ProviderConfig{}, "claude-test", config.ModelConfig{})
+	assistant := schema.AssistantMessage("", []schema.ToolCall{
+		{ID: "a", Function: schema.FunctionCall{Name: "weather", Arguments: `{"city":"Paris"}`}},
+		{ID: "b", Function: schema.FunctionCall{Name: "weather", Arguments: `{"city":"Rome"}`}},
+	})
+	assistant.ReasoningContent = "Two cities."
+	assistant.Extra = map[string]any{ThinkingSignatureKey: "sig"}
+
+	req, err := m.buildRequest([]*schema.Message{
+		schema.UserMessage("Weather in Paris and Rome?"),
+		assistant,
+		schema.ToolMessage("sunny", "a"),
+		schema.ToolMessage("rainy", "b"),
+	}, callOptions(nil, nil))
+	if err != nil {
+		t.Fatalf("buildRequest failed: %v", err)
+	}
+
+	if len(req.Messages) != 3 {
+		t.Fatalf("expected user/assistant/user turns, got %d messages", len(req.Messages))
+	}
+	if blocks := req.Messages[1].Content; len(blocks) != 3 || blocks[0].Type != "thinking" || blocks[0].Signature != "sig" {
+		t.Errorf("unexpected assistant blocks: %+v", blocks)
+	}
+	results := req.Messages[2].Content
+	if req.Messages[2].Role != "user" || len(results) != 2 || results[1].ToolUseID != "b" || results[1].Content != "rainy" {
+		t.Errorf("tool results not merged into one user turn: %+v", req.Messages[2])
+	}
+	if req.MaxTokens != defaultMaxTokens {
+		t.Errorf("expected default max_tokens, got %d", req.MaxTokens)
+	}
+}
+
+// imageMessage is a user question about a base64 PNG.
+func imageMessage() *schema.Message {
+	data := "aW1n"
+	return &schema.Message{Role: schema.User, UserInputMultiContent: []schema.MessageInputPart{
+		{Type: schema.ChatMessagePartTypeText, Text: "What is this?"},
+		{Type: schema.ChatMessagePartTypeImageURL, Image: &schema.MessageInputImage{
+			MessagePartCommon: schema.MessagePartCommon{Base64Data: &data, MIMEType: "image/png"},
+		}},
+	}}
+}
+
+func TestAnthropic_ImageInput(t *testing.T) {
+	m := newAnthropicChatModel(config.ProviderConfig{}, "claude-test", config.ModelConfig{})
+	req, err := m.buildRequest([]*schema.Message{imageMessage()}, callOptions(nil, nil))
+	if err != nil {
+		t.Fatalf("buildRequest failed: %v", err)
+	}
+	blocks := req.Messages[0].Content
+	if len(blocks) != 2 || blocks[0].Text != "What is this?" || blocks[1].Type != "image" {
+		t.Fatalf("unexpected blocks: %+v", blocks)
+	}
+	if src := blocks[1].Source; src.Type != "base64" || src.MediaType != "image/png" || src.Data != "aW1n" {
+		t.Errorf("unexpected image source: %+v", src)
+	}
+}
+
+func TestAnthropic_Stream(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"usage":{"input_tokens":12,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"Hmm."}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig-2"}}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Let me "}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"check."}}`,
+		`{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_9","name":"weather","input":{}}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"\"Oslo\"}"}}`,
+		`{"type":"content_block_stop","index":2}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":30}}`,
+		`{"type":"message_stop"}`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req anthropicRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream {
+			t.Error("expected a streaming request")
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, ev := range events {
+			var typ struct{ Type string }
+			_ = json.Unmarshal([]byte(ev), &typ)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typ.Type, ev)
+		}
+	}))
+	defer srv.Close()
+
+	cm, err := NewChatModel(config.ProviderConfig{BaseURL: srv.URL + "/v1", API: "anthropic"}, "claude-test")
+	if err != nil {
+		t.Fatalf("NewChatModel failed: %v", err)
+	}
+	sr, err := cm.Stream(context.Background(), []*schema.Message{schema.UserMessage("Weather in Oslo?")})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	msg := drain(t, sr)
+
+	if msg.Content != "Let me check." || msg.ReasoningContent != "Hmm." {
+		t.Errorf("unexpected content %q / reasoning %q", msg.Content, msg.ReasoningContent)
+	}
+	if len(msg.ToolCalls) != 1 || msg.ToolCalls[0].ID != "toolu_9" || msg.ToolCalls[0].Function.Arguments != `{"city":"Oslo"}` {
+		t.Errorf("unexpected tool calls: %+v", msg.ToolCalls)
+	}
+	if msg.Extra[ThinkingSignatureKey] != "sig-2" {
+		t.Errorf("thinking signature not kept: %v", msg.Extra)
+	}
+	if msg.ResponseMeta.FinishReason != "tool_use" || msg.ResponseMeta.Usage.PromptTokens != 12 || msg.ResponseMeta.Usage.CompletionTokens != 30 {
+		t.Errorf("unexpected response meta: %+v %+v", msg.ResponseMeta, msg.ResponseMeta.Usage)
+	}
+}
+
+func TestAnthropic_APIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`)
+	}))
+	defer srv.Close()
+
+	cm, _ := NewChatModel(config.ProviderConfig{BaseURL: srv.URL, API: "anthropic-messages"}, "claude-test")
+	_, err := cm.Generate(context.Background(), []*schema.Message{schema.UserMessage("hi")})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,164 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino-ext/components/model/openai"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+
+	"miri-main/src/internal/config"
+)
+
+// Provider APIs (ProviderConfig.API). An empty API is OpenAI-compatible.
+const (
+	APIOpenAI            = "openai"
+	APIOpenAICompletions = "openai-completions"
+	APIAnthropicMessages = "anthropic-messages"
+	APIOllamaChat        = "ollama-chat"
+)
+
+// defaultMaxTokens caps the answer of APIs that require a limit when the model
+// config has no maxTokens.
+const defaultMaxTokens = 4096
+
+// requestTimeout bounds a whole model call, streaming included.
+const requestTimeout = 30 * time.Minute
+
+// NewChatModel creates the chat model of a provider, speaking the provider's API:
+// OpenAI chat completions, the Anthropic Messages API, the Ollama chat API or the
+// offline mock.
+func NewChatModel(prov config.ProviderConfig, modelName string) (model.ToolCallingChatModel, error) {
+	mc := providerModel(prov, modelName)
+	switch normalizeAPI(prov.API) {
+	case APIOpenAI:
+		return openai.NewChatModel(context.Background(), &openai.ChatModelConfig{
+			BaseURL: prov.BaseURL,
+			APIKey:  prov.APIKey,
+			Model:   modelName,
+			Timeout: requestTimeout,
+		})
+	case APIAnthropicMessages:
+		return newAnthropicChatModel(prov, modelName, mc), nil
+	case APIOllamaChat:
+		return newOllamaChatModel(prov, modelName, mc), nil
+	case APIMock:
+		return newMockChatModel(prov, modelName)
+	default:
+		return nil, fmt.Errorf("unsupported provider API %q", prov.API)
+	}
+}
+
+// normalizeAPI maps the accepted spellings of an API to its constant.
+func normalizeAPI(api string) string {
+	switch strings.ToLower(strings.TrimSpace(api)) {
+	case "", APIOpenAI, APIOpenAICompletions:
+		return APIOpenAI
+	case "anthropic", APIAnthropicMessages:
+		return APIAnthropicMessages
+	case "ollama", APIOllamaChat:
+		return APIOllamaChat
+	case APIMock:
+		return APIMock
+	default:
+		return api
+	}
+}
+
+// providerModel returns the configured entry of a provider's model, if any.
+func providerModel(prov config.ProviderConfig, modelName string) config.ModelConfig {
+	for _, m := range prov.Models {
+		if m.ID == modelName || m.Name == modelName || strings.HasSuffix(m.ID, "/"+modelName) {
+			return m
+		}
+	}
+	return config.ModelConfig{}
+}
+
+// callOptions applies opts over the tools bound to a model.
+func callOptions(tools []*schema.ToolInfo, opts []model.Option) *model.Options {
+	return model.GetCommonOptions(&model.Options{Tools: tools}, opts...)
+}
+
+// postJSON sends body to url and returns the response, which the caller closes.
+// Responses other than 200 are returned as errors carrying the response body.
+func postJSON(ctx context.Context, client *http.Client, url string, header http.Header, body any) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header.Clone()
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("API error: %d - %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// toolParameters returns the JSON schema of a tool's parameters, an empty object
+// schema for tools without any.
+func toolParameters(info *schema.ToolInfo) (json.RawMessage, error) {
+	if info.ParamsOneOf == nil {
+		return json.RawMessage(`{"type":"object","properties":{}}`), nil
+	}
+	js, err := info.ParamsOneOf.ToJSONSchema()
+	if err != nil {
+		return nil, fmt.Errorf("tool %s: %w", info.Name, err)
+	}
+	if js == nil {
+		return json.RawMessage(`{"type":"object","properties":{}}`), nil
+	}
+	data, err := json.Marshal(js)
+	if err != nil {
+		return nil, fmt.Errorf("tool %s: %w", info.Name, err)
+	}
+	return data, nil
+}
+
+// textOf returns the text of a message, joining its text parts when it has no content.
+func textOf(m *schema.Message) string {
+	if m.Content != "" {
+		return m.Content
+	}
+	var parts []string
+	for _, p := range m.UserInputMultiContent {
+		if p.Type == schema.ChatMessagePartTypeText {
+			parts = append(parts, p.Text)
+		}
+	}
+	for _, p := range m.MultiContent {
+		if p.Type == schema.ChatMessagePartTypeText {
+			parts = append(parts, p.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// newUsage returns the response metadata of a call.
+func newUsage(finishReason string, prompt, completion int) *schema.ResponseMeta {
+	return &schema.ResponseMeta{
+		FinishReason: finishReason,
+		Usage: &schema.TokenUsage{
+			PromptTokens:     prompt,
+			CompletionTokens: completion,
+			TotalTokens:      prompt + completion,
+		},
+	}
+}
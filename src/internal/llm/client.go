@@ -1,15 +1,13 @@
 package llm
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
 	"log/slog"
 	"miri-main/src/internal/config"
-	"net/http"
 	"strings"
-	"time"
+
+	"github.com/cloudwego/eino/schema"
 )
 
 type Message struct {
@@ -19,23 +17,16 @@ type Message struct {
 
 type Usage struct {
 	PromptTokens     int     `json:"prompt_tokens"`
+	CachedTokens     int     `json:"cached_tokens,omitempty"`
+	CacheWriteTokens int     `json:"cache_write_tokens,omitempty"`
 	CompletionTokens int     `json:"completion_tokens"`
 	TotalTokens      int     `json:"total_tokens"`
 	TotalCost        float64 `json:"total_cost,omitempty"`
+	Model            string  `json:"model,omitempty"`
 }
 
-type ChatCompletionRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
-}
-
-type ChatCompletionResponse struct {
-	Choices []struct {
-		Message Message `json:"message"`
-	} `json:"choices"`
-	Usage *Usage `json:"usage,omitempty"`
-}
-
+// ChatCompletion sends messages to modelStr ("provider/model") using the API the
+// provider is configured with, and returns the answer and its usage.
 func ChatCompletion(cfg *config.Config, modelStr string, messages []Message) (string, *Usage, error) {
 	if cfg.Models.Mode != "merge" {
 		return "", nil, fmt.Errorf("unsupported models.mode: %s", cfg.Models.Mode)
@@ -52,59 +43,30 @@ func ChatCompletion(cfg *config.Config, modelStr string, messages []Message) (st
 		return "", nil, fmt.Errorf("provider %q not configured", provider)
 	}
 
-	if prov.API != "openai-completions" {
-		return "", nil, fmt.Errorf("unsupported provider API %q", prov.API)
-	}
-
-	url := strings.TrimRight(prov.BaseURL, "/") + "/chat/completions"
-
-	reqBody := ChatCompletionRequest{
-		Model:    model,
-		Messages: messages,
-	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", nil, err
-	}
-	slog.Debug("LLM request", "payload", string(jsonData))
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	cm, err := NewChatModel(prov, model)
 	if err != nil {
 		return "", nil, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	if prov.APIKey != "" {
-		req.Header.Set("Authorization", "Bearer "+prov.APIKey)
+	input := make([]*schema.Message, 0, len(messages))
+	for _, m := range messages {
+		input = append(input, &schema.Message{Role: schema.RoleType(m.Role), Content: m.Content})
 	}
+	slog.Debug("LLM request", "model", modelStr, "messages", len(input))
 
-	client := &http.Client{
-		Timeout: 300 * time.Second,
-	}
-	resp, err := client.Do(req)
+	msg, err := cm.Generate(context.Background(), input)
 	if err != nil {
-		return "", nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", nil, err
+		return "", nil, fmt.Errorf("%s: %w", provider, err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", nil, fmt.Errorf("%s API error: %d - %s", provider, resp.StatusCode, string(body))
+	usage := &Usage{Model: modelStr}
+	if msg.ResponseMeta != nil && msg.ResponseMeta.Usage != nil {
+		usage.PromptTokens = msg.ResponseMeta.Usage.PromptTokens
+		usage.CachedTokens = msg.ResponseMeta.Usage.PromptTokenDetails.CachedTokens
+		usage.CacheWriteTokens, _ = msg.Extra[CacheWriteTokensKey].(int)
+		usage.CompletionTokens = msg.ResponseMeta.Usage.CompletionTokens
+		usage.TotalTokens = msg.ResponseMeta.Usage.TotalTokens
+		usage.TotalCost = MessageCost(providerModel(prov, model).Cost, msg)
 	}
-
-	var completionResp ChatCompletionResponse
-	if err := json.Unmarshal(body, &completionResp); err != nil {
-		return "", nil, err
-	}
-
-	if len(completionResp.Choices) == 0 {
-		return "", nil, fmt.Errorf("no choices returned from %s API", provider)
-	}
-
-	return completionResp.Choices[0].Message.Content, completionResp.Usage, nil
+	return msg.Content, usage, nil
 }
@@ -0,0 +1,50 @@
+package llm
+
+import (
+	"github.com/cloudwego/eino/schema"
+
+	"miri-main/src/internal/config"
+)
+
+// CacheWriteTokensKey is the schema.Message Extra key holding the number of prompt
+// tokens written to the provider's prompt cache (Anthropic's cache creation tokens).
+const CacheWriteTokensKey = "cache_write_tokens"
+
+// CallCost returns the cost of a model call. Prices are per 1M tokens; prompt
+// includes the cached (read) and cache-write tokens, which are priced at
+// cacheRead and cacheWrite, or at input when those are not configured.
+func CallCost(c config.ModelCost, prompt, cached, cacheWrite, completion int) float64 {
+	cacheRead, write := c.CacheRead, c.CacheWrite
+	if cacheRead == 0 {
+		cacheRead = c.Input
+	}
+	if write == 0 {
+		write = c.Input
+	}
+	uncached := max(prompt-cached-cacheWrite, 0)
+	return (float64(uncached)*c.Input + float64(cached)*cacheRead + float64(cacheWrite)*write +
+		float64(completion)*c.Output) / 1000000.0
+}
+
+// TokenUsage returns the prompt, cached, cache-write and completion tokens
+// reported on msg.
+func TokenUsage(msg *schema.Message) (prompt, cached, cacheWrite, completion int) {
+	if msg == nil || msg.ResponseMeta == nil || msg.ResponseMeta.Usage == nil {
+		return 0, 0, 0, 0
+	}
+	u := msg.ResponseMeta.Usage
+	// Recorded messages come back from JSON with float64 numbers.
+	switch n := msg.Extra[CacheWriteTokensKey].(type) {
+	case int:
+		cacheWrite = n
+	case float64:
+		cacheWrite = int(n)
+	}
+	return u.PromptTokens, u.PromptTokenDetails.CachedTokens, cacheWrite, u.CompletionTokens
+}
+
+// MessageCost returns the cost of the model call that produced msg.
+func MessageCost(c config.ModelCost, msg *schema.Message) float64 {
+	prompt, cached, cacheWrite, completion := TokenUsage(msg)
+	return CallCost(c, prompt, cached, cacheWrite, completion)
+}
@@ -0,0 +1,45 @@
+package llm
+
+import (
+	"math"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+
+	"miri-main/src/internal/config"
+)
+
+func TestCallCost(t *testing.T) {
+	price := config.ModelCost{Input: 3, Output: 15, CacheRead: 0.3, CacheWrite: 3.75}
+	cases := []struct {
+		name                                   string
+		cost                                   config.ModelCost
+		prompt, cached, cacheWrite, completion int
+		want                                   float64
+	}{
+		{"uncached", price, 1000000, 0, 0, 1000000, 18},
+		{"cache read", price, 1000000, 800000, 0, 0, 0.2*3 + 0.8*0.3},
+		{"cache write", price, 1000000, 0, 1000000, 0, 3.75},
+		{"no cache prices", config.ModelCost{Input: 2, Output: 8}, 1000000, 500000, 0, 0, 2},
+	}
+	for _, c := range cases {
+		if got := CallCost(c.cost, c.prompt, c.cached, c.cacheWrite, c.completion); math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestMessageCost(t *testing.T) {
+	msg := &schema.Message{
+		Role:         schema.Assistant,
+		ResponseMeta: newUsage("stop", 1000000, 0),
+		// As decoded from a recorded cassette.
+		Extra: map[string]any{CacheWriteTokensKey: float64(1000000)},
+	}
+	if got := MessageCost(config.ModelCost{Input: 3, CacheWrite: 3.75}, msg); math.Abs(got-3.75) > 1e-9 {
+		t.Errorf("expected cache write pricing, got %v", got)
+	}
+	if MessageCost(config.ModelCost{Input: 3}, schema.AssistantMessage("hi", nil)) != 0 {
+		t.Error("expected no cost without usage")
+	}
+}
@@ -0,0 +1,121 @@
+package llm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"miri-main/src/internal/config"
+)
+
+// imageTimeout bounds an image generation request, downloads included.
+const imageTimeout = 5 * time.Minute
+
+// maxImageDownload caps an image fetched from a URL the images API returned.
+const maxImageDownload = 32 << 20
+
+// GeneratedImage is one image of an images API response.
+type GeneratedImage struct {
+	Data []byte
+	// RevisedPrompt is the prompt the model actually drew, when it rewrote it.
+	RevisedPrompt string
+}
+
+type imageRequest struct {
+	Model          string `json:"model"`
+	Prompt         string `json:"prompt"`
+	N              int    `json:"n,omitempty"`
+	ResponseFormat string `json:"response_format"`
+}
+
+type imageResponse struct {
+	Data []struct {
+		B64JSON       string `json:"b64_json"`
+		URL           string `json:"url"`
+		RevisedPrompt string `json:"revised_prompt"`
+	} `json:"data"`
+}
+
+// HasImagesAPI reports whether prov speaks an API with an images endpoint.
+func HasImagesAPI(prov config.ProviderConfig) bool {
+	return normalizeAPI(prov.API) == APIOpenAI
+}
+
+// GenerateImages asks the OpenAI-compatible images API of a provider
+// (POST <baseUrl>/images/generations) for n images of prompt.
+func GenerateImages(ctx context.Context, prov config.ProviderConfig, modelName, prompt string, n int) ([]GeneratedImage, error) {
+	if !HasImagesAPI(prov) {
+		return nil, fmt.Errorf("provider API %q has no images endpoint", prov.API)
+	}
+	if n < 1 {
+		n = 1
+	}
+	header := http.Header{}
+	if prov.APIKey != "" {
+		header.Set("Authorization", "Bearer "+prov.APIKey)
+	}
+	client := &http.Client{Timeout: imageTimeout}
+	url := strings.TrimRight(prov.BaseURL, "/") + "/images/generations"
+	resp, err := postJSON(ctx, client, url, header, imageRequest{Model: modelName, Prompt: prompt, N: n, ResponseFormat: "b64_json"})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out imageResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	if len(out.Data) == 0 {
+		return nil, errors.New("images API returned no images")
+	}
+
+	images := make([]GeneratedImage, 0, len(out.Data))
+	for _, d := range out.Data {
+		img := GeneratedImage{RevisedPrompt: d.RevisedPrompt}
+		switch {
+		case d.B64JSON != "":
+			if img.Data, err = base64.StdEncoding.DecodeString(d.B64JSON); err != nil {
+				return nil, fmt.Errorf("decode image: %w", err)
+			}
+		case d.URL != "":
+			// Some providers ignore response_format and return links.
+			if img.Data, err = downloadImage(ctx, client, d.URL); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, errors.New("image without data or url")
+		}
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+func downloadImage(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download image: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download image: status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageDownload+1))
+	if err != nil {
+		return nil, fmt.Errorf("download image: %w", err)
+	}
+	if len(data) > maxImageDownload {
+		return nil, fmt.Errorf("download image: larger than %d MB", maxImageDownload>>20)
+	}
+	return data, nil
+}
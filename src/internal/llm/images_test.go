@@ -0,0 +1,62 @@
+package llm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"miri-main/src/internal/config"
+)
+
+func TestGenerateImages(t *testing.T) {
+	var got imageRequest
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/images/generations":
+			if r.Header.Get("Authorization") != "Bearer key" {
+				t.Errorf("missing API key, got %q", r.Header.Get("Authorization"))
+			}
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			fmt.Fprintf(w, `{"data":[{"b64_json":%q,"revised_prompt":"a red fox in snow"},{"url":%q}]}`,
+				base64.StdEncoding.EncodeToString([]byte("first")), srv.URL+"/files/second.jpg")
+		case "/files/second.jpg":
+			w.Write([]byte("second"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	prov := config.ProviderConfig{BaseURL: srv.URL + "/v1/", APIKey: "key"}
+	images, err := GenerateImages(context.Background(), prov, "grok-2-image-1212", "a fox", 2)
+	if err != nil {
+		t.Fatalf("GenerateImages failed: %v", err)
+	}
+	if got.Model != "grok-2-image-1212" || got.Prompt != "a fox" || got.N != 2 || got.ResponseFormat != "b64_json" {
+		t.Errorf("unexpected request: %+v", got)
+	}
+	if len(images) != 2 || string(images[0].Data) != "first" || images[0].RevisedPrompt != "a red fox in snow" || string(images[1].Data) != "second" {
+		t.Errorf("unexpected images: %+v", images)
+	}
+}
+
+func TestGenerateImages_Errors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"content policy"}`, http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	if _, err := GenerateImages(context.Background(), config.ProviderConfig{BaseURL: srv.URL}, "m", "x", 1); err == nil {
+		t.Error("expected the API error")
+	}
+	if _, err := GenerateImages(context.Background(), config.ProviderConfig{API: APIAnthropicMessages}, "m", "x", 1); err == nil {
+		t.Error("expected an error for a provider without images API")
+	}
+}
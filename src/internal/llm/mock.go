@@ -0,0 +1,230 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"gopkg.in/yaml.v3"
+
+	"miri-main/src/internal/config"
+)
+
+// APIMock serves scripted responses from a fixture file instead of calling a model.
+const APIMock = "mock"
+
+// MockFixture is the scripted responses file of the mock API (YAML or JSON).
+//
+//	responses:
+//	  - match: weather          # case-insensitive substring of the last message
+//	    role: user              # role of the last message, any when empty
+//	    tool_calls:
+//	      - name: web_search
+//	        arguments: {query: "weather in Paris"}
+//	  - role: tool
+//	    content: It is sunny in Paris.
+type MockFixture struct {
+	Responses []MockResponse `yaml:"responses" json:"responses"`
+}
+
+// MockResponse is one scripted answer. The first response whose conditions hold
+// for the last input message is returned.
+type MockResponse struct {
+	Match     string         `yaml:"match" json:"match"`
+	Role      string         `yaml:"role" json:"role"`
+	Content   string         `yaml:"content" json:"content"`
+	Reasoning string         `yaml:"reasoning" json:"reasoning"`
+	ToolCalls []MockToolCall `yaml:"tool_calls" json:"tool_calls"`
+}
+
+// MockToolCall is a scripted tool call. Arguments may be a JSON string or any
+// YAML value, which is encoded as JSON.
+type MockToolCall struct {
+	Name      string `yaml:"name" json:"name"`
+	Arguments any    `yaml:"arguments" json:"arguments"`
+}
+
+// mockBuiltins answer the Brain's maintenance prompts when no fixture matches, so
+// the pipeline runs against the mock without any setup. Keys are phrases of the
+// prompt templates in templates/brain.
+var mockBuiltins = []MockResponse{
+	{Match: "reasoning topology annotator", Content: `{"steps":[{"id":1,"content":"Understand the request"},{"id":2,"content":"Answer it"}],` +
+		`"bonds":[{"from":1,"to":2,"type":"D","explanation":"The answer follows from the request"}],` +
+		`"topology_score":7,"bond_distribution":{"D":1.0,"R":0.0,"E":0.0},"assessment":"Short linear chain without reflection"}`},
+	{Match: "information deduplication", Content: "[]"},
+	{Match: "memory extractor", Content: "[]"},
+	{Match: "information extraction specialist", Content: "[]"},
+	{Match: "constructive critic", Content: `{"user_goal":"mock","addressed_score":5,"strengths":[],"weaknesses":[],` +
+		`"improvement_ideas":[],"overall_score":5,"justification":"Scripted mock reflection"}`},
+}
+
+// mockChatModel implements the mock API. Usage is derived from the text length
+// (4 characters per token), so identical inputs always report identical numbers.
+type mockChatModel struct {
+	model     string
+	responses []MockResponse
+	tools     []*schema.ToolInfo
+}
+
+func newMockChatModel(prov config.ProviderConfig, modelName string) (*mockChatModel, error) {
+	m := &mockChatModel{model: modelName}
+	if prov.Fixtures == "" {
+		return m, nil
+	}
+	fx, err := LoadMockFixture(prov.Fixtures)
+	if err != nil {
+		return nil, err
+	}
+	m.responses = fx.Responses
+	return m, nil
+}
+
+// LoadMockFixture reads a fixture file of the mock API.
+func LoadMockFixture(path string) (*MockFixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read mock fixtures: %w", err)
+	}
+	var fx MockFixture
+	if err := yaml.Unmarshal(data, &fx); err != nil {
+		return nil, fmt.Errorf("parse mock fixtures %s: %w", path, err)
+	}
+	return &fx, nil
+}
+
+func (m *mockChatModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	bound := *m
+	bound.tools = tools
+	return &bound, nil
+}
+
+func (m *mockChatModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.answer(input)
+}
+
+// Stream sends the answer word by word, then its tool calls and usage.
+func (m *mockChatModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	msg, err := m.answer(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var chunks []*schema.Message
+	if msg.ReasoningContent != "" {
+		chunks = append(chunks, &schema.Message{Role: schema.Assistant, ReasoningContent: msg.ReasoningContent})
+	}
+	for _, word := range strings.SplitAfter(msg.Content, " ") {
+		if word != "" {
+			chunks = append(chunks, &schema.Message{Role: schema.Assistant, Content: word})
+		}
+	}
+	for i, tc := range msg.ToolCalls {
+		idx := i
+		tc.Index = &idx
+		chunks = append(chunks, &schema.Message{Role: schema.Assistant, ToolCalls: []schema.ToolCall{tc}})
+	}
+	chunks = append(chunks, &schema.Message{Role: schema.Assistant, ResponseMeta: msg.ResponseMeta})
+	return schema.StreamReaderFromArray(chunks), nil
+}
+
+func (m *mockChatModel) answer(input []*schema.Message) (*schema.Message, error) {
+	var last *schema.Message
+	if len(input) > 0 {
+		last = input[len(input)-1]
+	}
+	resp, ok := matchMock(m.responses, last)
+	if !ok {
+		resp, ok = matchMock(mockBuiltins, last)
+	}
+	if !ok {
+		resp = MockResponse{Content: "mock answer"}
+		if last != nil {
+			resp.Content = fmt.Sprintf("[%s] %s", m.model, textOf(last))
+		}
+	}
+
+	// Tool call IDs are numbered by turn so they stay unique within a run.
+	turn := 0
+	for _, msg := range input {
+		if msg.Role == schema.Assistant {
+			turn++
+		}
+	}
+	msg := &schema.Message{Role: schema.Assistant, Content: resp.Content, ReasoningContent: resp.Reasoning}
+	for i, tc := range resp.ToolCalls {
+		args, err := mockArguments(tc.Arguments)
+		if err != nil {
+			return nil, fmt.Errorf("mock tool call %s: %w", tc.Name, err)
+		}
+		msg.ToolCalls = append(msg.ToolCalls, schema.ToolCall{
+			ID:       fmt.Sprintf("mock_call_%d_%d", turn, i),
+			Type:     "function",
+			Function: schema.FunctionCall{Name: tc.Name, Arguments: args},
+		})
+	}
+
+	var prompt int
+	for _, in := range input {
+		prompt += mockTokens(textOf(in))
+		for _, tc := range in.ToolCalls {
+			prompt += mockTokens(tc.Function.Arguments)
+		}
+	}
+	completion := mockTokens(msg.Content) + mockTokens(msg.ReasoningContent)
+	for _, tc := range msg.ToolCalls {
+		completion += mockTokens(tc.Function.Arguments)
+	}
+	finish := "stop"
+	if len(msg.ToolCalls) > 0 {
+		finish = "tool_calls"
+	}
+	msg.ResponseMeta = newUsage(finish, prompt, completion)
+	return msg, nil
+}
+
+// matchMock returns the first response whose conditions hold for last.
+func matchMock(responses []MockResponse, last *schema.Message) (MockResponse, bool) {
+	var role, text string
+	if last != nil {
+		role, text = string(last.Role), strings.ToLower(textOf(last))
+	}
+	for _, r := range responses {
+		if r.Role != "" && r.Role != role {
+			continue
+		}
+		if r.Match != "" && !strings.Contains(text, strings.ToLower(r.Match)) {
+			continue
+		}
+		return r, true
+	}
+	return MockResponse{}, false
+}
+
+func mockArguments(v any) (string, error) {
+	switch a := v.(type) {
+	case nil:
+		return "{}", nil
+	case string:
+		return a, nil
+	default:
+		data, err := json.Marshal(a)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+}
+
+func mockTokens(s string) int {
+	return (len(s) + 3) / 4
+}
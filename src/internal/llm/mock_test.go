@@ -0,0 +1,109 @@
+package llm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+
+	"miri-main/src/internal/config"
+)
+
+const testFixture = `
+responses:
+  - match: weather
+    role: user
+    reasoning: The weather needs a lookup.
+    tool_calls:
+      - name: weather
+        arguments: {city: Paris}
+  - role: tool
+    content: It is sunny in Paris.
+`
+
+func newTestMock(t *testing.T) *mockChatModel {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "mock.yaml")
+	if err := os.WriteFile(path, []byte(testFixture), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cm, err := NewChatModel(config.ProviderConfig{API: "mock", Fixtures: path}, "scripted")
+	if err != nil {
+		t.Fatalf("NewChatModel failed: %v", err)
+	}
+	return cm.(*mockChatModel)
+}
+
+func TestMock_ScriptedToolLoop(t *testing.T) {
+	m := newTestMock(t)
+	input := []*schema.Message{schema.UserMessage("What is the Weather in Paris?")}
+
+	first, err := m.Generate(context.Background(), input)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if len(first.ToolCalls) != 1 || first.ToolCalls[0].Function.Arguments != `{"city":"Paris"}` || first.ToolCalls[0].ID != "mock_call_0_0" {
+		t.Fatalf("unexpected tool calls: %+v", first.ToolCalls)
+	}
+	if first.ReasoningContent == "" || first.ResponseMeta.FinishReason != "tool_calls" {
+		t.Errorf("unexpected reasoning %q / finish %q", first.ReasoningContent, first.ResponseMeta.FinishReason)
+	}
+
+	input = append(input, first, schema.ToolMessage("sunny", first.ToolCalls[0].ID))
+	second, err := m.Generate(context.Background(), input)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if second.Content != "It is sunny in Paris." || len(second.ToolCalls) != 0 {
+		t.Errorf("unexpected final answer: %+v", second)
+	}
+
+	again, _ := m.Generate(context.Background(), input)
+	if *again.ResponseMeta.Usage != *second.ResponseMeta.Usage || second.ResponseMeta.Usage.TotalTokens == 0 {
+		t.Errorf("usage is not deterministic: %+v vs %+v", again.ResponseMeta.Usage, second.ResponseMeta.Usage)
+	}
+}
+
+func TestMock_BuiltinsAndEcho(t *testing.T) {
+	m := newTestMock(t)
+
+	topo, _ := m.Generate(context.Background(), []*schema.Message{schema.UserMessage("You are a strict reasoning topology annotator ...")})
+	if !strings.HasPrefix(topo.Content, `{"steps":`) {
+		t.Errorf("expected topology JSON, got %q", topo.Content)
+	}
+	dedup, _ := m.Generate(context.Background(), []*schema.Message{schema.UserMessage("You are an expert in information deduplication.")})
+	if dedup.Content != "[]" {
+		t.Errorf("expected empty dedup list, got %q", dedup.Content)
+	}
+	echo, _ := m.Generate(context.Background(), []*schema.Message{schema.UserMessage("hello")})
+	if echo.Content != "[scripted] hello" {
+		t.Errorf("unexpected echo %q", echo.Content)
+	}
+}
+
+func TestMock_Stream(t *testing.T) {
+	m := newTestMock(t)
+	input := []*schema.Message{schema.UserMessage("weather?")}
+	want, _ := m.Generate(context.Background(), input)
+
+	sr, err := m.Stream(context.Background(), input)
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	got := drain(t, sr)
+	if got.ReasoningContent != want.ReasoningContent || len(got.ToolCalls) != 1 || got.ToolCalls[0].ID != want.ToolCalls[0].ID {
+		t.Errorf("stream differs from Generate: %+v", got)
+	}
+	if got.ResponseMeta.Usage.TotalTokens != want.ResponseMeta.Usage.TotalTokens {
+		t.Errorf("stream usage %d, want %d", got.ResponseMeta.Usage.TotalTokens, want.ResponseMeta.Usage.TotalTokens)
+	}
+}
+
+func TestMock_MissingFixture(t *testing.T) {
+	if _, err := NewChatModel(config.ProviderConfig{API: "mock", Fixtures: "/nonexistent/mock.yaml"}, "x"); err == nil {
+		t.Fatal("expected an error for a missing fixture file")
+	}
+}
@@ -0,0 +1,279 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+
+	"miri-main/src/internal/config"
+)
+
+const ollamaDefaultBaseURL = "http://localhost:11434"
+
+// ollamaChatModel speaks the native Ollama chat API (/api/chat).
+type ollamaChatModel struct {
+	url           string
+	header        http.Header
+	model         string
+	maxTokens     int
+	contextWindow int
+	reasoning     bool
+	tools         []*schema.ToolInfo
+	client        *http.Client
+}
+
+func newOllamaChatModel(prov config.ProviderConfig, modelName string, mc config.ModelConfig) *ollamaChatModel {
+	// Accept the OpenAI-compatible base URL (".../v1") as well as the server root.
+	base := strings.TrimSuffix(strings.TrimRight(prov.BaseURL, "/"), "/v1")
+	if base == "" {
+		base = ollamaDefaultBaseURL
+	}
+	header := http.Header{}
+	if prov.APIKey != "" {
+		header.Set("Authorization", "Bearer "+prov.APIKey)
+	}
+	return &ollamaChatModel{
+		url:           base + "/api/chat",
+		header:        header,
+		model:         modelName,
+		maxTokens:     mc.MaxTokens,
+		contextWindow: mc.ContextWindow,
+		reasoning:     mc.Reasoning,
+		client:        &http.Client{Timeout: requestTimeout},
+	}
+}
+
+func (m *ollamaChatModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	bound := *m
+	bound.tools = tools
+	return &bound, nil
+}
+
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Tools    []ollamaTool    `json:"tools,omitempty"`
+	Stream   bool            `json:"stream"`
+	Think    bool            `json:"think,omitempty"`
+	Options  map[string]any  `json:"options,omitempty"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+	Images    []string         `json:"images,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaTool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description,omitempty"`
+		Parameters  json.RawMessage `json:"parameters"`
+	} `json:"function"`
+}
+
+// ollamaResponse is a whole response, or one line of a streamed one.
+type ollamaResponse struct {
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+func (m *ollamaChatModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	req, err := m.buildRequest(input, callOptions(m.tools, opts))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := postJSON(ctx, m.client, m.url, m.header, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out ollamaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	if out.Error != "" {
+		return nil, fmt.Errorf("API error: %s", out.Error)
+	}
+	msg := out.toMessage(nil)
+	msg.ResponseMeta = newUsage(out.DoneReason, out.PromptEvalCount, out.EvalCount)
+	return msg, nil
+}
+
+func (m *ollamaChatModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	req, err := m.buildRequest(input, callOptions(m.tools, opts))
+	if err != nil {
+		return nil, err
+	}
+	req.Stream = true
+	resp, err := postJSON(ctx, m.client, m.url, m.header, req)
+	if err != nil {
+		return nil, err
+	}
+
+	sr, sw := schema.Pipe[*schema.Message](16)
+	go func() {
+		defer resp.Body.Close()
+		defer sw.Close()
+		if err := readOllamaStream(resp.Body, sw); err != nil {
+			sw.Send(nil, err)
+		}
+	}()
+	return sr, nil
+}
+
+// readOllamaStream converts the JSON lines of a streamed response into message chunks.
+// Ollama sends each tool call whole, so they get the next free index.
+func readOllamaStream(body io.Reader, sw *schema.StreamWriter[*schema.Message]) error {
+	next := 0
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var out ollamaResponse
+		if err := json.Unmarshal([]byte(line), &out); err != nil {
+			return fmt.Errorf("decode stream line: %w", err)
+		}
+		if out.Error != "" {
+			return fmt.Errorf("API error: %s", out.Error)
+		}
+		chunk := out.toMessage(&next)
+		if out.Done {
+			chunk.ResponseMeta = newUsage(out.DoneReason, out.PromptEvalCount, out.EvalCount)
+		}
+		if sw.Send(chunk, nil) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// toMessage converts the response message. Ollama does not identify tool calls,
+// so each gets a generated ID; when next is set the calls are indexed from it for
+// stream concatenation.
+func (r *ollamaResponse) toMessage(next *int) *schema.Message {
+	msg := &schema.Message{
+		Role:             schema.Assistant,
+		Content:          r.Message.Content,
+		ReasoningContent: r.Message.Thinking,
+	}
+	for _, tc := range r.Message.ToolCalls {
+		args := string(tc.Function.Arguments)
+		if args == "" || args == "null" {
+			args = "{}"
+		}
+		call := schema.ToolCall{
+			ID:       "call_" + uuid.NewString(),
+			Type:     "function",
+			Function: schema.FunctionCall{Name: tc.Function.Name, Arguments: args},
+		}
+		if next != nil {
+			idx := *next
+			*next++
+			call.Index = &idx
+		}
+		msg.ToolCalls = append(msg.ToolCalls, call)
+	}
+	return msg
+}
+
+func (m *ollamaChatModel) buildRequest(input []*schema.Message, opts *model.Options) (*ollamaRequest, error) {
+	req := &ollamaRequest{Model: m.model, Think: m.reasoning, Options: map[string]any{}}
+	if opts.Model != nil && *opts.Model != "" {
+		req.Model = *opts.Model
+	}
+	maxTokens := m.maxTokens
+	if opts.MaxTokens != nil && *opts.MaxTokens > 0 {
+		maxTokens = *opts.MaxTokens
+	}
+	if maxTokens > 0 {
+		req.Options["num_predict"] = maxTokens
+	}
+	// Ollama truncates prompts to its own small default context unless told otherwise.
+	if m.contextWindow > 0 {
+		req.Options["num_ctx"] = m.contextWindow
+	}
+	if opts.Temperature != nil {
+		req.Options["temperature"] = *opts.Temperature
+	}
+	if opts.TopP != nil {
+		req.Options["top_p"] = *opts.TopP
+	}
+	if len(opts.Stop) > 0 {
+		req.Options["stop"] = opts.Stop
+	}
+
+	if opts.ToolChoice == nil || *opts.ToolChoice != schema.ToolChoiceForbidden {
+		for _, t := range opts.Tools {
+			params, err := toolParameters(t)
+			if err != nil {
+				return nil, err
+			}
+			tool := ollamaTool{Type: "function"}
+			tool.Function.Name = t.Name
+			tool.Function.Description = t.Desc
+			tool.Function.Parameters = params
+			req.Tools = append(req.Tools, tool)
+		}
+	}
+
+	for _, msg := range input {
+		om := ollamaMessage{Role: string(msg.Role), Content: textOf(msg)}
+		switch msg.Role {
+		case schema.Assistant:
+			om.Thinking = msg.ReasoningContent
+			for _, tc := range msg.ToolCalls {
+				var call ollamaToolCall
+				call.Function.Name = tc.Function.Name
+				call.Function.Arguments = json.RawMessage(tc.Function.Arguments)
+				if !json.Valid(call.Function.Arguments) {
+					call.Function.Arguments = json.RawMessage("{}")
+				}
+				om.ToolCalls = append(om.ToolCalls, call)
+			}
+		case schema.User:
+			// Ollama takes images as base64 data beside the text only.
+			for _, p := range msg.UserInputMultiContent {
+				if p.Type != schema.ChatMessagePartTypeImageURL || p.Image == nil {
+					continue
+				}
+				if p.Image.Base64Data == nil {
+					return nil, errors.New("ollama accepts base64 images only")
+				}
+				om.Images = append(om.Images, *p.Image.Base64Data)
+			}
+		case schema.Tool:
+			om.ToolName = msg.ToolName
+		}
+		req.Messages = append(req.Messages, om)
+	}
+	return req, nil
+}
@@ -0,0 +1,121 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+
+	"miri-main/src/internal/config"
+)
+
+func TestOllama_GenerateToolCall(t *testing.T) {
+	var got ollamaRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		fmt.Fprint(w, `{"message":{"role":"assistant","content":"","thinking":"Use the tool.",
+			"tool_calls":[{"function":{"name":"weather","arguments":{"city":"Lima"}}}]},
+			"done":true,"done_reason":"stop","prompt_eval_count":40,"eval_count":9}`)
+	}))
+	defer srv.Close()
+
+	prov := config.ProviderConfig{BaseURL: srv.URL + "/v1", API: "ollama-chat",
+		Models: []config.ModelConfig{{ID: "qwen3", ContextWindow: 32768, Reasoning: true}}}
+	cm, err := NewChatModel(prov, "qwen3")
+	if err != nil {
+		t.Fatalf("NewChatModel failed: %v", err)
+	}
+	cm, _ = cm.WithTools([]*schema.ToolInfo{weatherTool})
+
+	call := schema.ToolCall{ID: "call_1", Function: schema.FunctionCall{Name: "weather", Arguments: `{"city":"Quito"}`}}
+	tool := schema.ToolMessage("cloudy", "call_1")
+	tool.ToolName = "weather"
+	msg, err := cm.Generate(context.Background(), []*schema.Message{
+		schema.UserMessage("Weather in Quito, then Lima?"),
+		schema.AssistantMessage("", []schema.ToolCall{call}),
+		tool,
+	})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	if got.Stream || !got.Think || got.Options["num_ctx"] != float64(32768) {
+		t.Errorf("unexpected request settings: stream=%v think=%v options=%v", got.Stream, got.Think, got.Options)
+	}
+	if len(got.Tools) != 1 || got.Tools[0].Function.Name != "weather" {
+		t.Errorf("tools not sent: %+v", got.Tools)
+	}
+	if len(got.Messages) != 3 || string(got.Messages[1].ToolCalls[0].Function.Arguments) != `{"city":"Quito"}` || got.Messages[2].ToolName != "weather" {
+		t.Errorf("unexpected messages: %+v", got.Messages)
+	}
+
+	if msg.ReasoningContent != "Use the tool." {
+		t.Errorf("unexpected reasoning %q", msg.ReasoningContent)
+	}
+	if len(msg.ToolCalls) != 1 || msg.ToolCalls[0].ID == "" || msg.ToolCalls[0].Function.Arguments != `{"city":"Lima"}` {
+		t.Errorf("unexpected tool calls: %+v", msg.ToolCalls)
+	}
+	if u := msg.ResponseMeta.Usage; u.PromptTokens != 40 || u.CompletionTokens != 9 || u.TotalTokens != 49 {
+		t.Errorf("unexpected usage: %+v", u)
+	}
+}
+
+func TestOllama_Stream(t *testing.T) {
+	lines := []string{
+		`{"message":{"role":"assistant","content":"","thinking":"Hm"},"done":false}`,
+		`{"message":{"role":"assistant","content":"Hello"},"done":false}`,
+		`{"message":{"role":"assistant","content":" there"},"done":false}`,
+		`{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"weather","arguments":{"city":"Bern"}}}]},"done":false}`,
+		`{"message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":11,"eval_count":4}`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for _, l := range lines {
+			fmt.Fprintln(w, l)
+		}
+	}))
+	defer srv.Close()
+
+	cm, _ := NewChatModel(config.ProviderConfig{BaseURL: srv.URL, API: "ollama"}, "llama3")
+	sr, err := cm.Stream(context.Background(), []*schema.Message{schema.UserMessage("hi")})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	msg := drain(t, sr)
+
+	if msg.Content != "Hello there" || msg.ReasoningContent != "Hm" {
+		t.Errorf("unexpected content %q / reasoning %q", msg.Content, msg.ReasoningContent)
+	}
+	if len(msg.ToolCalls) != 1 || msg.ToolCalls[0].Function.Arguments != `{"city":"Bern"}` {
+		t.Errorf("unexpected tool calls: %+v", msg.ToolCalls)
+	}
+	if msg.ResponseMeta.FinishReason != "stop" || msg.ResponseMeta.Usage.TotalTokens != 15 {
+		t.Errorf("unexpected response meta: %+v", msg.ResponseMeta)
+	}
+}
+
+func TestOllama_ImageInput(t *testing.T) {
+	m := newOllamaChatModel(config.ProviderConfig{}, "llava", config.ModelConfig{})
+	req, err := m.buildRequest([]*schema.Message{imageMessage()}, callOptions(nil, nil))
+	if err != nil {
+		t.Fatalf("buildRequest failed: %v", err)
+	}
+	if msg := req.Messages[0]; msg.Content != "What is this?" || len(msg.Images) != 1 || msg.Images[0] != "aW1n" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+}
+
+func TestNewChatModel_UnknownAPI(t *testing.T) {
+	if _, err := NewChatModel(config.ProviderConfig{API: "carrier-pigeon"}, "x"); err == nil {
+		t.Fatal("expected an error for an unknown API")
+	}
+}
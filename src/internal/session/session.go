@@ -1,11 +1,51 @@
 package session
 
 import (
+	"log/slog"
+	"miri-main/src/internal/storage"
+	"sort"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 const DefaultSessionID = "miri:main:agent"
 
+// SubAgentSessionPrefix marks sessions owned by dynamic sub-agent runs.
+const SubAgentSessionPrefix = "subagent-"
+
+const maxSessionIDLen = 256
+
+// ChannelSessionID returns the session ID for a conversation with a device on a channel,
+// e.g. "miri:whatsapp:4917012345678@s.whatsapp.net".
+func ChannelSessionID(channel, device string) string {
+	return "miri:" + channel + ":" + device
+}
+
+// ValidID reports whether id can be used as a session ID. IDs end up in file names
+// (checkpoints, transcripts), so path separators and traversal sequences are rejected.
+func ValidID(id string) bool {
+	if id == "" || len(id) > maxSessionIDLen {
+		return false
+	}
+	if strings.ContainsAny(id, "/\\") || strings.Contains(id, "..") {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x20 || r == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// IsSubAgent reports whether id belongs to a dynamic sub-agent run.
+func IsSubAgent(id string) bool {
+	return strings.HasPrefix(id, SubAgentSessionPrefix)
+}
+
 type Message struct {
 	Prompt   string `json:"prompt"`
 	Response string `json:"response"`
@@ -19,6 +59,9 @@ type Session struct {
 	OutputTokens uint64  `json:"output_tokens"`
 	TotalCost    float64 `json:"total_cost"`
 	mu           sync.RWMutex
+
+	store     *storage.SessionStore
+	createdAt time.Time
 }
 
 func NewSession(id string) *Session {
@@ -35,15 +78,40 @@ func (s *Session) GetSoul() string {
 
 func (s *Session) AddTokens(prompt, output uint64, cost float64) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
 	s.PromptTokens += prompt
 	s.OutputTokens += output
 	s.TotalTokens += prompt + output
 	s.TotalCost += cost
+	s.mu.Unlock()
+	s.persist()
+}
+
+// persist writes the session totals to the attached store, if any.
+// It must be called without s.mu held.
+func (s *Session) persist() {
+	s.mu.RLock()
+	st := s.store
+	rec := storage.SessionRecord{
+		ID:           s.ID,
+		Soul:         s.Soul,
+		PromptTokens: s.PromptTokens,
+		OutputTokens: s.OutputTokens,
+		TotalTokens:  s.TotalTokens,
+		TotalCost:    s.TotalCost,
+		CreatedAt:    s.createdAt,
+	}
+	s.mu.RUnlock()
+	if st == nil {
+		return
+	}
+	if err := st.SaveSession(rec); err != nil {
+		slog.Warn("failed to persist session", "session_id", s.ID, "error", err)
+	}
 }
 
 type SessionManager struct {
 	sessions map[string]*Session
+	store    *storage.SessionStore
 	mu       sync.RWMutex
 }
 
@@ -53,13 +121,55 @@ func NewSessionManager() *SessionManager {
 	}
 }
 
+// AttachStore rehydrates sessions from st and persists every later change to it.
+func (sm *SessionManager) AttachStore(st *storage.SessionStore) error {
+	recs, err := st.LoadSessions()
+	if err != nil {
+		return err
+	}
+
+	sm.mu.Lock()
+	sm.store = st
+	for _, rec := range recs {
+		sess, ok := sm.sessions[rec.ID]
+		if !ok {
+			sess = NewSession(rec.ID)
+			sm.sessions[rec.ID] = sess
+		}
+		sess.mu.Lock()
+		sess.Soul = rec.Soul
+		sess.PromptTokens += rec.PromptTokens
+		sess.OutputTokens += rec.OutputTokens
+		sess.TotalTokens += rec.TotalTokens
+		sess.TotalCost += rec.TotalCost
+		sess.createdAt = rec.CreatedAt
+		sess.mu.Unlock()
+	}
+	pending := make([]*Session, 0, len(sm.sessions))
+	for _, sess := range sm.sessions {
+		sess.mu.Lock()
+		sess.store = st
+		sess.mu.Unlock()
+		pending = append(pending, sess)
+	}
+	sm.mu.Unlock()
+
+	// Write back merged totals of sessions that existed before the store was attached.
+	for _, sess := range pending {
+		sess.persist()
+	}
+	slog.Info("sessions restored from store", "count", len(recs))
+	return nil
+}
+
 func (s *Session) Clear() {
 	s.mu.Lock()
-	defer s.mu.Unlock()
 	s.TotalTokens = 0
 	s.PromptTokens = 0
 	s.OutputTokens = 0
 	s.TotalCost = 0
+	s.mu.Unlock()
+	s.persist()
 }
 
 func (sm *SessionManager) GetOrCreate(id string) *Session {
@@ -67,12 +177,17 @@ func (sm *SessionManager) GetOrCreate(id string) *Session {
 		id = DefaultSessionID
 	}
 	sm.mu.Lock()
-	defer sm.mu.Unlock()
 	if sess, ok := sm.sessions[id]; ok {
+		sm.mu.Unlock()
 		return sess
 	}
 	sess := NewSession(id)
+	sess.store = sm.store
+	sess.createdAt = time.Now().UTC()
 	sm.sessions[id] = sess
+	sm.mu.Unlock()
+
+	sess.persist()
 	return sess
 }
 
@@ -81,8 +196,11 @@ func (sm *SessionManager) AddTokens(id string, prompt, output uint64, cost float
 	sess.AddTokens(prompt, output, cost)
 }
 
+// CreateNewSession registers a fresh session with a random ID and returns the ID.
 func (sm *SessionManager) CreateNewSession() string {
-	return DefaultSessionID
+	id := "miri:session:" + uuid.New().String()
+	sm.GetOrCreate(id)
+	return id
 }
 
 func (sm *SessionManager) ListIDs() []string {
@@ -93,9 +211,30 @@ func (sm *SessionManager) ListIDs() []string {
 	for id := range sm.sessions {
 		ids = append(ids, id)
 	}
+	sort.Strings(ids)
 	return ids
 }
 
+// Delete forgets a session and removes it, with its buffered messages and vault
+// entries, from the attached store.
+func (sm *SessionManager) Delete(id string) error {
+	sm.mu.Lock()
+	sess, ok := sm.sessions[id]
+	delete(sm.sessions, id)
+	st := sm.store
+	sm.mu.Unlock()
+	if ok {
+		// Later updates of the session must not write it back.
+		sess.mu.Lock()
+		sess.store = nil
+		sess.mu.Unlock()
+	}
+	if st == nil {
+		return nil
+	}
+	return st.DeleteSession(id)
+}
+
 func (sm *SessionManager) GetSession(id string) *Session {
 	if id == "" {
 		id = DefaultSessionID
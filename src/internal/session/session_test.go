@@ -1,6 +1,8 @@
 package session
 
 import (
+	"miri-main/src/internal/storage"
+	"path/filepath"
 	"sync"
 	"testing"
 )
@@ -54,3 +56,110 @@ func TestConcurrentAddTokens(t *testing.T) {
 		t.Errorf("expected %d tokens, got %d", N, sess.TotalTokens)
 	}
 }
+
+func TestSessionManager_CreateNewSession(t *testing.T) {
+	sm := NewSessionManager()
+	id1 := sm.CreateNewSession()
+	id2 := sm.CreateNewSession()
+	if id1 == DefaultSessionID || id2 == DefaultSessionID {
+		t.Errorf("expected fresh session IDs, got %s and %s", id1, id2)
+	}
+	if id1 == id2 {
+		t.Errorf("expected distinct session IDs, got %s twice", id1)
+	}
+	if sm.GetSession(id1) == nil {
+		t.Errorf("expected session %s to be registered", id1)
+	}
+}
+
+func TestSessionManager_Isolation(t *testing.T) {
+	sm := NewSessionManager()
+	a := ChannelSessionID("whatsapp", "alice@s.whatsapp.net")
+	b := ChannelSessionID("whatsapp", "bob@s.whatsapp.net")
+	if a == b {
+		t.Fatalf("expected different session IDs per device, got %s", a)
+	}
+	sm.AddTokens(a, 10, 5, 0.01)
+	sm.AddTokens(b, 1, 1, 0)
+	if got := sm.GetSession(a).TotalTokens; got != 15 {
+		t.Errorf("expected 15 tokens for %s, got %d", a, got)
+	}
+	if got := sm.GetSession(b).TotalTokens; got != 2 {
+		t.Errorf("expected 2 tokens for %s, got %d", b, got)
+	}
+}
+
+func TestValidID(t *testing.T) {
+	valid := []string{DefaultSessionID, "miri:irc:#general", "miri:whatsapp:49170@s.whatsapp.net", "user-42"}
+	for _, id := range valid {
+		if !ValidID(id) {
+			t.Errorf("expected %q to be valid", id)
+		}
+	}
+	invalid := []string{"", "../etc/passwd", "a/b", `a\b`, "bad\nid"}
+	for _, id := range invalid {
+		if ValidID(id) {
+			t.Errorf("expected %q to be invalid", id)
+		}
+	}
+}
+
+func TestSessionManager_AttachStore(t *testing.T) {
+	ss, err := storage.OpenSessionStore(filepath.Join(t.TempDir(), "sessions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+
+	sm := NewSessionManager()
+	if err := sm.AttachStore(ss); err != nil {
+		t.Fatalf("AttachStore failed: %v", err)
+	}
+	sm.AddTokens("persisted", 7, 3, 0.5)
+
+	// A fresh manager (simulating a restart) must see the same totals.
+	restarted := NewSessionManager()
+	if err := restarted.AttachStore(ss); err != nil {
+		t.Fatalf("AttachStore after restart failed: %v", err)
+	}
+	sess := restarted.GetSession("persisted")
+	if sess == nil {
+		t.Fatal("expected session to be restored")
+	}
+	if sess.TotalTokens != 10 || sess.TotalCost != 0.5 {
+		t.Errorf("expected 10 tokens and 0.5 cost, got %d and %f", sess.TotalTokens, sess.TotalCost)
+	}
+
+	sess.Clear()
+	again := NewSessionManager()
+	_ = again.AttachStore(ss)
+	if got := again.GetSession("persisted").TotalTokens; got != 0 {
+		t.Errorf("expected cleared totals to persist, got %d", got)
+	}
+}
+
+func TestSessionManager_Delete(t *testing.T) {
+	ss, err := storage.OpenSessionStore(filepath.Join(t.TempDir(), "sessions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+
+	sm := NewSessionManager()
+	if err := sm.AttachStore(ss); err != nil {
+		t.Fatal(err)
+	}
+	id := SubAgentSessionPrefix + "run-1"
+	sess := sm.GetOrCreate(id)
+	if err := sm.Delete(id); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	// A late update of the deleted session does not bring it back.
+	sess.AddTokens(5, 5, 0.1)
+	if ids := sm.ListIDs(); len(ids) != 0 {
+		t.Errorf("expected no sessions left, got %v", ids)
+	}
+	if recs, _ := ss.LoadSessions(); len(recs) != 0 {
+		t.Errorf("expected the session removed from the store, got %+v", recs)
+	}
+}
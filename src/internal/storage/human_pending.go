@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Status values of a HumanQuestion.
+const (
+	HumanQuestionPending  = "pending"
+	HumanQuestionAnswered = "answered"
+	HumanQuestionExpired  = "expired"
+)
+
+// HumanQuestion is a question the agent asked the human (ask_human tool), stored as
+// <storage_dir>/human_pending/<id>.json until it is answered or expires.
+type HumanQuestion struct {
+	ID         string    `json:"id"`
+	Status     string    `json:"status"`
+	Question   string    `json:"question"`
+	SessionID  string    `json:"session_id"`
+	RunID      string    `json:"run_id,omitempty"`
+	Response   string    `json:"response,omitempty"`
+	Created    time.Time `json:"created"`
+	ExpiresAt  time.Time `json:"expires_at,omitzero"`
+	AnsweredAt time.Time `json:"answered_at,omitzero"`
+}
+
+func (s *Storage) humanPendingDir() string {
+	return filepath.Join(s.baseDir, "human_pending")
+}
+
+// SaveHumanQuestion creates or updates a question.
+func (s *Storage) SaveHumanQuestion(q *HumanQuestion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if filepath.Base(q.ID) != q.ID || q.ID == "" {
+		return fmt.Errorf("invalid question ID %q", q.ID)
+	}
+	dir := s.humanPendingDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, q.ID+".json"), data, 0644)
+}
+
+// LoadHumanQuestion loads a question by ID. A missing question yields an error
+// for which os.IsNotExist is true.
+func (s *Storage) LoadHumanQuestion(id string) (*HumanQuestion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	safeID := filepath.Base(id)
+	if safeID != id {
+		return nil, fmt.Errorf("invalid question ID %q", id)
+	}
+	data, err := os.ReadFile(filepath.Join(s.humanPendingDir(), safeID+".json"))
+	if err != nil {
+		return nil, err
+	}
+	var q HumanQuestion
+	if err := json.Unmarshal(data, &q); err != nil {
+		return nil, err
+	}
+	if q.ID == "" {
+		q.ID = safeID
+	}
+	return &q, nil
+}
+
+// ListHumanQuestions returns the questions with the given status ("" for all),
+// oldest first. If sessionID is non-empty, only questions of that session are returned.
+func (s *Storage) ListHumanQuestions(status, sessionID string) ([]*HumanQuestion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	dir := s.humanPendingDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var res []*HumanQuestion
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		var q HumanQuestion
+		if err := json.Unmarshal(data, &q); err != nil {
+			continue
+		}
+		if q.ID == "" {
+			q.ID = strings.TrimSuffix(e.Name(), ".json")
+		}
+		if status != "" && q.Status != status {
+			continue
+		}
+		if sessionID != "" && q.SessionID != sessionID {
+			continue
+		}
+		res = append(res, &q)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Created.Before(res[j].Created)
+	})
+	return res, nil
+}
@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Sources of model calls in the cost ledger.
+const (
+	CostSourceChat     = "chat"
+	CostSourceBrain    = "brain"
+	CostSourceSubAgent = "subagent"
+	CostSourceDream    = "dream"
+	CostSourceCron     = "cron"
+)
+
+// ErrUnknownCostGroup is returned by CostSummary for an unsupported grouping.
+var ErrUnknownCostGroup = errors.New("unknown cost grouping")
+
+// ledgerTimeFormat is fixed-width so that times compare as strings.
+const ledgerTimeFormat = "2006-01-02T15:04:05.000000Z"
+
+// costGroups maps the groupings of CostSummary to their column.
+var costGroups = map[string]string{
+	"day":      "substr(time, 1, 10)",
+	"model":    "model",
+	"provider": "provider",
+	"source":   "source",
+	"session":  "session_id",
+	"task":     "task_id",
+}
+
+// CostEntry is one model call (or paid tool call) in the cost ledger.
+type CostEntry struct {
+	ID               int64     `json:"id"`
+	Time             time.Time `json:"time"`
+	SessionID        string    `json:"session_id,omitempty"`
+	TaskID           string    `json:"task_id,omitempty"` // cron task the call was made for
+	Model            string    `json:"model"`
+	Provider         string    `json:"provider"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CachedTokens     int       `json:"cached_tokens"`
+	CacheWriteTokens int       `json:"cache_write_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	Cost             float64   `json:"cost"`
+	Source           string    `json:"source"`
+}
+
+// CostFilter selects ledger entries. Zero fields match everything; To is exclusive.
+type CostFilter struct {
+	From      time.Time
+	To        time.Time
+	Source    string
+	Model     string
+	Provider  string
+	SessionID string
+	TaskID    string
+}
+
+// CostSummary is the total of the ledger entries sharing a key (a day, model,
+// provider, source, session or task).
+type CostSummary struct {
+	Key              string  `json:"key"`
+	Calls            int     `json:"calls"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CachedTokens     int64   `json:"cached_tokens"`
+	CacheWriteTokens int64   `json:"cache_write_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+func (f CostFilter) where() (string, []any) {
+	var conds []string
+	var args []any
+	if !f.From.IsZero() {
+		conds = append(conds, "time >= ?")
+		args = append(args, f.From.UTC().Format(ledgerTimeFormat))
+	}
+	if !f.To.IsZero() {
+		conds = append(conds, "time < ?")
+		args = append(args, f.To.UTC().Format(ledgerTimeFormat))
+	}
+	for col, v := range map[string]string{"source": f.Source, "model": f.Model, "provider": f.Provider, "session_id": f.SessionID, "task_id": f.TaskID} {
+		if v != "" {
+			conds = append(conds, col+" = ?")
+			args = append(args, v)
+		}
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// AddCost appends an entry to the cost ledger, stamped with the current time
+// unless it has one.
+func (ss *SessionStore) AddCost(e CostEntry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	_, err := ss.db.Exec(`
+INSERT INTO cost_ledger (time, session_id, task_id, model, provider, prompt_tokens, cached_tokens, cache_write_tokens, completion_tokens, cost, source)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Time.UTC().Format(ledgerTimeFormat), e.SessionID, e.TaskID, e.Model, e.Provider,
+		e.PromptTokens, e.CachedTokens, e.CacheWriteTokens, e.CompletionTokens, e.Cost, e.Source)
+	if err != nil {
+		return fmt.Errorf("add cost entry: %w", err)
+	}
+	return nil
+}
+
+// CostEntries returns the ledger entries matching f, newest first, starting at
+// offset and at most limit of them (all when limit is 0), along with the number
+// of matching entries.
+func (ss *SessionStore) CostEntries(f CostFilter, limit, offset int) ([]CostEntry, int, error) {
+	where, args := f.where()
+	var total int
+	if err := ss.db.QueryRow(`SELECT COUNT(*) FROM cost_ledger`+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count cost entries: %w", err)
+	}
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := ss.db.Query(`
+SELECT id, time, session_id, task_id, model, provider, prompt_tokens, cached_tokens, cache_write_tokens, completion_tokens, cost, source
+FROM cost_ledger`+where+` ORDER BY time DESC, id DESC LIMIT ? OFFSET ?`, append(args, limit, max(offset, 0))...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("load cost entries: %w", err)
+	}
+	defer rows.Close()
+
+	out := []CostEntry{}
+	for rows.Next() {
+		var e CostEntry
+		var ts string
+		if err := rows.Scan(&e.ID, &ts, &e.SessionID, &e.TaskID, &e.Model, &e.Provider, &e.PromptTokens, &e.CachedTokens,
+			&e.CacheWriteTokens, &e.CompletionTokens, &e.Cost, &e.Source); err != nil {
+			return nil, 0, fmt.Errorf("scan cost entry: %w", err)
+		}
+		e.Time, _ = time.Parse(ledgerTimeFormat, ts)
+		out = append(out, e)
+	}
+	return out, total, rows.Err()
+}
+
+// CostSummary totals the ledger entries matching f by groupBy: "day" (UTC),
+// "model", "provider", "source", "session" or "task". Groups are sorted by key.
+func (ss *SessionStore) CostSummary(f CostFilter, groupBy string) ([]CostSummary, error) {
+	col, ok := costGroups[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownCostGroup, groupBy)
+	}
+	where, args := f.where()
+	rows, err := ss.db.Query(`
+SELECT `+col+`, COUNT(*), SUM(prompt_tokens), SUM(cached_tokens), SUM(cache_write_tokens), SUM(completion_tokens), SUM(cost)
+FROM cost_ledger`+where+` GROUP BY 1 ORDER BY 1`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("summarize costs: %w", err)
+	}
+	defer rows.Close()
+
+	out := []CostSummary{}
+	for rows.Next() {
+		var s CostSummary
+		if err := rows.Scan(&s.Key, &s.Calls, &s.PromptTokens, &s.CachedTokens, &s.CacheWriteTokens, &s.CompletionTokens, &s.Cost); err != nil {
+			return nil, fmt.Errorf("scan cost summary: %w", err)
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// SpentCost returns the total cost of the ledger entries matching f.
+func (ss *SessionStore) SpentCost(f CostFilter) (float64, error) {
+	where, args := f.where()
+	var total float64
+	if err := ss.db.QueryRow(`SELECT COALESCE(SUM(cost), 0) FROM cost_ledger`+where, args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("sum costs: %w", err)
+	}
+	return total, nil
+}
+
+// SpentCost returns the total cost of the ledger entries matching f.
+func (s *Storage) SpentCost(f CostFilter) (float64, error) {
+	ss, err := s.SessionStore()
+	if err != nil {
+		return 0, err
+	}
+	return ss.SpentCost(f)
+}
+
+// AddCost appends an entry to the cost ledger in the session database.
+func (s *Storage) AddCost(e CostEntry) error {
+	ss, err := s.SessionStore()
+	if err != nil {
+		return err
+	}
+	return ss.AddCost(e)
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSessionStore_CostLedger(t *testing.T) {
+	ss, err := OpenSessionStore(filepath.Join(t.TempDir(), "sessions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+
+	day1 := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	entries := []CostEntry{
+		{Time: day1, SessionID: "miri:main:session", Model: "grok-3", Provider: "xai", PromptTokens: 100, CachedTokens: 40, CompletionTokens: 10, Cost: 0.01, Source: CostSourceChat},
+		{Time: day1.Add(time.Hour), Model: "grok-3", Provider: "xai", PromptTokens: 500, CompletionTokens: 50, Cost: 0.05, Source: CostSourceBrain},
+		{Time: day2, Model: "claude-sonnet", Provider: "anthropic", PromptTokens: 200, CacheWriteTokens: 150, CompletionTokens: 20, Cost: 0.02, Source: CostSourceChat},
+	}
+	for _, e := range entries {
+		if err := ss.AddCost(e); err != nil {
+			t.Fatalf("AddCost failed: %v", err)
+		}
+	}
+
+	bySource, err := ss.CostSummary(CostFilter{}, "source")
+	if err != nil {
+		t.Fatalf("CostSummary failed: %v", err)
+	}
+	if len(bySource) != 2 || bySource[0].Key != CostSourceBrain || bySource[1].Key != CostSourceChat {
+		t.Fatalf("unexpected groups by source: %+v", bySource)
+	}
+	if chat := bySource[1]; chat.Calls != 2 || chat.PromptTokens != 300 || chat.CachedTokens != 40 ||
+		chat.CacheWriteTokens != 150 || chat.Cost < 0.0299 || chat.Cost > 0.0301 {
+		t.Errorf("unexpected chat totals: %+v", chat)
+	}
+
+	byDay, err := ss.CostSummary(CostFilter{Source: CostSourceChat}, "day")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byDay) != 2 || byDay[0].Key != "2026-03-01" || byDay[1].Key != "2026-03-02" {
+		t.Errorf("unexpected groups by day: %+v", byDay)
+	}
+
+	if _, err := ss.CostSummary(CostFilter{}, "color"); !errors.Is(err, ErrUnknownCostGroup) {
+		t.Errorf("expected ErrUnknownCostGroup, got %v", err)
+	}
+
+	got, total, err := ss.CostEntries(CostFilter{From: day1, To: day2}, 1, 0)
+	if err != nil {
+		t.Fatalf("CostEntries failed: %v", err)
+	}
+	if total != 2 || len(got) != 1 || got[0].Source != CostSourceBrain || !got[0].Time.Equal(day1.Add(time.Hour)) {
+		t.Errorf("expected the newest entry of day 1 out of 2, got %d %+v", total, got)
+	}
+	got, _, _ = ss.CostEntries(CostFilter{SessionID: "miri:main:session"}, 0, 0)
+	if len(got) != 1 || got[0].CachedTokens != 40 || got[0].Model != "grok-3" {
+		t.Errorf("unexpected entries of session: %+v", got)
+	}
+}
+
+func TestOpenSessionStore_AddsTaskColumn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The ledger as it was created before cron tasks were recorded.
+	if _, err := db.Exec(`CREATE TABLE cost_ledger (id INTEGER PRIMARY KEY AUTOINCREMENT, time TEXT NOT NULL,
+	session_id TEXT NOT NULL DEFAULT '', model TEXT NOT NULL DEFAULT '', provider TEXT NOT NULL DEFAULT '',
+	prompt_tokens INTEGER NOT NULL DEFAULT 0, cached_tokens INTEGER NOT NULL DEFAULT 0, cache_write_tokens INTEGER NOT NULL DEFAULT 0,
+	completion_tokens INTEGER NOT NULL DEFAULT 0, cost REAL NOT NULL DEFAULT 0, source TEXT NOT NULL DEFAULT '')`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	ss, err := OpenSessionStore(path)
+	if err != nil {
+		t.Fatalf("OpenSessionStore failed: %v", err)
+	}
+	defer ss.Close()
+	if err := ss.AddCost(CostEntry{TaskID: "task-1", Cost: 1, Source: CostSourceCron}); err != nil {
+		t.Fatalf("AddCost failed: %v", err)
+	}
+	if spent, err := ss.SpentCost(CostFilter{TaskID: "task-1"}); err != nil || spent != 1 {
+		t.Errorf("expected 1 spent by the task, got %v, %v", spent, err)
+	}
+}
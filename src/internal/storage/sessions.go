@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SessionRecord is the persisted form of a conversation session's totals.
+// Defined here (not in the session package) to avoid import cycles.
+type SessionRecord struct {
+	ID           string
+	Soul         string
+	PromptTokens uint64
+	OutputTokens uint64
+	TotalTokens  uint64
+	TotalCost    float64
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// SessionStore is a SQLite-backed store for sessions, their short-term message
+// buffers and the cost ledger. Messages are stored as opaque JSON blobs in arrival order.
+type SessionStore struct {
+	db *sql.DB
+}
+
+const sessionSchema = `
+CREATE TABLE IF NOT EXISTS sessions (
+	id            TEXT PRIMARY KEY,
+	soul          TEXT NOT NULL DEFAULT '',
+	prompt_tokens INTEGER NOT NULL DEFAULT 0,
+	output_tokens INTEGER NOT NULL DEFAULT 0,
+	total_tokens  INTEGER NOT NULL DEFAULT 0,
+	total_cost    REAL NOT NULL DEFAULT 0,
+	created_at    TEXT NOT NULL,
+	updated_at    TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS session_messages (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id TEXT NOT NULL,
+	message    TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_session_messages_session ON session_messages(session_id, id);
+CREATE TABLE IF NOT EXISTS cost_ledger (
+	id                 INTEGER PRIMARY KEY AUTOINCREMENT,
+	time               TEXT NOT NULL,
+	session_id         TEXT NOT NULL DEFAULT '',
+	task_id            TEXT NOT NULL DEFAULT '',
+	model              TEXT NOT NULL DEFAULT '',
+	provider           TEXT NOT NULL DEFAULT '',
+	prompt_tokens      INTEGER NOT NULL DEFAULT 0,
+	cached_tokens      INTEGER NOT NULL DEFAULT 0,
+	cache_write_tokens INTEGER NOT NULL DEFAULT 0,
+	completion_tokens  INTEGER NOT NULL DEFAULT 0,
+	cost               REAL NOT NULL DEFAULT 0,
+	source             TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_cost_ledger_time ON cost_ledger(time);
+CREATE TABLE IF NOT EXISTS vault_entries (
+	session_id TEXT NOT NULL,
+	token      TEXT NOT NULL,
+	value      TEXT NOT NULL,
+	PRIMARY KEY (session_id, token)
+);
+`
+
+// OpenSessionStore opens (or creates) the session database at path.
+func OpenSessionStore(path string) (*SessionStore, error) {
+	dsn := fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=5000", path)
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open session db: %w", err)
+	}
+	// SQLite allows a single writer; serialising through one connection avoids SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sessionSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate session db: %w", err)
+	}
+	if err := addColumn(db, "cost_ledger", "task_id", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate session db: %w", err)
+	}
+	return &SessionStore{db: db}, nil
+}
+
+// addColumn adds a column to a table created by an older schema.
+func addColumn(db *sql.DB, table, column, def string) error {
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	_, err := db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + def)
+	return err
+}
+
+// SessionStore returns the shared session store at <storage_dir>/sessions.db,
+// opening it on first use.
+func (s *Storage) SessionStore() (*SessionStore, error) {
+	s.sessionMu.Lock()
+	defer s.sessionMu.Unlock()
+	if s.sessionStore != nil {
+		return s.sessionStore, nil
+	}
+	ss, err := OpenSessionStore(filepath.Join(s.baseDir, "sessions.db"))
+	if err != nil {
+		return nil, err
+	}
+	s.sessionStore = ss
+	return ss, nil
+}
+
+// Close releases resources held by the storage, such as the session database.
+func (s *Storage) Close() error {
+	s.sessionMu.Lock()
+	defer s.sessionMu.Unlock()
+	if s.sessionStore == nil {
+		return nil
+	}
+	err := s.sessionStore.Close()
+	s.sessionStore = nil
+	return err
+}
+
+func (ss *SessionStore) Close() error {
+	return ss.db.Close()
+}
+
+// SaveSession inserts or updates the totals of a session.
+func (ss *SessionStore) SaveSession(rec SessionRecord) error {
+	now := time.Now().UTC()
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = now
+	}
+	_, err := ss.db.Exec(`
+INSERT INTO sessions (id, soul, prompt_tokens, output_tokens, total_tokens, total_cost, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(id) DO UPDATE SET
+	soul = excluded.soul,
+	prompt_tokens = excluded.prompt_tokens,
+	output_tokens = excluded.output_tokens,
+	total_tokens = excluded.total_tokens,
+	total_cost = excluded.total_cost,
+	updated_at = excluded.updated_at`,
+		rec.ID, rec.Soul, int64(rec.PromptTokens), int64(rec.OutputTokens), int64(rec.TotalTokens), rec.TotalCost,
+		rec.CreatedAt.Format(time.RFC3339Nano), now.Format(time.RFC3339Nano))
+	if err != nil {
+		return fmt.Errorf("save session %s: %w", rec.ID, err)
+	}
+	return nil
+}
+
+// LoadSessions returns every persisted session.
+func (ss *SessionStore) LoadSessions() ([]SessionRecord, error) {
+	rows, err := ss.db.Query(`SELECT id, soul, prompt_tokens, output_tokens, total_tokens, total_cost, created_at, updated_at FROM sessions ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("load sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var out []SessionRecord
+	for rows.Next() {
+		var rec SessionRecord
+		var pt, ot, tt int64
+		var created, updated string
+		if err := rows.Scan(&rec.ID, &rec.Soul, &pt, &ot, &tt, &rec.TotalCost, &created, &updated); err != nil {
+			return nil, fmt.Errorf("scan session: %w", err)
+		}
+		rec.PromptTokens, rec.OutputTokens, rec.TotalTokens = uint64(pt), uint64(ot), uint64(tt)
+		rec.CreatedAt, _ = time.Parse(time.RFC3339Nano, created)
+		rec.UpdatedAt, _ = time.Parse(time.RFC3339Nano, updated)
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+// DeleteSession removes a session and its buffered messages.
+func (ss *SessionStore) DeleteSession(id string) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM session_messages WHERE session_id = ?`, id); err != nil {
+		return fmt.Errorf("delete session messages %s: %w", id, err)
+	}
+	if _, err := tx.Exec(`DELETE FROM vault_entries WHERE session_id = ?`, id); err != nil {
+		return fmt.Errorf("delete vault entries of %s: %w", id, err)
+	}
+	if _, err := tx.Exec(`DELETE FROM sessions WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("delete session %s: %w", id, err)
+	}
+	return tx.Commit()
+}
+
+// AppendMessage appends one serialized message to a session's buffer.
+func (ss *SessionStore) AppendMessage(sessionID string, msg []byte) error {
+	_, err := ss.db.Exec(`INSERT INTO session_messages (session_id, message, created_at) VALUES (?, ?, ?)`,
+		sessionID, string(msg), time.Now().UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return fmt.Errorf("append message to %s: %w", sessionID, err)
+	}
+	return nil
+}
+
+// TrimMessages keeps only the newest keep messages of a session's buffer.
+func (ss *SessionStore) TrimMessages(sessionID string, keep int) error {
+	_, err := ss.db.Exec(`
+DELETE FROM session_messages
+WHERE session_id = ? AND id NOT IN (
+	SELECT id FROM session_messages WHERE session_id = ? ORDER BY id DESC LIMIT ?
+)`, sessionID, sessionID, keep)
+	if err != nil {
+		return fmt.Errorf("trim messages of %s: %w", sessionID, err)
+	}
+	return nil
+}
+
+// ClearMessages drops a session's buffer.
+func (ss *SessionStore) ClearMessages(sessionID string) error {
+	if _, err := ss.db.Exec(`DELETE FROM session_messages WHERE session_id = ?`, sessionID); err != nil {
+		return fmt.Errorf("clear messages of %s: %w", sessionID, err)
+	}
+	return nil
+}
+
+// LoadMessages returns the buffered messages of all sessions, oldest first.
+func (ss *SessionStore) LoadMessages() (map[string][][]byte, error) {
+	rows, err := ss.db.Query(`SELECT session_id, message FROM session_messages ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("load messages: %w", err)
+	}
+	defer rows.Close()
+
+	out := make(map[string][][]byte)
+	for rows.Next() {
+		var sid, msg string
+		if err := rows.Scan(&sid, &msg); err != nil {
+			return nil, fmt.Errorf("scan message: %w", err)
+		}
+		out[sid] = append(out[sid], []byte(msg))
+	}
+	return out, rows.Err()
+}
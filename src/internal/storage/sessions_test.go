@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSessionStore_SessionsRoundTrip(t *testing.T) {
+	ss, err := OpenSessionStore(filepath.Join(t.TempDir(), "sessions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+
+	rec := SessionRecord{ID: "miri:irc:#test", PromptTokens: 10, OutputTokens: 5, TotalTokens: 15, TotalCost: 0.25}
+	if err := ss.SaveSession(rec); err != nil {
+		t.Fatalf("SaveSession failed: %v", err)
+	}
+	rec.TotalTokens = 30
+	if err := ss.SaveSession(rec); err != nil {
+		t.Fatalf("SaveSession update failed: %v", err)
+	}
+
+	recs, err := ss.LoadSessions()
+	if err != nil {
+		t.Fatalf("LoadSessions failed: %v", err)
+	}
+	if len(recs) != 1 {
+		t.Fatalf("expected 1 session, got %d", len(recs))
+	}
+	if recs[0].TotalTokens != 30 || recs[0].TotalCost != 0.25 {
+		t.Errorf("unexpected totals: %+v", recs[0])
+	}
+
+	if err := ss.DeleteSession(rec.ID); err != nil {
+		t.Fatalf("DeleteSession failed: %v", err)
+	}
+	recs, _ = ss.LoadSessions()
+	if len(recs) != 0 {
+		t.Errorf("expected no sessions after delete, got %d", len(recs))
+	}
+}
+
+func TestSessionStore_Messages(t *testing.T) {
+	ss, err := OpenSessionStore(filepath.Join(t.TempDir(), "sessions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+
+	for _, m := range []string{"1", "2", "3", "4"} {
+		if err := ss.AppendMessage("a", []byte(m)); err != nil {
+			t.Fatalf("AppendMessage failed: %v", err)
+		}
+	}
+	_ = ss.AppendMessage("b", []byte("x"))
+
+	if err := ss.TrimMessages("a", 2); err != nil {
+		t.Fatalf("TrimMessages failed: %v", err)
+	}
+	msgs, err := ss.LoadMessages()
+	if err != nil {
+		t.Fatalf("LoadMessages failed: %v", err)
+	}
+	if len(msgs["a"]) != 2 || string(msgs["a"][0]) != "3" || string(msgs["a"][1]) != "4" {
+		t.Errorf("expected [3 4] for a, got %q", msgs["a"])
+	}
+	if len(msgs["b"]) != 1 {
+		t.Errorf("expected trim to leave b untouched, got %q", msgs["b"])
+	}
+
+	if err := ss.ClearMessages("a"); err != nil {
+		t.Fatalf("ClearMessages failed: %v", err)
+	}
+	msgs, _ = ss.LoadMessages()
+	if _, ok := msgs["a"]; ok {
+		t.Errorf("expected a to be cleared, got %q", msgs["a"])
+	}
+}
+
+func TestStorage_SessionStoreShared(t *testing.T) {
+	st, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	a, err := st.SessionStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := st.SessionStore()
+	if a != b {
+		t.Error("expected SessionStore to return the same instance")
+	}
+}
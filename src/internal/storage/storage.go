@@ -34,6 +34,9 @@ type SubAgentRun struct {
 type Storage struct {
 	baseDir string
 	mu      sync.RWMutex
+
+	sessionMu    sync.Mutex
+	sessionStore *SessionStore
 }
 
 type CronTxtJob struct {
@@ -242,6 +245,14 @@ func (s *Storage) SaveHuman(content string) error {
 	return os.WriteFile(path, []byte(content), 0644)
 }
 
+func (s *Storage) SaveSoul(content string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := filepath.Join(s.baseDir, "soul.md")
+	return os.WriteFile(path, []byte(content), 0644)
+}
+
 func (s *Storage) GetHuman() (string, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -0,0 +1,36 @@
+package storage
+
+import "fmt"
+
+// AddVaultEntry records that token stands for value in a session's conversation
+// (see engine/vault). Adding an existing entry again is a no-op.
+func (ss *SessionStore) AddVaultEntry(sessionID, token, value string) error {
+	_, err := ss.db.Exec(`INSERT OR IGNORE INTO vault_entries (session_id, token, value) VALUES (?, ?, ?)`,
+		sessionID, token, value)
+	if err != nil {
+		return fmt.Errorf("add vault entry: %w", err)
+	}
+	return nil
+}
+
+// LoadVaultEntries returns the values of the vault entries by token by session.
+func (ss *SessionStore) LoadVaultEntries() (map[string]map[string]string, error) {
+	rows, err := ss.db.Query(`SELECT session_id, token, value FROM vault_entries`)
+	if err != nil {
+		return nil, fmt.Errorf("load vault entries: %w", err)
+	}
+	defer rows.Close()
+
+	out := make(map[string]map[string]string)
+	for rows.Next() {
+		var sid, token, value string
+		if err := rows.Scan(&sid, &token, &value); err != nil {
+			return nil, fmt.Errorf("scan vault entry: %w", err)
+		}
+		if out[sid] == nil {
+			out[sid] = make(map[string]string)
+		}
+		out[sid][token] = value
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSessionStore_VaultEntries(t *testing.T) {
+	ss, err := OpenSessionStore(filepath.Join(t.TempDir(), "sessions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+
+	for _, e := range [][3]string{
+		{"miri:main:session", "[EMAIL_1f2e3d4c]", "bob@example.com"},
+		{"miri:main:session", "[EMAIL_1f2e3d4c]", "bob@example.com"},
+		{"", "[HEX_0a0b0c0d]", "3f786850e387550fdab836ed7e6dc881de23001b"},
+	} {
+		if err := ss.AddVaultEntry(e[0], e[1], e[2]); err != nil {
+			t.Fatalf("AddVaultEntry failed: %v", err)
+		}
+	}
+	entries, err := ss.LoadVaultEntries()
+	if err != nil {
+		t.Fatalf("LoadVaultEntries failed: %v", err)
+	}
+	if len(entries) != 2 || entries["miri:main:session"]["[EMAIL_1f2e3d4c]"] != "bob@example.com" || len(entries[""]) != 1 {
+		t.Errorf("unexpected vault entries %v", entries)
+	}
+
+	if err := ss.DeleteSession("miri:main:session"); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ = ss.LoadVaultEntries(); len(entries) != 1 {
+		t.Errorf("expected the session's entries deleted with it, got %v", entries)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log/slog"
 	"math"
+	"miri-main/src/internal/engine/memory"
 	"miri-main/src/internal/llm"
 	"miri-main/src/internal/session"
 	"miri-main/src/internal/storage"
@@ -99,8 +100,15 @@ func (p *Pool) execute(ctx context.Context, run *storage.SubAgentRun) {
 	eng.Startup(ctx)
 	defer eng.Shutdown(context.Background())
 
-	sessionID := "subagent-" + run.ID
+	sessionID := session.SubAgentSessionPrefix + run.ID
 	sess := p.sessionMgr.GetOrCreate(sessionID)
+	// The session is only the run's scratch space: its result is kept in the run
+	// and, once done, in the Brain.
+	defer func() {
+		if err := p.sessionMgr.Delete(sessionID); err != nil {
+			slog.Warn("failed to delete sub-agent session", "id", run.ID, "error", err)
+		}
+	}()
 
 	sysCtx := fmt.Sprintf("You are a %s sub-agent. Solve the given goal autonomously.", run.Role)
 	resp, usage, err := eng.Respond(ctx, sess, run.Goal, sysCtx)
@@ -151,6 +159,7 @@ func (p *Pool) injectFact(run *storage.SubAgentRun) {
 		"session":     run.ParentSession,
 		"created_at":  run.FinishedAt,
 	}
+	memory.SetSources(metadata, memory.SubAgentSource(run.ID, run.ParentSession, run.Output))
 	if err := p.parentEng.InjectFact(context.Background(), content, metadata); err != nil {
 		slog.Warn("failed to inject sub-agent fact into brain", "id", run.ID, "error", err)
 	}